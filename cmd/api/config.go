@@ -2,24 +2,134 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
+	"iot-platform/internal/archive"
+	"iot-platform/internal/ratelimit"
 	"os"
 )
 
 type ServerConfig struct {
 	Port string `json:"port"`
+	// GrpcPort is where the gRPC API listens.
+	GrpcPort string    `json:"grpcPort"`
+	TLS      TLSConfig `json:"tls"`
+}
+
+// TLSConfig serves the HTTP API over TLS when CertFile is set. Devices whose
+// client certificate chains to a CA in ClientCAFile may then authenticate
+// with it instead of their API key.
+type TLSConfig struct {
+	CertFile     string `json:"certFile"`
+	KeyFile      string `json:"keyFile"`
+	ClientCAFile string `json:"clientCAFile"`
+	// RequireClientCert refuses connections without a verified client
+	// certificate, which shuts out API key clients and operators alike.
+	RequireClientCert bool `json:"requireClientCert"`
 }
 
 type DatabaseConfig struct {
-	Host string `json:"host"`
+	Driver string `json:"driver"`
+	Path   string `json:"path"`
+	Host   string `json:"host"`
+	Port   string `json:"port"`
+	User   string `json:"user"`
+	Pass   string `json:"pass"`
+	Db     string `json:"db"`
+}
+
+// ReplicationConfig controls store-and-forward sync. An "edge" instance
+// forwards its changes to Upstream; a "central" instance accepts them. Both
+// sides need the same Token, which the edge sends as a bearer token.
+type ReplicationConfig struct {
+	Mode            string `json:"mode"`
+	SourceId        string `json:"sourceId"`
+	Upstream        string `json:"upstream"`
+	Token           string `json:"token"`
+	BatchSize       int    `json:"batchSize"`
+	IntervalSeconds int    `json:"intervalSeconds"`
+}
+
+type IngestConfig struct {
+	// DedupWindowHours is how long a device's message ids are remembered
+	// for deduplication.
+	DedupWindowHours int `json:"dedupWindowHours"`
+	// SignatureWindowSeconds is how far the timestamp of a signed request
+	// may be from the server's clock.
+	SignatureWindowSeconds int `json:"signatureWindowSeconds"`
+	// RequireSignatures refuses unsigned requests to the JSON ingest
+	// endpoints.
+	RequireSignatures bool `json:"requireSignatures"`
+}
+
+// StreamConfig sizes the live reading fanout behind the SSE endpoints.
+type StreamConfig struct {
+	// HistorySize is how many recent readings are kept for clients resuming
+	// with Last-Event-ID.
+	HistorySize int `json:"historySize"`
+	// QueueSize is how many readings a slow client may lag behind before it
+	// is disconnected.
+	QueueSize        int `json:"queueSize"`
+	HeartbeatSeconds int `json:"heartbeatSeconds"`
+}
+
+// CoapConfig controls the CoAP listener for constrained devices.
+type CoapConfig struct {
 	Port string `json:"port"`
-	User string `json:"user"`
-	Pass string `json:"pass"`
-	Db   string `json:"db"`
+	// PresenceTimeoutSeconds is how long a device stays online after its
+	// last heartbeat or telemetry.
+	PresenceTimeoutSeconds int `json:"presenceTimeoutSeconds"`
+}
+
+// ExportConfig controls Parquet export jobs.
+type ExportConfig struct {
+	// Directory holds a subdirectory of files and a manifest per job.
+	Directory string `json:"directory"`
+}
+
+// ArchiveConfig controls moving aged readings out of the database into
+// segment files. Archival is off unless AfterDays is set.
+type ArchiveConfig struct {
+	AfterDays       int `json:"afterDays"`
+	IntervalMinutes int `json:"intervalMinutes"`
+	// Directory holds the archive unless an S3 bucket is configured.
+	Directory string           `json:"directory"`
+	S3        archive.S3Config `json:"s3"`
+}
+
+// HotCacheConfig sizes the in-memory cache of recent readings. The cache is
+// off unless MemoryMB is set. It only sees readings stored by this instance,
+// so it must stay off when other instances write to the same database.
+type HotCacheConfig struct {
+	WindowMinutes int `json:"windowMinutes"`
+	MemoryMB      int `json:"memoryMB"`
+}
+
+// RateLimitConfig limits the readings per second of devices, by device kind,
+// and the requests per second of API consumers, over HTTP and gRPC, where
+// each message of a stream counts as a request. Readings of a tenant, the
+// root asset a device is attached to, are limited per UTC day by
+// TenantQuotas, or TenantDailyQuota when it has none. Zero rates and quotas
+// are unlimited. Rate limits are enforced by each instance on its own, while
+// quotas are counted in the database.
+type RateLimitConfig struct {
+	Device           ratelimit.Rate            `json:"device"`
+	Kinds            map[string]ratelimit.Rate `json:"kinds"`
+	Consumer         ratelimit.Rate            `json:"consumer"`
+	TenantDailyQuota int64                     `json:"tenantDailyQuota"`
+	TenantQuotas     map[string]int64          `json:"tenantQuotas"`
 }
 
 type Config struct {
-	Database DatabaseConfig `json:"database"`
-	Server   ServerConfig   `json:"server"`
+	Database    DatabaseConfig    `json:"database"`
+	Server      ServerConfig      `json:"server"`
+	Replication ReplicationConfig `json:"replication"`
+	Ingest      IngestConfig      `json:"ingest"`
+	Stream      StreamConfig      `json:"stream"`
+	Coap        CoapConfig        `json:"coap"`
+	Export      ExportConfig      `json:"export"`
+	Archive     ArchiveConfig     `json:"archive"`
+	HotCache    HotCacheConfig    `json:"hotCache"`
+	RateLimit   RateLimitConfig   `json:"rateLimit"`
 }
 
 func loadConfiguration(path string) (*Config, error) {
@@ -33,6 +143,17 @@ func loadConfiguration(path string) (*Config, error) {
 		return nil, err
 	}
 
+	if config.Database.Driver == "" {
+		config.Database.Driver = "postgres"
+	}
+	if config.Database.Driver != "postgres" && config.Database.Driver != "sqlite" {
+		return nil, fmt.Errorf("unknown database driver %q", config.Database.Driver)
+	}
+
+	if config.Database.Path == "" {
+		config.Database.Path = "iot_platform.db"
+	}
+
 	if config.Database.Host == "" {
 		config.Database.Host = "localhost"
 	}
@@ -56,5 +177,90 @@ func loadConfiguration(path string) (*Config, error) {
 		config.Server.Port = "3000"
 	}
 
+	if config.Server.GrpcPort == "" {
+		config.Server.GrpcPort = "9090"
+	}
+
+	if (config.Server.TLS.CertFile == "") != (config.Server.TLS.KeyFile == "") {
+		return nil, fmt.Errorf("server.tls requires both certFile and keyFile")
+	}
+	if config.Server.TLS.ClientCAFile != "" && config.Server.TLS.CertFile == "" {
+		return nil, fmt.Errorf("server.tls.clientCAFile requires certFile and keyFile")
+	}
+	if config.Server.TLS.RequireClientCert && config.Server.TLS.ClientCAFile == "" {
+		return nil, fmt.Errorf("server.tls.requireClientCert requires clientCAFile")
+	}
+
+	switch config.Replication.Mode {
+	case "":
+	case "central":
+		if config.Replication.Token == "" {
+			return nil, fmt.Errorf("replication mode central requires token")
+		}
+	case "edge":
+		if config.Replication.SourceId == "" || config.Replication.Upstream == "" || config.Replication.Token == "" {
+			return nil, fmt.Errorf("replication mode edge requires sourceId, upstream and token")
+		}
+	default:
+		return nil, fmt.Errorf("unknown replication mode %q", config.Replication.Mode)
+	}
+
+	if config.Replication.BatchSize == 0 {
+		config.Replication.BatchSize = 500
+	}
+
+	if config.Replication.IntervalSeconds == 0 {
+		config.Replication.IntervalSeconds = 5
+	}
+
+	if config.Ingest.DedupWindowHours == 0 {
+		config.Ingest.DedupWindowHours = 24
+	}
+
+	if config.Ingest.SignatureWindowSeconds == 0 {
+		config.Ingest.SignatureWindowSeconds = 300
+	}
+
+	if config.Stream.HistorySize == 0 {
+		config.Stream.HistorySize = 10000
+	}
+
+	if config.Stream.QueueSize == 0 {
+		config.Stream.QueueSize = 256
+	}
+
+	if config.Stream.HeartbeatSeconds == 0 {
+		config.Stream.HeartbeatSeconds = 15
+	}
+
+	if config.Coap.Port == "" {
+		config.Coap.Port = "5683"
+	}
+
+	if config.Coap.PresenceTimeoutSeconds == 0 {
+		config.Coap.PresenceTimeoutSeconds = 300
+	}
+
+	if config.Export.Directory == "" {
+		config.Export.Directory = "exports"
+	}
+
+	if config.Archive.IntervalMinutes == 0 {
+		config.Archive.IntervalMinutes = 60
+	}
+
+	if config.Archive.Directory == "" {
+		config.Archive.Directory = "archive"
+	}
+
+	if config.HotCache.WindowMinutes == 0 {
+		config.HotCache.WindowMinutes = 60
+	}
+	// Central instances also store the readings replicated to them, which
+	// the cache would never see.
+	if config.HotCache.MemoryMB > 0 && config.Replication.Mode == "central" {
+		return nil, fmt.Errorf("hotCache cannot be used with replication mode central")
+	}
+
 	return &config, nil
 }
@@ -1,14 +1,29 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"iot-platform/internal/api/coaphandler"
 	"iot-platform/internal/api/http/handler"
-	"iot-platform/internal/database/postgres"
-	"iot-platform/internal/database/postgres/device"
-	"iot-platform/internal/database/postgres/sensordata"
+	"iot-platform/internal/api/rpc"
+	"iot-platform/internal/archive"
+	"iot-platform/internal/coap"
+	"iot-platform/internal/connectivity"
+	"iot-platform/internal/export"
+	"iot-platform/internal/hotcache"
+	"iot-platform/internal/ratelimit"
+	"iot-platform/internal/replication"
 	"iot-platform/internal/service"
+	"iot-platform/internal/stream"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
+
+	"google.golang.org/grpc"
 )
 
 func main() {
@@ -17,23 +32,59 @@ func main() {
 		log.Fatalf("problem parsing config: %s", err)
 	}
 
-	db, err := postgres.InitDb(config.Database.Host, config.Database.Port, config.Database.User, config.Database.Pass, config.Database.Db)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	repos, err := openRepositories(ctx, config.Database, config.Replication.Mode == "edge")
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("error opening %s database: %s", config.Database.Driver, err)
 	}
-	defer db.Close()
+	defer repos.db.Close()
 
-	deviceRepo, err := device.NewDevicePostgresRepository(db)
-	if err != nil {
-		log.Fatal("error connecting to database")
+	if config.Replication.Mode == "edge" {
+		if err := replication.SeedDevices(ctx, repos.devices, repos.replication); err != nil {
+			log.Fatalf("error seeding replication outbox: %s", err)
+		}
+
+		upstream := replication.NewHTTPUpstream(config.Replication.Upstream, config.Replication.Token, &http.Client{Timeout: 30 * time.Second})
+		forwarder := replication.NewForwarder(repos.replication, upstream, config.Replication.SourceId, config.Replication.Upstream, config.Replication.BatchSize, time.Duration(config.Replication.IntervalSeconds)*time.Second)
+		go forwarder.Run(ctx)
 	}
-	deviceService := service.NewDevicesService(deviceRepo)
 
-	sensorDataRepo, err := sensordata.NewSensorDataPostgresRepository(db)
-	if err != nil {
-		log.Fatal("error connecting to database")
+	deviceService := service.NewDevicesService(repos.devices, service.WithCertificates(repos.certificates))
+	deviceKindService := service.NewDeviceKindService(repos.deviceKinds)
+	assetService := service.NewAssetService(repos.assets, repos.devices)
+	schemaValidator := service.NewSchemaValidator(repos.devices, repos.deviceKinds)
+	broker := stream.NewBroker(config.Stream.HistorySize, config.Stream.QueueSize)
+	sensorDataOptions := []service.SensorDataOption{service.WithReadingValidator(service.NewDeviceStateValidator(repos.devices)), service.WithReadingValidator(schemaValidator), service.WithPublisher(broker), service.WithAssetScope(assetService)}
+	if config.Archive.AfterDays > 0 {
+		sensorArchive, err := openArchive(ctx, config.Archive)
+		if err != nil {
+			log.Fatalf("error opening archive: %s", err)
+		}
+		sensorDataOptions = append(sensorDataOptions, service.WithArchive(sensorArchive))
+
+		archiver := archive.NewArchiver(repos.sensorData, sensorArchive, time.Duration(config.Archive.AfterDays)*24*time.Hour)
+		go archiver.Run(ctx, time.Duration(config.Archive.IntervalMinutes)*time.Minute)
 	}
-	sensorDataService := service.NewSensorDataService(sensorDataRepo)
+	if config.HotCache.MemoryMB > 0 {
+		hotCache := hotcache.NewCache(time.Duration(config.HotCache.WindowMinutes)*time.Minute, config.HotCache.MemoryMB<<20)
+		if err := hotCache.Load(ctx, repos.sensorData); err != nil {
+			log.Fatalf("error loading hot cache: %s", err)
+		}
+		go hotCache.Run(ctx)
+		sensorDataOptions = append(sensorDataOptions, service.WithCache(hotCache))
+	}
+	deviceLimiter := ratelimit.NewLimiter()
+	go deviceLimiter.Run(ctx)
+	ingestLimits := service.NewIngestLimits(repos.devices, assetService, repos.usage, deviceLimiter,
+		service.DeviceRates{Default: config.RateLimit.Device, Kinds: config.RateLimit.Kinds},
+		service.TenantQuotas{Default: config.RateLimit.TenantDailyQuota, Tenants: config.RateLimit.TenantQuotas})
+	sensorDataOptions = append(sensorDataOptions, service.WithLimiter(ingestLimits))
+	sensorDataService := service.NewSensorDataService(repos.sensorData, sensorDataOptions...)
+	go sensorDataService.ExpireMessageIds(ctx, time.Duration(config.Ingest.DedupWindowHours)*time.Hour)
+	signatureVerifier := service.NewSignatureVerifier(repos.devices, repos.nonces, time.Duration(config.Ingest.SignatureWindowSeconds)*time.Second)
+	go signatureVerifier.ExpireNonces(ctx)
 
 	deviceHandler := handler.NewDeviceHandler(*deviceService)
 	mux := http.NewServeMux()
@@ -42,24 +93,179 @@ func main() {
 	mux.HandleFunc("GET /devices/{id}", deviceHandler.GetDevice)
 	mux.HandleFunc("PUT /devices/{id}", deviceHandler.UpdateDevice)
 	mux.HandleFunc("DELETE /devices/{id}", deviceHandler.DeleteDevice)
+	mux.HandleFunc("POST /devices/{id}/state", deviceHandler.ChangeDeviceState)
+	mux.HandleFunc("POST /devices/{id}/restore", deviceHandler.RestoreDevice)
+	mux.HandleFunc("GET /devices/{id}/certificates", deviceHandler.ListCertificates)
+	mux.HandleFunc("POST /devices/{id}/certificates", deviceHandler.RegisterCertificate)
+	mux.HandleFunc("DELETE /devices/{id}/certificates/{fingerprint}", deviceHandler.RevokeCertificate)
+
+	streamHandler := handler.NewStreamHandler(broker, *deviceService, time.Duration(config.Stream.HeartbeatSeconds)*time.Second)
+	mux.HandleFunc("GET /devices/{id}/stream", streamHandler.DeviceStream)
+	mux.HandleFunc("GET /sensor-data/stream", streamHandler.FleetStream)
+
+	deviceKindHandler := handler.NewDeviceKindHandler(*deviceKindService)
+	mux.HandleFunc("GET /device-kinds", deviceKindHandler.ListDeviceKinds)
+	mux.HandleFunc("POST /device-kinds", deviceKindHandler.CreateDeviceKind)
+	mux.HandleFunc("GET /device-kinds/{name}", deviceKindHandler.GetDeviceKind)
+	mux.HandleFunc("PUT /device-kinds/{name}", deviceKindHandler.UpdateDeviceKind)
+	mux.HandleFunc("DELETE /device-kinds/{name}", deviceKindHandler.DeleteDeviceKind)
+	mux.HandleFunc("GET /device-kinds/{name}/versions", deviceKindHandler.ListDeviceKindVersions)
+
+	assetHandler := handler.NewAssetHandler(*assetService)
+	mux.HandleFunc("GET /assets", assetHandler.ListAssets)
+	mux.HandleFunc("POST /assets", assetHandler.CreateAsset)
+	mux.HandleFunc("GET /assets/{id}", assetHandler.GetAsset)
+	mux.HandleFunc("PUT /assets/{id}", assetHandler.UpdateAsset)
+	mux.HandleFunc("DELETE /assets/{id}", assetHandler.DeleteAsset)
+	mux.HandleFunc("GET /assets/{id}/tree", assetHandler.GetAssetTree)
+	mux.HandleFunc("POST /assets/{id}/move", assetHandler.MoveAsset)
+	mux.HandleFunc("PUT /assets/{id}/devices/{deviceId}", assetHandler.AttachDevice)
+	mux.HandleFunc("DELETE /assets/{id}/devices/{deviceId}", assetHandler.DetachDevice)
+
+	provisioningHandler := handler.NewProvisioningHandler(*service.NewProvisioningService(repos.provisioning, repos.assets))
+	mux.HandleFunc("GET /provisioning/tokens", provisioningHandler.ListEnrollmentTokens)
+	mux.HandleFunc("POST /provisioning/tokens", provisioningHandler.CreateEnrollmentToken)
+	mux.HandleFunc("GET /provisioning/tokens/{id}", provisioningHandler.GetEnrollmentToken)
+	mux.HandleFunc("DELETE /provisioning/tokens/{id}", provisioningHandler.RevokeEnrollmentToken)
+	mux.HandleFunc("GET /provisioning/events", provisioningHandler.ListProvisioningEvents)
+	mux.HandleFunc("POST /provision", provisioningHandler.Provision)
 
 	sensorDataHandler := handler.NewSensorDataHandler(*sensorDataService)
+	signatures := handler.NewSignatureMiddleware(signatureVerifier, config.Ingest.RequireSignatures)
 	mux.HandleFunc("GET /sensor-data", sensorDataHandler.ListSensorData)
-	mux.HandleFunc("POST /sensor-data", sensorDataHandler.CreateSensorData)
+	mux.HandleFunc("POST /sensor-data", signatures.Wrap(sensorDataHandler.CreateSensorData))
+	mux.HandleFunc("POST /sensor-data/batch", signatures.Wrap(sensorDataHandler.CreateSensorDataBatch))
+	mux.HandleFunc("GET /sensor-data/query", sensorDataHandler.QuerySensorData)
+	mux.HandleFunc("GET /sensor-data/aggregate", sensorDataHandler.AggregateSensorData)
+	mux.HandleFunc("POST /sensor-data/import", sensorDataHandler.ImportSensorData)
+	mux.HandleFunc("GET /sensor-data/export", sensorDataHandler.ExportSensorData)
 	mux.HandleFunc("GET /sensor-data/{id}", sensorDataHandler.GetSensorDataByDeviceId)
 	mux.HandleFunc("DELETE /sensor-data/{id}", sensorDataHandler.DeleteSensorData)
+	mux.HandleFunc("POST /write", sensorDataHandler.Write)
+
+	exporter, err := export.NewExporter(config.Export.Directory, sensorDataService)
+	if err != nil {
+		log.Fatalf("error opening export directory: %s", err)
+	}
+	defer exporter.Close()
+	exporter.ResumeInterrupted()
+	exportHandler := handler.NewExportHandler(exporter)
+	mux.HandleFunc("GET /exports", exportHandler.ListExports)
+	mux.HandleFunc("POST /exports", exportHandler.CreateExport)
+	mux.HandleFunc("GET /exports/{id}", exportHandler.GetExport)
+	mux.HandleFunc("POST /exports/{id}/resume", exportHandler.ResumeExport)
+	mux.HandleFunc("GET /exports/{id}/files/{path...}", exportHandler.GetExportFile)
+
+	remoteWriteHandler := handler.NewRemoteWriteHandler(*deviceService, sensorDataHandler)
+	mux.HandleFunc("POST /api/v1/write", remoteWriteHandler.Write)
+
+	connections := connectivity.NewRegistry()
+	connectionHandler := handler.NewDeviceConnectionHandler(*deviceService, sensorDataHandler, connections)
+	mux.HandleFunc("GET /devices/connected", connectionHandler.ListConnected)
+	mux.HandleFunc("GET /devices/{id}/ws", connectionHandler.Connect)
+	mux.HandleFunc("POST /devices/{id}/commands", connectionHandler.SendCommand)
+	mux.HandleFunc("PUT /devices/{id}/config", connectionHandler.PushConfig)
+
+	presence := connectivity.NewPresence(time.Duration(config.Coap.PresenceTimeoutSeconds) * time.Second)
+	go presence.Run(ctx)
+	presenceHandler := handler.NewPresenceHandler(*deviceService, presence)
+	mux.HandleFunc("GET /devices/online", presenceHandler.ListOnline)
+	mux.HandleFunc("GET /devices/{id}/presence", presenceHandler.GetPresence)
+
+	latestHandler := handler.NewLatestHandler(*deviceService, *sensorDataService)
+	mux.HandleFunc("GET /devices/latest", latestHandler.GetFleetSnapshot)
+	mux.HandleFunc("GET /devices/{id}/latest", latestHandler.GetDeviceLatest)
+
+	consumerLimiter := ratelimit.NewLimiter()
+	go consumerLimiter.Run(ctx)
+	consumerLimits := service.NewConsumerLimits(consumerLimiter, config.RateLimit.Consumer, deviceService)
+	rateLimitHandler := handler.NewRateLimitHandler(ingestLimits, consumerLimiter)
+	mux.HandleFunc("GET /rate-limits", rateLimitHandler.GetRateLimits)
+
+	if config.Replication.Mode == "central" {
+		replicationHandler := handler.NewReplicationHandler(*service.NewReplicationService(repos.replication), config.Replication.Token)
+		mux.HandleFunc("POST /replication/changes", replicationHandler.ReceiveChanges)
+	}
 
 	server := &http.Server{
 		Addr:         ":" + config.Server.Port,
-		Handler:      mux,
+		Handler:      handler.NewRateLimitMiddleware(consumerLimits).Wrap(mux),
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  15 * time.Second,
 	}
+	if config.Server.TLS.CertFile != "" {
+		server.TLSConfig, err = newTLSConfig(config.Server.TLS)
+		if err != nil {
+			log.Fatalf("error configuring TLS: %s", err)
+		}
+	}
+
+	// Shutdown waits for requests to finish, which streams and hijacked
+	// WebSocket connections never do on their own.
+	server.RegisterOnShutdown(streamHandler.Shutdown)
+	server.RegisterOnShutdown(func() { connections.CloseAll("server shutting down") })
+
+	grpcListener, err := net.Listen("tcp", ":"+config.Server.GrpcPort)
+	if err != nil {
+		log.Fatalf("Failed to listen for gRPC: %v", err)
+	}
+	grpcServer := rpc.NewServer(*deviceService, *sensorDataService,
+		grpc.UnaryInterceptor(rpc.UnaryConsumerLimit(consumerLimits)),
+		grpc.StreamInterceptor(rpc.StreamConsumerLimit(consumerLimits)))
+	go func() {
+		log.Printf("gRPC server starting on port %s\n", config.Server.GrpcPort)
+		if err := grpcServer.Serve(grpcListener); err != nil {
+			log.Printf("gRPC server stopped: %v", err)
+		}
+	}()
+
+	coapHandler := coaphandler.NewDeviceHandler(*deviceService, sensorDataHandler, presence)
+	coapMux := coap.NewMux()
+	coapMux.HandleFunc("/telemetry", coapHandler.Telemetry)
+	coapMux.HandleFunc("/heartbeat", coapHandler.Heartbeat)
+	coapMux.HandleFunc("/presence", coapHandler.Presence)
+	coapServer := coap.NewServer(coapMux)
+	go func() {
+		log.Printf("CoAP server starting on port %s\n", config.Coap.Port)
+		if err := coapServer.ListenAndServe(":" + config.Coap.Port); err != nil && !errors.Is(err, coap.ErrServerClosed) {
+			log.Printf("CoAP server stopped: %v", err)
+		}
+	}()
+
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Failed to shut down server: %v", err)
+		}
+		coapServer.Close()
+
+		// Streams may outlive the grace period; cut them off then.
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-shutdownCtx.Done():
+			grpcServer.Stop()
+		}
+	}()
 
 	log.Printf("Server starting on port %s\n", config.Server.Port)
-	if err := server.ListenAndServe(); err != nil {
+	if config.Server.TLS.CertFile != "" {
+		err = server.ListenAndServeTLS(config.Server.TLS.CertFile, config.Server.TLS.KeyFile)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("Failed to start server: %v", err)
 	}
+	<-shutdownDone
 	log.Println("Server stopped gracefully")
 }
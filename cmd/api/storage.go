@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"iot-platform/internal/archive"
+	"iot-platform/internal/database/postgres"
+	pgasset "iot-platform/internal/database/postgres/asset"
+	pgcertificate "iot-platform/internal/database/postgres/certificate"
+	pgdevice "iot-platform/internal/database/postgres/device"
+	pgdevicekind "iot-platform/internal/database/postgres/devicekind"
+	pgnonce "iot-platform/internal/database/postgres/nonce"
+	pgprovisioning "iot-platform/internal/database/postgres/provisioning"
+	pgreplication "iot-platform/internal/database/postgres/replication"
+	pgsensordata "iot-platform/internal/database/postgres/sensordata"
+	pgusage "iot-platform/internal/database/postgres/usage"
+	"iot-platform/internal/database/query"
+	"iot-platform/internal/database/sqlite"
+	sqliteasset "iot-platform/internal/database/sqlite/asset"
+	sqlitecertificate "iot-platform/internal/database/sqlite/certificate"
+	sqlitedevice "iot-platform/internal/database/sqlite/device"
+	sqlitedevicekind "iot-platform/internal/database/sqlite/devicekind"
+	sqlitenonce "iot-platform/internal/database/sqlite/nonce"
+	sqliteprovisioning "iot-platform/internal/database/sqlite/provisioning"
+	sqlitereplication "iot-platform/internal/database/sqlite/replication"
+	sqlitesensordata "iot-platform/internal/database/sqlite/sensordata"
+	sqliteusage "iot-platform/internal/database/sqlite/usage"
+	"iot-platform/internal/repository"
+	"net/http"
+	"time"
+)
+
+// repositories bundles the storage backend selected by database.driver.
+type repositories struct {
+	db           *sql.DB
+	devices      repository.DevicesRepository
+	deviceKinds  repository.DeviceKindsRepository
+	sensorData   repository.SensorDataRepository
+	replication  repository.ReplicationRepository
+	assets       repository.AssetsRepository
+	provisioning repository.ProvisioningRepository
+	certificates repository.CertificatesRepository
+	nonces       repository.NoncesRepository
+	usage        repository.UsageRepository
+}
+
+// openRepositories opens the configured backend. With record set, device
+// and reading writes append their changes to the replication outbox in the
+// same transaction, for an edge gateway to forward.
+func openRepositories(ctx context.Context, config DatabaseConfig, record bool) (*repositories, error) {
+	if config.Driver == "sqlite" {
+		return openSqlite(ctx, config, record)
+	}
+
+	return openPostgres(ctx, config, record)
+}
+
+// recordOptions returns the repository options recording changes in the
+// outbox of dialect, if record is set.
+func recordOptions(record bool, dialect query.Dialect) []query.Option {
+	if !record {
+		return nil
+	}
+
+	return []query.Option{query.WithOutbox(query.NewOutbox(dialect))}
+}
+
+func openPostgres(ctx context.Context, config DatabaseConfig, record bool) (*repositories, error) {
+	db, err := postgres.InitDb(config.Host, config.Port, config.User, config.Pass, config.Db)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := postgres.Migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	opts := recordOptions(record, postgres.Dialect)
+	devices, err := pgdevice.NewDevicePostgresRepository(db, opts...)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	deviceKinds, err := pgdevicekind.NewDeviceKindPostgresRepository(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	sensorData, err := pgsensordata.NewSensorDataPostgresRepository(db, opts...)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	replication, err := pgreplication.NewReplicationPostgresRepository(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	assets, err := pgasset.NewAssetPostgresRepository(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	provisioning, err := pgprovisioning.NewProvisioningPostgresRepository(db, opts...)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	certificates, err := pgcertificate.NewCertificatePostgresRepository(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	nonces, err := pgnonce.NewNoncePostgresRepository(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	usage, err := pgusage.NewUsagePostgresRepository(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &repositories{db: db, devices: devices, deviceKinds: deviceKinds, sensorData: sensorData, replication: replication, assets: assets, provisioning: provisioning, certificates: certificates, nonces: nonces, usage: usage}, nil
+}
+
+func openSqlite(ctx context.Context, config DatabaseConfig, record bool) (*repositories, error) {
+	db, err := sqlite.InitDb(config.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sqlite.Migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	opts := recordOptions(record, sqlite.Dialect)
+	devices, err := sqlitedevice.NewDeviceSqliteRepository(db, opts...)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	deviceKinds, err := sqlitedevicekind.NewDeviceKindSqliteRepository(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	sensorData, err := sqlitesensordata.NewSensorDataSqliteRepository(db, opts...)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	replication, err := sqlitereplication.NewReplicationSqliteRepository(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	assets, err := sqliteasset.NewAssetSqliteRepository(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	provisioning, err := sqliteprovisioning.NewProvisioningSqliteRepository(db, opts...)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	certificates, err := sqlitecertificate.NewCertificateSqliteRepository(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	nonces, err := sqlitenonce.NewNonceSqliteRepository(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	usage, err := sqliteusage.NewUsageSqliteRepository(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &repositories{db: db, devices: devices, deviceKinds: deviceKinds, sensorData: sensorData, replication: replication, assets: assets, provisioning: provisioning, certificates: certificates, nonces: nonces, usage: usage}, nil
+}
+
+// openArchive opens the archive in the configured S3 bucket, or directory
+// when there is none, and loads its index.
+func openArchive(ctx context.Context, config ArchiveConfig) (*archive.Archive, error) {
+	var store archive.Store
+	if config.S3.Bucket != "" {
+		store = archive.NewS3Store(config.S3, &http.Client{Timeout: time.Minute})
+	} else {
+		dirStore, err := archive.NewDirStore(config.Directory)
+		if err != nil {
+			return nil, err
+		}
+		store = dirStore
+	}
+
+	sensorArchive := archive.NewArchive(store)
+	if err := sensorArchive.Load(ctx); err != nil {
+		return nil, err
+	}
+
+	return sensorArchive, nil
+}
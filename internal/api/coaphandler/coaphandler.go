@@ -0,0 +1,274 @@
+// Package coaphandler serves constrained devices over CoAP. Devices
+// authenticate with their id and API key in the d and k query options,
+// e.g. coap://host/telemetry?d=<deviceId>&k=<apiKey>, and send JSON, CBOR
+// or SenML payloads.
+package coaphandler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"iot-platform/internal/api/http/handler"
+	"iot-platform/internal/coap"
+	"iot-platform/internal/connectivity"
+	"iot-platform/internal/model"
+	"iot-platform/internal/senml"
+	"iot-platform/internal/service"
+	"log"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+type DeviceHandler struct {
+	devices    service.DeviceService
+	sensorData *handler.SensorDataHandler
+	presence   *connectivity.Presence
+}
+
+func NewDeviceHandler(devices service.DeviceService, sensorData *handler.SensorDataHandler, presence *connectivity.Presence) *DeviceHandler {
+	return &DeviceHandler{
+		devices:    devices,
+		sensorData: sensorData,
+		presence:   presence,
+	}
+}
+
+var cborDecMode, _ = cbor.DecOptions{
+	DefaultMapType: reflect.TypeOf(map[string]any(nil)),
+}.DecMode()
+
+var errUnsupportedFormat = errors.New("unsupported content format")
+
+func (h *DeviceHandler) authenticate(ctx context.Context, r *coap.Request) (*model.Device, *coap.Response) {
+	query := r.Query()
+	device, err := h.devices.Authenticate(ctx, query.Get("d"), query.Get("k"))
+	if errors.Is(err, service.ErrUnauthorized) {
+		return nil, &coap.Response{Code: coap.Unauthorized}
+	}
+	if err != nil {
+		log.Printf("Failed to authenticate CoAP device: %v", err)
+		return nil, &coap.Response{Code: coap.InternalServerError}
+	}
+
+	return device, nil
+}
+
+// Telemetry handles POST /telemetry. The payload is a reading shaped like
+// the body of POST /sensor-data, {"readings": [...]} as for the batch
+// endpoint, or a SenML pack. deviceId may be left out; it defaults to the
+// authenticated device and may not name another one.
+func (h *DeviceHandler) Telemetry(ctx context.Context, r *coap.Request) *coap.Response {
+	if r.Code != coap.POST {
+		return &coap.Response{Code: coap.MethodNotAllowed}
+	}
+
+	device, failed := h.authenticate(ctx, r)
+	if failed != nil {
+		return failed
+	}
+
+	readings, failed := readingsOf(r)
+	if failed != nil {
+		return failed
+	}
+
+	for i := range readings {
+		if readings[i].DeviceId == "" {
+			readings[i].DeviceId = device.Id
+		}
+		if readings[i].DeviceId != device.Id {
+			return &coap.Response{Code: coap.Unauthorized, ContentFormat: coap.TextPlain, Payload: []byte("readings must belong to the authenticated device")}
+		}
+	}
+
+	h.presence.Touch(device.Id, time.Now())
+
+	status, response := h.sensorData.IngestReadings(ctx, readings)
+	code := coap.Changed
+	switch status {
+	case http.StatusBadRequest:
+		code = coap.BadRequest
+	case http.StatusTooManyRequests:
+		code = coap.TooManyRequests
+	case http.StatusInternalServerError:
+		code = coap.InternalServerError
+	}
+
+	return encode(r, code, response)
+}
+
+// Heartbeat handles POST /heartbeat, which only marks the device online.
+func (h *DeviceHandler) Heartbeat(ctx context.Context, r *coap.Request) *coap.Response {
+	if r.Code != coap.POST {
+		return &coap.Response{Code: coap.MethodNotAllowed}
+	}
+
+	device, failed := h.authenticate(ctx, r)
+	if failed != nil {
+		return failed
+	}
+
+	h.presence.Touch(device.Id, time.Now())
+
+	return &coap.Response{Code: coap.Changed}
+}
+
+// Presence handles GET /presence, the device's online status. With the
+// Observe option the device is notified whenever it goes offline or back
+// online, e.g. to learn that its heartbeats are not getting through.
+func (h *DeviceHandler) Presence(ctx context.Context, r *coap.Request) *coap.Response {
+	if r.Code != coap.GET {
+		return &coap.Response{Code: coap.MethodNotAllowed}
+	}
+
+	device, failed := h.authenticate(ctx, r)
+	if failed != nil {
+		return failed
+	}
+
+	if observation := r.Observe(); observation != nil {
+		changes, stop := h.presence.Watch(device.Id)
+		go func() {
+			defer stop()
+			for {
+				select {
+				case <-observation.Done():
+					return
+				case status := <-changes:
+					if err := observation.Notify(encode(r, coap.Content, status)); err != nil {
+						observation.Cancel()
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	return encode(r, coap.Content, h.presence.Status(device.Id))
+}
+
+func readingsOf(r *coap.Request) ([]handler.CreateSensorDataRequest, *coap.Response) {
+	invalid := &coap.Response{Code: coap.BadRequest, ContentFormat: coap.TextPlain, Payload: []byte("invalid payload")}
+
+	format, _ := r.ContentFormat()
+	if format == coap.AppSenMLJSON || format == coap.AppSenMLCBOR {
+		mediaType := senml.MediaTypeJSON
+		if format == coap.AppSenMLCBOR {
+			mediaType = senml.MediaTypeCBOR
+		}
+		pack, err := senml.Decode(mediaType, r.Payload)
+		if err != nil {
+			return nil, invalid
+		}
+		records, err := senml.Resolve(pack, time.Now())
+		if err != nil {
+			return nil, &coap.Response{Code: coap.BadRequest, ContentFormat: coap.TextPlain, Payload: []byte(err.Error())}
+		}
+		return handler.SenMLReadings(records, ""), nil
+	}
+
+	body, err := jsonBody(r)
+	if errors.Is(err, errUnsupportedFormat) {
+		return nil, &coap.Response{Code: coap.UnsupportedContentFormat}
+	}
+	if err != nil {
+		return nil, invalid
+	}
+
+	var batch handler.CreateSensorDataBatchRequest
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return nil, invalid
+	}
+	if len(batch.Readings) > 0 {
+		return batch.Readings, nil
+	}
+
+	var reading handler.CreateSensorDataRequest
+	if err := json.Unmarshal(body, &reading); err != nil {
+		return nil, invalid
+	}
+
+	return []handler.CreateSensorDataRequest{reading}, nil
+}
+
+// jsonBody returns the request payload as JSON, converting CBOR.
+func jsonBody(r *coap.Request) ([]byte, error) {
+	format, ok := r.ContentFormat()
+	if !ok {
+		format = coap.AppJSON
+	}
+
+	switch format {
+	case coap.AppJSON:
+		return r.Payload, nil
+	case coap.AppCBOR:
+		var value any
+		if err := cborDecMode.Unmarshal(r.Payload, &value); err != nil {
+			return nil, err
+		}
+		convertTimestamps(value)
+		return json.Marshal(value)
+	default:
+		return nil, errUnsupportedFormat
+	}
+}
+
+// convertTimestamps rewrites the epoch seconds CBOR encoders commonly use
+// for timestamps into the RFC 3339 strings the JSON request types expect.
+func convertTimestamps(value any) {
+	body, ok := value.(map[string]any)
+	if !ok {
+		return
+	}
+
+	if readings, ok := body["readings"].([]any); ok {
+		for _, reading := range readings {
+			convertTimestamps(reading)
+		}
+	}
+
+	var t time.Time
+	switch timestamp := body["timestamp"].(type) {
+	case uint64:
+		t = time.Unix(int64(timestamp), 0)
+	case int64:
+		t = time.Unix(timestamp, 0)
+	case float64:
+		t = time.UnixMicro(int64(timestamp * 1e6))
+	default:
+		return
+	}
+	body["timestamp"] = t.UTC().Format(time.RFC3339Nano)
+}
+
+// encode answers in the format the device asked for with Accept, or else in
+// the format of its request.
+func encode(r *coap.Request, code coap.Code, body any) *coap.Response {
+	format, ok := r.Accept()
+	if !ok {
+		format, ok = r.ContentFormat()
+	}
+	switch {
+	case ok && (format == coap.AppCBOR || format == coap.AppSenMLCBOR):
+		format = coap.AppCBOR
+	default:
+		format = coap.AppJSON
+	}
+
+	var payload []byte
+	var err error
+	if format == coap.AppCBOR {
+		payload, err = cbor.Marshal(body)
+	} else {
+		payload, err = json.Marshal(body)
+	}
+	if err != nil {
+		log.Printf("Failed to encode CoAP response: %v", err)
+		return &coap.Response{Code: coap.InternalServerError}
+	}
+
+	return &coap.Response{Code: code, ContentFormat: format, Payload: payload}
+}
@@ -0,0 +1,148 @@
+package coaphandler_test
+
+import (
+	"context"
+	"encoding/json"
+	"iot-platform/internal/api/coaphandler"
+	"iot-platform/internal/api/http/handler"
+	"iot-platform/internal/coap"
+	"iot-platform/internal/connectivity"
+	"iot-platform/internal/database/sqlite/sqlitetest"
+	"iot-platform/internal/model"
+	"iot-platform/internal/service"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+func TestDeviceHandler(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	repos := sqlitetest.NewRepositories(t)
+	deviceId, err := repos.Devices.SaveDevice(ctx, &model.Device{Name: "Soil probe", Kind: "probe", ApiKey: "key-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	presence := connectivity.NewPresence(time.Minute)
+	h := coaphandler.NewDeviceHandler(
+		*service.NewDevicesService(repos.Devices),
+		handler.NewSensorDataHandler(*service.NewSensorDataService(repos.SensorData)),
+		presence,
+	)
+	mux := coap.NewMux()
+	mux.HandleFunc("/telemetry", h.Telemetry)
+	mux.HandleFunc("/heartbeat", h.Heartbeat)
+	mux.HandleFunc("/presence", h.Presence)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := coap.NewServer(mux)
+	go server.Serve(conn)
+	defer server.Close()
+
+	client, err := coap.Dial(conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.AckTimeout = 200 * time.Millisecond
+
+	auth := url.Values{"d": {deviceId}, "k": {"key-1"}}
+
+	response, err := client.Post(ctx, "/telemetry", url.Values{"d": {deviceId}, "k": {"wrong"}}, coap.AppJSON, []byte(`{"metricName": "moisture", "metricValue": 31}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Code != coap.Unauthorized {
+		t.Errorf("expected 4.01 for a wrong API key, got %s", response.Code)
+	}
+
+	response, err = client.Post(ctx, "/telemetry", auth, coap.AppJSON, []byte(`{"metricName": "moisture", "metricValue": 31}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ingest handler.CreateSensorDataResponse
+	if err := json.Unmarshal(response.Payload, &ingest); err != nil {
+		t.Fatal(err)
+	}
+	if response.Code != coap.Changed || ingest.Accepted != 1 {
+		t.Errorf("expected 2.04 with one reading accepted, got %s %s", response.Code, response.Payload)
+	}
+
+	payload, err := cbor.Marshal(map[string]any{
+		"metrics":   map[string]any{"moisture": 32.5, "battery": 3.1},
+		"timestamp": time.Now().Add(-time.Minute).Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err = client.Post(ctx, "/telemetry", auth, coap.AppCBOR, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ingest = handler.CreateSensorDataResponse{}
+	if err := cbor.Unmarshal(response.Payload, &ingest); err != nil {
+		t.Fatal(err)
+	}
+	if format, _ := response.ContentFormat(); response.Code != coap.Changed || format != coap.AppCBOR || ingest.Accepted != 2 {
+		t.Errorf("expected a CBOR 2.04 with two readings accepted, got %s %d %+v", response.Code, format, ingest)
+	}
+
+	stored, err := repos.SensorData.FindSensorDataByDeviceId(ctx, deviceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 3 {
+		t.Errorf("expected 3 stored readings, got %d", len(stored))
+	}
+
+	response, err = client.Post(ctx, "/telemetry", auth, coap.AppJSON, []byte(`{"deviceId": "someone-else", "metricName": "moisture", "metricValue": 1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Code != coap.Unauthorized {
+		t.Errorf("expected 4.01 for another device's reading, got %s", response.Code)
+	}
+
+	// The device is online since its telemetry; observe it going offline
+	// and back online with a heartbeat.
+	notifications := make(chan connectivity.PresenceStatus, 4)
+	observeCtx, stopObserving := context.WithCancel(ctx)
+	defer stopObserving()
+	response, err = client.Observe(observeCtx, "/presence", auth, func(m *coap.Message) {
+		var status connectivity.PresenceStatus
+		json.Unmarshal(m.Payload, &status)
+		notifications <- status
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status connectivity.PresenceStatus
+	json.Unmarshal(response.Payload, &status)
+	if _, ok := response.Observe(); !ok || !status.Online {
+		t.Fatalf("expected an observed online status, got %s", response.Payload)
+	}
+
+	presence.Expire(time.Now().Add(time.Hour))
+	if status := <-notifications; status.Online {
+		t.Errorf("expected an offline notification, got %+v", status)
+	}
+
+	response, err = client.Post(ctx, "/heartbeat", auth, coap.AppJSON, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Code != coap.Changed {
+		t.Errorf("expected 2.04 for a heartbeat, got %s", response.Code)
+	}
+	if status := <-notifications; !status.Online {
+		t.Errorf("expected an online notification, got %+v", status)
+	}
+}
@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iot-platform/internal/model"
+	"iot-platform/internal/repository"
+	"iot-platform/internal/service"
+	"net/http"
+	"time"
+)
+
+type AssetRequest struct {
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	ParentId string `json:"parentId"`
+}
+
+// MoveAssetRequest moves an asset under ParentId, or to the top of the tree
+// when ParentId is empty.
+type MoveAssetRequest struct {
+	ParentId string `json:"parentId"`
+}
+
+type AssetResponse struct {
+	Id        string   `json:"id"`
+	Name      string   `json:"name"`
+	Kind      string   `json:"kind"`
+	ParentId  string   `json:"parentId,omitempty"`
+	DeviceIds []string `json:"deviceIds"`
+	CreatedAt string   `json:"createdAt"`
+	UpdatedAt string   `json:"updatedAt"`
+}
+
+type ListAssetsResponse struct {
+	Assets []*AssetResponse `json:"assets"`
+}
+
+// AssetTreeResponse is an asset with the assets below it nested.
+type AssetTreeResponse struct {
+	*AssetResponse
+	Children []*AssetTreeResponse `json:"children"`
+}
+
+func toAssetResponse(asset *model.Asset) *AssetResponse {
+	return &AssetResponse{
+		Id:        asset.Id,
+		Name:      asset.Name,
+		Kind:      asset.Kind,
+		ParentId:  asset.ParentId,
+		DeviceIds: asset.DeviceIds,
+		CreatedAt: asset.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: asset.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// toAssetTree nests a subtree, as returned by FetchSubtree, under its root.
+func toAssetTree(rootId string, subtree []*model.Asset) *AssetTreeResponse {
+	nodes := make(map[string]*AssetTreeResponse, len(subtree))
+	for _, asset := range subtree {
+		nodes[asset.Id] = &AssetTreeResponse{AssetResponse: toAssetResponse(asset), Children: []*AssetTreeResponse{}}
+	}
+	for _, asset := range subtree {
+		if parent := nodes[asset.ParentId]; parent != nil && asset.Id != rootId {
+			parent.Children = append(parent.Children, nodes[asset.Id])
+		}
+	}
+
+	return nodes[rootId]
+}
+
+type AssetHandler struct {
+	service service.AssetService
+}
+
+func NewAssetHandler(service service.AssetService) *AssetHandler {
+	return &AssetHandler{
+		service: service,
+	}
+}
+
+func (h *AssetHandler) CreateAsset(w http.ResponseWriter, r *http.Request) {
+	var req AssetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	asset := &model.Asset{Name: req.Name, Kind: req.Kind, ParentId: req.ParentId, DeviceIds: []string{}}
+	if err := h.service.CreateAsset(r.Context(), asset); err != nil {
+		writeAssetError(w, "failed to create asset", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(toAssetResponse(asset))
+}
+
+func (h *AssetHandler) ListAssets(w http.ResponseWriter, r *http.Request) {
+	assets, err := h.service.FetchAssets(r.Context())
+	if err != nil {
+		http.Error(w, "failed to fetch assets", http.StatusInternalServerError)
+		return
+	}
+
+	response := ListAssetsResponse{Assets: make([]*AssetResponse, len(assets))}
+	for i, asset := range assets {
+		response.Assets[i] = toAssetResponse(asset)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *AssetHandler) GetAsset(w http.ResponseWriter, r *http.Request) {
+	asset, err := h.service.FindAsset(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeAssetError(w, "failed to find asset", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toAssetResponse(asset))
+}
+
+// GetAssetTree returns an asset with everything below it nested.
+func (h *AssetHandler) GetAssetTree(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	subtree, err := h.service.FetchSubtree(r.Context(), id)
+	if err != nil {
+		writeAssetError(w, "failed to fetch asset tree", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toAssetTree(id, subtree))
+}
+
+// UpdateAsset renames an asset; parentId is ignored. Use MoveAsset to move
+// it.
+func (h *AssetHandler) UpdateAsset(w http.ResponseWriter, r *http.Request) {
+	var req AssetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	asset := &model.Asset{Name: req.Name, Kind: req.Kind}
+	if err := h.service.UpdateAsset(r.Context(), r.PathValue("id"), asset); err != nil {
+		writeAssetError(w, "failed to update asset", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toAssetResponse(asset))
+}
+
+// MoveAsset moves an asset together with its subtree.
+func (h *AssetHandler) MoveAsset(w http.ResponseWriter, r *http.Request) {
+	var req MoveAssetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	id := r.PathValue("id")
+	if err := h.service.MoveAsset(r.Context(), id, req.ParentId); err != nil {
+		writeAssetError(w, "failed to move asset", err)
+		return
+	}
+
+	asset, err := h.service.FindAsset(r.Context(), id)
+	if err != nil {
+		writeAssetError(w, "failed to find asset", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toAssetResponse(asset))
+}
+
+func (h *AssetHandler) DeleteAsset(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.DeleteAsset(r.Context(), r.PathValue("id")); err != nil {
+		writeAssetError(w, "failed to delete asset", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AttachDevice attaches a device to the asset, moving it from any asset it
+// was attached to before.
+func (h *AssetHandler) AttachDevice(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.AttachDevice(r.Context(), r.PathValue("id"), r.PathValue("deviceId")); err != nil {
+		writeAssetError(w, "failed to attach device", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AssetHandler) DetachDevice(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.DetachDevice(r.Context(), r.PathValue("id"), r.PathValue("deviceId")); err != nil {
+		writeAssetError(w, "failed to detach device", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeAssetError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidAsset):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repository.ErrAssetCycle), errors.Is(err, repository.ErrAssetNotEmpty):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, repository.ErrNotFound):
+		http.Error(w, "asset not found", http.StatusNotFound)
+	default:
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,127 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"iot-platform/internal/api/http/handler"
+	"iot-platform/internal/database/sqlite/sqlitetest"
+	"iot-platform/internal/model"
+	"iot-platform/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAssetHandler(t *testing.T) {
+	ctx := context.Background()
+	repos := sqlitetest.NewRepositories(t)
+	assetService := service.NewAssetService(repos.Assets, repos.Devices)
+	sensorDataService := service.NewSensorDataService(repos.SensorData, service.WithAssetScope(assetService))
+	h := handler.NewAssetHandler(*assetService)
+	sensorDataHandler := handler.NewSensorDataHandler(*sensorDataService)
+
+	create := func(name, parentId string) string {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		h.CreateAsset(recorder, httptest.NewRequest(http.MethodPost, "/assets", strings.NewReader(`{"name": "`+name+`", "kind": "room", "parentId": "`+parentId+`"}`)))
+		if recorder.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", recorder.Code, recorder.Body)
+		}
+		var response handler.AssetResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		return response.Id
+	}
+	withPath := func(request *http.Request, values ...string) *http.Request {
+		for i := 0; i < len(values); i += 2 {
+			request.SetPathValue(values[i], values[i+1])
+		}
+		return request
+	}
+
+	site := create("Site", "")
+	buildingB := create("Building B", site)
+	floor := create("Floor 1", buildingB)
+	buildingC := create("Building C", site)
+
+	recorder := httptest.NewRecorder()
+	h.CreateAsset(recorder, httptest.NewRequest(http.MethodPost, "/assets", strings.NewReader(`{"name": "Orphan", "parentId": "missing"}`)))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a missing parent, got %d", recorder.Code)
+	}
+
+	temperatures := map[string]float64{floor: 20, buildingB: 24, buildingC: 30}
+	for assetId, temperature := range temperatures {
+		deviceId, err := repos.Devices.SaveDevice(ctx, &model.Device{Name: "Sensor", Kind: "thermometer", ApiKey: "key-" + assetId})
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := httptest.NewRecorder()
+		h.AttachDevice(recorder, withPath(httptest.NewRequest(http.MethodPut, "/assets/"+assetId+"/devices/"+deviceId, nil), "id", assetId, "deviceId", deviceId))
+		if recorder.Code != http.StatusNoContent {
+			t.Fatalf("expected 204, got %d: %s", recorder.Code, recorder.Body)
+		}
+		if err := sensorDataService.CreateSensorData(ctx, &model.SensorData{DeviceId: deviceId, MetricName: "temperature", MetricValue: temperature}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	aggregate := func(assetId string) handler.AggregateSensorDataResponse {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		sensorDataHandler.AggregateSensorData(recorder, httptest.NewRequest(http.MethodGet, "/sensor-data/aggregate?fn=avg&metric=temperature&asset="+assetId, nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body)
+		}
+		var response handler.AggregateSensorDataResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	if avg := aggregate(buildingB); avg.Count != 2 || avg.Value != 22 {
+		t.Errorf("expected the average of building B and its floor, got %+v", avg)
+	}
+	if avg := aggregate(site); avg.Count != 3 {
+		t.Errorf("expected every device under the site, got %+v", avg)
+	}
+
+	recorder = httptest.NewRecorder()
+	h.MoveAsset(recorder, withPath(httptest.NewRequest(http.MethodPost, "/assets/"+buildingB+"/move", strings.NewReader(`{"parentId": "`+floor+`"}`)), "id", buildingB))
+	if recorder.Code != http.StatusConflict {
+		t.Errorf("expected 409 moving below a descendant, got %d", recorder.Code)
+	}
+	recorder = httptest.NewRecorder()
+	h.MoveAsset(recorder, withPath(httptest.NewRequest(http.MethodPost, "/assets/"+floor+"/move", strings.NewReader(`{"parentId": "`+buildingC+`"}`)), "id", floor))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body)
+	}
+	if avg := aggregate(buildingC); avg.Count != 2 || avg.Value != 25 {
+		t.Errorf("expected the floor to count towards building C after the move, got %+v", avg)
+	}
+
+	recorder = httptest.NewRecorder()
+	h.GetAssetTree(recorder, withPath(httptest.NewRequest(http.MethodGet, "/assets/"+site+"/tree", nil), "id", site))
+	var tree handler.AssetTreeResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&tree); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Id != site || len(tree.Children) != 2 || tree.Children[1].Id != buildingC || len(tree.Children[1].Children) != 1 || tree.Children[1].Children[0].Id != floor {
+		t.Errorf("unexpected tree: %+v", tree)
+	}
+
+	recorder = httptest.NewRecorder()
+	h.DeleteAsset(recorder, withPath(httptest.NewRequest(http.MethodDelete, "/assets/"+site, nil), "id", site))
+	if recorder.Code != http.StatusConflict {
+		t.Errorf("expected 409 deleting an asset with children, got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	sensorDataHandler.QuerySensorData(recorder, httptest.NewRequest(http.MethodGet, "/sensor-data/query?asset=missing", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown asset, got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,201 @@
+package handler_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"iot-platform/internal/api/http/handler"
+	"iot-platform/internal/connectivity"
+	"iot-platform/internal/database/sqlite/sqlitetest"
+	"iot-platform/internal/model"
+	"iot-platform/internal/service"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testCA issues client certificates for the tests.
+type testCA struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	serial      int64
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{certificate: certificate, key: key, serial: 1}
+}
+
+// issue returns a client certificate for commonName, with uris as subject
+// alternative names, and its PEM encoding.
+func (ca *testCA) issue(t *testing.T, commonName string, uris ...string) (tls.Certificate, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, uri := range uris {
+		parsed, err := url.Parse(uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template.URIs = append(template.URIs, parsed)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestDeviceHandler_ClientCertificates(t *testing.T) {
+	ctx := context.Background()
+	repos := sqlitetest.NewRepositories(t)
+	deviceId, err := repos.Devices.SaveDevice(ctx, &model.Device{Name: "Boiler", Kind: "thermometer", ApiKey: "key-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherId, err := repos.Devices.SaveDevice(ctx, &model.Device{Name: "Pump", Kind: "thermometer", ApiKey: "key-2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	devices := *service.NewDevicesService(repos.Devices, service.WithCertificates(repos.Certificates))
+	h := handler.NewDeviceHandler(devices)
+	connections := handler.NewDeviceConnectionHandler(devices, handler.NewSensorDataHandler(*service.NewSensorDataService(repos.SensorData)), connectivity.NewRegistry())
+
+	ca := newTestCA(t)
+	byName, byNamePEM := ca.issue(t, deviceId)
+	bySAN, bySANPEM := ca.issue(t, "pump", "urn:uuid:"+otherId)
+	unregistered, _ := ca.issue(t, deviceId)
+
+	register := func(id, certificate string) int {
+		t.Helper()
+		body, _ := json.Marshal(handler.RegisterCertificateRequest{Certificate: certificate})
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/devices/"+id+"/certificates", strings.NewReader(string(body)))
+		request.SetPathValue("id", id)
+		h.RegisterCertificate(recorder, request)
+		return recorder.Code
+	}
+	if code := register(deviceId, "not a certificate"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for garbage, got %d", code)
+	}
+	if code := register(deviceId, bySANPEM); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a certificate naming another device, got %d", code)
+	}
+	if code := register(deviceId, byNamePEM); code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	if code := register(deviceId, byNamePEM); code != http.StatusConflict {
+		t.Errorf("expected 409 registering twice, got %d", code)
+	}
+	if code := register(otherId, bySANPEM); code != http.StatusCreated {
+		t.Fatalf("expected 201 for a certificate naming the device in a SAN, got %d", code)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /devices/{id}/ws", connections.Connect)
+	server := httptest.NewUnstartedServer(mux)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.certificate)
+	server.TLS = &tls.Config{ClientCAs: clientCAs, ClientAuth: tls.VerifyClientCertIfGiven}
+	server.StartTLS()
+	defer server.Close()
+
+	connect := func(id string, certificate *tls.Certificate, header http.Header) (int, error) {
+		t.Helper()
+		tlsConfig := &tls.Config{RootCAs: x509.NewCertPool()}
+		tlsConfig.RootCAs.AddCert(server.Certificate())
+		if certificate != nil {
+			tlsConfig.Certificates = []tls.Certificate{*certificate}
+		}
+		dialer := websocket.Dialer{TLSClientConfig: tlsConfig}
+		conn, response, err := dialer.Dial("wss"+strings.TrimPrefix(server.URL, "https")+"/devices/"+id+"/ws", header)
+		if err != nil {
+			if response == nil {
+				return 0, err
+			}
+			return response.StatusCode, nil
+		}
+		conn.Close()
+		return http.StatusSwitchingProtocols, nil
+	}
+	expect := func(want int, id string, certificate *tls.Certificate, header http.Header, message string) {
+		t.Helper()
+		code, err := connect(id, certificate, header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != want {
+			t.Errorf("%s: expected %d, got %d", message, want, code)
+		}
+	}
+
+	expect(http.StatusSwitchingProtocols, deviceId, &byName, nil, "certificate naming the device in its CN")
+	expect(http.StatusSwitchingProtocols, otherId, &bySAN, nil, "certificate naming the device in a SAN")
+	expect(http.StatusUnauthorized, otherId, &byName, nil, "certificate of another device")
+	expect(http.StatusUnauthorized, deviceId, &unregistered, nil, "unregistered certificate")
+	expect(http.StatusSwitchingProtocols, deviceId, nil, http.Header{"X-Api-Key": {"key-1"}}, "API key without a certificate")
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodDelete, "/devices/"+deviceId+"/certificates/x", nil)
+	request.SetPathValue("id", deviceId)
+	request.SetPathValue("fingerprint", service.CertificateFingerprint(mustParse(t, byName)))
+	h.RevokeCertificate(recorder, request)
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", recorder.Code)
+	}
+	expect(http.StatusUnauthorized, deviceId, &byName, http.Header{"X-Api-Key": {"key-1"}}, "revoked certificate")
+}
+
+func mustParse(t *testing.T, certificate tls.Certificate) *x509.Certificate {
+	t.Helper()
+	parsed, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
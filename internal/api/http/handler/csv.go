@@ -0,0 +1,537 @@
+package handler
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iot-platform/internal/model"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// importBatchSize is how many rows are parsed before they are stored.
+	importBatchSize = 1000
+	// maxImportErrors bounds the row errors listed in an import report.
+	maxImportErrors = 1000
+)
+
+// csvColumns is the header written by the CSV export. The import reads the
+// same columns by default, so exports can be imported again.
+var csvColumns = []string{"id", "deviceId", "metricName", "valueType", "metricValue", "unit", "originalUnit", "originalValue", "timestamp", "violation", "labels"}
+
+type ImportError struct {
+	// Row is the row number in the file, counting the header as row 1.
+	Row    int    `json:"row"`
+	Metric string `json:"metric,omitempty"`
+	Error  string `json:"error"`
+}
+
+type ImportSensorDataResponse struct {
+	Message      string        `json:"message"`
+	Status       string        `json:"status"`
+	Rows         int           `json:"rows"`
+	Accepted     int           `json:"accepted"`
+	Deduplicated int           `json:"deduplicated"`
+	Flagged      int           `json:"flagged"`
+	ErrorCount   int           `json:"errorCount"`
+	Errors       []ImportError `json:"errors,omitempty"`
+}
+
+// csvMapping says which columns of an import hold what.
+type csvMapping struct {
+	deviceId        string
+	deviceColumn    string
+	timestampColumn string
+	metricColumn    string
+	valueColumn     string
+	typeColumn      string
+	unitColumn      string
+	labelsColumn    string
+	// metrics maps the columns of a wide file, one metric per column, to
+	// metric names.
+	metrics map[string]string
+	units   map[string]string
+
+	timestampFormat string
+	location        *time.Location
+	delimiter       rune
+}
+
+// parseCSVMapping reads the column mapping of an import:
+//
+//	deviceId         device of every row, instead of a device column
+//	deviceColumn     default deviceId
+//	timestampColumn  default timestamp
+//	metricColumn     default metricName
+//	valueColumn      default metricValue
+//	typeColumn       default valueType, optional
+//	unitColumn       default unit, optional
+//	labelsColumn     default labels, optional, a JSON object
+//	metrics          wide files: value columns, as column or column=metric,
+//	                 comma separated; replaces metric and value columns
+//	units            units of wide file metrics, as metric=unit
+//	timestampFormat  rfc3339 (default), unix, unixms or a Go time layout
+//	timezone         IANA zone of timestamps without one, default UTC
+//	delimiter        field delimiter, default ",", or "tab"
+func parseCSVMapping(values url.Values) (*csvMapping, error) {
+	mapping := &csvMapping{
+		deviceId:        values.Get("deviceId"),
+		deviceColumn:    valueOr(values.Get("deviceColumn"), "deviceId"),
+		timestampColumn: valueOr(values.Get("timestampColumn"), "timestamp"),
+		metricColumn:    valueOr(values.Get("metricColumn"), "metricName"),
+		valueColumn:     valueOr(values.Get("valueColumn"), "metricValue"),
+		typeColumn:      valueOr(values.Get("typeColumn"), "valueType"),
+		unitColumn:      valueOr(values.Get("unitColumn"), "unit"),
+		labelsColumn:    valueOr(values.Get("labelsColumn"), "labels"),
+		timestampFormat: valueOr(values.Get("timestampFormat"), "rfc3339"),
+		location:        time.UTC,
+		delimiter:       ',',
+	}
+
+	for _, entry := range splitList(values["metrics"]) {
+		if mapping.metrics == nil {
+			mapping.metrics = make(map[string]string)
+		}
+		column, metric, ok := strings.Cut(entry, "=")
+		if !ok {
+			metric = column
+		}
+		if err := model.ValidateMetricName(metric); err != nil {
+			return nil, fmt.Errorf("invalid metrics: %w", err)
+		}
+		mapping.metrics[column] = metric
+	}
+	for _, entry := range splitList(values["units"]) {
+		metric, unit, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, errors.New("invalid units, expected metric=unit")
+		}
+		if mapping.units == nil {
+			mapping.units = make(map[string]string)
+		}
+		mapping.units[metric] = unit
+	}
+
+	if timezone := values.Get("timezone"); timezone != "" {
+		location, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone: %w", err)
+		}
+		mapping.location = location
+	}
+
+	switch delimiter := values.Get("delimiter"); delimiter {
+	case "":
+	case "tab":
+		mapping.delimiter = '\t'
+	default:
+		if len([]rune(delimiter)) != 1 {
+			return nil, errors.New("delimiter must be a single character or tab")
+		}
+		mapping.delimiter = []rune(delimiter)[0]
+	}
+
+	return mapping, nil
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+
+	return value
+}
+
+// csvIndexes holds the position of each mapped column in the header, -1
+// when absent.
+type csvIndexes struct {
+	device, timestamp, metric, value, valueType, unit, labels int
+	metrics                                                   map[int]string
+}
+
+func (m *csvMapping) indexes(header []string) (*csvIndexes, error) {
+	position := make(map[string]int, len(header))
+	for i, column := range header {
+		position[strings.TrimSpace(column)] = i
+	}
+	find := func(column string) int {
+		if i, ok := position[column]; ok {
+			return i
+		}
+		return -1
+	}
+
+	idx := &csvIndexes{
+		device:    find(m.deviceColumn),
+		timestamp: find(m.timestampColumn),
+		metric:    find(m.metricColumn),
+		value:     find(m.valueColumn),
+		valueType: find(m.typeColumn),
+		unit:      find(m.unitColumn),
+		labels:    find(m.labelsColumn),
+	}
+	if m.deviceId == "" && idx.device < 0 {
+		return nil, fmt.Errorf("device column %q not found; set deviceColumn or deviceId", m.deviceColumn)
+	}
+	if idx.timestamp < 0 {
+		return nil, fmt.Errorf("timestamp column %q not found", m.timestampColumn)
+	}
+
+	if m.metrics != nil {
+		idx.metrics = make(map[int]string, len(m.metrics))
+		for column, metric := range m.metrics {
+			i := find(column)
+			if i < 0 {
+				return nil, fmt.Errorf("metric column %q not found", column)
+			}
+			idx.metrics[i] = metric
+		}
+		return idx, nil
+	}
+
+	if idx.metric < 0 || idx.value < 0 {
+		return nil, fmt.Errorf("columns %q and %q not found; set metricColumn and valueColumn, or metrics", m.metricColumn, m.valueColumn)
+	}
+
+	return idx, nil
+}
+
+func (m *csvMapping) parseTimestamp(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	switch m.timestampFormat {
+	case "rfc3339":
+		return time.Parse(time.RFC3339, value)
+	case "unix", "unixms":
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if m.timestampFormat == "unixms" {
+			return time.UnixMilli(int64(number)), nil
+		}
+		return time.UnixMicro(int64(number * 1e6)), nil
+	default:
+		return time.ParseInLocation(m.timestampFormat, value, m.location)
+	}
+}
+
+// readingOf turns a row into a reading, or reports why it cannot.
+func (m *csvMapping) readingOf(idx *csvIndexes, record []string) (CreateSensorDataRequest, error) {
+	cell := func(i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	reading := CreateSensorDataRequest{DeviceId: m.deviceId}
+	if reading.DeviceId == "" {
+		reading.DeviceId = cell(idx.device)
+	}
+
+	timestamp, err := m.parseTimestamp(cell(idx.timestamp))
+	if err != nil {
+		return reading, fmt.Errorf("invalid timestamp %q", cell(idx.timestamp))
+	}
+	reading.Timestamp = timestamp
+
+	if labels := cell(idx.labels); labels != "" {
+		if err := json.Unmarshal([]byte(labels), &reading.Labels); err != nil {
+			return reading, errors.New("labels must be a JSON object of strings")
+		}
+	}
+
+	if idx.metrics != nil {
+		reading.Metrics = make(map[string]json.RawMessage, len(idx.metrics))
+		for i, metric := range idx.metrics {
+			// Loggers leave a cell empty when a channel has no sample.
+			if value := cell(i); value != "" {
+				reading.Metrics[metric] = rawCSVValue(value, "")
+				if unit, ok := m.units[metric]; ok {
+					if reading.Units == nil {
+						reading.Units = make(map[string]string)
+					}
+					reading.Units[metric] = unit
+				}
+			}
+		}
+		if len(reading.Metrics) == 0 {
+			return reading, errors.New("row has no values")
+		}
+		return reading, nil
+	}
+
+	reading.MetricName = cell(idx.metric)
+	reading.ValueType = model.ValueType(cell(idx.valueType))
+	reading.Unit = cell(idx.unit)
+	reading.Metricvalue = rawCSVValue(cell(idx.value), reading.ValueType)
+
+	return reading, nil
+}
+
+// rawCSVValue converts a cell into the JSON value ingest expects. Strings
+// are exported unquoted, so cells are only taken as JSON when they hold a
+// number, a boolean, an object or the given type says so.
+func rawCSVValue(value string, valueType model.ValueType) json.RawMessage {
+	quoted, _ := json.Marshal(value)
+	switch valueType {
+	case model.ValueString:
+		return quoted
+	case "":
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return json.RawMessage(value)
+		}
+		if value == "true" || value == "false" || strings.HasPrefix(value, "{") {
+			return json.RawMessage(value)
+		}
+		return quoted
+	default:
+		return json.RawMessage(value)
+	}
+}
+
+// ImportSensorData stores the rows of a CSV file, sent as the body or as
+// the file field of a multipart form, in batches as it is read. Rows that
+// fail are listed by row number in the report; the others are stored.
+func (h *SensorDataHandler) ImportSensorData(w http.ResponseWriter, r *http.Request) {
+	mapping, err := parseCSVMapping(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Large files upload for longer than the server's read and write
+	// timeouts.
+	clearDeadlines(w)
+
+	body, err := csvBody(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reader := csv.NewReader(body)
+	reader.Comma = mapping.delimiter
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid CSV header: %v", err), http.StatusBadRequest)
+		return
+	}
+	idx, err := mapping.indexes(header)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := ImportSensorDataResponse{Message: "Sensor data imported successfully", Status: "success"}
+	addError := func(importError ImportError) {
+		response.ErrorCount++
+		if len(response.Errors) < maxImportErrors {
+			response.Errors = append(response.Errors, importError)
+		}
+	}
+
+	var readings []CreateSensorDataRequest
+	var rows []int
+	flush := func() error {
+		if len(readings) == 0 {
+			return nil
+		}
+		err := h.importBatch(r.Context(), readings, rows, &response, addError)
+		readings, rows = readings[:0], rows[:0]
+		return err
+	}
+
+	row := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		row++
+		if err != nil {
+			var parseError *csv.ParseError
+			if !errors.As(err, &parseError) {
+				http.Error(w, fmt.Sprintf("Failed to read CSV after %d rows: %v", response.Rows, err), http.StatusBadRequest)
+				return
+			}
+			response.Rows++
+			addError(ImportError{Row: row, Error: parseError.Err.Error()})
+			continue
+		}
+		response.Rows++
+
+		reading, err := mapping.readingOf(idx, record)
+		if err != nil {
+			addError(ImportError{Row: row, Error: err.Error()})
+			continue
+		}
+		readings = append(readings, reading)
+		rows = append(rows, row)
+
+		if len(readings) >= importBatchSize {
+			if err := flush(); err != nil {
+				http.Error(w, fmt.Sprintf("Failed to import sensor data after %d rows: %v", response.Rows, err), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to import sensor data after %d rows: %v", response.Rows, err), http.StatusInternalServerError)
+		return
+	}
+
+	if response.ErrorCount > 0 {
+		response.Message = "Sensor data partially imported"
+		response.Status = "partial"
+	}
+	if response.Accepted+response.Deduplicated == 0 {
+		response.Message = "No valid sensor data in file"
+		response.Status = "error"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+	log.Printf("Imported %d CSV rows, %d readings accepted", response.Rows, response.Accepted)
+}
+
+func (h *SensorDataHandler) importBatch(ctx context.Context, readings []CreateSensorDataRequest, rows []int, response *ImportSensorDataResponse, addError func(ImportError)) error {
+	status, result := h.IngestReadings(ctx, readings)
+	if status == http.StatusInternalServerError {
+		return errors.New(result.Message)
+	}
+
+	response.Accepted += result.Accepted
+	response.Deduplicated += result.Deduplicated
+	response.Flagged += result.Flagged
+	for _, ingestError := range result.Errors {
+		addError(ImportError{Row: rows[ingestError.Reading], Metric: ingestError.Metric, Error: ingestError.Error})
+	}
+
+	return nil
+}
+
+// csvBody returns the uploaded file without reading it into memory.
+func csvBody(r *http.Request) (io.Reader, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, nil
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, errors.New("multipart form has no file field")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+	}
+}
+
+// ExportSensorData streams the readings matched by the query parameters of
+// /sensor-data/query as CSV, in time order and a page at a time. limit is
+// optional and unbounded by default.
+func (h *SensorDataHandler) ExportSensorData(w http.ResponseWriter, r *http.Request) {
+	format := valueOr(r.URL.Query().Get("format"), "csv")
+	if format != "csv" {
+		http.Error(w, fmt.Sprintf("unsupported format %q", format), http.StatusBadRequest)
+		return
+	}
+
+	q, err := parseSensorDataQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Large exports outlive the server's write timeout, and an expired read
+	// deadline would cancel the request's context.
+	clearDeadlines(w)
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="sensor-data.csv"`)
+	writer := csv.NewWriter(w)
+	writer.Write(csvColumns)
+
+	exported := 0
+	err = h.sensorDataService.ExportSensorData(r.Context(), q, func(sensorDataList []*model.SensorData) error {
+		for _, sensorData := range sensorDataList {
+			if err := writer.Write(csvRecord(sensorData)); err != nil {
+				return err
+			}
+		}
+		exported += len(sensorDataList)
+		writer.Flush()
+		return writer.Error()
+	})
+	writer.Flush()
+	if err != nil {
+		// The status is sent with the first page; all that is left is to
+		// cut the file short.
+		log.Printf("CSV export stopped after %d readings: %v", exported, err)
+	}
+}
+
+// clearDeadlines lifts the server's read and write timeouts for the rest of
+// the request.
+func clearDeadlines(w http.ResponseWriter) {
+	controller := http.NewResponseController(w)
+	controller.SetReadDeadline(time.Time{})
+	controller.SetWriteDeadline(time.Time{})
+}
+
+func csvRecord(sensorData *model.SensorData) []string {
+	valueType := valueTypeOf(sensorData)
+
+	var value string
+	switch valueType {
+	case model.ValueNumber:
+		value = strconv.FormatFloat(sensorData.MetricValue, 'g', -1, 64)
+	case model.ValueString:
+		json.Unmarshal(sensorData.RawValue, &value)
+	default:
+		value = string(sensorData.RawValue)
+	}
+
+	var originalValue, labels string
+	if sensorData.OriginalValue != nil {
+		originalValue = strconv.FormatFloat(*sensorData.OriginalValue, 'g', -1, 64)
+	}
+	if len(sensorData.Labels) > 0 {
+		text, _ := json.Marshal(sensorData.Labels)
+		labels = string(text)
+	}
+
+	return []string{
+		strconv.FormatInt(sensorData.Id, 10),
+		sensorData.DeviceId,
+		sensorData.MetricName,
+		string(valueType),
+		value,
+		sensorData.Unit,
+		sensorData.OriginalUnit,
+		originalValue,
+		sensorData.Timestamp.UTC().Format(time.RFC3339Nano),
+		sensorData.Violation,
+		labels,
+	}
+}
@@ -2,17 +2,36 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"iot-platform/internal/model"
+	"iot-platform/internal/repository"
 	"iot-platform/internal/service"
 	"net/http"
 	"strconv"
 	"time"
 )
 
+// CreateDeviceRequest may set state to provisioned; devices are active
+// otherwise.
 type CreateDeviceRequest struct {
-	Name   string `json:"name"`
-	Kind   string `json:"kind"`
-	ApiKey string `json:"apiKey"`
+	Name   string            `json:"name"`
+	Kind   string            `json:"kind"`
+	ApiKey string            `json:"apiKey"`
+	State  model.DeviceState `json:"state"`
+}
+
+// RegisterCertificateRequest holds a PEM encoded client certificate.
+type RegisterCertificateRequest struct {
+	Certificate string `json:"certificate"`
+}
+
+type ListCertificatesResponse struct {
+	Certificates []*model.DeviceCertificate `json:"certificates"`
+}
+
+type ChangeDeviceStateRequest struct {
+	State model.DeviceState `json:"state"`
 }
 
 type CreateDeviceResponse struct {
@@ -26,6 +45,8 @@ type DeviceResponse struct {
 	Name      string `json:"name"`
 	Kind      string `json:"kind"`
 	ApiKey    string `json:"apiKey"`
+	State     string `json:"state"`
+	DeletedAt string `json:"deletedAt,omitempty"`
 	CreatedAt string `json:"createdAt"`
 	UpdatedAt string `json:"updatedAt"`
 }
@@ -37,14 +58,20 @@ type ListDeviceResponse struct {
 }
 
 func toUserResponse(device *model.Device) *DeviceResponse {
-	return &DeviceResponse{
+	response := &DeviceResponse{
 		Id:        device.Id,
 		Name:      device.Name,
 		Kind:      device.Kind,
 		ApiKey:    device.ApiKey,
+		State:     string(device.State),
 		CreatedAt: device.CreatedAt.Format(time.RFC3339),
 		UpdatedAt: device.UpdatedAt.Format(time.RFC3339),
 	}
+	if device.DeletedAt != nil {
+		response.DeletedAt = device.DeletedAt.Format(time.RFC3339)
+	}
+
+	return response
 }
 
 type DeviceHandler struct {
@@ -73,8 +100,13 @@ func (h *DeviceHandler) CreateDevice(w http.ResponseWriter, r *http.Request) {
 		Name:   req.Name,
 		Kind:   req.Kind,
 		ApiKey: req.ApiKey,
+		State:  req.State,
 	}
 	deviceId, err := h.service.CreateDevice(r.Context(), newDevice)
+	if errors.Is(err, service.ErrInvalidTransition) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "failed to create device", http.StatusInternalServerError)
 		return
@@ -89,7 +121,18 @@ func (h *DeviceHandler) CreateDevice(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// ListDevices lists live devices, only those in ?state= when given, or with
+// ?deleted=true the soft-deleted ones.
 func (h *DeviceHandler) ListDevices(w http.ResponseWriter, r *http.Request) {
+	filter := model.DeviceFilter{
+		State:   model.DeviceState(r.URL.Query().Get("state")),
+		Deleted: r.URL.Query().Get("deleted") == "true",
+	}
+	if filter.State != "" && !filter.State.Valid() {
+		http.Error(w, fmt.Sprintf("unknown state %q", filter.State), http.StatusBadRequest)
+		return
+	}
+
 	pageStr := r.URL.Query().Get("page")
 	pageSizeStr := r.URL.Query().Get("pageSize")
 
@@ -103,7 +146,7 @@ func (h *DeviceHandler) ListDevices(w http.ResponseWriter, r *http.Request) {
 		pageSize = 10
 	}
 
-	devices, err := h.service.FetchDevices(r.Context(), page, pageSize)
+	devices, err := h.service.FetchDevices(r.Context(), filter, page, pageSize)
 	if err != nil {
 		http.Error(w, "failed to fetch devices", http.StatusInternalServerError)
 		return
@@ -185,3 +228,97 @@ func (h *DeviceHandler) DeleteDevice(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// ChangeDeviceState moves a device through its lifecycle, e.g. suspending or
+// decommissioning it.
+func (h *DeviceHandler) ChangeDeviceState(w http.ResponseWriter, r *http.Request) {
+	var req ChangeDeviceStateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	device, err := h.service.ChangeDeviceState(r.Context(), r.PathValue("id"), req.State)
+	if errors.Is(err, service.ErrInvalidTransition) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "device not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toUserResponse(device))
+}
+
+// RestoreDevice brings back a soft-deleted device.
+func (h *DeviceHandler) RestoreDevice(w http.ResponseWriter, r *http.Request) {
+	device, err := h.service.RestoreDevice(r.Context(), r.PathValue("id"))
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "deleted device not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to restore device", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toUserResponse(device))
+}
+
+// RegisterCertificate lets the device authenticate with a client
+// certificate over mutual TLS.
+func (h *DeviceHandler) RegisterCertificate(w http.ResponseWriter, r *http.Request) {
+	var req RegisterCertificateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	certificate, err := h.service.RegisterCertificate(r.Context(), r.PathValue("id"), []byte(req.Certificate))
+	if err != nil {
+		writeCertificateError(w, "failed to register certificate", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(certificate)
+}
+
+func (h *DeviceHandler) ListCertificates(w http.ResponseWriter, r *http.Request) {
+	certificates, err := h.service.FetchCertificates(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeCertificateError(w, "failed to fetch certificates", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ListCertificatesResponse{Certificates: certificates})
+}
+
+func (h *DeviceHandler) RevokeCertificate(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.RevokeCertificate(r.Context(), r.PathValue("id"), r.PathValue("fingerprint")); err != nil {
+		writeCertificateError(w, "failed to revoke certificate", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeCertificateError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidCertificate):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repository.ErrDuplicateCertificate):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, repository.ErrNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrCertificatesDisabled):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+	default:
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusInternalServerError)
+	}
+}
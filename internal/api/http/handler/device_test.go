@@ -0,0 +1,143 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"iot-platform/internal/api/http/handler"
+	"iot-platform/internal/database/sqlite/sqlitetest"
+	"iot-platform/internal/model"
+	"iot-platform/internal/repository"
+	"iot-platform/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDeviceHandler_Lifecycle(t *testing.T) {
+	repos := sqlitetest.NewRepositories(t)
+	h := handler.NewDeviceHandler(*service.NewDevicesService(repos.Devices))
+	sensorDataHandler := handler.NewSensorDataHandler(*service.NewSensorDataService(repos.SensorData, service.WithReadingValidator(service.NewDeviceStateValidator(repos.Devices))))
+
+	recorder := httptest.NewRecorder()
+	h.CreateDevice(recorder, httptest.NewRequest(http.MethodPost, "/devices", strings.NewReader(`{"name": "Boiler", "kind": "thermometer", "apiKey": "key-1", "state": "provisioned"}`)))
+	var created handler.CreateDeviceResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+
+	changeState := func(state string) (int, handler.DeviceResponse) {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/devices/"+created.Id+"/state", strings.NewReader(`{"state": "`+state+`"}`))
+		request.SetPathValue("id", created.Id)
+		h.ChangeDeviceState(recorder, request)
+		var response handler.DeviceResponse
+		if recorder.Code == http.StatusOK {
+			if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return recorder.Code, response
+	}
+	list := func(query string) []*handler.DeviceResponse {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		h.ListDevices(recorder, httptest.NewRequest(http.MethodGet, "/devices?"+query, nil))
+		var response handler.ListDeviceResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		return response.Devices
+	}
+
+	if code, _ := changeState("suspended"); code != http.StatusConflict {
+		t.Errorf("expected 409 suspending a provisioned device, got %d", code)
+	}
+	if code, device := changeState("active"); code != http.StatusOK || device.State != "active" {
+		t.Fatalf("expected the device to be activated, got %d %+v", code, device)
+	}
+	if code, _ := changeState("suspended"); code != http.StatusOK {
+		t.Fatalf("expected 200 suspending an active device, got %d", code)
+	}
+
+	if devices := list("state=suspended"); len(devices) != 1 || devices[0].Id != created.Id {
+		t.Errorf("expected the suspended device, got %+v", devices)
+	}
+	if devices := list("state=active"); len(devices) != 0 {
+		t.Errorf("expected no active devices, got %+v", devices)
+	}
+
+	recorder, response := postJSON(t, sensorDataHandler.CreateSensorData, `{"deviceId": "`+created.Id+`", "metrics": {"temperature": 21}}`)
+	if recorder.Code != http.StatusBadRequest || len(response.Errors) != 1 {
+		t.Errorf("expected readings from a suspended device to be refused, got %d %+v", recorder.Code, response)
+	}
+
+	recorder = httptest.NewRecorder()
+	h.DeleteDevice(recorder, httptest.NewRequest(http.MethodDelete, "/devices/"+created.Id+"?id="+created.Id, nil))
+	if devices := list(""); len(devices) != 0 {
+		t.Errorf("expected the deleted device to be hidden, got %+v", devices)
+	}
+	if devices := list("deleted=true"); len(devices) != 1 || devices[0].DeletedAt == "" {
+		t.Errorf("expected the deleted device, got %+v", devices)
+	}
+
+	restore := func() int {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/devices/"+created.Id+"/restore", nil)
+		request.SetPathValue("id", created.Id)
+		h.RestoreDevice(recorder, request)
+		return recorder.Code
+	}
+	if code := restore(); code != http.StatusOK {
+		t.Fatalf("expected 200 restoring the device, got %d", code)
+	}
+	if code := restore(); code != http.StatusNotFound {
+		t.Errorf("expected 404 restoring a live device, got %d", code)
+	}
+	if devices := list("state=suspended"); len(devices) != 1 {
+		t.Errorf("expected the restored device to keep its state, got %+v", devices)
+	}
+
+	recorder = httptest.NewRecorder()
+	h.ListDevices(recorder, httptest.NewRequest(http.MethodGet, "/devices?state=retired", nil))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown state, got %d", recorder.Code)
+	}
+}
+
+func TestDeviceStateValidator_DoesNotCacheFailures(t *testing.T) {
+	ctx := context.Background()
+	repos := sqlitetest.NewRepositories(t)
+	id, err := repos.Devices.SaveDevice(ctx, &model.Device{Name: "Boiler", Kind: "thermometer", ApiKey: "key-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	devices := &failingDevices{DevicesRepository: repos.Devices, err: errors.New("connection reset")}
+	validator := service.NewDeviceStateValidator(devices)
+	if err := validator.ValidateReading(ctx, &model.SensorData{DeviceId: id}); err == nil || errors.Is(err, service.ErrDeviceInactive) {
+		t.Fatalf("expected the lookup error, got %v", err)
+	}
+
+	devices.err = nil
+	if err := validator.ValidateReading(ctx, &model.SensorData{DeviceId: id}); err != nil {
+		t.Errorf("expected the device to be looked up again, got %v", err)
+	}
+	if err := validator.ValidateReading(ctx, &model.SensorData{DeviceId: "missing"}); !errors.Is(err, service.ErrDeviceInactive) {
+		t.Errorf("expected an unknown device to be refused, got %v", err)
+	}
+}
+
+type failingDevices struct {
+	repository.DevicesRepository
+	err error
+}
+
+func (f *failingDevices) FindDeviceById(ctx context.Context, id string) (*model.Device, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.DevicesRepository.FindDeviceById(ctx, id)
+}
@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iot-platform/internal/model"
+	"iot-platform/internal/repository"
+	"iot-platform/internal/service"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type DeviceKindRequest struct {
+	Name                     string                  `json:"name"`
+	Description              string                  `json:"description"`
+	Metrics                  []model.MetricSchema    `json:"metrics"`
+	ReportingIntervalSeconds int                     `json:"reportingIntervalSeconds"`
+	Enforcement              model.SchemaEnforcement `json:"enforcement"`
+}
+
+type DeviceKindResponse struct {
+	Name                     string                  `json:"name"`
+	Version                  int                     `json:"version"`
+	Description              string                  `json:"description"`
+	Metrics                  []model.MetricSchema    `json:"metrics"`
+	ReportingIntervalSeconds int                     `json:"reportingIntervalSeconds"`
+	Enforcement              model.SchemaEnforcement `json:"enforcement"`
+	CreatedAt                string                  `json:"createdAt"`
+}
+
+type ListDeviceKindsResponse struct {
+	DeviceKinds []*DeviceKindResponse `json:"deviceKinds"`
+	Page        int                   `json:"page,omitempty"`
+	PageSize    int                   `json:"pageSize,omitempty"`
+}
+
+func toDeviceKindResponse(kind *model.DeviceKind) *DeviceKindResponse {
+	return &DeviceKindResponse{
+		Name:                     kind.Name,
+		Version:                  kind.Version,
+		Description:              kind.Description,
+		Metrics:                  kind.Metrics,
+		ReportingIntervalSeconds: kind.ReportingIntervalSeconds,
+		Enforcement:              kind.Enforcement,
+		CreatedAt:                kind.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func toDeviceKindsResponse(kinds []*model.DeviceKind) []*DeviceKindResponse {
+	responses := make([]*DeviceKindResponse, len(kinds))
+	for i, kind := range kinds {
+		responses[i] = toDeviceKindResponse(kind)
+	}
+
+	return responses
+}
+
+type DeviceKindHandler struct {
+	service service.DeviceKindService
+}
+
+func NewDeviceKindHandler(service service.DeviceKindService) *DeviceKindHandler {
+	return &DeviceKindHandler{
+		service: service,
+	}
+}
+
+func (h *DeviceKindHandler) CreateDeviceKind(w http.ResponseWriter, r *http.Request) {
+	var req DeviceKindRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	kind := toDeviceKind(req)
+	if err := h.service.CreateDeviceKind(r.Context(), kind); err != nil {
+		writeDeviceKindError(w, "failed to create device kind", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(toDeviceKindResponse(kind))
+}
+
+func (h *DeviceKindHandler) ListDeviceKinds(w http.ResponseWriter, r *http.Request) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err := strconv.Atoi(r.URL.Query().Get("pageSize"))
+	if err != nil || pageSize < 1 {
+		pageSize = 10
+	}
+
+	kinds, err := h.service.FetchDeviceKinds(r.Context(), page, pageSize)
+	if err != nil {
+		http.Error(w, "failed to fetch device kinds", http.StatusInternalServerError)
+		return
+	}
+
+	response := ListDeviceKindsResponse{
+		DeviceKinds: toDeviceKindsResponse(kinds),
+		Page:        page,
+		PageSize:    pageSize,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetDeviceKind returns the latest version of a kind, or the one given by
+// ?version=.
+func (h *DeviceKindHandler) GetDeviceKind(w http.ResponseWriter, r *http.Request) {
+	version := 0
+	if v := r.URL.Query().Get("version"); v != "" {
+		var err error
+		version, err = strconv.Atoi(v)
+		if err != nil || version < 1 {
+			http.Error(w, "invalid version", http.StatusBadRequest)
+			return
+		}
+	}
+
+	kind, err := h.service.FindDeviceKind(r.Context(), r.PathValue("name"), version)
+	if err != nil {
+		writeDeviceKindError(w, "failed to find device kind", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toDeviceKindResponse(kind))
+}
+
+func (h *DeviceKindHandler) ListDeviceKindVersions(w http.ResponseWriter, r *http.Request) {
+	kinds, err := h.service.FetchDeviceKindVersions(r.Context(), r.PathValue("name"))
+	if err != nil {
+		writeDeviceKindError(w, "failed to fetch device kind versions", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ListDeviceKindsResponse{DeviceKinds: toDeviceKindsResponse(kinds)})
+}
+
+// UpdateDeviceKind stores the request as a new version of the kind.
+func (h *DeviceKindHandler) UpdateDeviceKind(w http.ResponseWriter, r *http.Request) {
+	var req DeviceKindRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	kind := toDeviceKind(req)
+	if err := h.service.UpdateDeviceKind(r.Context(), r.PathValue("name"), kind); err != nil {
+		writeDeviceKindError(w, "failed to update device kind", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toDeviceKindResponse(kind))
+}
+
+func (h *DeviceKindHandler) DeleteDeviceKind(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.DeleteDeviceKind(r.Context(), r.PathValue("name")); err != nil {
+		writeDeviceKindError(w, "failed to delete device kind", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func toDeviceKind(req DeviceKindRequest) *model.DeviceKind {
+	return &model.DeviceKind{
+		Name:                     req.Name,
+		Description:              req.Description,
+		Metrics:                  req.Metrics,
+		ReportingIntervalSeconds: req.ReportingIntervalSeconds,
+		Enforcement:              req.Enforcement,
+	}
+}
+
+func writeDeviceKindError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidDeviceKind):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrDeviceKindExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, repository.ErrNotFound):
+		http.Error(w, "device kind not found", http.StatusNotFound)
+	default:
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusInternalServerError)
+	}
+}
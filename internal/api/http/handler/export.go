@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"iot-platform/internal/export"
+	"iot-platform/internal/model"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// ExportHandler runs Parquet export jobs and serves the files they write.
+type ExportHandler struct {
+	exporter *export.Exporter
+}
+
+type CreateExportRequest struct {
+	DeviceIds  []string  `json:"deviceIds"`
+	MetricName string    `json:"metric"`
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+}
+
+type ListExportsResponse struct {
+	Exports []*export.Manifest `json:"exports"`
+}
+
+func NewExportHandler(exporter *export.Exporter) *ExportHandler {
+	return &ExportHandler{exporter: exporter}
+}
+
+func (h *ExportHandler) CreateExport(w http.ResponseWriter, r *http.Request) {
+	var req CreateExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.MetricName != "" {
+		if err := model.ValidateMetricName(req.MetricName); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	manifest, err := h.exporter.Start(export.Request{
+		DeviceIds:  req.DeviceIds,
+		MetricName: req.MetricName,
+		From:       req.From,
+		To:         req.To,
+	})
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/exports/"+manifest.Id)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(manifest)
+}
+
+func (h *ExportHandler) ListExports(w http.ResponseWriter, r *http.Request) {
+	manifests, err := h.exporter.List()
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ListExportsResponse{Exports: manifests})
+}
+
+func (h *ExportHandler) GetExport(w http.ResponseWriter, r *http.Request) {
+	manifest, err := h.exporter.Get(r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(manifest)
+}
+
+func (h *ExportHandler) ResumeExport(w http.ResponseWriter, r *http.Request) {
+	manifest, err := h.exporter.Resume(r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(manifest)
+}
+
+// GetExportFile serves a file of an export by its path in the manifest.
+func (h *ExportHandler) GetExportFile(w http.ResponseWriter, r *http.Request) {
+	dir, err := h.exporter.Dir(r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	defer root.Close()
+
+	http.ServeFileFS(w, r, root.FS(), r.PathValue("path"))
+}
+
+func (h *ExportHandler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, export.ErrInvalidExport):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, export.ErrExportNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, export.ErrExportRunning), errors.Is(err, export.ErrExportCompleted):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("Export failed: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
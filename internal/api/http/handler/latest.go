@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"encoding/json"
+	"iot-platform/internal/service"
+	"net/http"
+	"strings"
+)
+
+// LatestHandler answers "what is the current reading?" from the last-value
+// table kept up to date on ingest, without reading any history.
+type LatestHandler struct {
+	devices           service.DeviceService
+	sensorDataService service.SensorDataService
+}
+
+// DeviceLatestResponse holds the newest reading of every metric of a
+// device, keyed by metric name.
+type DeviceLatestResponse struct {
+	DeviceId string                         `json:"deviceId"`
+	Metrics  map[string]*SensorDataResponse `json:"metrics"`
+}
+
+type FleetSnapshotResponse struct {
+	Metric     string                `json:"metric"`
+	SensorData []*SensorDataResponse `json:"sensorData"`
+}
+
+func NewLatestHandler(devices service.DeviceService, sensorDataService service.SensorDataService) *LatestHandler {
+	return &LatestHandler{
+		devices:           devices,
+		sensorDataService: sensorDataService,
+	}
+}
+
+func (h *LatestHandler) GetDeviceLatest(w http.ResponseWriter, r *http.Request) {
+	deviceId := r.PathValue("id")
+	if _, err := h.devices.FindDeviceById(r.Context(), deviceId); err != nil {
+		http.Error(w, "device not found", http.StatusNotFound)
+		return
+	}
+
+	sensorDataList, err := h.sensorDataService.LatestSensorData(r.Context(), deviceId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := DeviceLatestResponse{DeviceId: deviceId, Metrics: make(map[string]*SensorDataResponse)}
+	for _, sensorData := range sensorDataList {
+		response.Metrics[sensorData.MetricName] = toSensorData(sensorData)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetFleetSnapshot returns the newest reading of metric of every device.
+// labels, repeated or comma separated key=value pairs, keeps only readings
+// carrying all of them.
+func (h *LatestHandler) GetFleetSnapshot(w http.ResponseWriter, r *http.Request) {
+	metric := r.URL.Query().Get("metric")
+	if metric == "" {
+		http.Error(w, "metric is required", http.StatusBadRequest)
+		return
+	}
+
+	labels := make(map[string]string)
+	for _, pair := range splitList(r.URL.Query()["labels"]) {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			http.Error(w, "invalid labels, expected key=value", http.StatusBadRequest)
+			return
+		}
+		labels[key] = value
+	}
+
+	sensorDataList, err := h.sensorDataService.FleetSnapshot(r.Context(), metric, labels)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := FleetSnapshotResponse{Metric: metric, SensorData: []*SensorDataResponse{}}
+	for _, sensorData := range sensorDataList {
+		response.SensorData = append(response.SensorData, toSensorData(sensorData))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,86 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"iot-platform/internal/api/http/handler"
+	"iot-platform/internal/database/sqlite/sqlitetest"
+	"iot-platform/internal/model"
+	"iot-platform/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLatestHandler(t *testing.T) {
+	ctx := context.Background()
+	repos := sqlitetest.NewRepositories(t)
+	sensorDataService := service.NewSensorDataService(repos.SensorData)
+	h := handler.NewLatestHandler(*service.NewDevicesService(repos.Devices), *sensorDataService)
+
+	var deviceIds []string
+	for _, site := range []string{"a", "b"} {
+		deviceId, err := repos.Devices.SaveDevice(ctx, &model.Device{Name: "Boiler " + site, Kind: "thermometer", ApiKey: "key-" + site})
+		if err != nil {
+			t.Fatal(err)
+		}
+		deviceIds = append(deviceIds, deviceId)
+
+		now := time.Now().UTC().Truncate(time.Second)
+		readings := []*model.SensorData{
+			{DeviceId: deviceId, MetricName: "temperature", MetricValue: 20, Timestamp: now.Add(-time.Minute), Labels: map[string]string{"site": site}},
+			{DeviceId: deviceId, MetricName: "temperature", MetricValue: 21, Timestamp: now, Labels: map[string]string{"site": site}},
+			{DeviceId: deviceId, MetricName: "humidity", MetricValue: 40, Timestamp: now},
+		}
+		for _, reading := range readings {
+			if err := sensorDataService.CreateSensorData(ctx, reading); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/devices/"+deviceIds[0]+"/latest", nil)
+	request.SetPathValue("id", deviceIds[0])
+	h.GetDeviceLatest(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body)
+	}
+	var latest handler.DeviceLatestResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&latest); err != nil {
+		t.Fatal(err)
+	}
+	if len(latest.Metrics) != 2 || latest.Metrics["temperature"] == nil || latest.Metrics["temperature"].MetricValue != 21.0 {
+		t.Errorf("expected the newest value of both metrics, got %+v", latest.Metrics)
+	}
+
+	recorder = httptest.NewRecorder()
+	request = httptest.NewRequest(http.MethodGet, "/devices/missing/latest", nil)
+	request.SetPathValue("id", "missing")
+	h.GetDeviceLatest(recorder, request)
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown device, got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	h.GetFleetSnapshot(recorder, httptest.NewRequest(http.MethodGet, "/devices/latest?metric=temperature&labels=site=b", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body)
+	}
+	var snapshot handler.FleetSnapshotResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.SensorData) != 1 || snapshot.SensorData[0].DeviceId != deviceIds[1] {
+		t.Errorf("expected only the device labelled site=b, got %+v", snapshot.SensorData)
+	}
+
+	for _, query := range []string{"", "?metric=temperature&labels=site"} {
+		recorder = httptest.NewRecorder()
+		h.GetFleetSnapshot(recorder, httptest.NewRequest(http.MethodGet, "/devices/latest"+query, nil))
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %q, got %d", query, recorder.Code)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iot-platform/internal/lineprotocol"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// maxWriteBodySize matches InfluxDB's default max-body-size.
+	maxWriteBodySize = 25 << 20
+	// deviceTag is the tag naming a point's device. Points without it are
+	// attributed to the device named by their measurement.
+	deviceTag = "deviceId"
+)
+
+type WriteErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Write accepts InfluxDB line protocol, as sent by Telegraf and the Influx
+// clients to /write. The device is the deviceId tag or else the
+// measurement; every field becomes a metric, prefixed with the measurement
+// when that does not name the device; the remaining tags become labels.
+//
+// Like InfluxDB it answers 204 when every point was written and 400 with
+// the reasons when some were not, having written the rest.
+func (h *SensorDataHandler) Write(w http.ResponseWriter, r *http.Request) {
+	precision, err := lineprotocol.ParsePrecision(r.URL.Query().Get("precision"))
+	if err != nil {
+		writeInfluxError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var body io.Reader = http.MaxBytesReader(w, r.Body, maxWriteBodySize)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			writeInfluxError(w, fmt.Sprintf("invalid gzip body: %v", err), http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		writeInfluxError(w, fmt.Sprintf("unable to read body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	points, parseErrors := lineprotocol.Parse(string(data), precision)
+	var messages []string
+	for _, parseError := range parseErrors {
+		messages = append(messages, parseError.Error())
+	}
+
+	// Points without a timestamp share the time the write was received.
+	now := time.Now()
+	readings := make([]CreateSensorDataRequest, 0, len(points))
+	for _, point := range points {
+		readings = append(readings, readingOf(point, now))
+	}
+
+	dropped, err := h.ingestAll(r.Context(), readings)
+	if err != nil {
+		writeInfluxError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(dropped) > 0 {
+		messages = append(messages, fmt.Sprintf("partial write: %s dropped=%d", dropped[0].Error, len(dropped)))
+	}
+	if len(messages) > 0 {
+		writeInfluxError(w, strings.Join(messages, "\n"), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func readingOf(point lineprotocol.Point, now time.Time) CreateSensorDataRequest {
+	reading := CreateSensorDataRequest{
+		DeviceId:  point.Measurement,
+		Metrics:   make(map[string]json.RawMessage, len(point.Fields)),
+		Timestamp: point.Time,
+	}
+	if reading.Timestamp.IsZero() {
+		reading.Timestamp = now
+	}
+
+	prefix := ""
+	if deviceId, ok := point.Tags[deviceTag]; ok {
+		reading.DeviceId = deviceId
+		prefix = point.Measurement + "."
+	}
+
+	for key, value := range point.Tags {
+		if key == deviceTag {
+			continue
+		}
+		if reading.Labels == nil {
+			reading.Labels = make(map[string]string, len(point.Tags))
+		}
+		reading.Labels[key] = value
+	}
+
+	for field, value := range point.Fields {
+		reading.Metrics[prefix+field], _ = json.Marshal(value)
+	}
+
+	return reading
+}
+
+// writeInfluxError answers with InfluxDB's error body and header.
+func writeInfluxError(w http.ResponseWriter, message string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Influxdb-Error", strings.ReplaceAll(message, "\n", "; "))
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(WriteErrorResponse{Error: message})
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"encoding/json"
+	"iot-platform/internal/connectivity"
+	"iot-platform/internal/service"
+	"net/http"
+)
+
+// PresenceHandler reports whether devices that check in without holding a
+// connection, such as CoAP devices, have been heard from recently.
+type PresenceHandler struct {
+	devices  service.DeviceService
+	presence *connectivity.Presence
+}
+
+type ListOnlineDevicesResponse struct {
+	Devices []string `json:"devices"`
+}
+
+func NewPresenceHandler(devices service.DeviceService, presence *connectivity.Presence) *PresenceHandler {
+	return &PresenceHandler{
+		devices:  devices,
+		presence: presence,
+	}
+}
+
+func (h *PresenceHandler) GetPresence(w http.ResponseWriter, r *http.Request) {
+	deviceId := r.PathValue("id")
+	if _, err := h.devices.FindDeviceById(r.Context(), deviceId); err != nil {
+		http.Error(w, "device not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.presence.Status(deviceId))
+}
+
+func (h *PresenceHandler) ListOnline(w http.ResponseWriter, r *http.Request) {
+	devices := h.presence.Online()
+	if devices == nil {
+		devices = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ListOnlineDevicesResponse{Devices: devices})
+}
@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iot-platform/internal/model"
+	"iot-platform/internal/repository"
+	"iot-platform/internal/service"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// EnrollmentTokenRequest creates a token for devices of Kind, attached to
+// AssetId when set. MaxUses defaults to 1 and ExpiresAt to never.
+type EnrollmentTokenRequest struct {
+	Kind      string     `json:"kind"`
+	AssetId   string     `json:"assetId"`
+	MaxUses   int        `json:"maxUses"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// EnrollmentTokenResponse carries the token itself only when it is created.
+type EnrollmentTokenResponse struct {
+	Id        string `json:"id"`
+	Token     string `json:"token,omitempty"`
+	Kind      string `json:"kind"`
+	AssetId   string `json:"assetId,omitempty"`
+	MaxUses   int    `json:"maxUses"`
+	Uses      int    `json:"uses"`
+	ExpiresAt string `json:"expiresAt,omitempty"`
+	RevokedAt string `json:"revokedAt,omitempty"`
+	CreatedAt string `json:"createdAt"`
+}
+
+type ListEnrollmentTokensResponse struct {
+	Tokens []*EnrollmentTokenResponse `json:"tokens"`
+}
+
+type ListProvisioningEventsResponse struct {
+	Events []*model.ProvisioningEvent `json:"events"`
+}
+
+// ProvisionRequest is sent by a device registering itself.
+type ProvisionRequest struct {
+	Token  string `json:"token"`
+	Serial string `json:"serial"`
+	Name   string `json:"name"`
+}
+
+// ProvisionResponse holds the credentials the device authenticates with from
+// now on.
+type ProvisionResponse struct {
+	DeviceId string `json:"deviceId"`
+	ApiKey   string `json:"apiKey"`
+	Kind     string `json:"kind"`
+	State    string `json:"state"`
+}
+
+func toEnrollmentTokenResponse(token *model.EnrollmentToken) *EnrollmentTokenResponse {
+	response := &EnrollmentTokenResponse{
+		Id:        token.Id,
+		Kind:      token.Kind,
+		AssetId:   token.AssetId,
+		MaxUses:   token.MaxUses,
+		Uses:      token.Uses,
+		CreatedAt: token.CreatedAt.Format(time.RFC3339),
+	}
+	if token.ExpiresAt != nil {
+		response.ExpiresAt = token.ExpiresAt.Format(time.RFC3339)
+	}
+	if token.RevokedAt != nil {
+		response.RevokedAt = token.RevokedAt.Format(time.RFC3339)
+	}
+
+	return response
+}
+
+type ProvisioningHandler struct {
+	service service.ProvisioningService
+}
+
+func NewProvisioningHandler(service service.ProvisioningService) *ProvisioningHandler {
+	return &ProvisioningHandler{
+		service: service,
+	}
+}
+
+func (h *ProvisioningHandler) CreateEnrollmentToken(w http.ResponseWriter, r *http.Request) {
+	var req EnrollmentTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	token := &model.EnrollmentToken{Kind: req.Kind, AssetId: req.AssetId, MaxUses: req.MaxUses, ExpiresAt: req.ExpiresAt}
+	secret, err := h.service.CreateEnrollmentToken(r.Context(), token)
+	if errors.Is(err, service.ErrInvalidProvisioning) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to create enrollment token", http.StatusInternalServerError)
+		return
+	}
+
+	response := toEnrollmentTokenResponse(token)
+	response.Token = secret
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *ProvisioningHandler) ListEnrollmentTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := h.service.FetchEnrollmentTokens(r.Context())
+	if err != nil {
+		http.Error(w, "failed to fetch enrollment tokens", http.StatusInternalServerError)
+		return
+	}
+
+	response := ListEnrollmentTokensResponse{Tokens: make([]*EnrollmentTokenResponse, len(tokens))}
+	for i, token := range tokens {
+		response.Tokens[i] = toEnrollmentTokenResponse(token)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *ProvisioningHandler) GetEnrollmentToken(w http.ResponseWriter, r *http.Request) {
+	token, err := h.service.FindEnrollmentToken(r.Context(), r.PathValue("id"))
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "enrollment token not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to find enrollment token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toEnrollmentTokenResponse(token))
+}
+
+// RevokeEnrollmentToken stops a token from provisioning more devices. Devices
+// it provisioned already are kept.
+func (h *ProvisioningHandler) RevokeEnrollmentToken(w http.ResponseWriter, r *http.Request) {
+	err := h.service.RevokeEnrollmentToken(r.Context(), r.PathValue("id"))
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "enrollment token not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to revoke enrollment token", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListProvisioningEvents returns the audit trail of provisioning attempts,
+// those with ?token= only when given, newest first.
+func (h *ProvisioningHandler) ListProvisioningEvents(w http.ResponseWriter, r *http.Request) {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		limit = 100
+	}
+
+	events, err := h.service.FetchProvisioningEvents(r.Context(), r.URL.Query().Get("token"), limit)
+	if err != nil {
+		http.Error(w, "failed to fetch provisioning events", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ListProvisioningEventsResponse{Events: events})
+}
+
+// Provision registers the calling device with an enrollment token and hands
+// it its credentials.
+func (h *ProvisioningHandler) Provision(w http.ResponseWriter, r *http.Request) {
+	var req ProvisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	device, err := h.service.ProvisionDevice(r.Context(), req.Token, req.Serial, req.Name, r.RemoteAddr)
+	switch {
+	case errors.Is(err, service.ErrInvalidProvisioning):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, repository.ErrTokenRejected):
+		http.Error(w, repository.ErrTokenRejected.Error(), http.StatusForbidden)
+		return
+	case errors.Is(err, repository.ErrDuplicateSerial):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf("failed to provision device: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ProvisionResponse{DeviceId: device.Id, ApiKey: device.ApiKey, Kind: device.Kind, State: string(device.State)})
+}
@@ -0,0 +1,93 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"iot-platform/internal/api/http/handler"
+	"iot-platform/internal/database/sqlite/sqlitetest"
+	"iot-platform/internal/model"
+	"iot-platform/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProvisioningHandler(t *testing.T) {
+	ctx := context.Background()
+	repos := sqlitetest.NewRepositories(t)
+	h := handler.NewProvisioningHandler(*service.NewProvisioningService(repos.Provisioning, repos.Assets))
+	deviceService := service.NewDevicesService(repos.Devices)
+
+	group := &model.Asset{Name: "Warehouse", Kind: "site"}
+	if err := repos.Assets.SaveAsset(ctx, group); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	h.CreateEnrollmentToken(recorder, httptest.NewRequest(http.MethodPost, "/provisioning/tokens", strings.NewReader(`{"kind": "thermometer", "assetId": "missing"}`)))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a missing asset, got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	h.CreateEnrollmentToken(recorder, httptest.NewRequest(http.MethodPost, "/provisioning/tokens", strings.NewReader(`{"kind": "thermometer", "assetId": "`+group.Id+`", "maxUses": 2}`)))
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", recorder.Code, recorder.Body)
+	}
+	var token handler.EnrollmentTokenResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&token); err != nil {
+		t.Fatal(err)
+	}
+	if token.Token == "" || token.MaxUses != 2 {
+		t.Fatalf("expected a token with two uses, got %+v", token)
+	}
+
+	provision := func(secret, serial string) (int, handler.ProvisionResponse) {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		h.Provision(recorder, httptest.NewRequest(http.MethodPost, "/provision", strings.NewReader(`{"token": "`+secret+`", "serial": "`+serial+`"}`)))
+		var response handler.ProvisionResponse
+		if recorder.Code == http.StatusCreated {
+			if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return recorder.Code, response
+	}
+
+	code, provisioned := provision(token.Token, "SN-1")
+	if code != http.StatusCreated || provisioned.Kind != "thermometer" || provisioned.State != "provisioned" {
+		t.Fatalf("expected the device to be provisioned, got %d %+v", code, provisioned)
+	}
+	if _, err := deviceService.Authenticate(ctx, provisioned.DeviceId, provisioned.ApiKey); err != nil {
+		t.Errorf("expected the issued credentials to authenticate, got %v", err)
+	}
+	if code, _ := provision(token.Token, "SN-1"); code != http.StatusConflict {
+		t.Errorf("expected 409 for a provisioned serial, got %d", code)
+	}
+	if code, _ := provision("wrong", "SN-2"); code != http.StatusForbidden {
+		t.Errorf("expected 403 for an unknown token, got %d", code)
+	}
+
+	recorder = httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodDelete, "/provisioning/tokens/"+token.Id, nil)
+	request.SetPathValue("id", token.Id)
+	h.RevokeEnrollmentToken(recorder, request)
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", recorder.Code)
+	}
+	if code, _ := provision(token.Token, "SN-2"); code != http.StatusForbidden {
+		t.Errorf("expected 403 for a revoked token, got %d", code)
+	}
+
+	recorder = httptest.NewRecorder()
+	h.ListProvisioningEvents(recorder, httptest.NewRequest(http.MethodGet, "/provisioning/events?token="+token.Id, nil))
+	var events handler.ListProvisioningEventsResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&events); err != nil {
+		t.Fatal(err)
+	}
+	if len(events.Events) != 3 || !strings.Contains(events.Events[0].Error, "revoked") || events.Events[2].DeviceId != provisioned.DeviceId {
+		t.Errorf("expected every attempt with the token to be audited, got %+v", events.Events)
+	}
+}
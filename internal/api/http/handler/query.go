@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iot-platform/internal/model"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// parseSensorDataQuery reads the filters shared by the sensor data query
+// endpoints:
+//
+//	deviceId  one or more device ids, repeated or comma separated
+//	asset     asset id, selecting the devices anywhere below it
+//	metric    metric name
+//	from, to  RFC 3339 time range, from inclusive and to exclusive
+//	type      value type
+//	min, max  numeric bounds, implying type=number
+//	eq        exact value, interpreted according to type
+//	unit      unit to convert numeric results to; min, max and eq are in it
+//	limit, offset
+func parseSensorDataQuery(values url.Values) (model.SensorDataQuery, error) {
+	var q model.SensorDataQuery
+
+	q.DeviceIds = splitList(values["deviceId"])
+	q.AssetId = values.Get("asset")
+	q.MetricName = values.Get("metric")
+
+	var err error
+	if q.From, err = parseTime(values.Get("from")); err != nil {
+		return q, fmt.Errorf("invalid from: %w", err)
+	}
+	if q.To, err = parseTime(values.Get("to")); err != nil {
+		return q, fmt.Errorf("invalid to: %w", err)
+	}
+
+	q.ValueType = model.ValueType(values.Get("type"))
+	if q.ValueType != "" && !q.ValueType.Valid() {
+		return q, fmt.Errorf("unknown type %q", q.ValueType)
+	}
+
+	if q.Min, err = parseOptionalFloat(values.Get("min")); err != nil {
+		return q, fmt.Errorf("invalid min: %w", err)
+	}
+	if q.Max, err = parseOptionalFloat(values.Get("max")); err != nil {
+		return q, fmt.Errorf("invalid max: %w", err)
+	}
+	q.Unit = values.Get("unit")
+	if (q.Min != nil || q.Max != nil || q.Unit != "") && !q.ValueType.Numeric() {
+		return q, errors.New("min, max and unit only apply to numbers")
+	}
+
+	if eq := values.Get("eq"); eq != "" {
+		if err := applyEquals(&q, eq); err != nil {
+			return q, fmt.Errorf("invalid eq: %w", err)
+		}
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		if q.Limit, err = strconv.Atoi(limit); err != nil || q.Limit < 1 {
+			return q, errors.New("invalid limit")
+		}
+	}
+	if offset := values.Get("offset"); offset != "" {
+		if q.Offset, err = strconv.Atoi(offset); err != nil || q.Offset < 0 {
+			return q, errors.New("invalid offset")
+		}
+	}
+
+	return q, nil
+}
+
+// applyEquals turns eq into a typed filter. Strings are matched as given;
+// geo points and JSON objects must be written as JSON.
+func applyEquals(q *model.SensorDataQuery, eq string) error {
+	var raw json.RawMessage
+	switch q.ValueType {
+	case "":
+		return errors.New("eq requires type")
+	case model.ValueString:
+		raw, _ = json.Marshal(eq)
+	default:
+		raw = json.RawMessage(eq)
+	}
+
+	valueType, number, canonical, err := model.ParseValue(raw, q.ValueType)
+	if err != nil {
+		return err
+	}
+
+	if valueType == model.ValueNumber {
+		q.Min, q.Max = &number, &number
+		return nil
+	}
+	q.Equals = canonical
+
+	return nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+func parseOptionalFloat(value string) (*float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
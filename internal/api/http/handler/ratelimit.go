@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"encoding/json"
+	"iot-platform/internal/model"
+	"iot-platform/internal/ratelimit"
+	"iot-platform/internal/service"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimitsResponse holds the counters of every limit.
+type RateLimitsResponse struct {
+	Devices   ratelimit.Stats      `json:"devices"`
+	Consumers ratelimit.Stats      `json:"consumers"`
+	Usage     []*model.TenantUsage `json:"usage"`
+}
+
+// setRateLimitHeaders describes a limit with the RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers, the latter in seconds.
+func setRateLimitHeaders(header http.Header, limit, remaining int64, reset time.Duration) {
+	header.Set("RateLimit-Limit", strconv.FormatInt(limit, 10))
+	header.Set("RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+	header.Set("RateLimit-Reset", strconv.FormatInt(ceilSeconds(reset), 10))
+}
+
+func setRetryAfter(header http.Header, retryAfter time.Duration) {
+	header.Set("Retry-After", strconv.FormatInt(max(ceilSeconds(retryAfter), 1), 10))
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
+
+// consumerOf describes who sent r. Only client certificates are verified,
+// by the TLS handshake; the limits check the rest.
+func consumerOf(r *http.Request) service.Consumer {
+	consumer := service.Consumer{
+		DeviceId: r.Header.Get(headerDeviceId),
+		ApiKey:   apiKeyFrom(r),
+		Address:  r.RemoteAddr,
+	}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		consumer.Certificate = r.TLS.PeerCertificates[0]
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		consumer.Address = host
+	}
+
+	return consumer
+}
+
+// RateLimitMiddleware limits the requests of each API consumer.
+type RateLimitMiddleware struct {
+	limits *service.ConsumerLimits
+}
+
+func NewRateLimitMiddleware(limits *service.ConsumerLimits) *RateLimitMiddleware {
+	return &RateLimitMiddleware{
+		limits: limits,
+	}
+}
+
+// Wrap refuses requests past the rate of their consumer with 429, and tells
+// every consumer where it stands in the RateLimit headers.
+func (m *RateLimitMiddleware) Wrap(next http.Handler) http.Handler {
+	if m.limits.Unlimited() {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		decision := m.limits.Take(r.Context(), consumerOf(r))
+		setRateLimitHeaders(w.Header(), int64(decision.Limit), int64(decision.Remaining), decision.Reset)
+		if decision.Limited > 0 {
+			setRetryAfter(w.Header(), decision.RetryAfter)
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+type RateLimitHandler struct {
+	limits    *service.IngestLimits
+	consumers *ratelimit.Limiter
+}
+
+func NewRateLimitHandler(limits *service.IngestLimits, consumers *ratelimit.Limiter) *RateLimitHandler {
+	return &RateLimitHandler{
+		limits:    limits,
+		consumers: consumers,
+	}
+}
+
+// GetRateLimits returns the counters of the device and consumer rate limits
+// of this instance, and today's usage of every tenant.
+func (h *RateLimitHandler) GetRateLimits(w http.ResponseWriter, r *http.Request) {
+	usage, err := h.limits.Usage(r.Context())
+	if err != nil {
+		http.Error(w, "failed to fetch usage", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RateLimitsResponse{
+		Devices:   h.limits.DeviceStats(),
+		Consumers: h.consumers.Stats(),
+		Usage:     usage,
+	})
+}
@@ -0,0 +1,252 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"iot-platform/internal/api/http/handler"
+	"iot-platform/internal/database/sqlite/sqlitetest"
+	"iot-platform/internal/model"
+	"iot-platform/internal/ratelimit"
+	"iot-platform/internal/service"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimits(t *testing.T) {
+	ctx := context.Background()
+	repos := sqlitetest.NewRepositories(t)
+	cameraId, err := repos.Devices.SaveDevice(ctx, &model.Device{Name: "Gate", Kind: "camera", ApiKey: "key-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	meterId, err := repos.Devices.SaveDevice(ctx, &model.Device{Name: "Meter", Kind: "meter", ApiKey: "key-2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	site := &model.Asset{Name: "Site"}
+	if err := repos.Assets.SaveAsset(ctx, site); err != nil {
+		t.Fatal(err)
+	}
+	room := &model.Asset{Name: "Room", ParentId: site.Id}
+	if err := repos.Assets.SaveAsset(ctx, room); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Assets.AttachDevice(ctx, room.Id, meterId); err != nil {
+		t.Fatal(err)
+	}
+
+	slow := ratelimit.Rate{PerSecond: 0.001, Burst: 2}
+	limits := service.NewIngestLimits(repos.Devices, service.NewAssetService(repos.Assets, repos.Devices), repos.Usage, ratelimit.NewLimiter(),
+		service.DeviceRates{Default: ratelimit.Rate{PerSecond: 1000, Burst: 1000}, Kinds: map[string]ratelimit.Rate{"camera": slow}},
+		service.TenantQuotas{Tenants: map[string]int64{site.Id: 3}})
+	sensorDataHandler := handler.NewSensorDataHandler(*service.NewSensorDataService(repos.SensorData, service.WithLimiter(limits)))
+
+	consumers := ratelimit.NewLimiter()
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /sensor-data/batch", sensorDataHandler.CreateSensorDataBatch)
+	mux.HandleFunc("GET /rate-limits", handler.NewRateLimitHandler(limits, consumers).GetRateLimits)
+	devices := &countingAuthenticator{Authenticator: service.NewDevicesService(repos.Devices)}
+	server := handler.NewRateLimitMiddleware(service.NewConsumerLimits(consumers, ratelimit.Rate{PerSecond: 0.001, Burst: 5}, devices)).Wrap(mux)
+
+	send := func(apiKey, deviceId string, readings int) (*httptest.ResponseRecorder, handler.CreateSensorDataResponse) {
+		t.Helper()
+		var batch handler.CreateSensorDataBatchRequest
+		for i := 0; i < readings; i++ {
+			batch.Readings = append(batch.Readings, handler.CreateSensorDataRequest{DeviceId: deviceId, MetricName: "count", Metricvalue: json.RawMessage("1")})
+		}
+		body, _ := json.Marshal(batch)
+		request := httptest.NewRequest(http.MethodPost, "/sensor-data/batch", strings.NewReader(string(body)))
+		request.Header.Set("X-Device-Id", deviceId)
+		request.Header.Set("X-Api-Key", apiKey)
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+
+		var response handler.CreateSensorDataResponse
+		json.NewDecoder(recorder.Body).Decode(&response)
+		return recorder, response
+	}
+
+	recorder, response := send("key-1", cameraId, 3)
+	if recorder.Code != http.StatusOK || response.Accepted != 2 || len(response.Errors) != 1 || response.Errors[0].Reading != 2 {
+		t.Fatalf("expected the camera's burst of 2 to get through, got %d %+v", recorder.Code, response)
+	}
+	if limit := recorder.Header().Get("RateLimit-Limit"); limit != "2" || recorder.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("expected the camera's limit in the headers, got %q %q", limit, recorder.Header().Get("RateLimit-Remaining"))
+	}
+	recorder, _ = send("key-1", cameraId, 1)
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 429 with Retry-After once the camera ran out, got %d %v", recorder.Code, recorder.Header())
+	}
+
+	if recorder, response := send("key-2", meterId, 2); recorder.Code != http.StatusOK || response.Accepted != 2 {
+		t.Fatalf("expected the meter's readings to get through, got %d %+v", recorder.Code, response)
+	}
+	recorder, response = send("key-2", meterId, 2)
+	if recorder.Code != http.StatusTooManyRequests || len(response.Errors) != 2 || !strings.Contains(response.Errors[0].Error, "quota") {
+		t.Errorf("expected the site's quota to refuse the readings, got %d %+v", recorder.Code, response)
+	}
+	if remaining := recorder.Header().Get("RateLimit-Remaining"); remaining != "1" {
+		t.Errorf("expected 1 reading left of the quota, got %q", remaining)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/rate-limits", nil)
+	request.Header.Set("X-Api-Key", "operator")
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	var counters handler.RateLimitsResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&counters); err != nil {
+		t.Fatal(err)
+	}
+	if len(counters.Usage) != 1 || counters.Usage[0].TenantId != site.Id || counters.Usage[0].Readings != 2 || counters.Usage[0].Quota != 3 {
+		t.Errorf("unexpected usage: %+v", counters.Usage)
+	}
+	// Each device's first key lookup is also paid for by the address.
+	if counters.Devices.Limited != 2 || counters.Consumers.Taken != 7 || len(counters.Consumers.Buckets) != 3 {
+		t.Errorf("unexpected counters: %+v %+v", counters.Devices, counters.Consumers)
+	}
+	if devices.lookups != 2 {
+		t.Errorf("expected a key lookup per device, got %d", devices.lookups)
+	}
+
+	// Keys that do not authenticate a device count against the address,
+	// however many of them a client makes up.
+	for i := 0; i < 5; i++ {
+		request := httptest.NewRequest(http.MethodGet, "/rate-limits", nil)
+		request.Header.Set("X-Device-Id", cameraId)
+		request.Header.Set("X-Api-Key", "guess-"+strconv.Itoa(i))
+		recorder = httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+	}
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") == "" {
+		t.Errorf("expected the address's limit of 5 requests to be enforced, got %d", recorder.Code)
+	}
+	if stats := consumers.Stats(); len(stats.Buckets) != 3 {
+		t.Errorf("expected made-up keys to add no buckets, got %+v", stats.Buckets)
+	}
+	if devices.lookups != 4 {
+		t.Errorf("expected refused requests not to look keys up, got %d lookups", devices.lookups)
+	}
+}
+
+// countingAuthenticator counts the API keys looked up.
+type countingAuthenticator struct {
+	service.Authenticator
+	lookups int
+}
+
+func (a *countingAuthenticator) Authenticate(ctx context.Context, id string, apiKey string) (*model.Device, error) {
+	a.lookups++
+	return a.Authenticator.Authenticate(ctx, id, apiKey)
+}
+
+func TestRateLimits_RetriesDoNotUseQuota(t *testing.T) {
+	ctx := context.Background()
+	repos := sqlitetest.NewRepositories(t)
+	meterId, err := repos.Devices.SaveDevice(ctx, &model.Device{Name: "Meter", Kind: "meter", ApiKey: "key-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	site := &model.Asset{Name: "Site"}
+	if err := repos.Assets.SaveAsset(ctx, site); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Assets.AttachDevice(ctx, site.Id, meterId); err != nil {
+		t.Fatal(err)
+	}
+
+	limits := service.NewIngestLimits(repos.Devices, service.NewAssetService(repos.Assets, repos.Devices), repos.Usage, ratelimit.NewLimiter(),
+		service.DeviceRates{}, service.TenantQuotas{Tenants: map[string]int64{site.Id: 5}})
+	h := handler.NewSensorDataHandler(*service.NewSensorDataService(repos.SensorData, service.WithLimiter(limits)))
+
+	send := func(messageId string, metrics string) handler.CreateSensorDataResponse {
+		t.Helper()
+		request := httptest.NewRequest(http.MethodPost, "/sensor-data", strings.NewReader(`{"deviceId": "`+meterId+`", "metrics": `+metrics+`}`))
+		request.Header.Set("Idempotency-Key", messageId)
+		recorder := httptest.NewRecorder()
+		h.CreateSensorData(recorder, request)
+
+		var response handler.CreateSensorDataResponse
+		json.NewDecoder(recorder.Body).Decode(&response)
+		return response
+	}
+
+	for i := 0; i < 2; i++ {
+		if response := send("m-1", `{"power": 1, "energy": 2}`); response.Accepted+response.Deduplicated != 2 {
+			t.Fatalf("send %d: expected 2 readings stored or deduplicated, got %+v", i, response)
+		}
+	}
+	usage, err := limits.Usage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usage) != 1 {
+		t.Fatalf("expected the usage of 1 tenant, got %d", len(usage))
+	}
+	if usage[0].Readings != 2 {
+		t.Fatalf("expected the retry not to count, got a usage of %d", usage[0].Readings)
+	}
+
+	if response := send("m-2", `{"power": 1, "energy": 2, "voltage": 3}`); response.Accepted != 3 {
+		t.Errorf("expected the rest of the quota to take 3 readings, got %+v", response)
+	}
+}
+
+func TestIngestLimits_UnknownDevice(t *testing.T) {
+	repos := sqlitetest.NewRepositories(t)
+	limits := service.NewIngestLimits(repos.Devices, service.NewAssetService(repos.Assets, repos.Devices), repos.Usage, ratelimit.NewLimiter(),
+		service.DeviceRates{Default: ratelimit.Rate{PerSecond: 0.001, Burst: 1}}, service.TenantQuotas{})
+
+	// Unknown devices get the default rate; the repository refuses their
+	// readings later.
+	reading := func() []*model.SensorData {
+		return []*model.SensorData{{DeviceId: "missing", MetricName: "temperature", MetricValue: 20}}
+	}
+	admission, err := limits.Admit(context.Background(), reading())
+	if err != nil || admission.Refused[0] != nil {
+		t.Fatalf("expected the reading to be admitted, got %+v, %v", admission, err)
+	}
+	admission, err = limits.Admit(context.Background(), reading())
+	if err != nil || !errors.Is(admission.Refused[0], service.ErrRateLimited) {
+		t.Errorf("expected the default rate to apply, got %+v, %v", admission, err)
+	}
+}
+
+func TestIngestLimits_RefundOnAdmissionDay(t *testing.T) {
+	ctx := context.Background()
+	repos := sqlitetest.NewRepositories(t)
+	meterId, err := repos.Devices.SaveDevice(ctx, &model.Device{Name: "Meter", Kind: "meter"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	site := &model.Asset{Name: "Site"}
+	if err := repos.Assets.SaveAsset(ctx, site); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Assets.AttachDevice(ctx, site.Id, meterId); err != nil {
+		t.Fatal(err)
+	}
+	limits := service.NewIngestLimits(repos.Devices, service.NewAssetService(repos.Assets, repos.Devices), repos.Usage, ratelimit.NewLimiter(),
+		service.DeviceRates{}, service.TenantQuotas{})
+
+	// Readings admitted just before midnight are refunded on the day they
+	// were counted, not the day the refund runs.
+	yesterday := time.Now().UTC().AddDate(0, 0, -1).Format(time.DateOnly)
+	if _, err := repos.Usage.AddUsage(ctx, site.Id, yesterday, 2, math.MaxInt64); err != nil {
+		t.Fatal(err)
+	}
+	readings := []*model.SensorData{{DeviceId: meterId, MetricName: "power", MetricValue: 1}}
+	if err := limits.Refund(ctx, &service.Admission{Day: yesterday}, readings); err != nil {
+		t.Fatal(err)
+	}
+
+	usage, err := repos.Usage.ListUsage(ctx, yesterday)
+	if err != nil || len(usage) != 1 || usage[0].Readings != 1 {
+		t.Errorf("expected a usage of 1 yesterday, got %+v, %v", usage, err)
+	}
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"iot-platform/internal/model"
+	"iot-platform/internal/promremote"
+	"iot-platform/internal/service"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxRemoteWriteBodySize bounds a compressed remote_write request.
+const maxRemoteWriteBodySize = 32 << 20
+
+// RemoteWriteHandler receives Prometheus remote_write requests, so that
+// Prometheus servers scraping device exporters can forward their samples.
+type RemoteWriteHandler struct {
+	devices    service.DeviceService
+	sensorData *SensorDataHandler
+}
+
+func NewRemoteWriteHandler(devices service.DeviceService, sensorData *SensorDataHandler) *RemoteWriteHandler {
+	return &RemoteWriteHandler{
+		devices:    devices,
+		sensorData: sensorData,
+	}
+}
+
+// Write stores every sample as a reading. The series' deviceId label, or
+// else its instance label, names the device and __name__ the metric, with
+// colons replaced by dots; the other labels are kept as reading labels.
+//
+// Samples of unknown devices and invalid samples are dropped and reported
+// with a 400, which Prometheus does not retry; the rest are stored.
+func (h *RemoteWriteHandler) Write(w http.ResponseWriter, r *http.Request) {
+	if strings.Contains(r.Header.Get("Content-Type"), "io.prometheus.write.v2.Request") {
+		http.Error(w, "remote write 2.0 is not supported, use prometheus.WriteRequest", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRemoteWriteBodySize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to read body: %v", err), http.StatusBadRequest)
+		return
+	}
+	series, err := promremote.Decode(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var readings []CreateSensorDataRequest
+	var dropped []string
+	known := make(map[string]bool)
+	for _, ts := range series {
+		name := ts.Label("__name__")
+		deviceLabel := "deviceId"
+		deviceId := ts.Label(deviceLabel)
+		if deviceId == "" {
+			deviceLabel = "instance"
+			deviceId = ts.Label(deviceLabel)
+		}
+
+		if name == "" || deviceId == "" {
+			dropped = append(dropped, fmt.Sprintf("series %q has no __name__ and deviceId or instance labels", name))
+			continue
+		}
+		exists, ok := known[deviceId]
+		if !ok {
+			_, err := h.devices.FindDeviceById(r.Context(), deviceId)
+			exists = err == nil
+			known[deviceId] = exists
+		}
+		if !exists {
+			dropped = append(dropped, fmt.Sprintf("unknown device %q", deviceId))
+			continue
+		}
+
+		var labels map[string]string
+		for _, label := range ts.Labels {
+			if label.Name == "__name__" || label.Name == deviceLabel {
+				continue
+			}
+			if labels == nil {
+				labels = make(map[string]string, len(ts.Labels))
+			}
+			labels[label.Name] = label.Value
+		}
+
+		metricName := strings.ReplaceAll(name, ":", ".")
+		for _, sample := range ts.Samples {
+			if promremote.IsStaleMarker(sample.Value) {
+				continue
+			}
+			if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+				dropped = append(dropped, fmt.Sprintf("%s: value %v is not a number", metricName, sample.Value))
+				continue
+			}
+
+			value, _ := json.Marshal(sample.Value)
+			readings = append(readings, CreateSensorDataRequest{
+				DeviceId:    deviceId,
+				MetricName:  metricName,
+				Metricvalue: value,
+				ValueType:   model.ValueNumber,
+				Labels:      labels,
+				Timestamp:   time.UnixMilli(sample.Timestamp),
+			})
+		}
+	}
+
+	ingestErrors, err := h.sensorData.ingestAll(r.Context(), readings)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, ingestError := range ingestErrors {
+		dropped = append(dropped, fmt.Sprintf("%s: %s", ingestError.Metric, ingestError.Error))
+	}
+
+	if len(dropped) > 0 {
+		http.Error(w, fmt.Sprintf("partial write: %s dropped=%d", dropped[0], len(dropped)), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
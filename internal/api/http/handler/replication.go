@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iot-platform/internal/model"
+	"iot-platform/internal/service"
+	"log"
+	"net/http"
+)
+
+type ReplicationChangesRequest struct {
+	SourceId string          `json:"sourceId"`
+	AfterSeq int64           `json:"afterSeq"`
+	Changes  []*model.Change `json:"changes"`
+}
+
+type ReplicationChangesResponse struct {
+	LastSeq int64 `json:"lastSeq"`
+}
+
+type ReplicationHandler struct {
+	replicationService service.ReplicationService
+	token              string
+}
+
+func NewReplicationHandler(replicationService service.ReplicationService, token string) *ReplicationHandler {
+	return &ReplicationHandler{
+		replicationService: replicationService,
+		token:              token,
+	}
+}
+
+// ReceiveChanges applies the changes an edge instance pushed. Without a
+// token every push is refused.
+func (h *ReplicationHandler) ReceiveChanges(w http.ResponseWriter, r *http.Request) {
+	if h.token == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+h.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var request ReplicationChangesRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if request.SourceId == "" {
+		http.Error(w, "Source ID is required", http.StatusBadRequest)
+		return
+	}
+
+	lastSeq, err := h.replicationService.ReceiveChanges(r.Context(), request.SourceId, request.AfterSeq, request.Changes)
+	status := http.StatusOK
+	if errors.Is(err, service.ErrReplicationGap) {
+		status = http.StatusConflict
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to apply changes: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ReplicationChangesResponse{LastSeq: lastSeq})
+	log.Printf("Replication from %s at seq %d", request.SourceId, lastSeq)
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iot-platform/internal/model"
+	"iot-platform/internal/senml"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// senmlMediaType returns the SenML media type of the request body, or ""
+// when the body is not SenML.
+func senmlMediaType(r *http.Request) string {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+
+	switch mediaType {
+	case senml.MediaTypeJSON, senml.MediaTypeCBOR:
+		return mediaType
+	default:
+		return ""
+	}
+}
+
+// ingestSenML ingests a SenML pack, one reading per record. ?deviceId=
+// names the device when the record names do not.
+func (h *SensorDataHandler) ingestSenML(w http.ResponseWriter, r *http.Request, mediaType string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	pack, err := senml.Decode(mediaType, body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(pack) > maxBatchSize {
+		http.Error(w, fmt.Sprintf("A batch must contain between 1 and %d readings", maxBatchSize), http.StatusBadRequest)
+		return
+	}
+
+	records, err := senml.Resolve(pack, time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid SenML pack: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	h.ingest(w, r, SenMLReadings(records, r.URL.Query().Get("deviceId")))
+}
+
+// SenMLReadings turns resolved SenML records into readings. A record's
+// name is "<deviceId>:<metric>" or "<deviceId>/<metric>", typically a base
+// name identifying the device followed by the metric. A non-empty deviceId
+// names the device of every record instead, leaving only the part after the
+// last separator as the metric.
+func SenMLReadings(records []senml.Resolved, deviceId string) []CreateSensorDataRequest {
+	readings := make([]CreateSensorDataRequest, len(records))
+	for i, record := range records {
+		device, metric := "", record.Name
+		if separator := strings.LastIndexAny(record.Name, ":/"); separator >= 0 {
+			device, metric = record.Name[:separator], record.Name[separator+1:]
+		}
+		if deviceId != "" {
+			device = deviceId
+		}
+
+		reading := CreateSensorDataRequest{
+			DeviceId:   device,
+			MetricName: metric,
+			Timestamp:  record.Time,
+		}
+		switch {
+		case record.Value != nil:
+			reading.Metricvalue, _ = json.Marshal(*record.Value)
+			reading.ValueType = model.ValueNumber
+			reading.Unit = record.Unit
+		case record.StringValue != nil:
+			reading.Metricvalue, _ = json.Marshal(*record.StringValue)
+			reading.ValueType = model.ValueString
+		case record.BoolValue != nil:
+			reading.Metricvalue, _ = json.Marshal(*record.BoolValue)
+			reading.ValueType = model.ValueBool
+		case record.DataValue != nil:
+			reading.Metricvalue, _ = json.Marshal(base64.RawURLEncoding.EncodeToString(record.DataValue))
+			reading.ValueType = model.ValueString
+		default:
+			reading.Metricvalue, _ = json.Marshal(*record.Sum)
+			reading.ValueType = model.ValueNumber
+			reading.Unit = record.Unit
+		}
+		readings[i] = reading
+	}
+
+	return readings
+}
@@ -3,11 +3,14 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"iot-platform/internal/model"
+	"iot-platform/internal/repository"
 	"iot-platform/internal/service"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -17,25 +20,76 @@ type SensorDataHandler struct {
 	sensorDataService service.SensorDataService
 }
 
+// CreateSensorDataRequest carries either a single metricName/metricValue pair
+// or several metrics sampled at the same instant, e.g.
+// {"deviceId": "...", "metrics": {"temperature": 21.3, "humidity": 40}}.
+//
+// Values may be numbers, booleans, strings, geo points ({"lat", "lon"}) or
+// small JSON objects. The type is inferred unless valueType says otherwise.
+// Numbers may carry a unit, given by unit or, per metric, by units; readings
+// in a known unit are stored in the canonical unit of its dimension. Labels
+// are attached to every metric of the reading.
 type CreateSensorDataRequest struct {
-	DeviceId    string  `json:"deviceId"`
-	MetricName  string  `json:"metricName"`
-	Metricvalue float64 `json:"metricValue"`
+	DeviceId    string                     `json:"deviceId"`
+	MetricName  string                     `json:"metricName"`
+	Metricvalue json.RawMessage            `json:"metricValue"`
+	ValueType   model.ValueType            `json:"valueType"`
+	Unit        string                     `json:"unit"`
+	Metrics     map[string]json.RawMessage `json:"metrics"`
+	Units       map[string]string          `json:"units"`
+	Labels      map[string]string          `json:"labels"`
+	Timestamp   time.Time                  `json:"timestamp"`
+	MessageId   string                     `json:"messageId"`
+}
+
+type CreateSensorDataBatchRequest struct {
+	Readings []CreateSensorDataRequest `json:"readings"`
+}
+
+// IngestError explains why a reading, or one metric of it, was rejected.
+// Reading is the index of the reading in a batch and 0 otherwise.
+type IngestError struct {
+	Reading int    `json:"reading"`
+	Metric  string `json:"metric,omitempty"`
+	Error   string `json:"error"`
 }
 
 type CreateSensorDataResponse struct {
+	Message      string        `json:"message"`
+	Status       string        `json:"status"`
+	Accepted     int           `json:"accepted"`
+	Deduplicated int           `json:"deduplicated"`
+	Flagged      int           `json:"flagged"`
+	Errors       []IngestError `json:"errors,omitempty"`
+
+	// limited is the limit readings were refused by, if any.
+	limited *service.LimitError
+}
+
+type DeleteSensorDataResponse struct {
 	Message string `json:"message"`
 	Status  string `json:"status"`
 }
 
-type DeleteSensorDataResponse CreateSensorDataResponse
+const (
+	// maxBatchSize bounds the number of readings in one batch request.
+	maxBatchSize = 5000
+	// maxMetricsPerReading bounds the metrics map of a single reading.
+	maxMetricsPerReading = 100
+)
 
 type SensorDataResponse struct {
-	Id          int64   `json:"id"`
-	DeviceId    string  `json:"deviceId"`
-	MetricName  string  `json:"metricName"`
-	MetricValue float64 `json:"metricValue"`
-	Timestamp   string  `json:"timestamp"`
+	Id            int64             `json:"id"`
+	DeviceId      string            `json:"deviceId"`
+	MetricName    string            `json:"metricName"`
+	ValueType     model.ValueType   `json:"valueType"`
+	MetricValue   any               `json:"metricValue"`
+	Unit          string            `json:"unit,omitempty"`
+	OriginalUnit  string            `json:"originalUnit,omitempty"`
+	OriginalValue *float64          `json:"originalValue,omitempty"`
+	Timestamp     string            `json:"timestamp"`
+	Violation     string            `json:"violation,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
 }
 
 type ListSensorDataResponse struct {
@@ -44,13 +98,32 @@ type ListSensorDataResponse struct {
 	PageSize   int                   `json:"pageSize"`
 }
 
+type QuerySensorDataResponse struct {
+	SensorData []*SensorDataResponse `json:"sensorData"`
+	Limit      int                   `json:"limit"`
+	Offset     int                   `json:"offset"`
+}
+
+type AggregateSensorDataResponse struct {
+	Func  string  `json:"func"`
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit,omitempty"`
+	Count int64   `json:"count"`
+}
+
 func toSensorData(device *model.SensorData) *SensorDataResponse {
 	return &SensorDataResponse{
-		Id:          device.Id,
-		DeviceId:    device.DeviceId,
-		MetricName:  device.MetricName,
-		MetricValue: device.MetricValue,
-		Timestamp:   device.Timestamp.Format(time.RFC3339),
+		Id:            device.Id,
+		DeviceId:      device.DeviceId,
+		MetricName:    device.MetricName,
+		ValueType:     valueTypeOf(device),
+		MetricValue:   device.Value(),
+		Unit:          device.Unit,
+		OriginalUnit:  device.OriginalUnit,
+		OriginalValue: device.OriginalValue,
+		Timestamp:     device.Timestamp.Format(time.RFC3339),
+		Violation:     device.Violation,
+		Labels:        device.Labels,
 	}
 }
 func NewSensorDataHandler(sensorDataService service.SensorDataService) *SensorDataHandler {
@@ -59,37 +132,266 @@ func NewSensorDataHandler(sensorDataService service.SensorDataService) *SensorDa
 	}
 }
 
+// CreateSensorData takes a reading as JSON, or a SenML pack when the
+// Content-Type is application/senml+json or application/senml+cbor.
 func (h *SensorDataHandler) CreateSensorData(w http.ResponseWriter, r *http.Request) {
+	if mediaType := senmlMediaType(r); mediaType != "" {
+		h.ingestSenML(w, r, mediaType)
+		return
+	}
+
 	var request CreateSensorDataRequest
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
 		return
 	}
 
-	if request.DeviceId == "" || request.MetricName == "" || request.Metricvalue <= 0 {
-		http.Error(w, "Device ID, Metric Name and Metric Value are required", http.StatusBadRequest)
+	// Clients that cannot put a message id in the body may send it as an
+	// Idempotency-Key header instead.
+	if request.MessageId == "" {
+		request.MessageId = r.Header.Get("Idempotency-Key")
+	}
+
+	h.ingest(w, r, []CreateSensorDataRequest{request})
+}
+
+func (h *SensorDataHandler) CreateSensorDataBatch(w http.ResponseWriter, r *http.Request) {
+	if mediaType := senmlMediaType(r); mediaType != "" {
+		h.ingestSenML(w, r, mediaType)
 		return
 	}
 
-	ctx := context.Background()
-	sensorData := &model.SensorData{
-		DeviceId:    request.DeviceId,
-		MetricName:  request.MetricName,
-		MetricValue: request.Metricvalue,
-		Timestamp:   time.Now(),
+	var request CreateSensorDataBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
 	}
 
-	if err := h.sensorDataService.CreateSensorData(ctx, sensorData); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create sensor data: %v", err), http.StatusInternalServerError)
+	if len(request.Readings) == 0 || len(request.Readings) > maxBatchSize {
+		http.Error(w, fmt.Sprintf("A batch must contain between 1 and %d readings", maxBatchSize), http.StatusBadRequest)
 		return
 	}
 
+	h.ingest(w, r, request.Readings)
+	log.Printf("Ingested batch of %d readings", len(request.Readings))
+}
+
+// ingest stores every valid metric of the given readings and reports the
+// invalid ones. The request only fails as a whole when nothing was valid.
+func (h *SensorDataHandler) ingest(w http.ResponseWriter, r *http.Request, readings []CreateSensorDataRequest) {
+	status, response := h.IngestReadings(r.Context(), readings)
+	if status == http.StatusInternalServerError {
+		http.Error(w, response.Message, status)
+		return
+	}
+	if response.limited != nil {
+		setRateLimitHeaders(w.Header(), response.limited.Limit, response.limited.Remaining, response.limited.Reset)
+		if status == http.StatusTooManyRequests {
+			setRetryAfter(w.Header(), response.limited.RetryAfter)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// IngestReadings does the work of ingest for any transport and returns the
+// HTTP status that describes the outcome.
+func (h *SensorDataHandler) IngestReadings(ctx context.Context, readings []CreateSensorDataRequest) (int, CreateSensorDataResponse) {
+	now := time.Now()
+
+	var sensorDataList []*model.SensorData
+	var ingestErrors []IngestError
+	// readingOf maps each entry of sensorDataList back to its reading.
+	var readingOf []int
+	signer, signed := signerFrom(ctx)
+	for i, reading := range readings {
+		if signed && reading.DeviceId == "" {
+			reading.DeviceId = signer
+		}
+		if signed && reading.DeviceId != signer {
+			ingestErrors = append(ingestErrors, IngestError{Reading: i, Error: "reading is not from the signing device"})
+			continue
+		}
+
+		list, errs := toSensorDataList(i, reading, now)
+		sensorDataList = append(sensorDataList, list...)
+		ingestErrors = append(ingestErrors, errs...)
+		for range list {
+			readingOf = append(readingOf, i)
+		}
+	}
+
 	response := CreateSensorDataResponse{
 		Message: "Sensor data created successfully",
 		Status:  "success",
+		Errors:  ingestErrors,
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+
+	if len(sensorDataList) == 0 {
+		response.Message = "No valid sensor data in request"
+		response.Status = "error"
+		return http.StatusBadRequest, response
+	}
+
+	result, err := h.sensorDataService.IngestSensorData(ctx, sensorDataList)
+	if err != nil {
+		response.Message = fmt.Sprintf("Failed to create sensor data after %d readings: %v", result.Accepted+result.Deduplicated, err)
+		response.Status = "error"
+		return http.StatusInternalServerError, response
+	}
+
+	limited := 0
+	for _, rejected := range result.Rejected {
+		response.Errors = append(response.Errors, IngestError{
+			Reading: readingOf[rejected.Index],
+			Metric:  sensorDataList[rejected.Index].MetricName,
+			Error:   rejected.Err.Error(),
+		})
+
+		var limitErr *service.LimitError
+		if errors.As(rejected.Err, &limitErr) {
+			limited++
+			if response.limited == nil || limitErr.RetryAfter > response.limited.RetryAfter {
+				response.limited = limitErr
+			}
+		}
+	}
+
+	response.Accepted = result.Accepted
+	response.Deduplicated = result.Deduplicated
+	response.Flagged = result.Flagged
+	if limited > 0 && limited == len(result.Rejected) && limited == len(sensorDataList) {
+		response.Message = "Rate limit or quota exceeded"
+		response.Status = "error"
+		return http.StatusTooManyRequests, response
+	}
+	if len(result.Rejected) == len(sensorDataList) {
+		response.Message = "No valid sensor data in request"
+		response.Status = "error"
+		return http.StatusBadRequest, response
+	}
+	if len(response.Errors) > 0 {
+		response.Message = "Sensor data partially created"
+		response.Status = "partial"
+	}
+
+	return http.StatusOK, response
+}
+
+// ingestAll ingests any number of readings in batches of at most
+// maxBatchSize and returns the errors of all of them, with Reading indexing
+// into readings. It stops at the first batch that fails as a whole.
+func (h *SensorDataHandler) ingestAll(ctx context.Context, readings []CreateSensorDataRequest) ([]IngestError, error) {
+	var ingestErrors []IngestError
+	for start := 0; start < len(readings); start += maxBatchSize {
+		end := min(start+maxBatchSize, len(readings))
+		status, response := h.IngestReadings(ctx, readings[start:end])
+		if status == http.StatusInternalServerError {
+			return ingestErrors, errors.New(response.Message)
+		}
+		for _, ingestError := range response.Errors {
+			ingestError.Reading += start
+			ingestErrors = append(ingestErrors, ingestError)
+		}
+	}
+
+	return ingestErrors, nil
+}
+
+// toSensorDataList expands a request into one row per metric, all sharing the
+// reading's timestamp. With a metrics map, each metric gets its own message
+// id derived from the reading's so that retries deduplicate per metric.
+func toSensorDataList(index int, request CreateSensorDataRequest, now time.Time) ([]*model.SensorData, []IngestError) {
+	if request.DeviceId == "" {
+		return nil, []IngestError{{Reading: index, Error: "deviceId is required"}}
+	}
+
+	timestamp := request.Timestamp
+	if timestamp.IsZero() {
+		timestamp = now
+	}
+	if timestamp.After(now.Add(model.MaxClockSkew)) {
+		return nil, []IngestError{{Reading: index, Error: "timestamp is in the future"}}
+	}
+
+	if request.Metrics == nil {
+		if request.MetricName == "" || request.Metricvalue == nil {
+			return nil, []IngestError{{Reading: index, Error: "metricName and metricValue, or metrics, are required"}}
+		}
+
+		sensorData, err := newSensorData(request.DeviceId, request.MetricName, request.Metricvalue, request.ValueType, request.Unit, timestamp)
+		if err != nil {
+			return nil, []IngestError{{Reading: index, Metric: request.MetricName, Error: err.Error()}}
+		}
+		sensorData.MessageId = request.MessageId
+		sensorData.Labels = request.Labels
+
+		return []*model.SensorData{sensorData}, nil
+	}
+
+	if request.MetricName != "" || request.Unit != "" {
+		return nil, []IngestError{{Reading: index, Error: "metricName and unit cannot be combined with metrics, use units instead"}}
+	}
+	if len(request.Metrics) == 0 || len(request.Metrics) > maxMetricsPerReading {
+		return nil, []IngestError{{Reading: index, Error: fmt.Sprintf("metrics must contain between 1 and %d entries", maxMetricsPerReading)}}
+	}
+
+	names := make([]string, 0, len(request.Metrics))
+	for name := range request.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sensorDataList []*model.SensorData
+	var ingestErrors []IngestError
+	for _, name := range names {
+		sensorData, err := newSensorData(request.DeviceId, name, request.Metrics[name], "", request.Units[name], timestamp)
+		if err != nil {
+			ingestErrors = append(ingestErrors, IngestError{Reading: index, Metric: name, Error: err.Error()})
+			continue
+		}
+		if request.MessageId != "" {
+			sensorData.MessageId = request.MessageId + "/" + name
+		}
+		sensorData.Labels = request.Labels
+		sensorDataList = append(sensorDataList, sensorData)
+	}
+
+	return sensorDataList, ingestErrors
+}
+
+func newSensorData(deviceId, metricName string, value json.RawMessage, hint model.ValueType, unit string, timestamp time.Time) (*model.SensorData, error) {
+	if err := model.ValidateMetricName(metricName); err != nil {
+		return nil, err
+	}
+
+	valueType, number, raw, err := model.ParseValue(value, hint)
+	if err != nil {
+		return nil, err
+	}
+	if unit != "" && valueType != model.ValueNumber {
+		return nil, errors.New("only numbers can have a unit")
+	}
+
+	return &model.SensorData{
+		DeviceId:    deviceId,
+		MetricName:  metricName,
+		ValueType:   valueType,
+		MetricValue: number,
+		RawValue:    raw,
+		Unit:        unit,
+		Timestamp:   timestamp,
+	}, nil
+}
+
+func valueTypeOf(sensorData *model.SensorData) model.ValueType {
+	if sensorData.ValueType == "" {
+		return model.ValueNumber
+	}
+
+	return sensorData.ValueType
 }
 
 func (h *SensorDataHandler) ListSensorData(w http.ResponseWriter, r *http.Request) {
@@ -188,3 +490,67 @@ func (h *SensorDataHandler) DeleteSensorData(w http.ResponseWriter, r *http.Requ
 	json.NewEncoder(w).Encode(response)
 	log.Printf("Sensor data with ID %s deleted successfully", sensorDataId)
 }
+
+func (h *SensorDataHandler) QuerySensorData(w http.ResponseWriter, r *http.Request) {
+	q, err := parseSensorDataQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Limit == 0 {
+		q.Limit = 1000
+	}
+
+	sensorDataList, err := h.sensorDataService.QuerySensorData(r.Context(), q)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "asset not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to query sensor data: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := QuerySensorDataResponse{
+		SensorData: make([]*SensorDataResponse, len(sensorDataList)),
+		Limit:      min(q.Limit, service.MaxQueryLimit),
+		Offset:     q.Offset,
+	}
+	for i, sensorData := range sensorDataList {
+		response.SensorData[i] = toSensorData(sensorData)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *SensorDataHandler) AggregateSensorData(w http.ResponseWriter, r *http.Request) {
+	q, err := parseSensorDataQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fn := model.AggregateFunc(r.URL.Query().Get("fn"))
+	aggregate, err := h.sensorDataService.AggregateSensorData(r.Context(), q, fn)
+	if errors.Is(err, service.ErrUnknownAggregate) || errors.Is(err, service.ErrNotNumeric) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "asset not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to aggregate sensor data: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := AggregateSensorDataResponse{
+		Func:  string(aggregate.Func),
+		Value: aggregate.Value,
+		Unit:  q.Unit,
+		Count: aggregate.Count,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
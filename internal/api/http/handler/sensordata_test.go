@@ -0,0 +1,494 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iot-platform/internal/api/http/handler"
+	"iot-platform/internal/database/sqlite/sqlitetest"
+	"iot-platform/internal/model"
+	"iot-platform/internal/promremote"
+	"iot-platform/internal/repository/repositorytest"
+	"iot-platform/internal/service"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+func newSensorDataHandler(t *testing.T) (*handler.SensorDataHandler, repositorytest.Repositories, string) {
+	repos := sqlitetest.NewRepositories(t)
+
+	deviceId, err := repos.Devices.SaveDevice(context.Background(), &model.Device{Name: "Boiler", Kind: "thermometer", ApiKey: "key-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return handler.NewSensorDataHandler(*service.NewSensorDataService(repos.SensorData)), repos, deviceId
+}
+
+func postJSON(t *testing.T, handle http.HandlerFunc, body string) (*httptest.ResponseRecorder, handler.CreateSensorDataResponse) {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	handle(recorder, httptest.NewRequest(http.MethodPost, "/sensor-data", strings.NewReader(body)))
+
+	var response handler.CreateSensorDataResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("decode response %q: %v", recorder.Body.String(), err)
+	}
+
+	return recorder, response
+}
+
+func TestSensorDataHandler_CreateSensorData_Metrics(t *testing.T) {
+	h, repos, deviceId := newSensorDataHandler(t)
+
+	body := `{"deviceId": "` + deviceId + `", "timestamp": "2026-05-01T10:00:00Z", "messageId": "m-1", "metrics": {"temperature": 21.3, "humidity": 40, "bad name": 1}}`
+	recorder, response := postJSON(t, h.CreateSensorData, body)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", recorder.Code)
+	}
+	if response.Accepted != 2 || response.Status != "partial" {
+		t.Errorf("expected 2 accepted with status partial, got %+v", response)
+	}
+	if len(response.Errors) != 1 || response.Errors[0].Metric != "bad name" {
+		t.Errorf("expected a single error for \"bad name\", got %+v", response.Errors)
+	}
+
+	list, err := repos.SensorData.FindSensorDataByDeviceId(context.Background(), deviceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+	for _, sensorData := range list {
+		if !sensorData.Timestamp.Equal(want) {
+			t.Errorf("expected shared timestamp %s, got %s", want, sensorData.Timestamp)
+		}
+	}
+
+	_, response = postJSON(t, h.CreateSensorData, body)
+	if response.Accepted != 0 || response.Deduplicated != 2 {
+		t.Errorf("expected the retry to be deduplicated, got %+v", response)
+	}
+}
+
+func TestSensorDataHandler_CreateSensorData_AllInvalid(t *testing.T) {
+	h, _, deviceId := newSensorDataHandler(t)
+
+	recorder, response := postJSON(t, h.CreateSensorData, `{"deviceId": "`+deviceId+`", "metrics": {"": 1}}`)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", recorder.Code)
+	}
+	if response.Status != "error" || len(response.Errors) != 1 {
+		t.Errorf("expected one error, got %+v", response)
+	}
+}
+
+func TestSensorDataHandler_CreateSensorDataBatch(t *testing.T) {
+	h, _, deviceId := newSensorDataHandler(t)
+
+	body := `{"readings": [
+		{"deviceId": "` + deviceId + `", "metricName": "temperature", "metricValue": 20, "messageId": "a"},
+		{"deviceId": "` + deviceId + `", "metricName": "temperature", "metricValue": 20, "messageId": "a"},
+		{"metricName": "temperature", "metricValue": 20}
+	]}`
+	recorder, response := postJSON(t, h.CreateSensorDataBatch, body)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", recorder.Code)
+	}
+	if response.Accepted != 1 || response.Deduplicated != 1 {
+		t.Errorf("expected 1 accepted and 1 deduplicated, got %+v", response)
+	}
+	if len(response.Errors) != 1 || response.Errors[0].Reading != 2 {
+		t.Errorf("expected an error for reading 2, got %+v", response.Errors)
+	}
+}
+
+func TestSensorDataHandler_TypedValues(t *testing.T) {
+	h, _, deviceId := newSensorDataHandler(t)
+
+	body := `{"deviceId": "` + deviceId + `", "metrics": {"door": true, "firmware": "1.2.3", "position": {"lat": 52.5, "lon": 13.4}, "temperature": 0}}`
+	recorder, response := postJSON(t, h.CreateSensorData, body)
+	if recorder.Code != http.StatusOK || response.Accepted != 4 {
+		t.Fatalf("expected 4 accepted readings, got %d %+v", recorder.Code, response)
+	}
+
+	recorder = httptest.NewRecorder()
+	h.QuerySensorData(recorder, httptest.NewRequest(http.MethodGet, "/sensor-data/query?deviceId="+deviceId+"&type=string&eq=1.2.3", nil))
+	var query handler.QuerySensorDataResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&query); err != nil {
+		t.Fatal(err)
+	}
+	if len(query.SensorData) != 1 || query.SensorData[0].MetricValue != "1.2.3" {
+		t.Errorf("expected the firmware reading, got %+v", query.SensorData)
+	}
+
+	recorder = httptest.NewRecorder()
+	h.AggregateSensorData(recorder, httptest.NewRequest(http.MethodGet, "/sensor-data/aggregate?fn=max&type=bool", nil))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("expected aggregating booleans to be rejected, got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	h.AggregateSensorData(recorder, httptest.NewRequest(http.MethodGet, "/sensor-data/aggregate?fn=count&deviceId="+deviceId, nil))
+	var aggregate handler.AggregateSensorDataResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&aggregate); err != nil {
+		t.Fatal(err)
+	}
+	if aggregate.Count != 1 {
+		t.Errorf("expected only the numeric reading to be counted, got %+v", aggregate)
+	}
+}
+
+func TestSensorDataHandler_SchemaEnforcement(t *testing.T) {
+	ctx := context.Background()
+	repos := sqlitetest.NewRepositories(t)
+	deviceId, err := repos.Devices.SaveDevice(ctx, &model.Device{Name: "Boiler", Kind: "thermometer", ApiKey: "key-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	max := 100.0
+	kinds := service.NewDeviceKindService(repos.DeviceKinds)
+	kind := &model.DeviceKind{Name: "thermometer", Metrics: []model.MetricSchema{{Name: "temperature", Max: &max}}}
+	if err := kinds.CreateDeviceKind(ctx, kind); err != nil {
+		t.Fatal(err)
+	}
+
+	newHandler := func() *handler.SensorDataHandler {
+		validator := service.NewSchemaValidator(repos.Devices, repos.DeviceKinds)
+		return handler.NewSensorDataHandler(*service.NewSensorDataService(repos.SensorData, service.WithReadingValidator(validator)))
+	}
+
+	body := `{"deviceId": "` + deviceId + `", "metrics": {"temperature": 21.3, "humidity": 40}}`
+	recorder, response := postJSON(t, newHandler().CreateSensorData, body)
+	if recorder.Code != http.StatusOK || response.Accepted != 1 || response.Status != "partial" {
+		t.Fatalf("expected humidity to be rejected, got %d %+v", recorder.Code, response)
+	}
+	if len(response.Errors) != 1 || response.Errors[0].Metric != "humidity" {
+		t.Errorf("expected a single error for humidity, got %+v", response.Errors)
+	}
+
+	recorder, _ = postJSON(t, newHandler().CreateSensorData, `{"deviceId": "`+deviceId+`", "metricName": "temperature", "metricValue": 150}`)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("expected out of range reading to be rejected, got %d", recorder.Code)
+	}
+
+	if err := kinds.UpdateDeviceKind(ctx, "thermometer", &model.DeviceKind{Metrics: kind.Metrics, Enforcement: model.EnforceFlag}); err != nil {
+		t.Fatal(err)
+	}
+	_, response = postJSON(t, newHandler().CreateSensorData, `{"deviceId": "`+deviceId+`", "metricName": "temperature", "metricValue": 150}`)
+	if response.Accepted != 1 || response.Flagged != 1 {
+		t.Errorf("expected the reading to be stored and flagged, got %+v", response)
+	}
+
+	list, err := repos.SensorData.FindSensorDataByDeviceId(ctx, deviceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flagged := 0
+	for _, sensorData := range list {
+		if sensorData.Violation != "" {
+			flagged++
+		}
+	}
+	if len(list) != 2 || flagged != 1 {
+		t.Errorf("expected 2 readings with 1 flagged, got %d with %d flagged", len(list), flagged)
+	}
+}
+
+func TestSensorDataHandler_Units(t *testing.T) {
+	h, repos, deviceId := newSensorDataHandler(t)
+
+	body := `{"readings": [
+		{"deviceId": "` + deviceId + `", "metricName": "temperature", "metricValue": 212, "unit": "degF"},
+		{"deviceId": "` + deviceId + `", "metricName": "temperature", "metricValue": 20, "unit": "Cel"},
+		{"deviceId": "` + deviceId + `", "metrics": {"pressure": 1013.25}, "units": {"pressure": "hPa"}}
+	]}`
+	recorder, response := postJSON(t, h.CreateSensorDataBatch, body)
+	if recorder.Code != http.StatusOK || response.Accepted != 3 {
+		t.Fatalf("expected 3 accepted readings, got %d %+v", recorder.Code, response)
+	}
+
+	list, err := repos.SensorData.QuerySensorData(context.Background(), model.SensorDataQuery{DeviceIds: []string{deviceId}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list[0].Unit != "Cel" || list[0].MetricValue != 100 || list[0].OriginalUnit != "degF" || *list[0].OriginalValue != 212 {
+		t.Errorf("expected 212 degF to be stored as 100 Cel, got %+v", list[0])
+	}
+	if list[2].Unit != "Pa" || list[2].MetricValue != 101325 {
+		t.Errorf("expected 1013.25 hPa to be stored as 101325 Pa, got %+v", list[2])
+	}
+
+	recorder = httptest.NewRecorder()
+	h.QuerySensorData(recorder, httptest.NewRequest(http.MethodGet, "/sensor-data/query?deviceId="+deviceId+"&unit=degF&min=100", nil))
+	var query handler.QuerySensorDataResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&query); err != nil {
+		t.Fatal(err)
+	}
+	if len(query.SensorData) != 1 || query.SensorData[0].MetricValue != 212.0 || query.SensorData[0].Unit != "degF" {
+		t.Errorf("expected only the 212 degF reading, got %+v", query.SensorData)
+	}
+
+	recorder = httptest.NewRecorder()
+	h.AggregateSensorData(recorder, httptest.NewRequest(http.MethodGet, "/sensor-data/aggregate?fn=sum&unit=degF&deviceId="+deviceId, nil))
+	var aggregate handler.AggregateSensorDataResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&aggregate); err != nil {
+		t.Fatal(err)
+	}
+	if aggregate.Count != 2 || aggregate.Value < 279.99 || aggregate.Value > 280.01 || aggregate.Unit != "degF" {
+		t.Errorf("expected a sum of 280 degF over 2 readings, got %+v", aggregate)
+	}
+
+	recorder, _ = postJSON(t, h.CreateSensorData, `{"deviceId": "`+deviceId+`", "metricName": "door", "metricValue": true, "unit": "Cel"}`)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("expected a unit on a boolean to be rejected, got %d", recorder.Code)
+	}
+}
+
+func TestSensorDataHandler_SenML(t *testing.T) {
+	h, repos, deviceId := newSensorDataHandler(t)
+
+	body := `[
+		{"bn": "` + deviceId + `:", "bt": 1777629600, "bu": "degF", "n": "temperature", "v": 212},
+		{"n": "door", "vb": true},
+		{"bn": "unknown-device", "n": "x", "v": 1}
+	]`
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/sensor-data/batch", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/senml+json")
+	h.CreateSensorDataBatch(recorder, request)
+
+	var response handler.CreateSensorDataResponse
+	json.NewDecoder(recorder.Body).Decode(&response)
+	if recorder.Code != http.StatusOK || response.Accepted != 2 || len(response.Errors) != 1 {
+		t.Fatalf("expected 2 readings accepted and 1 rejected, got %d %+v", recorder.Code, response)
+	}
+
+	list, err := repos.SensorData.FindSensorDataByDeviceId(context.Background(), deviceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sensorData := range list {
+		if sensorData.MetricName == "temperature" && (sensorData.Unit != "Cel" || sensorData.MetricValue != 100 || !sensorData.Timestamp.Equal(time.Unix(1777629600, 0))) {
+			t.Errorf("expected 100 Cel at the base time, got %+v", sensorData)
+		}
+	}
+	if len(list) != 2 {
+		t.Errorf("expected 2 stored readings, got %d", len(list))
+	}
+
+	cborBody, _ := cbor.Marshal([]map[int]any{{0: "humidity", 1: "%RH", 2: 40}})
+	recorder = httptest.NewRecorder()
+	request = httptest.NewRequest(http.MethodPost, "/sensor-data?deviceId="+deviceId, bytes.NewReader(cborBody))
+	request.Header.Set("Content-Type", "application/senml+cbor")
+	h.CreateSensorData(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected 200 for a CBOR pack, got %d %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestSensorDataHandler_Write(t *testing.T) {
+	h, repos, deviceId := newSensorDataHandler(t)
+
+	body := deviceId + ",room=kitchen temperature=21.5,door=true 1777629600\n" +
+		"cpu,deviceId=" + deviceId + ",host=gw-1 usage_idle=97.5,state=\"ok\" 1777629600\n" +
+		"not line protocol\n" +
+		deviceId + " bad\\ name=1 1777629600\n"
+	recorder := httptest.NewRecorder()
+	h.Write(recorder, httptest.NewRequest(http.MethodPost, "/write?db=iot&precision=s", strings.NewReader(body)))
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a partial write, got %d", recorder.Code)
+	}
+	var response handler.WriteErrorResponse
+	json.NewDecoder(recorder.Body).Decode(&response)
+	if !strings.Contains(response.Error, "unable to parse 'not line protocol'") || !strings.Contains(response.Error, "partial write:") || !strings.Contains(response.Error, "dropped=1") {
+		t.Errorf("unexpected error %q", response.Error)
+	}
+
+	list, err := repos.SensorData.FindSensorDataByDeviceId(context.Background(), deviceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 4 {
+		t.Fatalf("expected 4 stored readings, got %d", len(list))
+	}
+	for _, sensorData := range list {
+		if !sensorData.Timestamp.Equal(time.Unix(1777629600, 0)) {
+			t.Errorf("expected the line's timestamp, got %s", sensorData.Timestamp)
+		}
+		switch sensorData.MetricName {
+		case "temperature", "door":
+			if sensorData.Labels["room"] != "kitchen" {
+				t.Errorf("expected the room label on %s, got %v", sensorData.MetricName, sensorData.Labels)
+			}
+		case "cpu.usage_idle", "cpu.state":
+			if sensorData.Labels["host"] != "gw-1" || sensorData.Labels["deviceId"] != "" {
+				t.Errorf("expected only the host label on %s, got %v", sensorData.MetricName, sensorData.Labels)
+			}
+		default:
+			t.Errorf("unexpected metric %s", sensorData.MetricName)
+		}
+	}
+
+	recorder = httptest.NewRecorder()
+	h.Write(recorder, httptest.NewRequest(http.MethodPost, "/write", strings.NewReader(deviceId+" humidity=40i")))
+	if recorder.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestRemoteWriteHandler(t *testing.T) {
+	h, repos, deviceId := newSensorDataHandler(t)
+	remoteWrite := handler.NewRemoteWriteHandler(*service.NewDevicesService(repos.Devices), h)
+
+	body := promremote.Encode([]promremote.TimeSeries{
+		{
+			Labels:  []promremote.Label{{Name: "__name__", Value: "modbus:register_value"}, {Name: "deviceId", Value: deviceId}, {Name: "register", Value: "40001"}},
+			Samples: []promremote.Sample{{Value: 12.5, Timestamp: 1777629600000}, {Value: math.Float64frombits(0x7ff0000000000002), Timestamp: 1777629615000}},
+		},
+		{
+			Labels:  []promremote.Label{{Name: "__name__", Value: "up"}, {Name: "instance", Value: "unknown:9602"}},
+			Samples: []promremote.Sample{{Value: 1, Timestamp: 1777629600000}},
+		},
+	})
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(body))
+	request.Header.Set("Content-Encoding", "snappy")
+	request.Header.Set("Content-Type", "application/x-protobuf")
+	remoteWrite.Write(recorder, request)
+
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), `unknown device "unknown:9602" dropped=1`) {
+		t.Fatalf("expected the unknown device to be dropped, got %d %s", recorder.Code, recorder.Body)
+	}
+
+	list, err := repos.SensorData.FindSensorDataByDeviceId(context.Background(), deviceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("expected 1 stored reading, got %d", len(list))
+	}
+	got := list[0]
+	if got.MetricName != "modbus.register_value" || got.MetricValue != 12.5 || got.Labels["register"] != "40001" || !got.Timestamp.Equal(time.UnixMilli(1777629600000)) {
+		t.Errorf("unexpected reading %+v", got)
+	}
+}
+
+func TestSensorDataHandler_ImportExportCSV(t *testing.T) {
+	h, repos, deviceId := newSensorDataHandler(t)
+
+	// A wide logger file with local timestamps.
+	body := "Time;Temp;RH\n" +
+		"2026-04-01 10:00:00;21.5;40\n" +
+		"2026-04-01 10:01:00;;41\n" +
+		"yesterday;22;42\n" +
+		"2026-04-01 10:02:00;abc;43\n"
+	recorder := httptest.NewRecorder()
+	target := "/sensor-data/import?deviceId=" + deviceId + "&delimiter=%3B&timestampColumn=Time&metrics=Temp=temperature,RH=humidity&units=temperature=Cel&timezone=Europe/Berlin&timestampFormat=2006-01-02+15:04:05"
+	h.ImportSensorData(recorder, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+
+	var report handler.ImportSensorDataResponse
+	json.NewDecoder(recorder.Body).Decode(&report)
+	if recorder.Code != http.StatusOK || report.Rows != 4 || report.Accepted != 4 || report.ErrorCount != 2 {
+		t.Fatalf("expected 4 rows with 4 readings accepted and 2 errors, got %d %+v", recorder.Code, report)
+	}
+	if report.Errors[0].Row != 4 || report.Errors[1].Row != 5 || report.Errors[1].Metric != "temperature" {
+		t.Errorf("expected errors on rows 4 and 5, got %+v", report.Errors)
+	}
+
+	recorder = httptest.NewRecorder()
+	h.ExportSensorData(recorder, httptest.NewRequest(http.MethodGet, "/sensor-data/export?format=csv&deviceId="+deviceId+"&metric=temperature", nil))
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("expected a CSV export, got %d", recorder.Code)
+	}
+	lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "id,deviceId,metricName,") || !strings.Contains(lines[1], ",temperature,number,21.5,Cel,,,2026-04-01T08:00:00Z,") {
+		t.Errorf("unexpected export %q", lines)
+	}
+
+	// An export imports again as is.
+	recorder = httptest.NewRecorder()
+	h.ImportSensorData(recorder, httptest.NewRequest(http.MethodPost, "/sensor-data/import", strings.NewReader(strings.Join(lines, "\n"))))
+	report = handler.ImportSensorDataResponse{}
+	json.NewDecoder(recorder.Body).Decode(&report)
+	if report.Accepted != 1 || report.ErrorCount != 0 {
+		t.Errorf("expected the export to import cleanly, got %+v", report)
+	}
+
+	list, err := repos.SensorData.FindSensorDataByDeviceId(context.Background(), deviceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 5 {
+		t.Errorf("expected 5 stored readings, got %d", len(list))
+	}
+
+	recorder = httptest.NewRecorder()
+	h.ImportSensorData(recorder, httptest.NewRequest(http.MethodPost, "/sensor-data/import", strings.NewReader("when,value\n")))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a file without the mapped columns, got %d", recorder.Code)
+	}
+}
+
+func TestSensorDataHandler_ImportExportOutliveServerTimeouts(t *testing.T) {
+	h, _, deviceId := newSensorDataHandler(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /sensor-data/import", h.ImportSensorData)
+	mux.HandleFunc("GET /sensor-data/export", h.ExportSensorData)
+	server := httptest.NewUnstartedServer(mux)
+	server.Config.ReadTimeout = 100 * time.Millisecond
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	// The rows trickle in for several times the server's timeouts.
+	body, upload := io.Pipe()
+	go func() {
+		upload.Write([]byte("deviceId,metricName,metricValue,timestamp\n"))
+		for i := 0; i < 5; i++ {
+			time.Sleep(60 * time.Millisecond)
+			fmt.Fprintf(upload, "%s,temperature,%d,2026-04-01T10:0%d:00Z\n", deviceId, 20+i, i)
+		}
+		upload.Close()
+	}()
+
+	response, err := http.Post(server.URL+"/sensor-data/import", "text/csv", body)
+	if err != nil {
+		t.Fatalf("slow import: %v", err)
+	}
+	var report handler.ImportSensorDataResponse
+	err = json.NewDecoder(response.Body).Decode(&report)
+	response.Body.Close()
+	if err != nil || report.Accepted != 5 {
+		t.Fatalf("expected 5 readings imported, got %+v, %v", report, err)
+	}
+
+	// The client reads the export slower than the write timeout allows.
+	response, err = http.Get(server.URL + "/sensor-data/export?deviceId=" + deviceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	time.Sleep(200 * time.Millisecond)
+	export, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("slow export: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(export)), "\n"); len(lines) != 6 {
+		t.Errorf("expected a header and 5 readings, got %q", lines)
+	}
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"iot-platform/internal/repository"
+	"iot-platform/internal/service"
+	"net/http"
+)
+
+// Headers of a request signed by a device. See service.SignedMessage for
+// what the signature covers.
+const (
+	headerDeviceId  = "X-Device-Id"
+	headerTimestamp = "X-Timestamp"
+	headerNonce     = "X-Nonce"
+	headerSignature = "X-Signature"
+)
+
+// maxSignedBodySize bounds the body read into memory to verify a signature.
+const maxSignedBodySize = 32 << 20
+
+type signerKey struct{}
+
+// signerFrom returns the device that signed the request ctx belongs to.
+func signerFrom(ctx context.Context) (string, bool) {
+	deviceId, ok := ctx.Value(signerKey{}).(string)
+	return deviceId, ok
+}
+
+// SignatureMiddleware verifies HMAC-signed ingest requests.
+type SignatureMiddleware struct {
+	verifier *service.SignatureVerifier
+	required bool
+}
+
+// NewSignatureMiddleware returns middleware that verifies signed requests and,
+// when required is set, refuses unsigned ones.
+func NewSignatureMiddleware(verifier *service.SignatureVerifier, required bool) *SignatureMiddleware {
+	return &SignatureMiddleware{
+		verifier: verifier,
+		required: required,
+	}
+}
+
+// Wrap verifies the signature of a request before passing it on to next.
+// Readings of a signed request must belong to the signing device; those that
+// name no device are taken to.
+func (m *SignatureMiddleware) Wrap(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		signature := r.Header.Get(headerSignature)
+		if signature == "" {
+			if m.required {
+				http.Error(w, "request must be signed", http.StatusUnauthorized)
+				return
+			}
+			next(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSignedBodySize))
+		if err != nil {
+			http.Error(w, "failed to read request body", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		device, err := m.verifier.Verify(r.Context(), service.SignedRequest{
+			DeviceId:  r.Header.Get(headerDeviceId),
+			Timestamp: r.Header.Get(headerTimestamp),
+			Nonce:     r.Header.Get(headerNonce),
+			Signature: signature,
+			Method:    r.Method,
+			Path:      r.URL.RequestURI(),
+			Body:      body,
+		})
+		switch {
+		case errors.Is(err, service.ErrInvalidSignature), errors.Is(err, service.ErrStaleTimestamp), errors.Is(err, repository.ErrNonceUsed):
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		case err != nil:
+			http.Error(w, "failed to verify signature", http.StatusInternalServerError)
+			return
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), signerKey{}, device.Id))
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next(w, r)
+	}
+}
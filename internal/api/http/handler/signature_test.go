@@ -0,0 +1,91 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"iot-platform/internal/api/http/handler"
+	"iot-platform/internal/database/sqlite/sqlitetest"
+	"iot-platform/internal/model"
+	"iot-platform/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignatureMiddleware(t *testing.T) {
+	ctx := context.Background()
+	repos := sqlitetest.NewRepositories(t)
+	deviceId, err := repos.Devices.SaveDevice(ctx, &model.Device{Name: "Boiler", Kind: "thermometer", ApiKey: "secret-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherId, err := repos.Devices.SaveDevice(ctx, &model.Device{Name: "Pump", Kind: "thermometer", ApiKey: "secret-2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sensorDataHandler := handler.NewSensorDataHandler(*service.NewSensorDataService(repos.SensorData))
+	signatures := handler.NewSignatureMiddleware(service.NewSignatureVerifier(repos.Devices, repos.Nonces, 5*time.Minute), true)
+	create := signatures.Wrap(sensorDataHandler.CreateSensorData)
+	batch := signatures.Wrap(sensorDataHandler.CreateSensorDataBatch)
+
+	type signed struct {
+		timestamp time.Time
+		nonce     string
+		secret    string
+	}
+	send := func(handle http.HandlerFunc, path, body string, s *signed) *httptest.ResponseRecorder {
+		t.Helper()
+		request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if s != nil {
+			timestamp := strconv.FormatInt(s.timestamp.Unix(), 10)
+			request.Header.Set("X-Device-Id", deviceId)
+			request.Header.Set("X-Timestamp", timestamp)
+			request.Header.Set("X-Nonce", s.nonce)
+			request.Header.Set("X-Signature", service.Sign(s.secret, service.SignedMessage(timestamp, s.nonce, http.MethodPost, path, []byte(body))))
+		}
+		recorder := httptest.NewRecorder()
+		handle(recorder, request)
+		return recorder
+	}
+
+	body := `{"metrics": {"temperature": 21.5}}`
+	if recorder := send(create, "/sensor-data", body, nil); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an unsigned request, got %d", recorder.Code)
+	}
+	if recorder := send(create, "/sensor-data", body, &signed{time.Now(), "n-1", "secret-2"}); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a wrong key, got %d", recorder.Code)
+	}
+	if recorder := send(create, "/sensor-data", body, &signed{time.Now().Add(-10 * time.Minute), "n-1", "secret-1"}); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a stale timestamp, got %d", recorder.Code)
+	}
+
+	request := &signed{time.Now(), "n-1", "secret-1"}
+	recorder := send(create, "/sensor-data", body, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body)
+	}
+	list, err := repos.SensorData.FindSensorDataByDeviceId(ctx, deviceId)
+	if err != nil || len(list) != 1 {
+		t.Errorf("expected the reading to be stored for the signing device, got %d, %v", len(list), err)
+	}
+	if recorder := send(create, "/sensor-data", body, request); recorder.Code != http.StatusUnauthorized || !strings.Contains(recorder.Body.String(), "nonce") {
+		t.Errorf("expected a replay to be refused, got %d %s", recorder.Code, recorder.Body)
+	}
+
+	batchBody := `{"readings": [
+		{"deviceId": "` + deviceId + `", "metricName": "temperature", "metricValue": 22},
+		{"deviceId": "` + otherId + `", "metricName": "temperature", "metricValue": 23}
+	]}`
+	recorder = send(batch, "/sensor-data/batch", batchBody, &signed{time.Now(), "n-2", "secret-1"})
+	var response handler.CreateSensorDataResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Accepted != 1 || len(response.Errors) != 1 || response.Errors[0].Reading != 1 {
+		t.Errorf("expected the other device's reading to be refused, got %+v", response)
+	}
+}
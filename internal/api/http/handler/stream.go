@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iot-platform/internal/model"
+	"iot-platform/internal/service"
+	"iot-platform/internal/stream"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StreamHandler pushes newly ingested readings to clients as Server-Sent
+// Events. Every event carries an id; a reconnecting client sends the last one
+// it saw in Last-Event-ID and receives the buffered events it missed.
+type StreamHandler struct {
+	broker    *stream.Broker
+	devices   service.DeviceService
+	heartbeat time.Duration
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewStreamHandler(broker *stream.Broker, devices service.DeviceService, heartbeat time.Duration) *StreamHandler {
+	return &StreamHandler{
+		broker:    broker,
+		devices:   devices,
+		heartbeat: heartbeat,
+		done:      make(chan struct{}),
+	}
+}
+
+// Shutdown ends every open stream. Clients reconnect with Last-Event-ID.
+func (h *StreamHandler) Shutdown() {
+	h.closeOnce.Do(func() { close(h.done) })
+}
+
+// DeviceStream streams the readings of one device, optionally restricted to
+// the metrics given by ?metric= and the labels given by ?label=key:value.
+func (h *StreamHandler) DeviceStream(w http.ResponseWriter, r *http.Request) {
+	deviceId := r.PathValue("id")
+	if _, err := h.devices.FindDeviceById(r.Context(), deviceId); err != nil {
+		http.Error(w, "device not found", http.StatusNotFound)
+		return
+	}
+
+	labels, err := parseLabels(r.URL.Query()["label"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter := stream.Filter{
+		DeviceIds:   []string{deviceId},
+		MetricNames: splitList(r.URL.Query()["metric"]),
+		Labels:      labels,
+	}
+	h.serve(w, r, filter, nil)
+}
+
+// FleetStream streams the readings of every device, filtered by ?deviceId=,
+// ?metric=, ?label=key:value and the device kind in ?kind=.
+func (h *StreamHandler) FleetStream(w http.ResponseWriter, r *http.Request) {
+	labels, err := parseLabels(r.URL.Query()["label"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter := stream.Filter{
+		DeviceIds:   splitList(r.URL.Query()["deviceId"]),
+		MetricNames: splitList(r.URL.Query()["metric"]),
+		Labels:      labels,
+	}
+
+	var match func(*model.SensorData) bool
+	if kinds := splitList(r.URL.Query()["kind"]); len(kinds) > 0 {
+		match = h.kindMatcher(r.Context(), kinds)
+	}
+	h.serve(w, r, filter, match)
+}
+
+func (h *StreamHandler) serve(w http.ResponseWriter, r *http.Request, filter stream.Filter, match func(*model.SensorData) bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	lastEventId := r.Header.Get("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = r.URL.Query().Get("lastEventId")
+	}
+	afterId, _ := strconv.ParseInt(lastEventId, 10, 64)
+
+	// Streams outlive the server's write timeout.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	subscription, replay := h.broker.Subscribe(filter, afterId)
+	defer subscription.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	for _, event := range replay {
+		if err := writeEvent(w, event, match); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.done:
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-subscription.Events():
+			if !ok {
+				// Dropped for falling behind; the client resumes from its
+				// last event id.
+				log.Printf("Dropped slow stream subscriber %s", r.RemoteAddr)
+				return
+			}
+			if err := writeEvent(w, event, match); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event stream.Event, match func(*model.SensorData) bool) error {
+	if match != nil && !match(event.SensorData) {
+		return nil
+	}
+
+	data, err := json.Marshal(toSensorData(event.SensorData))
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: reading\ndata: %s\n\n", event.Id, data)
+	return err
+}
+
+// kindMatcher matches readings of devices of the given kinds. Device kinds
+// are looked up once per device for the lifetime of the stream.
+func (h *StreamHandler) kindMatcher(ctx context.Context, kinds []string) func(*model.SensorData) bool {
+	deviceKinds := make(map[string]string)
+
+	return func(sensorData *model.SensorData) bool {
+		kind, ok := deviceKinds[sensorData.DeviceId]
+		if !ok {
+			if device, err := h.devices.FindDeviceById(ctx, sensorData.DeviceId); err == nil {
+				kind = device.Kind
+			}
+			deviceKinds[sensorData.DeviceId] = kind
+		}
+
+		return slices.Contains(kinds, kind)
+	}
+}
+
+// splitList flattens repeated and comma separated query values.
+func splitList(values []string) []string {
+	var list []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+
+	return list
+}
+
+// parseLabels reads repeated key:value label filters. Values are taken
+// whole, commas included; repeating a key matches any of its values.
+func parseLabels(values []string) (map[string][]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	labels := make(map[string][]string)
+	for _, value := range values {
+		key, labelValue, ok := strings.Cut(value, ":")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid label filter %q, expected key:value", value)
+		}
+		labels[key] = append(labels[key], labelValue)
+	}
+
+	return labels, nil
+}
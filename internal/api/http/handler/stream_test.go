@@ -0,0 +1,156 @@
+package handler_test
+
+import (
+	"bufio"
+	"context"
+	"iot-platform/internal/api/http/handler"
+	"iot-platform/internal/database/sqlite/sqlitetest"
+	"iot-platform/internal/model"
+	"iot-platform/internal/service"
+	"iot-platform/internal/stream"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamHandler_DeviceStream(t *testing.T) {
+	ctx := context.Background()
+	repos := sqlitetest.NewRepositories(t)
+	deviceId, err := repos.Devices.SaveDevice(ctx, &model.Device{Name: "Boiler", Kind: "thermometer", ApiKey: "key-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broker := stream.NewBroker(100, 10)
+	sensorDataService := service.NewSensorDataService(repos.SensorData, service.WithPublisher(broker))
+	streamHandler := handler.NewStreamHandler(broker, *service.NewDevicesService(repos.Devices), time.Hour)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /devices/{id}/stream", streamHandler.DeviceStream)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	publish := func(metric string) {
+		t.Helper()
+		if err := sensorDataService.CreateSensorData(ctx, &model.SensorData{DeviceId: deviceId, MetricName: metric, MetricValue: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// readEvent returns the id and data of the next event on the stream.
+	readEvent := func(reader *bufio.Reader) (string, string) {
+		t.Helper()
+		var id, data string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read stream: %v", err)
+			}
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case line == "" && data != "":
+				return id, data
+			case strings.HasPrefix(line, "id: "):
+				id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}
+	open := func(lastEventId string) (*http.Response, *bufio.Reader) {
+		t.Helper()
+		request, _ := http.NewRequest(http.MethodGet, server.URL+"/devices/"+deviceId+"/stream?metric=temperature", nil)
+		if lastEventId != "" {
+			request.Header.Set("Last-Event-ID", lastEventId)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("unexpected content type %q", response.Header.Get("Content-Type"))
+		}
+		return response, bufio.NewReader(response.Body)
+	}
+
+	response, reader := open("")
+	publish("humidity")
+	publish("temperature")
+	id, data := readEvent(reader)
+	if !strings.Contains(data, `"metricName":"temperature"`) {
+		t.Errorf("expected the temperature reading, got %s", data)
+	}
+	response.Body.Close()
+
+	publish("temperature")
+	response, reader = open(id)
+	defer response.Body.Close()
+	resumedId, _ := readEvent(reader)
+	if resumedId <= id {
+		t.Errorf("expected to resume after %s, got %s", id, resumedId)
+	}
+
+	notFound, err := http.Get(server.URL + "/devices/missing/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	notFound.Body.Close()
+	if notFound.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown device, got %d", notFound.StatusCode)
+	}
+}
+
+func TestStreamHandler_FleetStreamLabels(t *testing.T) {
+	ctx := context.Background()
+	repos := sqlitetest.NewRepositories(t)
+	deviceId, err := repos.Devices.SaveDevice(ctx, &model.Device{Name: "Boiler", Kind: "thermometer", ApiKey: "key-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broker := stream.NewBroker(100, 10)
+	sensorDataService := service.NewSensorDataService(repos.SensorData, service.WithPublisher(broker))
+	streamHandler := handler.NewStreamHandler(broker, *service.NewDevicesService(repos.Devices), time.Hour)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stream", streamHandler.FleetStream)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/stream?label=room:kitchen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	for _, room := range []string{"cellar", "kitchen"} {
+		reading := &model.SensorData{DeviceId: deviceId, MetricName: "temperature", MetricValue: 1, Labels: map[string]string{"room": room}}
+		if err := sensorDataService.CreateSensorData(ctx, reading); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reader := bufio.NewReader(response.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read stream: %v", err)
+		}
+		if strings.HasPrefix(line, "data: ") {
+			if !strings.Contains(line, `"room":"kitchen"`) {
+				t.Errorf("expected only the kitchen reading, got %s", line)
+			}
+			break
+		}
+	}
+
+	invalid, err := http.Get(server.URL + "/stream?label=kitchen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalid.Body.Close()
+	if invalid.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for a label without a key, got %d", invalid.StatusCode)
+	}
+}
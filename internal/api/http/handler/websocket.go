@@ -0,0 +1,264 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"iot-platform/internal/connectivity"
+	"iot-platform/internal/model"
+	"iot-platform/internal/service"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteWait      = 10 * time.Second
+	wsPongWait       = 60 * time.Second
+	wsPingPeriod     = wsPongWait * 9 / 10
+	wsMaxMessageSize = 1 << 20
+)
+
+type SendCommandRequest struct {
+	Name    string          `json:"name"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type PushResponse struct {
+	Id     string `json:"id"`
+	Status string `json:"status"`
+}
+
+type ListConnectedDevicesResponse struct {
+	Devices []string `json:"devices"`
+}
+
+// DeviceConnectionHandler serves devices that hold a WebSocket connection.
+// Devices send telemetry frames over it and receive commands and
+// configuration pushed through the HTTP API.
+type DeviceConnectionHandler struct {
+	devices    service.DeviceService
+	sensorData *SensorDataHandler
+	registry   *connectivity.Registry
+	upgrader   websocket.Upgrader
+}
+
+func NewDeviceConnectionHandler(devices service.DeviceService, sensorData *SensorDataHandler, registry *connectivity.Registry) *DeviceConnectionHandler {
+	return &DeviceConnectionHandler{
+		devices:    devices,
+		sensorData: sensorData,
+		registry:   registry,
+		upgrader: websocket.Upgrader{
+			// Devices are not browsers; they authenticate with their API key
+			// or client certificate.
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	}
+}
+
+// apiKeyFrom reads a device API key from X-Api-Key, a bearer token or, for
+// clients that cannot set headers, the apiKey query parameter.
+func apiKeyFrom(r *http.Request) string {
+	if apiKey := r.Header.Get("X-Api-Key"); apiKey != "" {
+		return apiKey
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+
+	return r.URL.Query().Get("apiKey")
+}
+
+// authenticateDevice authenticates the device id by the client certificate
+// it presented, when it connected over mutual TLS, and by its API key
+// otherwise. The server only accepts client certificates it has verified.
+func authenticateDevice(devices service.DeviceService, r *http.Request, id string) (*model.Device, error) {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		device, err := devices.AuthenticateCertificate(r.Context(), r.TLS.PeerCertificates[0])
+		if err != nil || device.Id != id {
+			return nil, service.ErrUnauthorized
+		}
+		return device, nil
+	}
+
+	return devices.Authenticate(r.Context(), id, apiKeyFrom(r))
+}
+
+func (h *DeviceConnectionHandler) Connect(w http.ResponseWriter, r *http.Request) {
+	device, err := authenticateDevice(h.devices, r, r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already replied.
+		return
+	}
+
+	session := newWebSocketSession(conn)
+	h.registry.Register(device.Id, session)
+	defer h.registry.Unregister(device.Id, session)
+	defer session.Close("connection closed")
+	go session.keepAlive()
+
+	log.Printf("Device %s connected from %s", device.Id, r.RemoteAddr)
+	for {
+		var message connectivity.Message
+		if err := conn.ReadJSON(&message); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("Device %s connection failed: %v", device.Id, err)
+			}
+			break
+		}
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
+		if reply := h.handleMessage(r, device, message); reply != nil {
+			if err := session.Send(*reply); err != nil {
+				break
+			}
+		}
+	}
+	log.Printf("Device %s disconnected", device.Id)
+}
+
+func (h *DeviceConnectionHandler) handleMessage(r *http.Request, device *model.Device, message connectivity.Message) *connectivity.Message {
+	switch message.Type {
+	case connectivity.MessageTelemetry:
+		var request CreateSensorDataRequest
+		if err := json.Unmarshal(message.Data, &request); err != nil {
+			return errorMessage(message.Id, "invalid telemetry: "+err.Error())
+		}
+		if request.DeviceId == "" {
+			request.DeviceId = device.Id
+		}
+		if request.DeviceId != device.Id {
+			return errorMessage(message.Id, "telemetry for another device")
+		}
+
+		status, response := h.sensorData.IngestReadings(r.Context(), []CreateSensorDataRequest{request})
+		messageType := connectivity.MessageAck
+		if status != http.StatusOK {
+			messageType = connectivity.MessageError
+		}
+		data, _ := json.Marshal(response)
+		return &connectivity.Message{Type: messageType, Id: message.Id, Data: data}
+	case connectivity.MessageAck, connectivity.MessageError:
+		log.Printf("Device %s answered message %s with %s: %s", device.Id, message.Id, message.Type, message.Data)
+		return nil
+	default:
+		return errorMessage(message.Id, "unknown message type "+message.Type)
+	}
+}
+
+func errorMessage(id string, text string) *connectivity.Message {
+	data, _ := json.Marshal(map[string]string{"error": text})
+	return &connectivity.Message{Type: connectivity.MessageError, Id: id, Data: data}
+}
+
+func (h *DeviceConnectionHandler) ListConnected(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ListConnectedDevicesResponse{Devices: h.registry.Connected()})
+}
+
+func (h *DeviceConnectionHandler) SendCommand(w http.ResponseWriter, r *http.Request) {
+	var req SendCommandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		http.Error(w, "invalid request body, name is required", http.StatusBadRequest)
+		return
+	}
+
+	data, _ := json.Marshal(req)
+	h.push(w, r.PathValue("id"), connectivity.MessageCommand, data)
+}
+
+// PushConfig sends a configuration object to a connected device. It is not
+// stored; devices should ask for it again after reconnecting.
+func (h *DeviceConnectionHandler) PushConfig(w http.ResponseWriter, r *http.Request) {
+	var config map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		http.Error(w, "invalid request body, expected a JSON object", http.StatusBadRequest)
+		return
+	}
+
+	data, _ := json.Marshal(config)
+	h.push(w, r.PathValue("id"), connectivity.MessageConfig, data)
+}
+
+func (h *DeviceConnectionHandler) push(w http.ResponseWriter, deviceId string, messageType string, data json.RawMessage) {
+	message := connectivity.Message{Type: messageType, Id: uuid.NewString(), Data: data}
+	err := h.registry.Send(deviceId, message)
+	if errors.Is(err, connectivity.ErrNotConnected) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to send to device", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(PushResponse{Id: message.Id, Status: "sent"})
+}
+
+// webSocketSession serializes writes to a connection, which gorilla/websocket
+// does not allow concurrently.
+type webSocketSession struct {
+	conn      *websocket.Conn
+	mu        sync.Mutex
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newWebSocketSession(conn *websocket.Conn) *webSocketSession {
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	return &webSocketSession{
+		conn: conn,
+		done: make(chan struct{}),
+	}
+}
+
+func (s *webSocketSession) Send(message connectivity.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return s.conn.WriteJSON(message)
+}
+
+func (s *webSocketSession) Close(reason string) error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, reason), time.Now().Add(wsWriteWait))
+		s.conn.Close()
+	})
+
+	return nil
+}
+
+func (s *webSocketSession) keepAlive() {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
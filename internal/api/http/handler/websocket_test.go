@@ -0,0 +1,96 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"iot-platform/internal/api/http/handler"
+	"iot-platform/internal/connectivity"
+	"iot-platform/internal/database/sqlite/sqlitetest"
+	"iot-platform/internal/model"
+	"iot-platform/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestDeviceConnectionHandler(t *testing.T) {
+	ctx := context.Background()
+	repos := sqlitetest.NewRepositories(t)
+	deviceId, err := repos.Devices.SaveDevice(ctx, &model.Device{Name: "Boiler", Kind: "thermometer", ApiKey: "key-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	devices := *service.NewDevicesService(repos.Devices)
+	sensorDataHandler := handler.NewSensorDataHandler(*service.NewSensorDataService(repos.SensorData))
+	registry := connectivity.NewRegistry()
+	h := handler.NewDeviceConnectionHandler(devices, sensorDataHandler, registry)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /devices/{id}/ws", h.Connect)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/devices/" + deviceId + "/ws"
+	if _, response, err := websocket.DefaultDialer.Dial(url, http.Header{"X-Api-Key": {"wrong"}}); err == nil || response.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a wrong API key, got %v", err)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": {"Bearer key-1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	telemetry := connectivity.Message{Type: connectivity.MessageTelemetry, Id: "t-1", Data: json.RawMessage(`{"metrics": {"temperature": 21.5, "humidity": 40}}`)}
+	if err := conn.WriteJSON(telemetry); err != nil {
+		t.Fatal(err)
+	}
+	var ack connectivity.Message
+	if err := conn.ReadJSON(&ack); err != nil {
+		t.Fatal(err)
+	}
+	var ingest handler.CreateSensorDataResponse
+	json.Unmarshal(ack.Data, &ingest)
+	if ack.Type != connectivity.MessageAck || ack.Id != "t-1" || ingest.Accepted != 2 {
+		t.Errorf("expected an ack for 2 readings, got %+v %s", ack, ack.Data)
+	}
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/devices/"+deviceId+"/commands", strings.NewReader(`{"name": "reboot"}`))
+	request.SetPathValue("id", deviceId)
+	h.SendCommand(recorder, request)
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", recorder.Code)
+	}
+	var command connectivity.Message
+	if err := conn.ReadJSON(&command); err != nil {
+		t.Fatal(err)
+	}
+	if command.Type != connectivity.MessageCommand || !strings.Contains(string(command.Data), `"reboot"`) {
+		t.Errorf("expected the reboot command, got %+v", command)
+	}
+
+	if connected := registry.Connected(); len(connected) != 1 || connected[0] != deviceId {
+		t.Errorf("expected the device to be connected, got %v", connected)
+	}
+
+	registry.CloseAll("server shutting down")
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("expected a going away close frame, got %v", err)
+	}
+
+	recorder = httptest.NewRecorder()
+	request = httptest.NewRequest(http.MethodPost, "/devices/"+deviceId+"/commands", strings.NewReader(`{"name": "reboot"}`))
+	request.SetPathValue("id", deviceId)
+	h.SendCommand(recorder, request)
+	if recorder.Code != http.StatusConflict {
+		t.Errorf("expected 409 once disconnected, got %d", recorder.Code)
+	}
+}
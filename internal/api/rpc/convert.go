@@ -0,0 +1,186 @@
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"iot-platform/internal/api/rpc/iotpb"
+	"iot-platform/internal/model"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func fromCreateDeviceRequest(req *iotpb.CreateDeviceRequest) *model.Device {
+	return &model.Device{
+		Name:   req.Name,
+		Kind:   req.Kind,
+		ApiKey: req.ApiKey,
+	}
+}
+
+func fromUpdateDeviceRequest(req *iotpb.UpdateDeviceRequest) *model.Device {
+	return &model.Device{
+		Name:   req.Name,
+		Kind:   req.Kind,
+		ApiKey: req.ApiKey,
+	}
+}
+
+func toDevice(device *model.Device) *iotpb.Device {
+	return &iotpb.Device{
+		Id:        device.Id,
+		Name:      device.Name,
+		Kind:      device.Kind,
+		ApiKey:    device.ApiKey,
+		CreatedAt: timestamppb.New(device.CreatedAt),
+		UpdatedAt: timestamppb.New(device.UpdatedAt),
+	}
+}
+
+func toSensorData(sensorData *model.SensorData) *iotpb.SensorData {
+	pb := &iotpb.SensorData{
+		Id:            sensorData.Id,
+		DeviceId:      sensorData.DeviceId,
+		MetricName:    sensorData.MetricName,
+		Unit:          sensorData.Unit,
+		Timestamp:     timestamppb.New(sensorData.Timestamp),
+		MessageId:     sensorData.MessageId,
+		Violation:     sensorData.Violation,
+		OriginalUnit:  sensorData.OriginalUnit,
+		OriginalValue: sensorData.OriginalValue,
+	}
+
+	switch sensorData.ValueType {
+	case model.ValueBool:
+		var b bool
+		json.Unmarshal(sensorData.RawValue, &b)
+		pb.Value = &iotpb.SensorData_Bool{Bool: b}
+	case model.ValueString:
+		var s string
+		json.Unmarshal(sensorData.RawValue, &s)
+		pb.Value = &iotpb.SensorData_String_{String_: s}
+	case model.ValueGeo:
+		var point model.GeoPoint
+		json.Unmarshal(sensorData.RawValue, &point)
+		pb.Value = &iotpb.SensorData_Geo{Geo: &iotpb.GeoPoint{Lat: point.Lat, Lon: point.Lon, Alt: point.Alt}}
+	case model.ValueJSON:
+		pb.Value = &iotpb.SensorData_Json{Json: string(sensorData.RawValue)}
+	default:
+		pb.Value = &iotpb.SensorData_Number{Number: sensorData.MetricValue}
+	}
+
+	return pb
+}
+
+// fromSensorDataList validates readings like POST /sensor-data does. It
+// returns the valid ones along with their index in the stream.
+func fromSensorDataList(readings []*iotpb.SensorData, offset int) ([]*model.SensorData, []int, []*iotpb.IngestError) {
+	now := time.Now()
+
+	var list []*model.SensorData
+	var indexes []int
+	var ingestErrors []*iotpb.IngestError
+	for i, reading := range readings {
+		sensorData, err := fromSensorData(reading, now)
+		if err != nil {
+			ingestErrors = append(ingestErrors, &iotpb.IngestError{Reading: int32(offset + i), Metric: reading.MetricName, Error: err.Error()})
+			continue
+		}
+		list = append(list, sensorData)
+		indexes = append(indexes, offset+i)
+	}
+
+	return list, indexes, ingestErrors
+}
+
+func fromSensorData(pb *iotpb.SensorData, now time.Time) (*model.SensorData, error) {
+	if pb.DeviceId == "" {
+		return nil, errors.New("device_id is required")
+	}
+	if err := model.ValidateMetricName(pb.MetricName); err != nil {
+		return nil, err
+	}
+
+	timestamp := now
+	if pb.Timestamp != nil {
+		timestamp = pb.Timestamp.AsTime()
+	}
+	if timestamp.After(now.Add(model.MaxClockSkew)) {
+		return nil, errors.New("timestamp is in the future")
+	}
+
+	var raw []byte
+	var hint model.ValueType
+	switch value := pb.Value.(type) {
+	case *iotpb.SensorData_Number:
+		raw, _ = json.Marshal(value.Number)
+		hint = model.ValueNumber
+	case *iotpb.SensorData_Bool:
+		raw, _ = json.Marshal(value.Bool)
+		hint = model.ValueBool
+	case *iotpb.SensorData_String_:
+		raw, _ = json.Marshal(value.String_)
+		hint = model.ValueString
+	case *iotpb.SensorData_Geo:
+		raw, _ = json.Marshal(model.GeoPoint{Lat: value.Geo.Lat, Lon: value.Geo.Lon, Alt: value.Geo.Alt})
+		hint = model.ValueGeo
+	case *iotpb.SensorData_Json:
+		raw, hint = []byte(value.Json), model.ValueJSON
+	default:
+		return nil, errors.New("value is required")
+	}
+
+	valueType, number, canonical, err := model.ParseValue(raw, hint)
+	if err != nil {
+		return nil, err
+	}
+	if pb.Unit != "" && valueType != model.ValueNumber {
+		return nil, errors.New("only numbers can have a unit")
+	}
+
+	return &model.SensorData{
+		DeviceId:    pb.DeviceId,
+		MetricName:  pb.MetricName,
+		ValueType:   valueType,
+		MetricValue: number,
+		RawValue:    canonical,
+		Unit:        pb.Unit,
+		Timestamp:   timestamp,
+		MessageId:   pb.MessageId,
+	}, nil
+}
+
+func fromQueryRequest(req *iotpb.QueryRequest) (model.SensorDataQuery, error) {
+	if req == nil {
+		return model.SensorDataQuery{}, nil
+	}
+
+	q := model.SensorDataQuery{
+		DeviceIds:  req.DeviceIds,
+		MetricName: req.MetricName,
+		ValueType:  model.ValueType(req.ValueType),
+		Min:        req.Min,
+		Max:        req.Max,
+		Unit:       req.Unit,
+		Limit:      int(req.Limit),
+		Offset:     int(req.Offset),
+	}
+	if req.From != nil {
+		q.From = req.From.AsTime()
+	}
+	if req.To != nil {
+		q.To = req.To.AsTime()
+	}
+
+	if q.ValueType != "" && !q.ValueType.Valid() {
+		return q, errors.New("unknown value_type " + req.ValueType)
+	}
+	if (q.Min != nil || q.Max != nil || q.Unit != "") && !q.ValueType.Numeric() {
+		return q, errors.New("min, max and unit only apply to numbers")
+	}
+	if q.Limit < 0 || q.Offset < 0 {
+		return q, errors.New("limit and offset must not be negative")
+	}
+
+	return q, nil
+}
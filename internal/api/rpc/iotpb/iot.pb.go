@@ -0,0 +1,1298 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: iot.proto
+
+package iotpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Device struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Kind          string                 `protobuf:"bytes,3,opt,name=kind,proto3" json:"kind,omitempty"`
+	ApiKey        string                 `protobuf:"bytes,4,opt,name=api_key,json=apiKey,proto3" json:"api_key,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt     *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Device) Reset() {
+	*x = Device{}
+	mi := &file_iot_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Device) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Device) ProtoMessage() {}
+
+func (x *Device) ProtoReflect() protoreflect.Message {
+	mi := &file_iot_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Device.ProtoReflect.Descriptor instead.
+func (*Device) Descriptor() ([]byte, []int) {
+	return file_iot_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Device) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Device) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Device) GetKind() string {
+	if x != nil {
+		return x.Kind
+	}
+	return ""
+}
+
+func (x *Device) GetApiKey() string {
+	if x != nil {
+		return x.ApiKey
+	}
+	return ""
+}
+
+func (x *Device) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Device) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+type CreateDeviceRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Kind          string                 `protobuf:"bytes,2,opt,name=kind,proto3" json:"kind,omitempty"`
+	ApiKey        string                 `protobuf:"bytes,3,opt,name=api_key,json=apiKey,proto3" json:"api_key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateDeviceRequest) Reset() {
+	*x = CreateDeviceRequest{}
+	mi := &file_iot_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateDeviceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateDeviceRequest) ProtoMessage() {}
+
+func (x *CreateDeviceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_iot_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateDeviceRequest.ProtoReflect.Descriptor instead.
+func (*CreateDeviceRequest) Descriptor() ([]byte, []int) {
+	return file_iot_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CreateDeviceRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *CreateDeviceRequest) GetKind() string {
+	if x != nil {
+		return x.Kind
+	}
+	return ""
+}
+
+func (x *CreateDeviceRequest) GetApiKey() string {
+	if x != nil {
+		return x.ApiKey
+	}
+	return ""
+}
+
+type GetDeviceRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetDeviceRequest) Reset() {
+	*x = GetDeviceRequest{}
+	mi := &file_iot_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetDeviceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetDeviceRequest) ProtoMessage() {}
+
+func (x *GetDeviceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_iot_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetDeviceRequest.ProtoReflect.Descriptor instead.
+func (*GetDeviceRequest) Descriptor() ([]byte, []int) {
+	return file_iot_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetDeviceRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type ListDevicesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Page          int32                  `protobuf:"varint,1,opt,name=page,proto3" json:"page,omitempty"`
+	PageSize      int32                  `protobuf:"varint,2,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListDevicesRequest) Reset() {
+	*x = ListDevicesRequest{}
+	mi := &file_iot_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListDevicesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListDevicesRequest) ProtoMessage() {}
+
+func (x *ListDevicesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_iot_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListDevicesRequest.ProtoReflect.Descriptor instead.
+func (*ListDevicesRequest) Descriptor() ([]byte, []int) {
+	return file_iot_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ListDevicesRequest) GetPage() int32 {
+	if x != nil {
+		return x.Page
+	}
+	return 0
+}
+
+func (x *ListDevicesRequest) GetPageSize() int32 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+type ListDevicesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Devices       []*Device              `protobuf:"bytes,1,rep,name=devices,proto3" json:"devices,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListDevicesResponse) Reset() {
+	*x = ListDevicesResponse{}
+	mi := &file_iot_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListDevicesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListDevicesResponse) ProtoMessage() {}
+
+func (x *ListDevicesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_iot_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListDevicesResponse.ProtoReflect.Descriptor instead.
+func (*ListDevicesResponse) Descriptor() ([]byte, []int) {
+	return file_iot_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListDevicesResponse) GetDevices() []*Device {
+	if x != nil {
+		return x.Devices
+	}
+	return nil
+}
+
+type UpdateDeviceRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Kind          string                 `protobuf:"bytes,3,opt,name=kind,proto3" json:"kind,omitempty"`
+	ApiKey        string                 `protobuf:"bytes,4,opt,name=api_key,json=apiKey,proto3" json:"api_key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateDeviceRequest) Reset() {
+	*x = UpdateDeviceRequest{}
+	mi := &file_iot_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateDeviceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateDeviceRequest) ProtoMessage() {}
+
+func (x *UpdateDeviceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_iot_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateDeviceRequest.ProtoReflect.Descriptor instead.
+func (*UpdateDeviceRequest) Descriptor() ([]byte, []int) {
+	return file_iot_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *UpdateDeviceRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *UpdateDeviceRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *UpdateDeviceRequest) GetKind() string {
+	if x != nil {
+		return x.Kind
+	}
+	return ""
+}
+
+func (x *UpdateDeviceRequest) GetApiKey() string {
+	if x != nil {
+		return x.ApiKey
+	}
+	return ""
+}
+
+type DeleteDeviceRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteDeviceRequest) Reset() {
+	*x = DeleteDeviceRequest{}
+	mi := &file_iot_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteDeviceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteDeviceRequest) ProtoMessage() {}
+
+func (x *DeleteDeviceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_iot_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteDeviceRequest.ProtoReflect.Descriptor instead.
+func (*DeleteDeviceRequest) Descriptor() ([]byte, []int) {
+	return file_iot_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *DeleteDeviceRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type GeoPoint struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Lat           float64                `protobuf:"fixed64,1,opt,name=lat,proto3" json:"lat,omitempty"`
+	Lon           float64                `protobuf:"fixed64,2,opt,name=lon,proto3" json:"lon,omitempty"`
+	Alt           *float64               `protobuf:"fixed64,3,opt,name=alt,proto3,oneof" json:"alt,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GeoPoint) Reset() {
+	*x = GeoPoint{}
+	mi := &file_iot_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GeoPoint) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GeoPoint) ProtoMessage() {}
+
+func (x *GeoPoint) ProtoReflect() protoreflect.Message {
+	mi := &file_iot_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GeoPoint.ProtoReflect.Descriptor instead.
+func (*GeoPoint) Descriptor() ([]byte, []int) {
+	return file_iot_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *GeoPoint) GetLat() float64 {
+	if x != nil {
+		return x.Lat
+	}
+	return 0
+}
+
+func (x *GeoPoint) GetLon() float64 {
+	if x != nil {
+		return x.Lon
+	}
+	return 0
+}
+
+func (x *GeoPoint) GetAlt() float64 {
+	if x != nil && x.Alt != nil {
+		return *x.Alt
+	}
+	return 0
+}
+
+type SensorData struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Id         int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	DeviceId   string                 `protobuf:"bytes,2,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	MetricName string                 `protobuf:"bytes,3,opt,name=metric_name,json=metricName,proto3" json:"metric_name,omitempty"`
+	// Types that are valid to be assigned to Value:
+	//
+	//	*SensorData_Number
+	//	*SensorData_Bool
+	//	*SensorData_String_
+	//	*SensorData_Geo
+	//	*SensorData_Json
+	Value         isSensorData_Value     `protobuf_oneof:"value"`
+	Unit          string                 `protobuf:"bytes,9,opt,name=unit,proto3" json:"unit,omitempty"`
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,10,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	MessageId     string                 `protobuf:"bytes,11,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	Violation     string                 `protobuf:"bytes,12,opt,name=violation,proto3" json:"violation,omitempty"`
+	OriginalUnit  string                 `protobuf:"bytes,13,opt,name=original_unit,json=originalUnit,proto3" json:"original_unit,omitempty"`
+	OriginalValue *float64               `protobuf:"fixed64,14,opt,name=original_value,json=originalValue,proto3,oneof" json:"original_value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SensorData) Reset() {
+	*x = SensorData{}
+	mi := &file_iot_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SensorData) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SensorData) ProtoMessage() {}
+
+func (x *SensorData) ProtoReflect() protoreflect.Message {
+	mi := &file_iot_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SensorData.ProtoReflect.Descriptor instead.
+func (*SensorData) Descriptor() ([]byte, []int) {
+	return file_iot_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *SensorData) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *SensorData) GetDeviceId() string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return ""
+}
+
+func (x *SensorData) GetMetricName() string {
+	if x != nil {
+		return x.MetricName
+	}
+	return ""
+}
+
+func (x *SensorData) GetValue() isSensorData_Value {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *SensorData) GetNumber() float64 {
+	if x != nil {
+		if x, ok := x.Value.(*SensorData_Number); ok {
+			return x.Number
+		}
+	}
+	return 0
+}
+
+func (x *SensorData) GetBool() bool {
+	if x != nil {
+		if x, ok := x.Value.(*SensorData_Bool); ok {
+			return x.Bool
+		}
+	}
+	return false
+}
+
+func (x *SensorData) GetString_() string {
+	if x != nil {
+		if x, ok := x.Value.(*SensorData_String_); ok {
+			return x.String_
+		}
+	}
+	return ""
+}
+
+func (x *SensorData) GetGeo() *GeoPoint {
+	if x != nil {
+		if x, ok := x.Value.(*SensorData_Geo); ok {
+			return x.Geo
+		}
+	}
+	return nil
+}
+
+func (x *SensorData) GetJson() string {
+	if x != nil {
+		if x, ok := x.Value.(*SensorData_Json); ok {
+			return x.Json
+		}
+	}
+	return ""
+}
+
+func (x *SensorData) GetUnit() string {
+	if x != nil {
+		return x.Unit
+	}
+	return ""
+}
+
+func (x *SensorData) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *SensorData) GetMessageId() string {
+	if x != nil {
+		return x.MessageId
+	}
+	return ""
+}
+
+func (x *SensorData) GetViolation() string {
+	if x != nil {
+		return x.Violation
+	}
+	return ""
+}
+
+func (x *SensorData) GetOriginalUnit() string {
+	if x != nil {
+		return x.OriginalUnit
+	}
+	return ""
+}
+
+func (x *SensorData) GetOriginalValue() float64 {
+	if x != nil && x.OriginalValue != nil {
+		return *x.OriginalValue
+	}
+	return 0
+}
+
+type isSensorData_Value interface {
+	isSensorData_Value()
+}
+
+type SensorData_Number struct {
+	Number float64 `protobuf:"fixed64,4,opt,name=number,proto3,oneof"`
+}
+
+type SensorData_Bool struct {
+	Bool bool `protobuf:"varint,5,opt,name=bool,proto3,oneof"`
+}
+
+type SensorData_String_ struct {
+	String_ string `protobuf:"bytes,6,opt,name=string,proto3,oneof"`
+}
+
+type SensorData_Geo struct {
+	Geo *GeoPoint `protobuf:"bytes,7,opt,name=geo,proto3,oneof"`
+}
+
+type SensorData_Json struct {
+	// json holds a JSON object.
+	Json string `protobuf:"bytes,8,opt,name=json,proto3,oneof"`
+}
+
+func (*SensorData_Number) isSensorData_Value() {}
+
+func (*SensorData_Bool) isSensorData_Value() {}
+
+func (*SensorData_String_) isSensorData_Value() {}
+
+func (*SensorData_Geo) isSensorData_Value() {}
+
+func (*SensorData_Json) isSensorData_Value() {}
+
+type IngestRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Readings      []*SensorData          `protobuf:"bytes,1,rep,name=readings,proto3" json:"readings,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IngestRequest) Reset() {
+	*x = IngestRequest{}
+	mi := &file_iot_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IngestRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IngestRequest) ProtoMessage() {}
+
+func (x *IngestRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_iot_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IngestRequest.ProtoReflect.Descriptor instead.
+func (*IngestRequest) Descriptor() ([]byte, []int) {
+	return file_iot_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *IngestRequest) GetReadings() []*SensorData {
+	if x != nil {
+		return x.Readings
+	}
+	return nil
+}
+
+type IngestError struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Reading       int32                  `protobuf:"varint,1,opt,name=reading,proto3" json:"reading,omitempty"`
+	Metric        string                 `protobuf:"bytes,2,opt,name=metric,proto3" json:"metric,omitempty"`
+	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IngestError) Reset() {
+	*x = IngestError{}
+	mi := &file_iot_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IngestError) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IngestError) ProtoMessage() {}
+
+func (x *IngestError) ProtoReflect() protoreflect.Message {
+	mi := &file_iot_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IngestError.ProtoReflect.Descriptor instead.
+func (*IngestError) Descriptor() ([]byte, []int) {
+	return file_iot_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *IngestError) GetReading() int32 {
+	if x != nil {
+		return x.Reading
+	}
+	return 0
+}
+
+func (x *IngestError) GetMetric() string {
+	if x != nil {
+		return x.Metric
+	}
+	return ""
+}
+
+func (x *IngestError) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type IngestResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Accepted      int32                  `protobuf:"varint,1,opt,name=accepted,proto3" json:"accepted,omitempty"`
+	Deduplicated  int32                  `protobuf:"varint,2,opt,name=deduplicated,proto3" json:"deduplicated,omitempty"`
+	Flagged       int32                  `protobuf:"varint,3,opt,name=flagged,proto3" json:"flagged,omitempty"`
+	Errors        []*IngestError         `protobuf:"bytes,4,rep,name=errors,proto3" json:"errors,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IngestResponse) Reset() {
+	*x = IngestResponse{}
+	mi := &file_iot_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IngestResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IngestResponse) ProtoMessage() {}
+
+func (x *IngestResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_iot_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IngestResponse.ProtoReflect.Descriptor instead.
+func (*IngestResponse) Descriptor() ([]byte, []int) {
+	return file_iot_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *IngestResponse) GetAccepted() int32 {
+	if x != nil {
+		return x.Accepted
+	}
+	return 0
+}
+
+func (x *IngestResponse) GetDeduplicated() int32 {
+	if x != nil {
+		return x.Deduplicated
+	}
+	return 0
+}
+
+func (x *IngestResponse) GetFlagged() int32 {
+	if x != nil {
+		return x.Flagged
+	}
+	return 0
+}
+
+func (x *IngestResponse) GetErrors() []*IngestError {
+	if x != nil {
+		return x.Errors
+	}
+	return nil
+}
+
+type QueryRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DeviceIds     []string               `protobuf:"bytes,1,rep,name=device_ids,json=deviceIds,proto3" json:"device_ids,omitempty"`
+	MetricName    string                 `protobuf:"bytes,2,opt,name=metric_name,json=metricName,proto3" json:"metric_name,omitempty"`
+	From          *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=from,proto3" json:"from,omitempty"`
+	To            *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=to,proto3" json:"to,omitempty"`
+	ValueType     string                 `protobuf:"bytes,5,opt,name=value_type,json=valueType,proto3" json:"value_type,omitempty"`
+	Min           *float64               `protobuf:"fixed64,6,opt,name=min,proto3,oneof" json:"min,omitempty"`
+	Max           *float64               `protobuf:"fixed64,7,opt,name=max,proto3,oneof" json:"max,omitempty"`
+	Unit          string                 `protobuf:"bytes,8,opt,name=unit,proto3" json:"unit,omitempty"`
+	Limit         int32                  `protobuf:"varint,9,opt,name=limit,proto3" json:"limit,omitempty"`
+	Offset        int32                  `protobuf:"varint,10,opt,name=offset,proto3" json:"offset,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryRequest) Reset() {
+	*x = QueryRequest{}
+	mi := &file_iot_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryRequest) ProtoMessage() {}
+
+func (x *QueryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_iot_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryRequest.ProtoReflect.Descriptor instead.
+func (*QueryRequest) Descriptor() ([]byte, []int) {
+	return file_iot_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *QueryRequest) GetDeviceIds() []string {
+	if x != nil {
+		return x.DeviceIds
+	}
+	return nil
+}
+
+func (x *QueryRequest) GetMetricName() string {
+	if x != nil {
+		return x.MetricName
+	}
+	return ""
+}
+
+func (x *QueryRequest) GetFrom() *timestamppb.Timestamp {
+	if x != nil {
+		return x.From
+	}
+	return nil
+}
+
+func (x *QueryRequest) GetTo() *timestamppb.Timestamp {
+	if x != nil {
+		return x.To
+	}
+	return nil
+}
+
+func (x *QueryRequest) GetValueType() string {
+	if x != nil {
+		return x.ValueType
+	}
+	return ""
+}
+
+func (x *QueryRequest) GetMin() float64 {
+	if x != nil && x.Min != nil {
+		return *x.Min
+	}
+	return 0
+}
+
+func (x *QueryRequest) GetMax() float64 {
+	if x != nil && x.Max != nil {
+		return *x.Max
+	}
+	return 0
+}
+
+func (x *QueryRequest) GetUnit() string {
+	if x != nil {
+		return x.Unit
+	}
+	return ""
+}
+
+func (x *QueryRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *QueryRequest) GetOffset() int32 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+type AggregateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Query         *QueryRequest          `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
+	Func          string                 `protobuf:"bytes,2,opt,name=func,proto3" json:"func,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AggregateRequest) Reset() {
+	*x = AggregateRequest{}
+	mi := &file_iot_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AggregateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AggregateRequest) ProtoMessage() {}
+
+func (x *AggregateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_iot_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AggregateRequest.ProtoReflect.Descriptor instead.
+func (*AggregateRequest) Descriptor() ([]byte, []int) {
+	return file_iot_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *AggregateRequest) GetQuery() *QueryRequest {
+	if x != nil {
+		return x.Query
+	}
+	return nil
+}
+
+func (x *AggregateRequest) GetFunc() string {
+	if x != nil {
+		return x.Func
+	}
+	return ""
+}
+
+type AggregateResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Func          string                 `protobuf:"bytes,1,opt,name=func,proto3" json:"func,omitempty"`
+	Value         float64                `protobuf:"fixed64,2,opt,name=value,proto3" json:"value,omitempty"`
+	Unit          string                 `protobuf:"bytes,3,opt,name=unit,proto3" json:"unit,omitempty"`
+	Count         int64                  `protobuf:"varint,4,opt,name=count,proto3" json:"count,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AggregateResponse) Reset() {
+	*x = AggregateResponse{}
+	mi := &file_iot_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AggregateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AggregateResponse) ProtoMessage() {}
+
+func (x *AggregateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_iot_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AggregateResponse.ProtoReflect.Descriptor instead.
+func (*AggregateResponse) Descriptor() ([]byte, []int) {
+	return file_iot_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *AggregateResponse) GetFunc() string {
+	if x != nil {
+		return x.Func
+	}
+	return ""
+}
+
+func (x *AggregateResponse) GetValue() float64 {
+	if x != nil {
+		return x.Value
+	}
+	return 0
+}
+
+func (x *AggregateResponse) GetUnit() string {
+	if x != nil {
+		return x.Unit
+	}
+	return ""
+}
+
+func (x *AggregateResponse) GetCount() int64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+var File_iot_proto protoreflect.FileDescriptor
+
+const file_iot_proto_rawDesc = "" +
+	"\n" +
+	"\tiot.proto\x12\x06iot.v1\x1a\x1bgoogle/protobuf/empty.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\xcf\x01\n" +
+	"\x06Device\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x12\n" +
+	"\x04kind\x18\x03 \x01(\tR\x04kind\x12\x17\n" +
+	"\aapi_key\x18\x04 \x01(\tR\x06apiKey\x129\n" +
+	"\n" +
+	"created_at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"updated_at\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\"V\n" +
+	"\x13CreateDeviceRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04kind\x18\x02 \x01(\tR\x04kind\x12\x17\n" +
+	"\aapi_key\x18\x03 \x01(\tR\x06apiKey\"\"\n" +
+	"\x10GetDeviceRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"E\n" +
+	"\x12ListDevicesRequest\x12\x12\n" +
+	"\x04page\x18\x01 \x01(\x05R\x04page\x12\x1b\n" +
+	"\tpage_size\x18\x02 \x01(\x05R\bpageSize\"?\n" +
+	"\x13ListDevicesResponse\x12(\n" +
+	"\adevices\x18\x01 \x03(\v2\x0e.iot.v1.DeviceR\adevices\"f\n" +
+	"\x13UpdateDeviceRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x12\n" +
+	"\x04kind\x18\x03 \x01(\tR\x04kind\x12\x17\n" +
+	"\aapi_key\x18\x04 \x01(\tR\x06apiKey\"%\n" +
+	"\x13DeleteDeviceRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"M\n" +
+	"\bGeoPoint\x12\x10\n" +
+	"\x03lat\x18\x01 \x01(\x01R\x03lat\x12\x10\n" +
+	"\x03lon\x18\x02 \x01(\x01R\x03lon\x12\x15\n" +
+	"\x03alt\x18\x03 \x01(\x01H\x00R\x03alt\x88\x01\x01B\x06\n" +
+	"\x04_alt\"\xd8\x03\n" +
+	"\n" +
+	"SensorData\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x1b\n" +
+	"\tdevice_id\x18\x02 \x01(\tR\bdeviceId\x12\x1f\n" +
+	"\vmetric_name\x18\x03 \x01(\tR\n" +
+	"metricName\x12\x18\n" +
+	"\x06number\x18\x04 \x01(\x01H\x00R\x06number\x12\x14\n" +
+	"\x04bool\x18\x05 \x01(\bH\x00R\x04bool\x12\x18\n" +
+	"\x06string\x18\x06 \x01(\tH\x00R\x06string\x12$\n" +
+	"\x03geo\x18\a \x01(\v2\x10.iot.v1.GeoPointH\x00R\x03geo\x12\x14\n" +
+	"\x04json\x18\b \x01(\tH\x00R\x04json\x12\x12\n" +
+	"\x04unit\x18\t \x01(\tR\x04unit\x128\n" +
+	"\ttimestamp\x18\n" +
+	" \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\v \x01(\tR\tmessageId\x12\x1c\n" +
+	"\tviolation\x18\f \x01(\tR\tviolation\x12#\n" +
+	"\roriginal_unit\x18\r \x01(\tR\foriginalUnit\x12*\n" +
+	"\x0eoriginal_value\x18\x0e \x01(\x01H\x01R\roriginalValue\x88\x01\x01B\a\n" +
+	"\x05valueB\x11\n" +
+	"\x0f_original_value\"?\n" +
+	"\rIngestRequest\x12.\n" +
+	"\breadings\x18\x01 \x03(\v2\x12.iot.v1.SensorDataR\breadings\"U\n" +
+	"\vIngestError\x12\x18\n" +
+	"\areading\x18\x01 \x01(\x05R\areading\x12\x16\n" +
+	"\x06metric\x18\x02 \x01(\tR\x06metric\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\"\x97\x01\n" +
+	"\x0eIngestResponse\x12\x1a\n" +
+	"\baccepted\x18\x01 \x01(\x05R\baccepted\x12\"\n" +
+	"\fdeduplicated\x18\x02 \x01(\x05R\fdeduplicated\x12\x18\n" +
+	"\aflagged\x18\x03 \x01(\x05R\aflagged\x12+\n" +
+	"\x06errors\x18\x04 \x03(\v2\x13.iot.v1.IngestErrorR\x06errors\"\xc9\x02\n" +
+	"\fQueryRequest\x12\x1d\n" +
+	"\n" +
+	"device_ids\x18\x01 \x03(\tR\tdeviceIds\x12\x1f\n" +
+	"\vmetric_name\x18\x02 \x01(\tR\n" +
+	"metricName\x12.\n" +
+	"\x04from\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x04from\x12*\n" +
+	"\x02to\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x02to\x12\x1d\n" +
+	"\n" +
+	"value_type\x18\x05 \x01(\tR\tvalueType\x12\x15\n" +
+	"\x03min\x18\x06 \x01(\x01H\x00R\x03min\x88\x01\x01\x12\x15\n" +
+	"\x03max\x18\a \x01(\x01H\x01R\x03max\x88\x01\x01\x12\x12\n" +
+	"\x04unit\x18\b \x01(\tR\x04unit\x12\x14\n" +
+	"\x05limit\x18\t \x01(\x05R\x05limit\x12\x16\n" +
+	"\x06offset\x18\n" +
+	" \x01(\x05R\x06offsetB\x06\n" +
+	"\x04_minB\x06\n" +
+	"\x04_max\"R\n" +
+	"\x10AggregateRequest\x12*\n" +
+	"\x05query\x18\x01 \x01(\v2\x14.iot.v1.QueryRequestR\x05query\x12\x12\n" +
+	"\x04func\x18\x02 \x01(\tR\x04func\"g\n" +
+	"\x11AggregateResponse\x12\x12\n" +
+	"\x04func\x18\x01 \x01(\tR\x04func\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x01R\x05value\x12\x12\n" +
+	"\x04unit\x18\x03 \x01(\tR\x04unit\x12\x14\n" +
+	"\x05count\x18\x04 \x01(\x03R\x05count2\xcd\x02\n" +
+	"\rDeviceService\x12;\n" +
+	"\fCreateDevice\x12\x1b.iot.v1.CreateDeviceRequest\x1a\x0e.iot.v1.Device\x125\n" +
+	"\tGetDevice\x12\x18.iot.v1.GetDeviceRequest\x1a\x0e.iot.v1.Device\x12F\n" +
+	"\vListDevices\x12\x1a.iot.v1.ListDevicesRequest\x1a\x1b.iot.v1.ListDevicesResponse\x12;\n" +
+	"\fUpdateDevice\x12\x1b.iot.v1.UpdateDeviceRequest\x1a\x0e.iot.v1.Device\x12C\n" +
+	"\fDeleteDevice\x12\x1b.iot.v1.DeleteDeviceRequest\x1a\x16.google.protobuf.Empty2\x84\x02\n" +
+	"\x11SensorDataService\x127\n" +
+	"\x06Ingest\x12\x15.iot.v1.IngestRequest\x1a\x16.iot.v1.IngestResponse\x12?\n" +
+	"\fIngestStream\x12\x15.iot.v1.IngestRequest\x1a\x16.iot.v1.IngestResponse(\x01\x123\n" +
+	"\x05Query\x12\x14.iot.v1.QueryRequest\x1a\x12.iot.v1.SensorData0\x01\x12@\n" +
+	"\tAggregate\x12\x18.iot.v1.AggregateRequest\x1a\x19.iot.v1.AggregateResponseB%Z#iot-platform/internal/api/rpc/iotpbb\x06proto3"
+
+var (
+	file_iot_proto_rawDescOnce sync.Once
+	file_iot_proto_rawDescData []byte
+)
+
+func file_iot_proto_rawDescGZIP() []byte {
+	file_iot_proto_rawDescOnce.Do(func() {
+		file_iot_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_iot_proto_rawDesc), len(file_iot_proto_rawDesc)))
+	})
+	return file_iot_proto_rawDescData
+}
+
+var file_iot_proto_msgTypes = make([]protoimpl.MessageInfo, 15)
+var file_iot_proto_goTypes = []any{
+	(*Device)(nil),                // 0: iot.v1.Device
+	(*CreateDeviceRequest)(nil),   // 1: iot.v1.CreateDeviceRequest
+	(*GetDeviceRequest)(nil),      // 2: iot.v1.GetDeviceRequest
+	(*ListDevicesRequest)(nil),    // 3: iot.v1.ListDevicesRequest
+	(*ListDevicesResponse)(nil),   // 4: iot.v1.ListDevicesResponse
+	(*UpdateDeviceRequest)(nil),   // 5: iot.v1.UpdateDeviceRequest
+	(*DeleteDeviceRequest)(nil),   // 6: iot.v1.DeleteDeviceRequest
+	(*GeoPoint)(nil),              // 7: iot.v1.GeoPoint
+	(*SensorData)(nil),            // 8: iot.v1.SensorData
+	(*IngestRequest)(nil),         // 9: iot.v1.IngestRequest
+	(*IngestError)(nil),           // 10: iot.v1.IngestError
+	(*IngestResponse)(nil),        // 11: iot.v1.IngestResponse
+	(*QueryRequest)(nil),          // 12: iot.v1.QueryRequest
+	(*AggregateRequest)(nil),      // 13: iot.v1.AggregateRequest
+	(*AggregateResponse)(nil),     // 14: iot.v1.AggregateResponse
+	(*timestamppb.Timestamp)(nil), // 15: google.protobuf.Timestamp
+	(*emptypb.Empty)(nil),         // 16: google.protobuf.Empty
+}
+var file_iot_proto_depIdxs = []int32{
+	15, // 0: iot.v1.Device.created_at:type_name -> google.protobuf.Timestamp
+	15, // 1: iot.v1.Device.updated_at:type_name -> google.protobuf.Timestamp
+	0,  // 2: iot.v1.ListDevicesResponse.devices:type_name -> iot.v1.Device
+	7,  // 3: iot.v1.SensorData.geo:type_name -> iot.v1.GeoPoint
+	15, // 4: iot.v1.SensorData.timestamp:type_name -> google.protobuf.Timestamp
+	8,  // 5: iot.v1.IngestRequest.readings:type_name -> iot.v1.SensorData
+	10, // 6: iot.v1.IngestResponse.errors:type_name -> iot.v1.IngestError
+	15, // 7: iot.v1.QueryRequest.from:type_name -> google.protobuf.Timestamp
+	15, // 8: iot.v1.QueryRequest.to:type_name -> google.protobuf.Timestamp
+	12, // 9: iot.v1.AggregateRequest.query:type_name -> iot.v1.QueryRequest
+	1,  // 10: iot.v1.DeviceService.CreateDevice:input_type -> iot.v1.CreateDeviceRequest
+	2,  // 11: iot.v1.DeviceService.GetDevice:input_type -> iot.v1.GetDeviceRequest
+	3,  // 12: iot.v1.DeviceService.ListDevices:input_type -> iot.v1.ListDevicesRequest
+	5,  // 13: iot.v1.DeviceService.UpdateDevice:input_type -> iot.v1.UpdateDeviceRequest
+	6,  // 14: iot.v1.DeviceService.DeleteDevice:input_type -> iot.v1.DeleteDeviceRequest
+	9,  // 15: iot.v1.SensorDataService.Ingest:input_type -> iot.v1.IngestRequest
+	9,  // 16: iot.v1.SensorDataService.IngestStream:input_type -> iot.v1.IngestRequest
+	12, // 17: iot.v1.SensorDataService.Query:input_type -> iot.v1.QueryRequest
+	13, // 18: iot.v1.SensorDataService.Aggregate:input_type -> iot.v1.AggregateRequest
+	0,  // 19: iot.v1.DeviceService.CreateDevice:output_type -> iot.v1.Device
+	0,  // 20: iot.v1.DeviceService.GetDevice:output_type -> iot.v1.Device
+	4,  // 21: iot.v1.DeviceService.ListDevices:output_type -> iot.v1.ListDevicesResponse
+	0,  // 22: iot.v1.DeviceService.UpdateDevice:output_type -> iot.v1.Device
+	16, // 23: iot.v1.DeviceService.DeleteDevice:output_type -> google.protobuf.Empty
+	11, // 24: iot.v1.SensorDataService.Ingest:output_type -> iot.v1.IngestResponse
+	11, // 25: iot.v1.SensorDataService.IngestStream:output_type -> iot.v1.IngestResponse
+	8,  // 26: iot.v1.SensorDataService.Query:output_type -> iot.v1.SensorData
+	14, // 27: iot.v1.SensorDataService.Aggregate:output_type -> iot.v1.AggregateResponse
+	19, // [19:28] is the sub-list for method output_type
+	10, // [10:19] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
+}
+
+func init() { file_iot_proto_init() }
+func file_iot_proto_init() {
+	if File_iot_proto != nil {
+		return
+	}
+	file_iot_proto_msgTypes[7].OneofWrappers = []any{}
+	file_iot_proto_msgTypes[8].OneofWrappers = []any{
+		(*SensorData_Number)(nil),
+		(*SensorData_Bool)(nil),
+		(*SensorData_String_)(nil),
+		(*SensorData_Geo)(nil),
+		(*SensorData_Json)(nil),
+	}
+	file_iot_proto_msgTypes[12].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_iot_proto_rawDesc), len(file_iot_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   15,
+			NumExtensions: 0,
+			NumServices:   2,
+		},
+		GoTypes:           file_iot_proto_goTypes,
+		DependencyIndexes: file_iot_proto_depIdxs,
+		MessageInfos:      file_iot_proto_msgTypes,
+	}.Build()
+	File_iot_proto = out.File
+	file_iot_proto_goTypes = nil
+	file_iot_proto_depIdxs = nil
+}
@@ -0,0 +1,94 @@
+package rpc
+
+import (
+	"context"
+	"iot-platform/internal/service"
+	"math"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryConsumerLimit refuses calls past the rate of their consumer with
+// ResourceExhausted. Consumers are told apart as over HTTP: by a verified
+// client certificate, or the x-device-id and x-api-key metadata, or else
+// their address.
+func UnaryConsumerLimit(limits *service.ConsumerLimits) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := take(ctx, limits, consumerOf(ctx)); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamConsumerLimit is UnaryConsumerLimit for streams. Every message a
+// client sends counts as a call, so that one long stream cannot ingest past
+// the limit.
+func StreamConsumerLimit(limits *service.ConsumerLimits) grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &limitedStream{ServerStream: stream, limits: limits, consumer: consumerOf(stream.Context())})
+	}
+}
+
+type limitedStream struct {
+	grpc.ServerStream
+	limits   *service.ConsumerLimits
+	consumer service.Consumer
+}
+
+func (s *limitedStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	return take(s.Context(), s.limits, s.consumer)
+}
+
+func take(ctx context.Context, limits *service.ConsumerLimits, consumer service.Consumer) error {
+	if limits.Unlimited() {
+		return nil
+	}
+
+	decision := limits.Take(ctx, consumer)
+	if decision.Limited > 0 {
+		retryAfter := max(int64(math.Ceil(decision.RetryAfter.Seconds())), 1)
+		return status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry after %ds", retryAfter)
+	}
+
+	return nil
+}
+
+// consumerOf describes who made a call. Only client certificates are
+// verified, by the TLS handshake; the limits check the rest.
+func consumerOf(ctx context.Context) service.Consumer {
+	var consumer service.Consumer
+	if p, ok := peer.FromContext(ctx); ok {
+		consumer.Address = p.Addr.String()
+		if host, _, err := net.SplitHostPort(consumer.Address); err == nil {
+			consumer.Address = host
+		}
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.VerifiedChains) > 0 {
+			consumer.Certificate = info.State.VerifiedChains[0][0]
+		}
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("x-device-id"); len(values) > 0 {
+		consumer.DeviceId = values[0]
+	}
+	if values := md.Get("x-api-key"); len(values) > 0 {
+		consumer.ApiKey = values[0]
+	} else if values := md.Get("authorization"); len(values) > 0 {
+		consumer.ApiKey, _ = strings.CutPrefix(values[0], "Bearer ")
+	}
+
+	return consumer
+}
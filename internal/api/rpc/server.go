@@ -0,0 +1,229 @@
+// Package rpc serves the device and sensor data services over gRPC. The
+// protocol is defined in iotpb/iot.proto.
+package rpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iot-platform/internal/api/rpc/iotpb"
+	"iot-platform/internal/model"
+	"iot-platform/internal/service"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const (
+	// maxIngestBatch bounds the readings of one IngestRequest.
+	maxIngestBatch = 5000
+	// queryPageSize is how many readings Query fetches at a time.
+	queryPageSize = 1000
+)
+
+// NewServer returns a gRPC server exposing both services and reflection.
+func NewServer(devices service.DeviceService, sensorData service.SensorDataService, opts ...grpc.ServerOption) *grpc.Server {
+	server := grpc.NewServer(opts...)
+	iotpb.RegisterDeviceServiceServer(server, &DeviceServer{devices: devices})
+	iotpb.RegisterSensorDataServiceServer(server, &SensorDataServer{sensorData: sensorData})
+	reflection.Register(server)
+
+	return server
+}
+
+type DeviceServer struct {
+	iotpb.UnimplementedDeviceServiceServer
+	devices service.DeviceService
+}
+
+func (s *DeviceServer) CreateDevice(ctx context.Context, req *iotpb.CreateDeviceRequest) (*iotpb.Device, error) {
+	if req.Name == "" || req.Kind == "" || req.ApiKey == "" {
+		return nil, status.Error(codes.InvalidArgument, "name, kind and api_key are required")
+	}
+
+	id, err := s.devices.CreateDevice(ctx, fromCreateDeviceRequest(req))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to create device: %v", err)
+	}
+
+	return s.GetDevice(ctx, &iotpb.GetDeviceRequest{Id: id})
+}
+
+func (s *DeviceServer) GetDevice(ctx context.Context, req *iotpb.GetDeviceRequest) (*iotpb.Device, error) {
+	device, err := s.devices.FindDeviceById(ctx, req.Id)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "device not found")
+	}
+
+	return toDevice(device), nil
+}
+
+func (s *DeviceServer) ListDevices(ctx context.Context, req *iotpb.ListDevicesRequest) (*iotpb.ListDevicesResponse, error) {
+	page, pageSize := int(req.Page), int(req.PageSize)
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 10
+	}
+
+	devices, err := s.devices.FetchDevices(ctx, model.DeviceFilter{}, page, pageSize)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch devices: %v", err)
+	}
+
+	response := &iotpb.ListDevicesResponse{}
+	for _, device := range devices {
+		response.Devices = append(response.Devices, toDevice(device))
+	}
+
+	return response, nil
+}
+
+func (s *DeviceServer) UpdateDevice(ctx context.Context, req *iotpb.UpdateDeviceRequest) (*iotpb.Device, error) {
+	if _, err := s.devices.FindDeviceById(ctx, req.Id); err != nil {
+		return nil, status.Error(codes.NotFound, "device not found")
+	}
+
+	if err := s.devices.UpdateDevice(ctx, req.Id, fromUpdateDeviceRequest(req)); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to update device: %v", err)
+	}
+
+	return s.GetDevice(ctx, &iotpb.GetDeviceRequest{Id: req.Id})
+}
+
+func (s *DeviceServer) DeleteDevice(ctx context.Context, req *iotpb.DeleteDeviceRequest) (*emptypb.Empty, error) {
+	if err := s.devices.DeleteDevice(ctx, req.Id); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to delete device: %v", err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+type SensorDataServer struct {
+	iotpb.UnimplementedSensorDataServiceServer
+	sensorData service.SensorDataService
+}
+
+func (s *SensorDataServer) Ingest(ctx context.Context, req *iotpb.IngestRequest) (*iotpb.IngestResponse, error) {
+	response := &iotpb.IngestResponse{}
+	if err := s.ingest(ctx, req.Readings, 0, response); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+func (s *SensorDataServer) IngestStream(stream grpc.ClientStreamingServer[iotpb.IngestRequest, iotpb.IngestResponse]) error {
+	response := &iotpb.IngestResponse{}
+	offset := 0
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(response)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := s.ingest(stream.Context(), req.Readings, offset, response); err != nil {
+			return err
+		}
+		offset += len(req.Readings)
+	}
+}
+
+// ingest stores the valid readings of a batch and adds the outcome to
+// response. Error indexes are offset by the readings of earlier batches.
+func (s *SensorDataServer) ingest(ctx context.Context, readings []*iotpb.SensorData, offset int, response *iotpb.IngestResponse) error {
+	if len(readings) > maxIngestBatch {
+		return status.Errorf(codes.InvalidArgument, "a batch must not contain more than %d readings", maxIngestBatch)
+	}
+
+	list, indexes, ingestErrors := fromSensorDataList(readings, offset)
+	response.Errors = append(response.Errors, ingestErrors...)
+	if len(list) == 0 {
+		return nil
+	}
+
+	result, err := s.sensorData.IngestSensorData(ctx, list)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to store sensor data: %v", err)
+	}
+
+	response.Accepted += int32(result.Accepted)
+	response.Deduplicated += int32(result.Deduplicated)
+	response.Flagged += int32(result.Flagged)
+	for _, rejected := range result.Rejected {
+		response.Errors = append(response.Errors, &iotpb.IngestError{
+			Reading: int32(indexes[rejected.Index]),
+			Metric:  list[rejected.Index].MetricName,
+			Error:   rejected.Err.Error(),
+		})
+	}
+
+	return nil
+}
+
+// Query pages through the matching readings so that large results are
+// streamed rather than held in memory.
+func (s *SensorDataServer) Query(req *iotpb.QueryRequest, stream grpc.ServerStreamingServer[iotpb.SensorData]) error {
+	q, err := fromQueryRequest(req)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	remaining := q.Limit
+	for {
+		q.Limit = queryPageSize
+		if remaining > 0 {
+			q.Limit = min(remaining, queryPageSize)
+		}
+
+		list, err := s.sensorData.QuerySensorData(stream.Context(), q)
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to query sensor data: %v", err)
+		}
+		for _, sensorData := range list {
+			if err := stream.Send(toSensorData(sensorData)); err != nil {
+				return err
+			}
+		}
+
+		if remaining > 0 {
+			remaining -= len(list)
+			if remaining <= 0 {
+				return nil
+			}
+		}
+		if len(list) < q.Limit {
+			return nil
+		}
+		q.Offset += len(list)
+	}
+}
+
+func (s *SensorDataServer) Aggregate(ctx context.Context, req *iotpb.AggregateRequest) (*iotpb.AggregateResponse, error) {
+	q, err := fromQueryRequest(req.Query)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	aggregate, err := s.sensorData.AggregateSensorData(ctx, q, model.AggregateFunc(req.Func))
+	if errors.Is(err, service.ErrUnknownAggregate) || errors.Is(err, service.ErrNotNumeric) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to aggregate sensor data: %v", err)
+	}
+
+	return &iotpb.AggregateResponse{
+		Func:  string(aggregate.Func),
+		Value: aggregate.Value,
+		Unit:  q.Unit,
+		Count: aggregate.Count,
+	}, nil
+}
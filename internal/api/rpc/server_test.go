@@ -0,0 +1,141 @@
+package rpc_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iot-platform/internal/api/rpc"
+	"iot-platform/internal/api/rpc/iotpb"
+	"iot-platform/internal/database/sqlite/sqlitetest"
+	"iot-platform/internal/ratelimit"
+	"iot-platform/internal/service"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newClient(t *testing.T, opts ...grpc.ServerOption) *grpc.ClientConn {
+	repos := sqlitetest.NewRepositories(t)
+	server := rpc.NewServer(*service.NewDevicesService(repos.Devices), *service.NewSensorDataService(repos.SensorData), opts...)
+
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+	conn := newClient(t)
+	devices := iotpb.NewDeviceServiceClient(conn)
+	sensorData := iotpb.NewSensorDataServiceClient(conn)
+
+	device, err := devices.CreateDevice(ctx, &iotpb.CreateDeviceRequest{Name: "Boiler", Kind: "thermometer", ApiKey: "key-1"})
+	if err != nil {
+		t.Fatalf("CreateDevice: %v", err)
+	}
+	if device.Id == "" || device.CreatedAt == nil {
+		t.Errorf("unexpected device %+v", device)
+	}
+
+	if _, err := devices.GetDevice(ctx, &iotpb.GetDeviceRequest{Id: "missing"}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound, got %v", err)
+	}
+
+	stream, err := sensorData.IngestStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		err := stream.Send(&iotpb.IngestRequest{Readings: []*iotpb.SensorData{
+			{DeviceId: device.Id, MetricName: "temperature", Value: &iotpb.SensorData_Number{Number: float64(i)}, Unit: "Cel"},
+			{DeviceId: device.Id, MetricName: "door", Value: &iotpb.SensorData_Bool{Bool: true}},
+			{DeviceId: device.Id, MetricName: "bad name", Value: &iotpb.SensorData_Number{Number: 1}},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ingest, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("IngestStream: %v", err)
+	}
+	if ingest.Accepted != 6 || len(ingest.Errors) != 3 || ingest.Errors[2].Reading != 8 {
+		t.Errorf("expected 6 accepted and 3 errors ending at reading 8, got %+v", ingest)
+	}
+
+	query, err := sensorData.Query(ctx, &iotpb.QueryRequest{DeviceIds: []string{device.Id}, MetricName: "temperature", ValueType: "number", Unit: "degF"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values []float64
+	for {
+		reading, err := query.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		values = append(values, reading.GetNumber())
+	}
+	if len(values) != 3 || values[0] != 32 || values[2] != 35.6 {
+		t.Errorf("expected 3 readings converted to degF, got %v", values)
+	}
+
+	aggregate, err := sensorData.Aggregate(ctx, &iotpb.AggregateRequest{Func: "max", Query: &iotpb.QueryRequest{DeviceIds: []string{device.Id}}})
+	if err != nil || aggregate.Value != 2 || aggregate.Count != 3 {
+		t.Errorf("expected max 2 over 3 readings, got %+v, %v", aggregate, err)
+	}
+
+	if _, err := sensorData.Aggregate(ctx, &iotpb.AggregateRequest{Func: "median"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for an unknown aggregate, got %v", err)
+	}
+}
+
+func TestServer_ConsumerLimit(t *testing.T) {
+	ctx := context.Background()
+	// Calls without an API key count against the address and are never
+	// authenticated.
+	limits := service.NewConsumerLimits(ratelimit.NewLimiter(), ratelimit.Rate{PerSecond: 0.001, Burst: 4}, nil)
+	conn := newClient(t, grpc.UnaryInterceptor(rpc.UnaryConsumerLimit(limits)), grpc.StreamInterceptor(rpc.StreamConsumerLimit(limits)))
+	devices := iotpb.NewDeviceServiceClient(conn)
+	sensorData := iotpb.NewSensorDataServiceClient(conn)
+
+	device, err := devices.CreateDevice(ctx, &iotpb.CreateDeviceRequest{Name: "Boiler", Kind: "thermometer", ApiKey: "key-1"})
+	if err != nil {
+		t.Fatalf("CreateDevice: %v", err)
+	}
+
+	stream, err := sensorData.IngestStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		reading := &iotpb.SensorData{DeviceId: device.Id, MetricName: "temperature", Value: &iotpb.SensorData_Number{Number: float64(i)}}
+		if err := stream.Send(&iotpb.IngestRequest{Readings: []*iotpb.SensorData{reading}}); err != nil {
+			break
+		}
+	}
+	if _, err := stream.CloseAndRecv(); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected the fourth message to be ResourceExhausted, got %v", err)
+	}
+
+	if _, err := devices.GetDevice(ctx, &iotpb.GetDeviceRequest{Id: device.Id}); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected ResourceExhausted, got %v", err)
+	}
+}
@@ -0,0 +1,325 @@
+// Package archive moves aged sensor data out of the database into
+// compressed, checksummed segment files, and answers queries from them.
+//
+// Each segment is gzipped JSON lines of readings, stored as
+// segments/<name>.jsonl.gz. Its index, stored as index/<name>.json, holds
+// the segment's checksum and the time bounds of every device and metric in
+// it, so that queries only read the segments that can match.
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iot-platform/internal/model"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrChecksumMismatch = errors.New("archive segment checksum mismatch")
+
+// Segment is the index of one segment file.
+type Segment struct {
+	Name string `json:"name"`
+	// Checksum is the hex SHA-256 of the compressed file.
+	Checksum string    `json:"checksum"`
+	Bytes    int       `json:"bytes"`
+	Rows     int       `json:"rows"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Series   []Series  `json:"series"`
+}
+
+// Series bounds the readings of one device and metric in a segment. From
+// and To are both inclusive.
+type Series struct {
+	DeviceId   string    `json:"deviceId"`
+	MetricName string    `json:"metricName"`
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	Rows       int       `json:"rows"`
+}
+
+func (s *Segment) path() string {
+	return "segments/" + s.Name + ".jsonl.gz"
+}
+
+// overlaps reports whether the segment may hold readings matched by q.
+func (s *Segment) overlaps(q model.SensorDataQuery) bool {
+	for _, series := range s.Series {
+		if len(q.DeviceIds) > 0 && !slices.Contains(q.DeviceIds, series.DeviceId) {
+			continue
+		}
+		if q.MetricName != "" && q.MetricName != series.MetricName {
+			continue
+		}
+		if !q.From.IsZero() && series.To.Before(q.From) {
+			continue
+		}
+		if !q.To.IsZero() && !series.From.Before(q.To) {
+			continue
+		}
+		if q.After != nil && series.To.Before(q.After.Timestamp) {
+			continue
+		}
+		return true
+	}
+
+	return false
+}
+
+type Archive struct {
+	store Store
+
+	mu       sync.RWMutex
+	segments []*Segment
+}
+
+func NewArchive(store Store) *Archive {
+	return &Archive{store: store}
+}
+
+// Load reads the index of every segment in the store.
+func (a *Archive) Load(ctx context.Context) error {
+	names, err := a.store.List(ctx, "index/")
+	if err != nil {
+		return err
+	}
+
+	segments := make([]*Segment, 0, len(names))
+	for _, name := range names {
+		data, err := a.store.Get(ctx, name)
+		if err != nil {
+			return err
+		}
+		var segment Segment
+		if err := json.Unmarshal(data, &segment); err != nil {
+			return fmt.Errorf("index %s: %w", name, err)
+		}
+		segments = append(segments, &segment)
+	}
+
+	a.mu.Lock()
+	a.segments = segments
+	a.mu.Unlock()
+
+	return nil
+}
+
+// Segments returns the index of every segment.
+func (a *Archive) Segments() []*Segment {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return slices.Clone(a.segments)
+}
+
+// Horizon returns the newest archived timestamp, or the zero time when
+// nothing is archived.
+func (a *Archive) Horizon() time.Time {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var horizon time.Time
+	for _, segment := range a.segments {
+		if segment.To.After(horizon) {
+			horizon = segment.To
+		}
+	}
+
+	return horizon
+}
+
+// Write stores readings as a new segment. The segment file is written
+// before its index, so a segment is only ever found once it is complete.
+// Writing the same readings again replaces the segment.
+func (a *Archive) Write(ctx context.Context, sensorDataList []*model.SensorData) (*Segment, error) {
+	if len(sensorDataList) == 0 {
+		return nil, errors.New("no readings to archive")
+	}
+	sensorDataList = slices.Clone(sensorDataList)
+	sortSensorData(sensorDataList)
+
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	encoder := json.NewEncoder(writer)
+	series := make(map[[2]string]*Series)
+	for _, sensorData := range sensorDataList {
+		if err := encoder.Encode(sensorData); err != nil {
+			return nil, err
+		}
+
+		key := [2]string{sensorData.DeviceId, sensorData.MetricName}
+		s, ok := series[key]
+		if !ok {
+			s = &Series{DeviceId: sensorData.DeviceId, MetricName: sensorData.MetricName, From: sensorData.Timestamp.UTC()}
+			series[key] = s
+		}
+		s.To = sensorData.Timestamp.UTC()
+		s.Rows++
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	first, last := sensorDataList[0], sensorDataList[len(sensorDataList)-1]
+	checksum := sha256.Sum256(buffer.Bytes())
+	segment := &Segment{
+		Name:     fmt.Sprintf("%s-%d", first.Timestamp.UTC().Format("20060102T150405Z"), first.Id),
+		Checksum: hex.EncodeToString(checksum[:]),
+		Bytes:    buffer.Len(),
+		Rows:     len(sensorDataList),
+		From:     first.Timestamp.UTC(),
+		To:       last.Timestamp.UTC(),
+	}
+	for _, s := range series {
+		segment.Series = append(segment.Series, *s)
+	}
+	sort.Slice(segment.Series, func(i, j int) bool {
+		if segment.Series[i].DeviceId != segment.Series[j].DeviceId {
+			return segment.Series[i].DeviceId < segment.Series[j].DeviceId
+		}
+		return segment.Series[i].MetricName < segment.Series[j].MetricName
+	})
+
+	index, err := json.Marshal(segment)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.store.Put(ctx, segment.path(), buffer.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := a.store.Put(ctx, "index/"+segment.Name+".json", index); err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	a.segments = slices.DeleteFunc(a.segments, func(s *Segment) bool { return s.Name == segment.Name })
+	a.segments = append(a.segments, segment)
+	a.mu.Unlock()
+
+	return segment, nil
+}
+
+// Read returns the readings of a segment, verifying its checksum.
+func (a *Archive) Read(ctx context.Context, segment *Segment) ([]*model.SensorData, error) {
+	data, err := a.store.Get(ctx, segment.path())
+	if err != nil {
+		return nil, err
+	}
+	checksum := sha256.Sum256(data)
+	if hex.EncodeToString(checksum[:]) != segment.Checksum {
+		return nil, fmt.Errorf("%w: %s", ErrChecksumMismatch, segment.Name)
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	sensorDataList := make([]*model.SensorData, 0, segment.Rows)
+	decoder := json.NewDecoder(bufio.NewReader(reader))
+	for decoder.More() {
+		var sensorData model.SensorData
+		if err := decoder.Decode(&sensorData); err != nil {
+			return nil, fmt.Errorf("segment %s: %w", segment.Name, err)
+		}
+		sensorDataList = append(sensorDataList, &sensorData)
+	}
+
+	return sensorDataList, nil
+}
+
+// QuerySensorData returns the archived readings matched by q in time order,
+// the way a SensorDataRepository does.
+func (a *Archive) QuerySensorData(ctx context.Context, q model.SensorDataQuery) ([]*model.SensorData, error) {
+	limit := 0
+	if q.Limit > 0 {
+		limit = q.Offset + q.Limit
+	}
+	sensorDataList, err := a.match(ctx, q, limit)
+	if err != nil {
+		return nil, err
+	}
+	sortSensorData(sensorDataList)
+
+	if q.Limit > 0 {
+		start := min(q.Offset, len(sensorDataList))
+		end := min(start+q.Limit, len(sensorDataList))
+		sensorDataList = sensorDataList[start:end]
+	}
+
+	return sensorDataList, nil
+}
+
+// match returns the archived readings matched by q, unordered. A reading
+// archived twice, by a run interrupted before it deleted what it archived,
+// is returned once. Segments are read oldest first, and only until the
+// first limit readings in time order are known, unless limit is 0.
+func (a *Archive) match(ctx context.Context, q model.SensorDataQuery, limit int) ([]*model.SensorData, error) {
+	a.mu.RLock()
+	var segments []*Segment
+	for _, segment := range a.segments {
+		if segment.overlaps(q) {
+			segments = append(segments, segment)
+		}
+	}
+	a.mu.RUnlock()
+	slices.SortFunc(segments, func(a, b *Segment) int { return a.From.Compare(b.From) })
+
+	seen := make(map[int64]bool)
+	var matched []*model.SensorData
+	for i, segment := range segments {
+		// Later segments only hold readings from their From on, so readings
+		// before it are final.
+		if limit > 0 && i > 0 && countBefore(matched, segment.From) >= limit {
+			break
+		}
+
+		sensorDataList, err := a.Read(ctx, segment)
+		if err != nil {
+			return nil, err
+		}
+		for _, sensorData := range sensorDataList {
+			if seen[sensorData.Id] || !q.Matches(sensorData, false) {
+				continue
+			}
+			seen[sensorData.Id] = true
+			matched = append(matched, sensorData)
+		}
+	}
+
+	return matched, nil
+}
+
+func countBefore(sensorDataList []*model.SensorData, t time.Time) int {
+	count := 0
+	for _, sensorData := range sensorDataList {
+		if sensorData.Timestamp.Before(t) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// sortSensorData sorts readings into time order, the order of
+// query.Select.
+func sortSensorData(sensorDataList []*model.SensorData) {
+	slices.SortFunc(sensorDataList, func(a, b *model.SensorData) int {
+		if c := a.Timestamp.Compare(b.Timestamp); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Id, b.Id)
+	})
+}
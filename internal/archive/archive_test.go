@@ -0,0 +1,201 @@
+package archive_test
+
+import (
+	"context"
+	"errors"
+	"iot-platform/internal/archive"
+	"iot-platform/internal/database/sqlite/sqlitetest"
+	"iot-platform/internal/model"
+	"iot-platform/internal/service"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestArchiver(t *testing.T) {
+	ctx := context.Background()
+	repos := sqlitetest.NewRepositories(t)
+	deviceId, err := repos.Devices.SaveDevice(ctx, &model.Device{Name: "Boiler", Kind: "thermometer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, age := range []time.Duration{40 * 24 * time.Hour, 35 * 24 * time.Hour, 31 * 24 * time.Hour, time.Hour} {
+		sensorData := &model.SensorData{DeviceId: deviceId, MetricName: "temperature", MetricValue: float64(10 * (i + 1)), Unit: "°C", Timestamp: now.Add(-age), Labels: map[string]string{"room": "a"}}
+		if err := repos.SensorData.SaveSensorData(ctx, sensorData); err != nil {
+			t.Fatal(err)
+		}
+	}
+	status := &model.SensorData{DeviceId: deviceId, MetricName: "status", ValueType: model.ValueString, RawValue: []byte(`"ok"`), Timestamp: now.Add(-33 * 24 * time.Hour)}
+	if err := repos.SensorData.SaveSensorData(ctx, status); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	store, err := archive.NewDirStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensorArchive := archive.NewArchive(store)
+	archiver := archive.NewArchiver(repos.SensorData, sensorArchive, 30*24*time.Hour)
+
+	moved, err := archiver.ArchiveOnce(ctx, now)
+	if err != nil || moved != 4 {
+		t.Fatalf("expected 4 archived readings, got %d, %v", moved, err)
+	}
+	remaining, err := repos.SensorData.QuerySensorData(ctx, model.SensorDataQuery{})
+	if err != nil || len(remaining) != 1 || remaining[0].MetricValue != 40 {
+		t.Fatalf("expected only the recent reading in the database, got %v, %v", remaining, err)
+	}
+	if moved, err := archiver.ArchiveOnce(ctx, now); err != nil || moved != 0 {
+		t.Fatalf("expected nothing left to archive, got %d, %v", moved, err)
+	}
+
+	// A fresh archive finds the segment through its index.
+	reopened := archive.NewArchive(store)
+	if err := reopened.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	segments := reopened.Segments()
+	if len(segments) != 1 || segments[0].Rows != 4 || len(segments[0].Series) != 2 {
+		t.Fatalf("unexpected segments %+v", segments)
+	}
+	if !reopened.Horizon().Equal(now.Add(-31 * 24 * time.Hour)) {
+		t.Errorf("unexpected horizon %v", reopened.Horizon())
+	}
+
+	sensorDataService := service.NewSensorDataService(repos.SensorData, service.WithArchive(reopened))
+
+	all, err := sensorDataService.QuerySensorData(ctx, model.SensorDataQuery{DeviceIds: []string{deviceId}, MetricName: "temperature"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 4 || all[0].MetricValue != 10 || all[3].MetricValue != 40 || all[0].Labels["room"] != "a" || all[0].Unit != "°C" {
+		t.Fatalf("expected archived and current readings in time order, got %+v", all)
+	}
+
+	page, err := sensorDataService.QuerySensorData(ctx, model.SensorDataQuery{MetricName: "temperature", Limit: 2, Offset: 2})
+	if err != nil || len(page) != 2 || page[0].MetricValue != 30 || page[1].MetricValue != 40 {
+		t.Fatalf("unexpected page %+v, %v", page, err)
+	}
+
+	matched, err := sensorDataService.QuerySensorData(ctx, model.SensorDataQuery{Equals: []byte(`"ok"`)})
+	if err != nil || len(matched) != 1 || matched[0].MetricName != "status" {
+		t.Fatalf("expected the archived status reading, got %+v, %v", matched, err)
+	}
+
+	recent, err := sensorDataService.QuerySensorData(ctx, model.SensorDataQuery{From: now.Add(-24 * time.Hour)})
+	if err != nil || len(recent) != 1 {
+		t.Fatalf("expected one recent reading, got %+v, %v", recent, err)
+	}
+
+	avg, err := sensorDataService.AggregateSensorData(ctx, model.SensorDataQuery{MetricName: "temperature"}, model.AggregateAvg)
+	if err != nil || avg.Count != 4 || avg.Value != 25 {
+		t.Fatalf("expected an average of 25 over 4 readings, got %+v, %v", avg, err)
+	}
+
+	var exported int
+	err = sensorDataService.ExportSensorData(ctx, model.SensorDataQuery{}, func(list []*model.SensorData) error {
+		exported += len(list)
+		return nil
+	})
+	if err != nil || exported != 5 {
+		t.Fatalf("expected 5 exported readings, got %d, %v", exported, err)
+	}
+
+	// A corrupted segment is refused rather than read.
+	path := filepath.Join(dir, "segments", segments[0].Name+".jsonl.gz")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.QuerySensorData(ctx, model.SensorDataQuery{}); !errors.Is(err, archive.ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+}
+
+func TestArchive_InterruptedRun(t *testing.T) {
+	ctx := context.Background()
+	repos := sqlitetest.NewRepositories(t)
+	deviceId, err := repos.Devices.SaveDevice(ctx, &model.Device{Name: "Boiler", Kind: "thermometer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	var old []*model.SensorData
+	for i, age := range []time.Duration{40 * 24 * time.Hour, 35 * 24 * time.Hour, 31 * 24 * time.Hour, time.Hour} {
+		sensorData := &model.SensorData{DeviceId: deviceId, MetricName: "temperature", MetricValue: float64(10 * (i + 1)), Timestamp: now.Add(-age)}
+		if err := repos.SensorData.SaveSensorData(ctx, sensorData); err != nil {
+			t.Fatal(err)
+		}
+		if age > 30*24*time.Hour {
+			old = append(old, sensorData)
+		}
+	}
+
+	// A run that stored its segment but never deleted the readings.
+	store, err := archive.NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensorArchive := archive.NewArchive(store)
+	if _, err := sensorArchive.Write(ctx, old); err != nil {
+		t.Fatal(err)
+	}
+	sensorDataService := service.NewSensorDataService(repos.SensorData, service.WithArchive(sensorArchive))
+
+	count, err := sensorDataService.AggregateSensorData(ctx, model.SensorDataQuery{}, model.AggregateCount)
+	if err != nil || count.Count != 4 || count.Value != 4 {
+		t.Errorf("expected each of 4 readings counted once, got %+v, %v", count, err)
+	}
+	sum, err := sensorDataService.AggregateSensorData(ctx, model.SensorDataQuery{To: now.Add(-32 * 24 * time.Hour)}, model.AggregateSum)
+	if err != nil || sum.Count != 2 || sum.Value != 30 {
+		t.Errorf("expected a sum of 30 over 2 old readings, got %+v, %v", sum, err)
+	}
+}
+
+func TestArchive_QueryStopsAtLimit(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := archive.NewDirStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensorArchive := archive.NewArchive(store)
+
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	var segments []*archive.Segment
+	for i := range 2 {
+		var sensorDataList []*model.SensorData
+		for j := range 3 {
+			id := int64(3*i + j + 1)
+			sensorDataList = append(sensorDataList, &model.SensorData{Id: id, DeviceId: "boiler", MetricName: "temperature", MetricValue: float64(id), Timestamp: now.Add(time.Duration(id) * time.Hour)})
+		}
+		segment, err := sensorArchive.Write(ctx, sensorDataList)
+		if err != nil {
+			t.Fatal(err)
+		}
+		segments = append(segments, segment)
+	}
+
+	// The newer segment is corrupted, so reading it fails.
+	path := filepath.Join(dir, "segments", segments[1].Name+".jsonl.gz")
+	if err := os.WriteFile(path, []byte("corrupted"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := sensorArchive.QuerySensorData(ctx, model.SensorDataQuery{Limit: 2, Offset: 1})
+	if err != nil || len(page) != 2 || page[0].Id != 2 || page[1].Id != 3 {
+		t.Fatalf("expected readings 2 and 3 from the older segment alone, got %+v, %v", page, err)
+	}
+	if _, err := sensorArchive.QuerySensorData(ctx, model.SensorDataQuery{Limit: 4}); !errors.Is(err, archive.ErrChecksumMismatch) {
+		t.Fatalf("expected the newer segment to be read, got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package archive
+
+import (
+	"context"
+	"iot-platform/internal/model"
+	"iot-platform/internal/repository"
+	"log"
+	"time"
+)
+
+// segmentRows bounds the readings of one segment, and so the memory an
+// archive run and a segment read take.
+const segmentRows = 10000
+
+// Archiver moves readings older than its age out of the repository into an
+// archive.
+type Archiver struct {
+	repo    repository.SensorDataRepository
+	archive *Archive
+	age     time.Duration
+}
+
+func NewArchiver(repo repository.SensorDataRepository, archive *Archive, age time.Duration) *Archiver {
+	return &Archiver{
+		repo:    repo,
+		archive: archive,
+		age:     age,
+	}
+}
+
+// ArchiveOnce archives every reading older than now minus the archiver's
+// age, oldest first, and returns how many it moved. Readings are deleted
+// only once their segment is stored, so an interrupted run at worst leaves
+// readings in both places, which queries of the archive tolerate.
+func (ar *Archiver) ArchiveOnce(ctx context.Context, now time.Time) (int, error) {
+	cutoff := now.Add(-ar.age)
+	moved := 0
+	for {
+		sensorDataList, err := ar.repo.QuerySensorData(ctx, model.SensorDataQuery{To: cutoff, Limit: segmentRows})
+		if err != nil || len(sensorDataList) == 0 {
+			return moved, err
+		}
+
+		if _, err := ar.archive.Write(ctx, sensorDataList); err != nil {
+			return moved, err
+		}
+
+		ids := make([]int64, len(sensorDataList))
+		for i, sensorData := range sensorDataList {
+			ids[i] = sensorData.Id
+		}
+		if _, err := ar.repo.DeleteSensorDataByIds(ctx, ids); err != nil {
+			return moved, err
+		}
+		moved += len(sensorDataList)
+
+		if len(sensorDataList) < segmentRows {
+			return moved, nil
+		}
+	}
+}
+
+// Run archives every interval until ctx is cancelled.
+func (ar *Archiver) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		moved, err := ar.ArchiveOnce(ctx, time.Now())
+		if err != nil {
+			log.Printf("failed to archive sensor data: %v", err)
+		}
+		if moved > 0 {
+			log.Printf("Archived %d readings", moved)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var ErrNotFound = errors.New("archive object not found")
+
+// Store keeps the archive's segment and index files by name. Names are
+// slash separated paths.
+type Store interface {
+	Put(ctx context.Context, name string, data []byte) error
+	Get(ctx context.Context, name string) ([]byte, error)
+	// List returns the names starting with prefix, sorted.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// DirStore keeps files under a local directory.
+type DirStore struct {
+	dir string
+}
+
+func NewDirStore(dir string) (*DirStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &DirStore{dir: dir}, nil
+}
+
+// Put writes data under a temporary name and renames it, so a file is
+// either complete or missing.
+func (s *DirStore) Put(ctx context.Context, name string, data []byte) error {
+	path := filepath.Join(s.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+func (s *DirStore) Get(ctx context.Context, name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, filepath.FromSlash(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+
+	return data, err
+}
+
+func (s *DirStore) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(s.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+		if strings.HasPrefix(name, prefix) && !strings.HasSuffix(name, ".tmp") {
+			names = append(names, name)
+		}
+		return nil
+	})
+	sort.Strings(names)
+
+	return names, err
+}
@@ -0,0 +1,247 @@
+package coap
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	ackTimeout     = 2 * time.Second
+	maxRetransmits = 4
+)
+
+var ErrTimeout = errors.New("coap: no response")
+
+// Client sends requests to one server, for tools, tests and simulated
+// devices.
+type Client struct {
+	conn *net.UDPConn
+
+	mu        sync.Mutex
+	messageId uint16
+	pending   map[string]chan *Message
+	closed    chan struct{}
+	// AckTimeout is the initial retransmission timeout of confirmable
+	// requests; it doubles after every retransmission.
+	AckTimeout time.Duration
+}
+
+func Dial(addr string) (*Client, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, udpAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	var seed [2]byte
+	rand.Read(seed[:])
+	c := &Client{
+		conn:       conn,
+		messageId:  binary.BigEndian.Uint16(seed[:]),
+		pending:    make(map[string]chan *Message),
+		closed:     make(chan struct{}),
+		AckTimeout: ackTimeout,
+	}
+	go c.read()
+
+	return c, nil
+}
+
+func (c *Client) Close() error {
+	select {
+	case <-c.closed:
+		return nil
+	default:
+		close(c.closed)
+	}
+
+	return c.conn.Close()
+}
+
+func (c *Client) read() {
+	buf := make([]byte, maxMessageSize+1)
+	for {
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			select {
+			case <-c.closed:
+				return
+			default:
+				// Typically ICMP port unreachable; retransmission copes.
+				continue
+			}
+		}
+
+		message, err := Unmarshal(buf[:n])
+		if err != nil {
+			continue
+		}
+		if message.Type == Confirmable {
+			c.write(&Message{Type: Acknowledgement, MessageId: message.MessageId})
+		}
+		if message.Code == Empty {
+			continue
+		}
+
+		c.mu.Lock()
+		responses := c.pending[string(message.Token)]
+		c.mu.Unlock()
+		if responses == nil {
+			if message.Type == NonConfirmable {
+				// An observation the client no longer knows about.
+				c.write(&Message{Type: Reset, MessageId: message.MessageId})
+			}
+			continue
+		}
+
+		select {
+		case responses <- message:
+		default:
+		}
+	}
+}
+
+func (c *Client) write(message *Message) error {
+	data, err := message.Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = c.conn.Write(data)
+	return err
+}
+
+func (c *Client) nextMessageId() uint16 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.messageId++
+	return c.messageId
+}
+
+func (c *Client) register(size int) ([]byte, chan *Message) {
+	token := make([]byte, 8)
+	rand.Read(token)
+	responses := make(chan *Message, size)
+
+	c.mu.Lock()
+	c.pending[string(token)] = responses
+	c.mu.Unlock()
+
+	return token, responses
+}
+
+func (c *Client) unregister(token []byte) {
+	c.mu.Lock()
+	delete(c.pending, string(token))
+	c.mu.Unlock()
+}
+
+// Do sends request as a confirmable message, retransmitting it until a
+// response arrives or ctx is done. The message id and token are set by Do.
+func (c *Client) Do(ctx context.Context, request *Message) (*Message, error) {
+	token, responses := c.register(1)
+	defer c.unregister(token)
+
+	return c.exchange(ctx, request, token, responses)
+}
+
+func (c *Client) exchange(ctx context.Context, request *Message, token []byte, responses chan *Message) (*Message, error) {
+	request.Type = Confirmable
+	request.MessageId = c.nextMessageId()
+	request.Token = token
+
+	timeout := c.AckTimeout
+	for attempt := 0; attempt <= maxRetransmits; attempt++ {
+		if err := c.write(request); err != nil {
+			return nil, err
+		}
+
+		timer := time.NewTimer(timeout)
+		select {
+		case response := <-responses:
+			timer.Stop()
+			return response, nil
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+			timeout *= 2
+		}
+	}
+
+	return nil, ErrTimeout
+}
+
+// NewRequest builds a request for path with the given query.
+func NewRequest(code Code, path string, query url.Values) *Message {
+	request := &Message{Code: code}
+	request.SetPath(path)
+	if len(query) > 0 {
+		request.SetQuery(query)
+	}
+
+	return request
+}
+
+func (c *Client) Get(ctx context.Context, path string, query url.Values) (*Message, error) {
+	return c.Do(ctx, NewRequest(GET, path, query))
+}
+
+func (c *Client) Post(ctx context.Context, path string, query url.Values, contentFormat MediaType, payload []byte) (*Message, error) {
+	request := NewRequest(POST, path, query)
+	request.SetContentFormat(contentFormat)
+	request.Payload = payload
+
+	return c.Do(ctx, request)
+}
+
+// Observe registers interest in path and calls notify with every later
+// notification until ctx is done, then deregisters. It returns the initial
+// response, which has no Observe option when the server did not register
+// the client.
+func (c *Client) Observe(ctx context.Context, path string, query url.Values, notify func(*Message)) (*Message, error) {
+	token, responses := c.register(16)
+
+	request := NewRequest(GET, path, query)
+	request.SetObserve(0)
+	response, err := c.exchange(ctx, request, token, responses)
+	if err != nil {
+		c.unregister(token)
+		return nil, err
+	}
+	if _, ok := response.Observe(); !ok {
+		c.unregister(token)
+		return response, nil
+	}
+
+	go func() {
+		defer c.unregister(token)
+		for {
+			select {
+			case <-ctx.Done():
+				deregister := NewRequest(GET, path, query)
+				deregister.SetObserve(1)
+				deregister.Type = NonConfirmable
+				deregister.MessageId = c.nextMessageId()
+				deregister.Token = token
+				c.write(deregister)
+				return
+			case <-c.closed:
+				return
+			case notification := <-responses:
+				notify(notification)
+			}
+		}
+	}()
+
+	return response, nil
+}
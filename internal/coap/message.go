@@ -0,0 +1,370 @@
+// Package coap implements the parts of CoAP (RFC 7252) and its Observe
+// extension (RFC 7641) that the platform's constrained devices use:
+// confirmable and non-confirmable requests with piggybacked responses,
+// request paths and queries, content formats and observe notifications.
+// Block-wise transfer and DTLS are not supported.
+package coap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+type Type uint8
+
+const (
+	Confirmable Type = iota
+	NonConfirmable
+	Acknowledgement
+	Reset
+)
+
+// Code is a request method or response code, class.detail in 3 and 5 bits.
+type Code uint8
+
+const (
+	Empty  Code = 0
+	GET    Code = 1
+	POST   Code = 2
+	PUT    Code = 3
+	DELETE Code = 4
+
+	Created                  Code = 2<<5 | 1
+	Deleted                  Code = 2<<5 | 2
+	Valid                    Code = 2<<5 | 3
+	Changed                  Code = 2<<5 | 4
+	Content                  Code = 2<<5 | 5
+	BadRequest               Code = 4<<5 | 0
+	Unauthorized             Code = 4<<5 | 1
+	NotFound                 Code = 4<<5 | 4
+	MethodNotAllowed         Code = 4<<5 | 5
+	NotAcceptable            Code = 4<<5 | 6
+	RequestEntityTooLarge    Code = 4<<5 | 13
+	UnsupportedContentFormat Code = 4<<5 | 15
+	TooManyRequests          Code = 4<<5 | 29
+	InternalServerError      Code = 5<<5 | 0
+	ServiceUnavailable       Code = 5<<5 | 3
+)
+
+func (c Code) String() string {
+	return fmt.Sprintf("%d.%02d", c>>5, c&0x1f)
+}
+
+// IsRequest reports whether c is a method rather than a response code.
+func (c Code) IsRequest() bool {
+	return c > Empty && c>>5 == 0
+}
+
+type OptionNumber uint16
+
+const (
+	IfMatch       OptionNumber = 1
+	URIHost       OptionNumber = 3
+	ETag          OptionNumber = 4
+	IfNoneMatch   OptionNumber = 5
+	Observe       OptionNumber = 6
+	URIPort       OptionNumber = 7
+	LocationPath  OptionNumber = 8
+	URIPath       OptionNumber = 11
+	ContentFormat OptionNumber = 12
+	MaxAge        OptionNumber = 14
+	URIQuery      OptionNumber = 15
+	Accept        OptionNumber = 17
+	LocationQuery OptionNumber = 20
+	Size1         OptionNumber = 60
+)
+
+// critical options must be understood; unknown ones are rejected.
+func (n OptionNumber) critical() bool {
+	return n&1 == 1
+}
+
+type MediaType uint16
+
+const (
+	TextPlain     MediaType = 0
+	AppJSON       MediaType = 50
+	AppCBOR       MediaType = 60
+	AppSenMLJSON  MediaType = 110
+	AppSenMLCBOR  MediaType = 112
+	unknownFormat MediaType = 0xffff
+)
+
+type Option struct {
+	Number OptionNumber
+	Value  []byte
+}
+
+type Message struct {
+	Type      Type
+	Code      Code
+	MessageId uint16
+	Token     []byte
+	Options   []Option
+	Payload   []byte
+}
+
+var ErrMalformed = errors.New("malformed coap message")
+
+const payloadMarker = 0xff
+
+func (m *Message) Marshal() ([]byte, error) {
+	if len(m.Token) > 8 {
+		return nil, errors.New("token longer than 8 bytes")
+	}
+
+	buf := make([]byte, 4, 4+len(m.Token)+len(m.Payload)+32)
+	buf[0] = 1<<6 | byte(m.Type)<<4 | byte(len(m.Token))
+	buf[1] = byte(m.Code)
+	binary.BigEndian.PutUint16(buf[2:], m.MessageId)
+	buf = append(buf, m.Token...)
+
+	options := make([]Option, len(m.Options))
+	copy(options, m.Options)
+	sort.SliceStable(options, func(i, j int) bool { return options[i].Number < options[j].Number })
+
+	var previous OptionNumber
+	for _, option := range options {
+		delta := int(option.Number - previous)
+		previous = option.Number
+
+		deltaNibble, deltaExt := optionNibble(delta)
+		lengthNibble, lengthExt := optionNibble(len(option.Value))
+		buf = append(buf, byte(deltaNibble<<4|lengthNibble))
+		buf = append(buf, deltaExt...)
+		buf = append(buf, lengthExt...)
+		buf = append(buf, option.Value...)
+	}
+
+	if len(m.Payload) > 0 {
+		buf = append(buf, payloadMarker)
+		buf = append(buf, m.Payload...)
+	}
+
+	return buf, nil
+}
+
+func optionNibble(n int) (int, []byte) {
+	switch {
+	case n < 13:
+		return n, nil
+	case n < 269:
+		return 13, []byte{byte(n - 13)}
+	default:
+		return 14, binary.BigEndian.AppendUint16(nil, uint16(n-269))
+	}
+}
+
+func Unmarshal(data []byte) (*Message, error) {
+	if len(data) < 4 || data[0]>>6 != 1 {
+		return nil, ErrMalformed
+	}
+
+	m := &Message{
+		Type:      Type(data[0] >> 4 & 0x3),
+		Code:      Code(data[1]),
+		MessageId: binary.BigEndian.Uint16(data[2:]),
+	}
+	tokenLength := int(data[0] & 0xf)
+	if tokenLength > 8 || len(data) < 4+tokenLength {
+		return nil, ErrMalformed
+	}
+	m.Token = append([]byte(nil), data[4:4+tokenLength]...)
+
+	data = data[4+tokenLength:]
+	var number OptionNumber
+	for len(data) > 0 {
+		if data[0] == payloadMarker {
+			if len(data) == 1 {
+				return nil, ErrMalformed
+			}
+			m.Payload = append([]byte(nil), data[1:]...)
+			break
+		}
+
+		delta, length := int(data[0]>>4), int(data[0]&0xf)
+		data = data[1:]
+		var err error
+		if delta, data, err = readExtended(delta, data); err != nil {
+			return nil, err
+		}
+		if length, data, err = readExtended(length, data); err != nil {
+			return nil, err
+		}
+		if len(data) < length {
+			return nil, ErrMalformed
+		}
+
+		number += OptionNumber(delta)
+		m.Options = append(m.Options, Option{Number: number, Value: append([]byte(nil), data[:length]...)})
+		data = data[length:]
+	}
+
+	return m, nil
+}
+
+func readExtended(nibble int, data []byte) (int, []byte, error) {
+	switch nibble {
+	case 13:
+		if len(data) < 1 {
+			return 0, nil, ErrMalformed
+		}
+		return int(data[0]) + 13, data[1:], nil
+	case 14:
+		if len(data) < 2 {
+			return 0, nil, ErrMalformed
+		}
+		return int(binary.BigEndian.Uint16(data)) + 269, data[2:], nil
+	case 15:
+		return 0, nil, ErrMalformed
+	default:
+		return nibble, data, nil
+	}
+}
+
+func (m *Message) AddOption(number OptionNumber, value []byte) {
+	m.Options = append(m.Options, Option{Number: number, Value: value})
+}
+
+func (m *Message) AddUintOption(number OptionNumber, value uint32) {
+	m.AddOption(number, encodeUint(value))
+}
+
+func (m *Message) option(number OptionNumber) ([]byte, bool) {
+	for _, option := range m.Options {
+		if option.Number == number {
+			return option.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+func (m *Message) uintOption(number OptionNumber) (uint32, bool) {
+	value, ok := m.option(number)
+	if !ok || len(value) > 4 {
+		return 0, false
+	}
+
+	var n uint32
+	for _, b := range value {
+		n = n<<8 | uint32(b)
+	}
+
+	return n, true
+}
+
+func encodeUint(value uint32) []byte {
+	var buf []byte
+	for value > 0 {
+		buf = append([]byte{byte(value)}, buf...)
+		value >>= 8
+	}
+
+	return buf
+}
+
+// SetPath replaces the Uri-Path options with the segments of path.
+func (m *Message) SetPath(path string) {
+	m.removeOption(URIPath)
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		if segment != "" {
+			m.AddOption(URIPath, []byte(segment))
+		}
+	}
+}
+
+// Path returns the Uri-Path options joined with slashes, e.g. "/telemetry".
+func (m *Message) Path() string {
+	var segments []string
+	for _, option := range m.Options {
+		if option.Number == URIPath {
+			segments = append(segments, string(option.Value))
+		}
+	}
+
+	return "/" + strings.Join(segments, "/")
+}
+
+// SetQuery adds one Uri-Query option per value.
+func (m *Message) SetQuery(values url.Values) {
+	m.removeOption(URIQuery)
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		for _, value := range values[key] {
+			m.AddOption(URIQuery, []byte(key+"="+value))
+		}
+	}
+}
+
+func (m *Message) Query() url.Values {
+	values := url.Values{}
+	for _, option := range m.Options {
+		if option.Number == URIQuery {
+			key, value, _ := strings.Cut(string(option.Value), "=")
+			values.Add(key, value)
+		}
+	}
+
+	return values
+}
+
+func (m *Message) ContentFormat() (MediaType, bool) {
+	value, ok := m.uintOption(ContentFormat)
+	return MediaType(value), ok
+}
+
+func (m *Message) SetContentFormat(mediaType MediaType) {
+	m.removeOption(ContentFormat)
+	m.AddUintOption(ContentFormat, uint32(mediaType))
+}
+
+// Accept returns the media type the client asked for.
+func (m *Message) Accept() (MediaType, bool) {
+	value, ok := m.uintOption(Accept)
+	return MediaType(value), ok
+}
+
+func (m *Message) Observe() (uint32, bool) {
+	return m.uintOption(Observe)
+}
+
+func (m *Message) SetObserve(sequence uint32) {
+	m.removeOption(Observe)
+	m.AddUintOption(Observe, sequence&0xffffff)
+}
+
+func (m *Message) removeOption(number OptionNumber) {
+	options := m.Options[:0]
+	for _, option := range m.Options {
+		if option.Number != number {
+			options = append(options, option)
+		}
+	}
+	m.Options = options
+}
+
+// unknownCriticalOption returns the first critical option the server does
+// not implement.
+func (m *Message) unknownCriticalOption() (OptionNumber, bool) {
+	for _, option := range m.Options {
+		switch option.Number {
+		case URIHost, Observe, URIPort, URIPath, ContentFormat, URIQuery, Accept:
+			continue
+		}
+		if option.Number.critical() {
+			return option.Number, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,75 @@
+package coap
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	m := &Message{
+		Type:      Confirmable,
+		Code:      POST,
+		MessageId: 0x1234,
+		Token:     []byte{1, 2, 3, 4},
+		Payload:   []byte(`{"metrics":{"t":1}}`),
+	}
+	m.SetPath("/telemetry")
+	m.SetQuery(url.Values{"d": {"device-1"}, "k": {"a-rather-long-api-key-for-the-extended-length"}})
+	m.SetContentFormat(AppCBOR)
+	m.SetObserve(0)
+	// Option 60 needs an extended delta.
+	m.AddUintOption(Size1, 300)
+
+	data, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.Type != Confirmable || decoded.Code != POST || decoded.MessageId != 0x1234 || !bytes.Equal(decoded.Token, m.Token) {
+		t.Errorf("header did not round trip: %+v", decoded)
+	}
+	if decoded.Path() != "/telemetry" {
+		t.Errorf("expected path /telemetry, got %s", decoded.Path())
+	}
+	if query := decoded.Query(); query.Get("d") != "device-1" || query.Get("k") != "a-rather-long-api-key-for-the-extended-length" {
+		t.Errorf("query did not round trip: %v", query)
+	}
+	if format, ok := decoded.ContentFormat(); !ok || format != AppCBOR {
+		t.Errorf("expected content format 60, got %d", format)
+	}
+	if observe, ok := decoded.Observe(); !ok || observe != 0 {
+		t.Errorf("expected observe 0, got %d %v", observe, ok)
+	}
+	if size, ok := decoded.uintOption(Size1); !ok || size != 300 {
+		t.Errorf("expected size1 300, got %d", size)
+	}
+	if !bytes.Equal(decoded.Payload, m.Payload) {
+		t.Errorf("payload did not round trip: %s", decoded.Payload)
+	}
+}
+
+func TestUnmarshalMalformed(t *testing.T) {
+	for _, data := range [][]byte{
+		{},
+		{0x80, 0x01, 0, 0},       // version 2
+		{0x49, 0x01, 0, 0},       // token length 9
+		{0x40, 0x01, 0, 0, 0xff}, // payload marker without payload
+		{0x40, 0x01, 0, 0, 0xf0}, // reserved option delta
+		{0x40, 0x01, 0, 0, 0x13, 'a'},
+	} {
+		if _, err := Unmarshal(data); err == nil {
+			t.Errorf("expected %x to be malformed", data)
+		}
+	}
+}
+
+func TestCodeString(t *testing.T) {
+	if Content.String() != "2.05" || UnsupportedContentFormat.String() != "4.15" {
+		t.Errorf("unexpected code strings %s %s", Content, UnsupportedContentFormat)
+	}
+}
@@ -0,0 +1,438 @@
+package coap
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// exchangeLifetime is how long a confirmable request's response is kept so
+// that retransmissions are answered without handling the request again.
+const exchangeLifetime = 247 * time.Second
+
+const maxMessageSize = 1152
+
+// Request is an incoming request and where it came from.
+type Request struct {
+	*Message
+	Addr   net.Addr
+	server *Server
+}
+
+// Response is what a handler answers with.
+type Response struct {
+	Code          Code
+	ContentFormat MediaType
+	Payload       []byte
+}
+
+type Handler interface {
+	ServeCoAP(ctx context.Context, r *Request) *Response
+}
+
+type HandlerFunc func(ctx context.Context, r *Request) *Response
+
+func (f HandlerFunc) ServeCoAP(ctx context.Context, r *Request) *Response {
+	return f(ctx, r)
+}
+
+// Mux routes requests on their Uri-Path.
+type Mux struct {
+	handlers map[string]Handler
+}
+
+func NewMux() *Mux {
+	return &Mux{handlers: make(map[string]Handler)}
+}
+
+func (m *Mux) Handle(path string, handler Handler) {
+	m.handlers[path] = handler
+}
+
+func (m *Mux) HandleFunc(path string, handler func(ctx context.Context, r *Request) *Response) {
+	m.Handle(path, HandlerFunc(handler))
+}
+
+func (m *Mux) ServeCoAP(ctx context.Context, r *Request) *Response {
+	handler, ok := m.handlers[r.Path()]
+	if !ok {
+		return &Response{Code: NotFound}
+	}
+
+	return handler.ServeCoAP(ctx, r)
+}
+
+type exchangeKey struct {
+	addr      string
+	messageId uint16
+}
+
+type exchange struct {
+	response []byte // nil while the request is being handled
+	expires  time.Time
+}
+
+type observerKey struct {
+	addr  string
+	token string
+}
+
+// Server answers CoAP requests arriving on a packet connection.
+type Server struct {
+	Handler Handler
+
+	mu        sync.Mutex
+	conn      net.PacketConn
+	exchanges map[exchangeKey]*exchange
+	observers map[observerKey]*Observation
+	// notified maps the message id of recent notifications to their
+	// observation so that a Reset can cancel it.
+	notified  map[uint16]*Observation
+	messageId uint16
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+func NewServer(handler Handler) *Server {
+	var seed [2]byte
+	rand.Read(seed[:])
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Server{
+		Handler:   handler,
+		exchanges: make(map[exchangeKey]*exchange),
+		observers: make(map[observerKey]*Observation),
+		notified:  make(map[uint16]*Observation),
+		messageId: binary.BigEndian.Uint16(seed[:]),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+var ErrServerClosed = errors.New("coap: server closed")
+
+func (s *Server) ListenAndServe(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(conn)
+}
+
+// Serve reads requests from conn until Close. It always returns an error,
+// ErrServerClosed after Close.
+func (s *Server) Serve(conn net.PacketConn) error {
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+
+	go s.expireExchanges()
+
+	buf := make([]byte, maxMessageSize+1)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		message, err := Unmarshal(buf[:n])
+		if err != nil {
+			continue
+		}
+		s.receive(message, addr)
+	}
+}
+
+// Close stops the server and cancels every observation.
+func (s *Server) Close() error {
+	s.cancel()
+
+	s.mu.Lock()
+	conn := s.conn
+	observers := s.observers
+	s.observers = make(map[observerKey]*Observation)
+	s.mu.Unlock()
+
+	for _, observation := range observers {
+		observation.cancel()
+	}
+
+	var err error
+	if conn != nil {
+		err = conn.Close()
+	}
+	s.wg.Wait()
+
+	return err
+}
+
+func (s *Server) receive(message *Message, addr net.Addr) {
+	switch {
+	case message.Type == Reset:
+		s.mu.Lock()
+		observation := s.notified[message.MessageId]
+		s.mu.Unlock()
+		if observation != nil {
+			s.cancelObservation(observation)
+		}
+	case message.Code == Empty && message.Type == Confirmable:
+		// CoAP ping.
+		s.write(&Message{Type: Reset, MessageId: message.MessageId}, addr)
+	case message.Code.IsRequest() && (message.Type == Confirmable || message.Type == NonConfirmable):
+		s.request(message, addr)
+	}
+}
+
+func (s *Server) request(message *Message, addr net.Addr) {
+	key := exchangeKey{addr: addr.String(), messageId: message.MessageId}
+
+	s.mu.Lock()
+	if previous, ok := s.exchanges[key]; ok {
+		s.mu.Unlock()
+		if previous.response != nil {
+			s.writeBytes(previous.response, addr)
+		}
+		return
+	}
+	s.exchanges[key] = &exchange{expires: time.Now().Add(exchangeLifetime)}
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		request := &Request{Message: message, Addr: addr, server: s}
+		var response *Response
+		if number, ok := message.unknownCriticalOption(); ok {
+			log.Printf("Rejecting CoAP request with unknown critical option %d", number)
+			response = &Response{Code: BadRequest}
+		} else {
+			response = s.Handler.ServeCoAP(s.ctx, request)
+		}
+		if response == nil {
+			response = &Response{Code: InternalServerError}
+		}
+
+		reply := &Message{
+			Type:      Acknowledgement,
+			Code:      response.Code,
+			MessageId: message.MessageId,
+			Token:     message.Token,
+			Payload:   response.Payload,
+		}
+		if message.Type == NonConfirmable {
+			reply.Type = NonConfirmable
+			reply.MessageId = s.nextMessageId()
+		}
+		if len(response.Payload) > 0 {
+			reply.SetContentFormat(response.ContentFormat)
+		}
+		if observation := s.observation(addr, message.Token); observation != nil && response.Code < BadRequest {
+			reply.SetObserve(observation.next())
+		}
+
+		data, err := reply.Marshal()
+		if err != nil {
+			log.Printf("Failed to encode CoAP response: %v", err)
+			return
+		}
+
+		s.mu.Lock()
+		if current, ok := s.exchanges[key]; ok {
+			current.response = data
+		}
+		s.mu.Unlock()
+		s.writeBytes(data, addr)
+	}()
+}
+
+func (s *Server) expireExchanges() {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			for key, exchange := range s.exchanges {
+				if exchange.response != nil && now.After(exchange.expires) {
+					delete(s.exchanges, key)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *Server) nextMessageId() uint16 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messageId++
+	return s.messageId
+}
+
+func (s *Server) write(message *Message, addr net.Addr) error {
+	data, err := message.Marshal()
+	if err != nil {
+		return err
+	}
+
+	return s.writeBytes(data, addr)
+}
+
+func (s *Server) writeBytes(data []byte, addr net.Addr) error {
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+
+	if conn == nil {
+		return ErrServerClosed
+	}
+	_, err := conn.WriteTo(data, addr)
+	return err
+}
+
+// Observation is a client's registration to be notified of changes to a
+// resource (RFC 7641).
+type Observation struct {
+	server   *Server
+	key      observerKey
+	addr     net.Addr
+	token    []byte
+	done     chan struct{}
+	once     sync.Once
+	mu       sync.Mutex
+	sequence uint32
+	last     uint16
+}
+
+// Observe handles the Observe option of a GET request. It registers the
+// client and returns its observation when the option asks for that, cancels
+// a previous registration with the same token when it asks for
+// deregistration, and returns nil otherwise.
+func (r *Request) Observe() *Observation {
+	value, ok := r.Message.Observe()
+	if !ok || r.Code != GET {
+		return nil
+	}
+
+	s := r.server
+	key := observerKey{addr: r.Addr.String(), token: string(r.Token)}
+	s.mu.Lock()
+	previous := s.observers[key]
+	s.mu.Unlock()
+	if previous != nil {
+		s.cancelObservation(previous)
+	}
+	if value != 0 || s.ctx.Err() != nil {
+		return nil
+	}
+
+	observation := &Observation{
+		server: s,
+		key:    key,
+		addr:   r.Addr,
+		token:  r.Token,
+		done:   make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.observers[key] = observation
+	s.mu.Unlock()
+
+	return observation
+}
+
+func (s *Server) observation(addr net.Addr, token []byte) *Observation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.observers[observerKey{addr: addr.String(), token: string(token)}]
+}
+
+func (s *Server) cancelObservation(observation *Observation) {
+	s.mu.Lock()
+	if s.observers[observation.key] == observation {
+		delete(s.observers, observation.key)
+	}
+	if s.notified[observation.last] == observation {
+		delete(s.notified, observation.last)
+	}
+	s.mu.Unlock()
+
+	observation.cancel()
+}
+
+func (o *Observation) cancel() {
+	o.once.Do(func() { close(o.done) })
+}
+
+// Done is closed when the client deregisters, rejects a notification or the
+// server closes.
+func (o *Observation) Done() <-chan struct{} {
+	return o.done
+}
+
+// Cancel ends the observation from the server side.
+func (o *Observation) Cancel() {
+	o.server.cancelObservation(o)
+}
+
+func (o *Observation) next() uint32 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.sequence++
+	return o.sequence
+}
+
+// Notify sends the current state of the resource as a non-confirmable
+// notification.
+func (o *Observation) Notify(response *Response) error {
+	select {
+	case <-o.done:
+		return ErrServerClosed
+	default:
+	}
+
+	s := o.server
+	message := &Message{
+		Type:      NonConfirmable,
+		Code:      response.Code,
+		MessageId: s.nextMessageId(),
+		Token:     o.token,
+		Payload:   response.Payload,
+	}
+	if len(response.Payload) > 0 {
+		message.SetContentFormat(response.ContentFormat)
+	}
+	message.SetObserve(o.next())
+
+	s.mu.Lock()
+	delete(s.notified, o.last)
+	o.last = message.MessageId
+	s.notified[message.MessageId] = o
+	s.mu.Unlock()
+
+	if err := s.write(message, o.addr); err != nil {
+		return err
+	}
+	// Any response other than a success ends the observation.
+	if response.Code >= BadRequest {
+		s.cancelObservation(o)
+	}
+
+	return nil
+}
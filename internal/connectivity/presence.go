@@ -0,0 +1,148 @@
+package connectivity
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PresenceStatus is whether a device was heard from recently.
+type PresenceStatus struct {
+	DeviceId string    `json:"deviceId"`
+	Online   bool      `json:"online"`
+	LastSeen time.Time `json:"lastSeen,omitempty"`
+}
+
+// Presence tracks when devices that do not hold a connection, such as CoAP
+// devices sending heartbeats, were last heard from. A device is online until
+// timeout passes without a heartbeat or telemetry.
+type Presence struct {
+	timeout time.Duration
+
+	mu       sync.Mutex
+	lastSeen map[string]time.Time
+	online   map[string]bool
+	watchers map[string]map[chan PresenceStatus]struct{}
+}
+
+func NewPresence(timeout time.Duration) *Presence {
+	return &Presence{
+		timeout:  timeout,
+		lastSeen: make(map[string]time.Time),
+		online:   make(map[string]bool),
+		watchers: make(map[string]map[chan PresenceStatus]struct{}),
+	}
+}
+
+// Touch records that the device was heard from at t.
+func (p *Presence) Touch(deviceId string, t time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if t.After(p.lastSeen[deviceId]) {
+		p.lastSeen[deviceId] = t
+	}
+	if !p.online[deviceId] && time.Since(p.lastSeen[deviceId]) < p.timeout {
+		p.online[deviceId] = true
+		p.notify(deviceId)
+	}
+}
+
+func (p *Presence) Status(deviceId string) PresenceStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.status(deviceId)
+}
+
+func (p *Presence) status(deviceId string) PresenceStatus {
+	return PresenceStatus{
+		DeviceId: deviceId,
+		Online:   p.online[deviceId],
+		LastSeen: p.lastSeen[deviceId],
+	}
+}
+
+// Online returns the ids of the online devices in order.
+func (p *Presence) Online() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var deviceIds []string
+	for deviceId, online := range p.online {
+		if online {
+			deviceIds = append(deviceIds, deviceId)
+		}
+	}
+	sort.Strings(deviceIds)
+
+	return deviceIds
+}
+
+// Watch returns a channel receiving the device's status whenever it goes
+// online or offline. Only the latest change is kept for slow readers.
+// Stop must be called once the caller is done.
+func (p *Presence) Watch(deviceId string) (changes <-chan PresenceStatus, stop func()) {
+	ch := make(chan PresenceStatus, 1)
+
+	p.mu.Lock()
+	if p.watchers[deviceId] == nil {
+		p.watchers[deviceId] = make(map[chan PresenceStatus]struct{})
+	}
+	p.watchers[deviceId][ch] = struct{}{}
+	p.mu.Unlock()
+
+	return ch, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		delete(p.watchers[deviceId], ch)
+		if len(p.watchers[deviceId]) == 0 {
+			delete(p.watchers, deviceId)
+		}
+	}
+}
+
+func (p *Presence) notify(deviceId string) {
+	status := p.status(deviceId)
+	for ch := range p.watchers[deviceId] {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- status
+	}
+}
+
+// Expire marks devices not heard from within the timeout as offline.
+func (p *Presence) Expire(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for deviceId, online := range p.online {
+		if online && now.Sub(p.lastSeen[deviceId]) >= p.timeout {
+			p.online[deviceId] = false
+			p.notify(deviceId)
+		}
+	}
+}
+
+// Run expires devices until ctx is done.
+func (p *Presence) Run(ctx context.Context) {
+	interval := p.timeout / 10
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			p.Expire(now)
+		}
+	}
+}
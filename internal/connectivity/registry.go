@@ -0,0 +1,107 @@
+// Package connectivity tracks devices holding a persistent connection so
+// that commands and configuration can be pushed to them.
+package connectivity
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+)
+
+const (
+	// MessageTelemetry carries readings from the device, shaped like the
+	// body of POST /sensor-data.
+	MessageTelemetry = "telemetry"
+	// MessageAck answers a message with the same id.
+	MessageAck     = "ack"
+	MessageError   = "error"
+	MessageCommand = "command"
+	MessageConfig  = "config"
+)
+
+// Message is a frame exchanged with a connected device.
+type Message struct {
+	Type string          `json:"type"`
+	Id   string          `json:"id,omitempty"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+var ErrNotConnected = errors.New("device is not connected")
+
+// Session is one device's connection.
+type Session interface {
+	Send(message Message) error
+	Close(reason string) error
+}
+
+type Registry struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		sessions: make(map[string]Session),
+	}
+}
+
+// Register makes session the device's connection, closing any previous one.
+func (r *Registry) Register(deviceId string, session Session) {
+	r.mu.Lock()
+	previous := r.sessions[deviceId]
+	r.sessions[deviceId] = session
+	r.mu.Unlock()
+
+	if previous != nil {
+		previous.Close("replaced by a new connection")
+	}
+}
+
+// Unregister forgets session unless the device has reconnected since.
+func (r *Registry) Unregister(deviceId string, session Session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.sessions[deviceId] == session {
+		delete(r.sessions, deviceId)
+	}
+}
+
+func (r *Registry) Send(deviceId string, message Message) error {
+	r.mu.Lock()
+	session := r.sessions[deviceId]
+	r.mu.Unlock()
+
+	if session == nil {
+		return ErrNotConnected
+	}
+
+	return session.Send(message)
+}
+
+// Connected returns the ids of the connected devices in order.
+func (r *Registry) Connected() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deviceIds := make([]string, 0, len(r.sessions))
+	for deviceId := range r.sessions {
+		deviceIds = append(deviceIds, deviceId)
+	}
+	sort.Strings(deviceIds)
+
+	return deviceIds
+}
+
+// CloseAll disconnects every device, e.g. on shutdown.
+func (r *Registry) CloseAll(reason string) {
+	r.mu.Lock()
+	sessions := r.sessions
+	r.sessions = make(map[string]Session)
+	r.mu.Unlock()
+
+	for _, session := range sessions {
+		session.Close(reason)
+	}
+}
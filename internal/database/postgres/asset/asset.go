@@ -0,0 +1,22 @@
+package asset
+
+import (
+	"database/sql"
+	"errors"
+	"iot-platform/internal/database/postgres"
+	"iot-platform/internal/database/query"
+)
+
+type AssetPostgresRepository struct {
+	*query.AssetRepository
+}
+
+func NewAssetPostgresRepository(db *sql.DB) (*AssetPostgresRepository, error) {
+	if err := db.Ping(); err != nil {
+		return nil, errors.New("failed to connect to the database: " + err.Error())
+	}
+
+	return &AssetPostgresRepository{
+		AssetRepository: query.NewAssetRepository(db, postgres.Dialect),
+	}, nil
+}
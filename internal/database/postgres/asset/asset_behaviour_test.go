@@ -0,0 +1,11 @@
+package asset_test
+
+import (
+	"iot-platform/internal/database/postgres/postgrestest"
+	"iot-platform/internal/repository/repositorytest"
+	"testing"
+)
+
+func TestAssetPostgresRepository_Behaviour(t *testing.T) {
+	repositorytest.TestAssetsRepository(t, postgrestest.NewRepositories)
+}
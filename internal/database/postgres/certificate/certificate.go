@@ -0,0 +1,21 @@
+package certificate
+
+import (
+	"database/sql"
+	"errors"
+	"iot-platform/internal/database/query"
+)
+
+type CertificatePostgresRepository struct {
+	*query.CertificateRepository
+}
+
+func NewCertificatePostgresRepository(db *sql.DB) (*CertificatePostgresRepository, error) {
+	if err := db.Ping(); err != nil {
+		return nil, errors.New("failed to connect to the database: " + err.Error())
+	}
+
+	return &CertificatePostgresRepository{
+		CertificateRepository: query.NewCertificateRepository(db),
+	}, nil
+}
@@ -0,0 +1,11 @@
+package certificate_test
+
+import (
+	"iot-platform/internal/database/postgres/postgrestest"
+	"iot-platform/internal/repository/repositorytest"
+	"testing"
+)
+
+func TestCertificatePostgresRepository_Behaviour(t *testing.T) {
+	repositorytest.TestCertificatesRepository(t, postgrestest.NewRepositories)
+}
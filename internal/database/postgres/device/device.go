@@ -5,7 +5,9 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"iot-platform/internal/database/query"
 	"iot-platform/internal/model"
+	"iot-platform/internal/repository"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,74 +15,115 @@ import (
 )
 
 type DevicePostgresRepository struct {
-	db *sql.DB
+	db     *sql.DB
+	outbox *query.Outbox
 }
 
-func NewDevicePostgresRepository(db *sql.DB) (*DevicePostgresRepository, error) {
+func NewDevicePostgresRepository(db *sql.DB, opts ...query.Option) (*DevicePostgresRepository, error) {
 	if err := db.Ping(); err != nil {
 		return nil, errors.New("failed to connect to the database: " + err.Error())
 	}
 
 	return &DevicePostgresRepository{
-		db: db,
+		db:     db,
+		outbox: query.NewOptions(opts...).Outbox,
 	}, nil
 }
 
 func (de *DevicePostgresRepository) SaveDevice(ctx context.Context, device *model.Device) (string, error) {
-	if device.Id == "" {
-		fmt.Println("Test")
-		newDeviceId := uuid.New().String()
-		_, err := de.db.Exec(`INSERT INTO devices (id, name, kind, api_key) VALUES ($1, $2, $3, $4)`, newDeviceId, device.Name, device.Kind, device.ApiKey)
+	id := device.Id
+	err := de.outbox.Record(ctx, de.db, func(ex query.Execer) error {
+		if id == "" {
+			id = uuid.New().String()
+			_, err := ex.ExecContext(ctx, `INSERT INTO devices (id, name, kind, api_key, state) VALUES ($1, $2, $3, $4, $5)`, id, device.Name, device.Kind, device.ApiKey, query.DeviceState(device))
+			return err
+		}
+
+		_, err := ex.ExecContext(ctx, `UPDATE devices SET name = $1, kind = $2, api_key = $3, updated_at = $4 WHERE id = $5`, device.Name, device.Kind, device.ApiKey, time.Now(), id)
+		return err
+	}, func(ex query.Execer) (*model.Change, error) {
+		return query.DeviceSaved(ctx, ex, id)
+	})
+
+	return id, err
+}
+
+func (de *DevicePostgresRepository) FindDeviceById(ctx context.Context, id string) (*model.Device, error) {
+	row := de.db.QueryRow(`SELECT `+query.DeviceColumns+` FROM devices WHERE id = $1 AND deleted_at IS NULL`, id)
+
+	return query.ScanDevice(row)
+}
 
+func (de *DevicePostgresRepository) DeleteDevice(ctx context.Context, id string) error {
+	return de.outbox.Record(ctx, de.db, func(ex query.Execer) error {
+		res, err := ex.ExecContext(ctx, `UPDATE devices SET deleted_at = now(), updated_at = now() WHERE id = $1 AND deleted_at IS NULL`, id)
 		if err != nil {
-			return newDeviceId, err
+			return err
 		}
 
-		return newDeviceId, nil
-	} else {
-		_, err := de.db.Exec(`UPDATE devices SET name = $1, kind = $2, api_key = $3, updated_at = $4 WHERE id = $5`, device.Name, device.Kind, device.ApiKey, time.Now(), device.Id)
+		rowsAffected, err := res.RowsAffected()
 		if err != nil {
-			return device.Id, err
+			return err
 		}
 
-		return device.Id, nil
-	}
+		if rowsAffected == 0 {
+			return fmt.Errorf("no device found with id: %s", id)
+		}
 
+		return nil
+	}, func(ex query.Execer) (*model.Change, error) {
+		return query.DeviceDeleted(id), nil
+	})
 }
 
-func (de *DevicePostgresRepository) FindDeviceById(ctx context.Context, id string) (*model.Device, error) {
-	row := de.db.QueryRow(`SELECT devices.id, devices.name, devices.kind, devices.api_key, devices.created_at, devices.updated_at FROM devices WHERE id = $1`, id)
+func (de *DevicePostgresRepository) RestoreDevice(ctx context.Context, id string) error {
+	return de.outbox.Record(ctx, de.db, func(ex query.Execer) error {
+		res, err := ex.ExecContext(ctx, `UPDATE devices SET deleted_at = NULL, updated_at = now() WHERE id = $1 AND deleted_at IS NOT NULL`, id)
+		if err != nil {
+			return err
+		}
 
-	var device model.Device
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
 
-	err := row.Scan(&device.Id, &device.Name, &device.Kind, &device.ApiKey, &device.CreatedAt, &device.UpdatedAt)
-	if err != nil {
-		return nil, err
-	}
+		if rowsAffected == 0 {
+			return repository.ErrNotFound
+		}
 
-	return &device, nil
+		return nil
+	}, func(ex query.Execer) (*model.Change, error) {
+		return query.DeviceSaved(ctx, ex, id)
+	})
 }
 
-func (de *DevicePostgresRepository) DeleteDevice(ctx context.Context, id string) error {
-	res, err := de.db.Exec(`DELETE FROM devices WHERE id = $1`, id)
-	if err != nil {
-		return err
-	}
+func (de *DevicePostgresRepository) UpdateDeviceState(ctx context.Context, id string, from, to model.DeviceState) error {
+	return de.outbox.Record(ctx, de.db, func(ex query.Execer) error {
+		res, err := ex.ExecContext(ctx, `UPDATE devices SET state = $1, updated_at = now() WHERE id = $2 AND state = $3 AND deleted_at IS NULL`, string(to), id, string(from))
+		if err != nil {
+			return err
+		}
 
-	rowsAffected, err := res.RowsAffected()
-	if err != nil {
-		return err
-	}
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("no device found with id: %s", id)
-	}
+		if rowsAffected == 0 {
+			return repository.ErrNotFound
+		}
 
-	return nil
+		return nil
+	}, func(ex query.Execer) (*model.Change, error) {
+		return query.DeviceSaved(ctx, ex, id)
+	})
 }
 
-func (de *DevicePostgresRepository) ListDevices(ctx context.Context, page int, pageSize int) ([]*model.Device, error) {
-	rows, err := de.db.Query(`SELECT devices.id, devices.name, devices.kind, devices.api_key, devices.created_at, devices.updated_at FROM devices ORDER BY created_at OFFSET $1 LIMIT $2`, (page-1)*pageSize, pageSize)
+func (de *DevicePostgresRepository) ListDevices(ctx context.Context, filter model.DeviceFilter, page int, pageSize int) ([]*model.Device, error) {
+	where, args := query.DeviceWhere(filter)
+	args = append(args, (page-1)*pageSize, pageSize)
+	rows, err := de.db.Query(fmt.Sprintf(`SELECT %s FROM devices %s ORDER BY created_at OFFSET $%d LIMIT $%d`, query.DeviceColumns, where, len(args)-1, len(args)), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -88,13 +131,12 @@ func (de *DevicePostgresRepository) ListDevices(ctx context.Context, page int, p
 
 	var devices []*model.Device
 	for rows.Next() {
-		var device model.Device
-		err := rows.Scan(&device.Id, &device.Name, &device.Kind, &device.ApiKey, &device.UpdatedAt, &device.CreatedAt)
+		device, err := query.ScanDevice(rows)
 		if err != nil {
 			return nil, err
 		}
 
-		devices = append(devices, &device)
+		devices = append(devices, device)
 	}
 
 	err = rows.Err()
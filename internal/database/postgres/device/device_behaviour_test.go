@@ -0,0 +1,11 @@
+package device_test
+
+import (
+	"iot-platform/internal/database/postgres/postgrestest"
+	"iot-platform/internal/repository/repositorytest"
+	"testing"
+)
+
+func TestDevicePostgresRepository_Behaviour(t *testing.T) {
+	repositorytest.TestDevicesRepository(t, postgrestest.NewRepositories)
+}
@@ -34,9 +34,9 @@ func TestDevicePostgresRepository_SaveDevice_InsertSuccess(t *testing.T) {
 		Id:     "",
 	}
 
-	mock.ExpectExec(`^INSERT INTO devices \(id, name, kind, api_key\) VALUES \(\$1, \$2, \$3, \$4\)$`).
-		WithArgs(sqlmock.AnyArg(), testDevice.Name, testDevice.Kind, testDevice.ApiKey). // Arguments: ID, Name, Kind, ApiKey
-		WillReturnResult(sqlmock.NewResult(1, 1))                                        // Simulate 1 row inserted, 1 row affected (ID is not auto-increment here)
+	mock.ExpectExec(`^INSERT INTO devices \(id, name, kind, api_key, state\) VALUES \(\$1, \$2, \$3, \$4, \$5\)$`).
+		WithArgs(sqlmock.AnyArg(), testDevice.Name, testDevice.Kind, testDevice.ApiKey, "active"). // Arguments: ID, Name, Kind, ApiKey, State
+		WillReturnResult(sqlmock.NewResult(1, 1))                                                  // Simulate 1 row inserted, 1 row affected (ID is not auto-increment here)
 
 	ctx := context.Background()
 	_, err = repo.SaveDevice(ctx, testDevice)
@@ -70,8 +70,8 @@ func TestDevicePostgresRepository_SaveDevice_InsertFailure(t *testing.T) {
 	}
 	insertErr := errors.New("failed to insert")
 
-	mock.ExpectExec(`^INSERT INTO devices \(id, name, kind, api_key\) VALUES \(\$1, \$2, \$3, \$4\)$`).
-		WithArgs(sqlmock.AnyArg(), testDevice.Name, testDevice.Kind, testDevice.ApiKey).
+	mock.ExpectExec(`^INSERT INTO devices \(id, name, kind, api_key, state\) VALUES \(\$1, \$2, \$3, \$4, \$5\)$`).
+		WithArgs(sqlmock.AnyArg(), testDevice.Name, testDevice.Kind, testDevice.ApiKey, "active").
 		WillReturnError(insertErr)
 
 	_, err = repo.SaveDevice(context.Background(), testDevice)
@@ -230,7 +230,7 @@ func TestDevicePostgresRepository_FindDeviceById_NotFound(t *testing.T) {
 	testId := "Not Found Device Id"
 	notFoundErr := errors.New("device not found error")
 
-	mock.ExpectQuery(`^SELECT devices.id, devices.name, devices.kind, devices.api_key, devices.created_at, devices.updated_at FROM devices WHERE id = \$1$`).
+	mock.ExpectQuery(`^SELECT id, name, kind, api_key, state, serial, created_at, updated_at, deleted_at FROM devices WHERE id = \$1 AND deleted_at IS NULL$`).
 		WithArgs(testId).
 		WillReturnError(notFoundErr)
 
@@ -259,10 +259,10 @@ func TestDevicePostgresRepository_FindDeviceById_Success(t *testing.T) {
 
 	testId := uuid.NewString()
 
-	rows := sqlmock.NewRows([]string{"id", "name", "kind", "api_key", "created_at", "updated_at"})
-	rows.AddRow(testId, "Success Name", "Success Kind", "success-api-key", time.Now(), time.Now())
+	rows := sqlmock.NewRows([]string{"id", "name", "kind", "api_key", "state", "serial", "created_at", "updated_at", "deleted_at"})
+	rows.AddRow(testId, "Success Name", "Success Kind", "success-api-key", "active", nil, time.Now(), time.Now(), nil)
 
-	mock.ExpectQuery(`^SELECT devices.id, devices.name, devices.kind, devices.api_key, devices.created_at, devices.updated_at FROM devices WHERE id = \$1$`).
+	mock.ExpectQuery(`^SELECT id, name, kind, api_key, state, serial, created_at, updated_at, deleted_at FROM devices WHERE id = \$1 AND deleted_at IS NULL$`).
 		WithArgs(testId).
 		WillReturnRows(rows)
 
@@ -296,7 +296,7 @@ func TestDevicePostgresRepository_DeleteDevice_NotFound(t *testing.T) {
 
 	testId := "Not Found Device Id"
 
-	mock.ExpectExec(`^DELETE FROM devices WHERE id = \$1$`).
+	mock.ExpectExec(`^UPDATE devices SET deleted_at = now\(\), updated_at = now\(\) WHERE id = \$1 AND deleted_at IS NULL$`).
 		WithArgs(testId).
 		WillReturnResult(sqlmock.NewResult(0, 0))
 
@@ -325,7 +325,7 @@ func TestDevicePostgresRepository_DeleteDevice_Success(t *testing.T) {
 
 	testId := "Success Id"
 
-	mock.ExpectExec(`^DELETE FROM devices WHERE id = \$1$`).
+	mock.ExpectExec(`^UPDATE devices SET deleted_at = now\(\), updated_at = now\(\) WHERE id = \$1 AND deleted_at IS NULL$`).
 		WithArgs(testId).
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
@@ -355,7 +355,7 @@ func TestDevicePostgresRepository_DeleteDevice_DeleteDbError(t *testing.T) {
 	testId := "Success Id"
 	dbErr := errors.New("db error")
 
-	mock.ExpectExec(`^DELETE FROM devices WHERE id = \$1$`).
+	mock.ExpectExec(`^UPDATE devices SET deleted_at = now\(\), updated_at = now\(\) WHERE id = \$1 AND deleted_at IS NULL$`).
 		WithArgs(testId).
 		WillReturnError(dbErr)
 
@@ -385,7 +385,7 @@ func TestDevicePostgresRepository_DeleteDevice_ResultError(t *testing.T) {
 	testId := "Success Id"
 	resErr := errors.New("result error")
 
-	mock.ExpectExec(`^DELETE FROM devices WHERE id = \$1$`).
+	mock.ExpectExec(`^UPDATE devices SET deleted_at = now\(\), updated_at = now\(\) WHERE id = \$1 AND deleted_at IS NULL$`).
 		WithArgs(testId).
 		WillReturnResult(sqlmock.NewErrorResult(resErr))
 
@@ -414,13 +414,13 @@ func TestDevicePostgresRepository_ListDevices_EmptyList(t *testing.T) {
 
 	testPage := 1
 	testPageSize := 10
-	testRows := sqlmock.NewRows([]string{"id", "name", "kind", "api_key", "created_at", "updated_at"})
+	testRows := sqlmock.NewRows([]string{"id", "name", "kind", "api_key", "state", "serial", "created_at", "updated_at", "deleted_at"})
 
-	mock.ExpectQuery(`^SELECT devices.id, devices.name, devices.kind, devices.api_key, devices.created_at, devices.updated_at FROM devices ORDER BY created_at OFFSET \$1 LIMIT \$2$`).
+	mock.ExpectQuery(`^SELECT id, name, kind, api_key, state, serial, created_at, updated_at, deleted_at FROM devices WHERE deleted_at IS NULL ORDER BY created_at OFFSET \$1 LIMIT \$2$`).
 		WithArgs((testPage-1)*testPageSize, testPageSize).
 		WillReturnRows(testRows)
 
-	_, err = repo.ListDevices(context.Background(), testPage, testPageSize)
+	_, err = repo.ListDevices(context.Background(), model.DeviceFilter{}, testPage, testPageSize)
 
 	if err != nil {
 		t.Errorf("expected no error, got %s", err)
@@ -445,11 +445,11 @@ func TestDevicePostgresRepository_ListDevices_SelectDbError(t *testing.T) {
 
 	dbErr := errors.New("db error")
 
-	mock.ExpectQuery(`^SELECT devices.id, devices.name, devices.kind, devices.api_key, devices.created_at, devices.updated_at FROM devices ORDER BY created_at OFFSET \$1 LIMIT \$2$`).
+	mock.ExpectQuery(`^SELECT id, name, kind, api_key, state, serial, created_at, updated_at, deleted_at FROM devices WHERE deleted_at IS NULL ORDER BY created_at OFFSET \$1 LIMIT \$2$`).
 		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).
 		WillReturnError(dbErr)
 
-	_, err = repo.ListDevices(context.Background(), 1, 10)
+	_, err = repo.ListDevices(context.Background(), model.DeviceFilter{}, 1, 10)
 
 	if err == nil {
 		t.Error("expected error, got nil")
@@ -473,15 +473,15 @@ func TestDevicePostgresRepository_ListDevices_RowsError(t *testing.T) {
 	}
 
 	dbErr := errors.New("db error")
-	testRows := sqlmock.NewRows([]string{"id", "name", "kind", "api_key", "created_at", "updated_at"})
-	testRows.AddRow("Read Error Id", "Read Error Name", "Read Error Kind", "read-error-api-key", time.Now(), time.Now())
+	testRows := sqlmock.NewRows([]string{"id", "name", "kind", "api_key", "state", "serial", "created_at", "updated_at", "deleted_at"})
+	testRows.AddRow("Read Error Id", "Read Error Name", "Read Error Kind", "read-error-api-key", "active", nil, time.Now(), time.Now(), nil)
 	testRows.RowError(0, dbErr)
 
-	mock.ExpectQuery(`^SELECT devices.id, devices.name, devices.kind, devices.api_key, devices.created_at, devices.updated_at FROM devices ORDER BY created_at OFFSET \$1 LIMIT \$2$`).
+	mock.ExpectQuery(`^SELECT id, name, kind, api_key, state, serial, created_at, updated_at, deleted_at FROM devices WHERE deleted_at IS NULL ORDER BY created_at OFFSET \$1 LIMIT \$2$`).
 		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).
 		WillReturnRows(testRows)
 
-	_, err = repo.ListDevices(context.Background(), 1, 10)
+	_, err = repo.ListDevices(context.Background(), model.DeviceFilter{}, 1, 10)
 
 	if err == nil {
 		t.Error("expected error, got nil")
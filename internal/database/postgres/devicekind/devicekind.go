@@ -0,0 +1,21 @@
+package devicekind
+
+import (
+	"database/sql"
+	"errors"
+	"iot-platform/internal/database/query"
+)
+
+type DeviceKindPostgresRepository struct {
+	*query.DeviceKindRepository
+}
+
+func NewDeviceKindPostgresRepository(db *sql.DB) (*DeviceKindPostgresRepository, error) {
+	if err := db.Ping(); err != nil {
+		return nil, errors.New("failed to connect to the database: " + err.Error())
+	}
+
+	return &DeviceKindPostgresRepository{
+		DeviceKindRepository: query.NewDeviceKindRepository(db),
+	}, nil
+}
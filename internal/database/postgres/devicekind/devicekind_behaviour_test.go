@@ -0,0 +1,11 @@
+package devicekind_test
+
+import (
+	"iot-platform/internal/database/postgres/postgrestest"
+	"iot-platform/internal/repository/repositorytest"
+	"testing"
+)
+
+func TestDeviceKindPostgresRepository_Behaviour(t *testing.T) {
+	repositorytest.TestDeviceKindsRepository(t, postgrestest.NewRepositories)
+}
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS replication_outbox (
+    seq BIGSERIAL PRIMARY KEY,
+    kind TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS replication_checkpoints (
+    target TEXT PRIMARY KEY,
+    seq BIGINT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS replication_sources (
+    source_id TEXT PRIMARY KEY,
+    seq BIGINT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,4 @@
+ALTER TABLE sensor_data ADD COLUMN IF NOT EXISTS value_type TEXT NOT NULL DEFAULT 'number';
+ALTER TABLE sensor_data ADD COLUMN IF NOT EXISTS value_text TEXT;
+
+CREATE INDEX IF NOT EXISTS sensor_data_metric_name_timestamp_idx ON sensor_data (metric_name, timestamp);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS device_kinds (
+    name TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    definition TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (name, version)
+);
+
+ALTER TABLE sensor_data ADD COLUMN IF NOT EXISTS violation TEXT;
@@ -0,0 +1,3 @@
+ALTER TABLE sensor_data ADD COLUMN IF NOT EXISTS unit TEXT;
+ALTER TABLE sensor_data ADD COLUMN IF NOT EXISTS original_unit TEXT;
+ALTER TABLE sensor_data ADD COLUMN IF NOT EXISTS original_value DOUBLE PRECISION;
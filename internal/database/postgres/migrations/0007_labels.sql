@@ -0,0 +1 @@
+ALTER TABLE sensor_data ADD COLUMN IF NOT EXISTS labels TEXT;
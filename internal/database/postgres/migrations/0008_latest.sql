@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS sensor_data_latest (
+    device_id TEXT NOT NULL REFERENCES devices (id) ON DELETE CASCADE,
+    metric_name TEXT NOT NULL,
+    sensor_data_id BIGINT NOT NULL,
+    value_type TEXT NOT NULL DEFAULT 'number',
+    metric_value DOUBLE PRECISION NOT NULL,
+    value_text TEXT,
+    timestamp TIMESTAMPTZ NOT NULL,
+    violation TEXT,
+    unit TEXT,
+    original_unit TEXT,
+    original_value DOUBLE PRECISION,
+    labels TEXT,
+    PRIMARY KEY (device_id, metric_name)
+);
+
+CREATE INDEX IF NOT EXISTS sensor_data_latest_metric_name_idx ON sensor_data_latest (metric_name);
+
+INSERT INTO sensor_data_latest (sensor_data_id, device_id, metric_name, value_type, metric_value, value_text, timestamp, violation, unit, original_unit, original_value, labels)
+SELECT id, device_id, metric_name, value_type, metric_value, value_text, timestamp, violation, unit, original_unit, original_value, labels FROM (
+    SELECT *, ROW_NUMBER() OVER (PARTITION BY device_id, metric_name ORDER BY timestamp DESC, id DESC) AS position FROM sensor_data
+) AS ranked
+WHERE position = 1;
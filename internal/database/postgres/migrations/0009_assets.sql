@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS assets (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    parent_id TEXT REFERENCES assets (id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS assets_parent_id_idx ON assets (parent_id);
+
+CREATE TABLE IF NOT EXISTS asset_devices (
+    device_id TEXT PRIMARY KEY REFERENCES devices (id) ON DELETE CASCADE,
+    asset_id TEXT NOT NULL REFERENCES assets (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS asset_devices_asset_id_idx ON asset_devices (asset_id);
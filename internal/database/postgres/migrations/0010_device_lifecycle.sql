@@ -0,0 +1,4 @@
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS state TEXT NOT NULL DEFAULT 'active';
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS devices_state_idx ON devices (state);
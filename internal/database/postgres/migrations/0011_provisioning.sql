@@ -0,0 +1,27 @@
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS serial TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS devices_serial_idx ON devices (serial);
+
+CREATE TABLE IF NOT EXISTS enrollment_tokens (
+    id TEXT PRIMARY KEY,
+    token_hash TEXT NOT NULL UNIQUE,
+    kind TEXT NOT NULL,
+    asset_id TEXT REFERENCES assets (id) ON DELETE SET NULL,
+    max_uses INTEGER NOT NULL,
+    uses INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS provisioning_events (
+    id BIGSERIAL PRIMARY KEY,
+    token_id TEXT,
+    serial TEXT NOT NULL,
+    device_id TEXT,
+    remote_addr TEXT,
+    error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS provisioning_events_token_id_idx ON provisioning_events (token_id, id);
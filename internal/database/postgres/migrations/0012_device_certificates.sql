@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS device_certificates (
+    fingerprint TEXT PRIMARY KEY,
+    device_id TEXT NOT NULL REFERENCES devices (id) ON DELETE CASCADE,
+    subject TEXT NOT NULL,
+    not_after TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS device_certificates_device_id_idx ON device_certificates (device_id);
@@ -0,0 +1,21 @@
+package nonce
+
+import (
+	"database/sql"
+	"errors"
+	"iot-platform/internal/database/query"
+)
+
+type NoncePostgresRepository struct {
+	*query.NonceRepository
+}
+
+func NewNoncePostgresRepository(db *sql.DB) (*NoncePostgresRepository, error) {
+	if err := db.Ping(); err != nil {
+		return nil, errors.New("failed to connect to the database: " + err.Error())
+	}
+
+	return &NoncePostgresRepository{
+		NonceRepository: query.NewNonceRepository(db),
+	}, nil
+}
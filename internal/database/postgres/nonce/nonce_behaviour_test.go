@@ -0,0 +1,11 @@
+package nonce_test
+
+import (
+	"iot-platform/internal/database/postgres/postgrestest"
+	"iot-platform/internal/repository/repositorytest"
+	"testing"
+)
+
+func TestNoncePostgresRepository_Behaviour(t *testing.T) {
+	repositorytest.TestNoncesRepository(t, postgrestest.NewRepositories)
+}
@@ -1,11 +1,28 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
+	"embed"
 	"fmt"
+	"io/fs"
+	"iot-platform/internal/database/migrate"
+	"iot-platform/internal/database/query"
 	"log"
 )
 
+// Dialect is how the shared repositories of package query lock rows on
+// Postgres.
+var Dialect = query.Dialect{
+	ForUpdate:      " FOR UPDATE",
+	LockAssets:     "LOCK TABLE assets IN SHARE ROW EXCLUSIVE MODE",
+	InsertionOrder: "id",
+	LockOutbox:     "LOCK TABLE replication_outbox IN EXCLUSIVE MODE",
+}
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
 func InitDb(host, port, user, pass, dbName string) (*sql.DB, error) {
 	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", user, pass, host, port, dbName)
 
@@ -16,3 +33,13 @@ func InitDb(host, port, user, pass, dbName string) (*sql.DB, error) {
 
 	return db, nil
 }
+
+// Migrate brings the Postgres schema up to date.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	scripts, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return err
+	}
+
+	return migrate.Up(ctx, db, scripts)
+}
@@ -0,0 +1,22 @@
+package provisioning
+
+import (
+	"database/sql"
+	"errors"
+	"iot-platform/internal/database/postgres"
+	"iot-platform/internal/database/query"
+)
+
+type ProvisioningPostgresRepository struct {
+	*query.ProvisioningRepository
+}
+
+func NewProvisioningPostgresRepository(db *sql.DB, opts ...query.Option) (*ProvisioningPostgresRepository, error) {
+	if err := db.Ping(); err != nil {
+		return nil, errors.New("failed to connect to the database: " + err.Error())
+	}
+
+	return &ProvisioningPostgresRepository{
+		ProvisioningRepository: query.NewProvisioningRepository(db, postgres.Dialect, query.NewOptions(opts...).Outbox),
+	}, nil
+}
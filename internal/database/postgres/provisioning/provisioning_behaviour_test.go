@@ -0,0 +1,11 @@
+package provisioning_test
+
+import (
+	"iot-platform/internal/database/postgres/postgrestest"
+	"iot-platform/internal/repository/repositorytest"
+	"testing"
+)
+
+func TestProvisioningPostgresRepository_Behaviour(t *testing.T) {
+	repositorytest.TestProvisioningRepository(t, postgrestest.NewRepositories)
+}
@@ -0,0 +1,22 @@
+package replication
+
+import (
+	"database/sql"
+	"errors"
+	"iot-platform/internal/database/postgres"
+	"iot-platform/internal/database/query"
+)
+
+type ReplicationPostgresRepository struct {
+	*query.ReplicationRepository
+}
+
+func NewReplicationPostgresRepository(db *sql.DB) (*ReplicationPostgresRepository, error) {
+	if err := db.Ping(); err != nil {
+		return nil, errors.New("failed to connect to the database: " + err.Error())
+	}
+
+	return &ReplicationPostgresRepository{
+		ReplicationRepository: query.NewReplicationRepository(db, postgres.Dialect),
+	}, nil
+}
@@ -0,0 +1,11 @@
+package replication_test
+
+import (
+	"iot-platform/internal/database/postgres/postgrestest"
+	"iot-platform/internal/repository/repositorytest"
+	"testing"
+)
+
+func TestReplicationPostgresRepository_Behaviour(t *testing.T) {
+	repositorytest.TestReplicationRepository(t, postgrestest.NewRepositories)
+}
@@ -0,0 +1,11 @@
+package sensordata_test
+
+import (
+	"iot-platform/internal/database/postgres/postgrestest"
+	"iot-platform/internal/repository/repositorytest"
+	"testing"
+)
+
+func TestSensorDataPostgresRepository_Behaviour(t *testing.T) {
+	repositorytest.TestSensorDataRepository(t, postgrestest.NewRepositories)
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"iot-platform/internal/database/postgres/sensordata"
 	"iot-platform/internal/model"
+	"iot-platform/internal/repository"
 	"testing"
 	"time"
 
@@ -31,9 +32,14 @@ func TestSensorDataPostgresRepository_SaveSensorData_InsertSuccess(t *testing.T)
 		MetricValue: 0.0,
 	}
 
-	mock.ExpectExec(`^INSERT INTO sensor_data \(device_id, metric_name, metric_value\) VALUES \(\$1, \$2, \$3\)$`).
-		WithArgs(testSensorData.DeviceId, testSensorData.MetricName, testSensorData.MetricValue). // Arguments: ID, Name, Kind, ApiKey
-		WillReturnResult(sqlmock.NewResult(0, 1))                                                 // Simulate 1 row inserted, 1 row affected (ID is not auto-increment here)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^INSERT INTO sensor_data \(device_id, metric_name, value_type, metric_value, value_text, timestamp, violation, unit, original_unit, original_value, labels\) VALUES \(\$1, \$2, \$3, \$4, \$5, \$6, \$7, \$8, \$9, \$10, \$11\) RETURNING id$`).
+		WithArgs(testSensorData.DeviceId, testSensorData.MetricName, "number", testSensorData.MetricValue, nil, sqlmock.AnyArg(), nil, nil, nil, nil, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectExec(`^INSERT INTO sensor_data_latest \(sensor_data_id, device_id, metric_name, .+\) ON CONFLICT \(device_id, metric_name\) DO UPDATE SET .+$`).
+		WithArgs(int64(7), testSensorData.DeviceId, testSensorData.MetricName, "number", testSensorData.MetricValue, nil, sqlmock.AnyArg(), nil, nil, nil, nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
 
 	ctx := context.Background()
 	err = repo.SaveSensorData(ctx, testSensorData)
@@ -41,6 +47,9 @@ func TestSensorDataPostgresRepository_SaveSensorData_InsertSuccess(t *testing.T)
 	if err != nil {
 		t.Errorf("expected no error, but got: %v", err)
 	}
+	if testSensorData.Id != 7 {
+		t.Errorf("expected the returned id to be set, but got: %d", testSensorData.Id)
+	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -66,9 +75,11 @@ func TestSensorDataPostgresRepository_SaveSensorData_InsertDbFailure(t *testing.
 		MetricValue: 0.0,
 	}
 
-	mock.ExpectExec(`^INSERT INTO sensor_data \(device_id, metric_name, metric_value\) VALUES \(\$1, \$2, \$3\)$`).
-		WithArgs(testSensorData.DeviceId, testSensorData.MetricName, testSensorData.MetricValue). // Arguments: ID, Name, Kind, ApiKey
-		WillReturnError(errors.New("database insert error"))                                      // Simulate 1 row inserted, 1 row affected (ID is not auto-increment here)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^INSERT INTO sensor_data \(device_id, metric_name, value_type, metric_value, value_text, timestamp, violation, unit, original_unit, original_value, labels\) VALUES \(\$1, \$2, \$3, \$4, \$5, \$6, \$7, \$8, \$9, \$10, \$11\) RETURNING id$`).
+		WithArgs(testSensorData.DeviceId, testSensorData.MetricName, "number", testSensorData.MetricValue, nil, sqlmock.AnyArg(), nil, nil, nil, nil, nil).
+		WillReturnError(errors.New("database insert error"))
+	mock.ExpectRollback()
 
 	ctx := context.Background()
 	err = repo.SaveSensorData(ctx, testSensorData)
@@ -127,7 +138,7 @@ func TestSensorDataPostgresRepository_FindSensorDataById_QueryDbError(t *testing
 
 	testId := int64(1)
 
-	mock.ExpectQuery(`^SELECT device_id, metric_name, metric_value, timestamp FROM sensor_data WHERE id = \$1$`).
+	mock.ExpectQuery(`^SELECT device_id, metric_name, value_type, metric_value, value_text, timestamp, violation, unit, original_unit, original_value, labels FROM sensor_data WHERE id = \$1$`).
 		WithArgs(testId).
 		WillReturnError(errors.New("query db error"))
 
@@ -184,9 +195,9 @@ func TestSensorDataPostgresRepository_FindSensorDataById_NotFoundError(t *testin
 	}
 
 	testId := int64(1)
-	testRows := mock.NewRows([]string{"device_id", "metric_name", "metric_value", "timestamp"})
+	testRows := mock.NewRows([]string{"device_id", "metric_name", "value_type", "metric_value", "value_text", "timestamp", "violation", "unit", "original_unit", "original_value", "labels"})
 
-	mock.ExpectQuery(`^SELECT device_id, metric_name, metric_value, timestamp FROM sensor_data WHERE id = \$1$`).
+	mock.ExpectQuery(`^SELECT device_id, metric_name, value_type, metric_value, value_text, timestamp, violation, unit, original_unit, original_value, labels FROM sensor_data WHERE id = \$1$`).
 		WithArgs(testId).
 		WillReturnRows(testRows)
 
@@ -216,18 +227,20 @@ func TestSensorDataPostgresRepository_FindSensorDataById_Success(t *testing.T) {
 	}
 
 	testId := int64(1)
-	testRows := mock.NewRows([]string{"device_id", "metric_name", "metric_value", "timestamp"})
-	testRows.AddRow(uuid.NewString(), "test-metric", 1.0, time.Now())
+	testRows := mock.NewRows([]string{"device_id", "metric_name", "value_type", "metric_value", "value_text", "timestamp", "violation", "unit", "original_unit", "original_value", "labels"})
+	testRows.AddRow(uuid.NewString(), "test-metric", "number", 1.0, nil, time.Now(), nil, nil, nil, nil, nil)
 
-	mock.ExpectQuery(`^SELECT device_id, metric_name, metric_value, timestamp FROM sensor_data WHERE id = \$1$`).
+	mock.ExpectQuery(`^SELECT device_id, metric_name, value_type, metric_value, value_text, timestamp, violation, unit, original_unit, original_value, labels FROM sensor_data WHERE id = \$1$`).
 		WithArgs(testId).
 		WillReturnRows(testRows)
 
 	ctx := context.Background()
-	_, err = repo.FindSensorDataById(ctx, testId)
+	sensorData, err := repo.FindSensorDataById(ctx, testId)
 
 	if err != nil {
 		t.Errorf("expected no error, but got %s", err)
+	} else if sensorData.Id != testId {
+		t.Errorf("expected id %d, but got %d", testId, sensorData.Id)
 	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -250,7 +263,7 @@ func TestSensorDataPostgresRepository_FindSensorDataByDeviceId_QueryDbError(t *t
 
 	testDeviceId := "test-device-id"
 
-	mock.ExpectQuery(`^SELECT id, metric_name, metric_value, timestamp FROM sensor_data WHERE device_id = \$1$`).
+	mock.ExpectQuery(`^SELECT id, metric_name, value_type, metric_value, value_text, timestamp, violation, unit, original_unit, original_value, labels FROM sensor_data WHERE device_id = \$1$`).
 		WithArgs(testDeviceId).
 		WillReturnError(errors.New("query db error"))
 
@@ -307,9 +320,9 @@ func TestSensorDataPostgresRepository_FindSensorDataByDeviceId_NotFoundError(t *
 	}
 
 	testDeviceId := "test-device-id"
-	testRows := mock.NewRows([]string{"id", "metric_name", "metric_value", "timestamp"})
+	testRows := mock.NewRows([]string{"id", "metric_name", "value_type", "metric_value", "value_text", "timestamp", "violation", "unit", "original_unit", "original_value", "labels"})
 
-	mock.ExpectQuery(`^SELECT id, metric_name, metric_value, timestamp FROM sensor_data WHERE device_id = \$1$`).
+	mock.ExpectQuery(`^SELECT id, metric_name, value_type, metric_value, value_text, timestamp, violation, unit, original_unit, original_value, labels FROM sensor_data WHERE device_id = \$1$`).
 		WithArgs(testDeviceId).
 		WillReturnRows(testRows)
 
@@ -339,10 +352,10 @@ func TestSensorDataPostgresRepository_FindSensorDataByDeviceId_Success(t *testin
 	}
 
 	testDeviceId := "test-device-id"
-	testRows := mock.NewRows([]string{"id", "metric_name", "metric_value", "timestamp"})
-	testRows.AddRow(1, "test-metric", 1.0, time.Now())
+	testRows := mock.NewRows([]string{"id", "metric_name", "value_type", "metric_value", "value_text", "timestamp", "violation", "unit", "original_unit", "original_value", "labels"})
+	testRows.AddRow(1, "test-metric", "number", 1.0, nil, time.Now(), nil, nil, nil, nil, nil)
 
-	mock.ExpectQuery(`^SELECT id, metric_name, metric_value, timestamp FROM sensor_data WHERE device_id = \$1$`).
+	mock.ExpectQuery(`^SELECT id, metric_name, value_type, metric_value, value_text, timestamp, violation, unit, original_unit, original_value, labels FROM sensor_data WHERE device_id = \$1$`).
 		WithArgs(testDeviceId).
 		WillReturnRows(testRows)
 
@@ -373,9 +386,11 @@ func TestSensorDataPostgresRepository_DeleteSensorData_QueryDbError(t *testing.T
 
 	testId := int64(1)
 
+	mock.ExpectBegin()
 	mock.ExpectExec(`^DELETE FROM sensor_data WHERE id = \$1$`).
 		WithArgs(testId).
 		WillReturnError(errors.New("query db error"))
+	mock.ExpectRollback()
 
 	ctx := context.Background()
 	err = repo.DeleteSensorData(ctx, testId)
@@ -431,9 +446,17 @@ func TestSensorDataPostgresRepository_DeleteSensorData_Success(t *testing.T) {
 
 	testId := int64(1)
 
+	mock.ExpectBegin()
 	mock.ExpectExec(`^DELETE FROM sensor_data WHERE id = \$1$`).
 		WithArgs(testId).
 		WillReturnResult(sqlmock.NewResult(0, 1)) // Simulate 1 row deleted
+	mock.ExpectQuery(`^DELETE FROM sensor_data_latest WHERE sensor_data_id = \$1 RETURNING device_id, metric_name$`).
+		WithArgs(testId).
+		WillReturnRows(sqlmock.NewRows([]string{"device_id", "metric_name"}).AddRow("test-device-id", "temperature"))
+	mock.ExpectExec(`^INSERT INTO sensor_data_latest \(.+\) SELECT .+ FROM sensor_data WHERE device_id = \$1 AND metric_name = \$2 ORDER BY timestamp DESC, id DESC LIMIT 1$`).
+		WithArgs("test-device-id", "temperature").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
 
 	ctx := context.Background()
 	err = repo.DeleteSensorData(ctx, testId)
@@ -463,7 +486,7 @@ func TestSensorDataPostgresRepository_ListSensorData_QueryDbError(t *testing.T)
 	testPage := 1
 	testPageSize := 10
 
-	mock.ExpectQuery(`^SELECT id, device_id, metric_name, metric_value, timestamp FROM sensor_data LIMIT \$1 OFFSET \$2$`).
+	mock.ExpectQuery(`^SELECT id, device_id, metric_name, value_type, metric_value, value_text, timestamp, violation, unit, original_unit, original_value, labels FROM sensor_data LIMIT \$1 OFFSET \$2$`).
 		WithArgs(testPageSize, (testPage-1)*testPageSize).
 		WillReturnError(errors.New("query db error"))
 
@@ -494,10 +517,10 @@ func TestSensorDataPostgresRepository_ListSensorData_Success(t *testing.T) {
 
 	testPage := 1
 	testPageSize := 10
-	testRows := mock.NewRows([]string{"id", "device_id", "metric_name", "metric_value", "timestamp"})
-	testRows.AddRow(1, "test-device-id", "test-metric", 1.0, time.Now())
+	testRows := mock.NewRows([]string{"id", "device_id", "metric_name", "value_type", "metric_value", "value_text", "timestamp", "violation", "unit", "original_unit", "original_value", "labels"})
+	testRows.AddRow(1, "test-device-id", "test-metric", "number", 1.0, nil, time.Now(), nil, nil, nil, nil, nil)
 
-	mock.ExpectQuery(`^SELECT id, device_id, metric_name, metric_value, timestamp FROM sensor_data LIMIT \$1 OFFSET \$2$`).
+	mock.ExpectQuery(`^SELECT id, device_id, metric_name, value_type, metric_value, value_text, timestamp, violation, unit, original_unit, original_value, labels FROM sensor_data LIMIT \$1 OFFSET \$2$`).
 		WithArgs(testPageSize, (testPage-1)*testPageSize).
 		WillReturnRows(testRows)
 
@@ -528,9 +551,9 @@ func TestSensorDataPostgresRepository_ListSensorData_EmptyResult(t *testing.T) {
 
 	testPage := 1
 	testPageSize := 10
-	testRows := mock.NewRows([]string{"id", "device_id", "metric_name", "metric_value", "timestamp"})
+	testRows := mock.NewRows([]string{"id", "device_id", "metric_name", "value_type", "metric_value", "value_text", "timestamp", "violation", "unit", "original_unit", "original_value", "labels"})
 
-	mock.ExpectQuery(`^SELECT id, device_id, metric_name, metric_value, timestamp FROM sensor_data LIMIT \$1 OFFSET \$2$`).
+	mock.ExpectQuery(`^SELECT id, device_id, metric_name, value_type, metric_value, value_text, timestamp, violation, unit, original_unit, original_value, labels FROM sensor_data LIMIT \$1 OFFSET \$2$`).
 		WithArgs(testPageSize, (testPage-1)*testPageSize).
 		WillReturnRows(testRows)
 
@@ -601,3 +624,139 @@ func TestSensorDataPostgresRepository_ListSensorData_InvalidPageSize(t *testing.
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestSensorDataPostgresRepository_SaveSensorData_MessageIdSuccess(t *testing.T) {
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo, err := sensordata.NewSensorDataPostgresRepository(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testSensorData := &model.SensorData{
+		DeviceId:    "test-device-id",
+		MetricName:  "Test Name",
+		MetricValue: 1.5,
+		MessageId:   "msg-1",
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^INSERT INTO sensor_data_messages \(device_id, message_id, received_at\) VALUES \(\$1, \$2, \$3\) ON CONFLICT \(device_id, message_id\) DO NOTHING$`).
+		WithArgs(testSensorData.DeviceId, testSensorData.MessageId, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`^INSERT INTO sensor_data \(device_id, metric_name, value_type, metric_value, value_text, timestamp, violation, unit, original_unit, original_value, labels, message_id\) VALUES \(\$1, \$2, \$3, \$4, \$5, \$6, \$7, \$8, \$9, \$10, \$11, \$12\) RETURNING id$`).
+		WithArgs(testSensorData.DeviceId, testSensorData.MetricName, "number", testSensorData.MetricValue, nil, sqlmock.AnyArg(), nil, nil, nil, nil, nil, testSensorData.MessageId).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec(`^INSERT INTO sensor_data_latest \(sensor_data_id, device_id, metric_name, .+\) ON CONFLICT \(device_id, metric_name\) DO UPDATE SET .+$`).
+		WithArgs(int64(1), testSensorData.DeviceId, testSensorData.MetricName, "number", testSensorData.MetricValue, nil, sqlmock.AnyArg(), nil, nil, nil, nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = repo.SaveSensorData(context.Background(), testSensorData)
+
+	if err != nil {
+		t.Errorf("expected no error, but got: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSensorDataPostgresRepository_SaveSensorData_MessageIdDuplicate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo, err := sensordata.NewSensorDataPostgresRepository(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testSensorData := &model.SensorData{
+		DeviceId:    "test-device-id",
+		MetricName:  "Test Name",
+		MetricValue: 1.5,
+		MessageId:   "msg-1",
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^INSERT INTO sensor_data_messages \(device_id, message_id, received_at\) VALUES \(\$1, \$2, \$3\) ON CONFLICT \(device_id, message_id\) DO NOTHING$`).
+		WithArgs(testSensorData.DeviceId, testSensorData.MessageId, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	err = repo.SaveSensorData(context.Background(), testSensorData)
+
+	if !errors.Is(err, repository.ErrDuplicateMessage) {
+		t.Errorf("expected ErrDuplicateMessage, but got: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSensorDataPostgresRepository_DeleteSensorDataByIds_Success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo, err := sensordata.NewSensorDataPostgresRepository(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectExec(`^DELETE FROM sensor_data WHERE id IN \(\$1, \$2\)$`).
+		WithArgs(int64(4), int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	deleted, err := repo.DeleteSensorDataByIds(context.Background(), []int64{4, 7})
+
+	if err != nil || deleted != 2 {
+		t.Errorf("expected 2 deleted rows, but got: %d, %v", deleted, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSensorDataPostgresRepository_PruneMessageIds_Success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo, err := sensordata.NewSensorDataPostgresRepository(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectExec(`^DELETE FROM sensor_data_messages WHERE received_at < \$1$`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	pruned, err := repo.PruneMessageIds(context.Background(), time.Now())
+
+	if err != nil || pruned != 3 {
+		t.Errorf("expected 3 pruned rows, but got: %d, %v", pruned, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,21 @@
+package usage
+
+import (
+	"database/sql"
+	"errors"
+	"iot-platform/internal/database/query"
+)
+
+type UsagePostgresRepository struct {
+	*query.UsageRepository
+}
+
+func NewUsagePostgresRepository(db *sql.DB) (*UsagePostgresRepository, error) {
+	if err := db.Ping(); err != nil {
+		return nil, errors.New("failed to connect to the database: " + err.Error())
+	}
+
+	return &UsagePostgresRepository{
+		UsageRepository: query.NewUsageRepository(db),
+	}, nil
+}
@@ -0,0 +1,11 @@
+package usage_test
+
+import (
+	"iot-platform/internal/database/postgres/postgrestest"
+	"iot-platform/internal/repository/repositorytest"
+	"testing"
+)
+
+func TestUsagePostgresRepository_Behaviour(t *testing.T) {
+	repositorytest.TestUsageRepository(t, postgrestest.NewRepositories)
+}
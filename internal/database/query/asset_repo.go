@@ -0,0 +1,229 @@
+package query
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"iot-platform/internal/model"
+	"iot-platform/internal/repository"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AssetRepository struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+func NewAssetRepository(db *sql.DB, dialect Dialect) *AssetRepository {
+	return &AssetRepository{
+		db:      db,
+		dialect: dialect,
+	}
+}
+
+func (as *AssetRepository) SaveAsset(ctx context.Context, asset *model.Asset) error {
+	if asset.Name == "" {
+		return errors.New("save argument error")
+	}
+
+	now := time.Now().UTC()
+	if asset.Id == "" {
+		id := uuid.New().String()
+		_, err := as.db.ExecContext(ctx, `INSERT INTO assets (id, name, kind, parent_id, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6)`, id, asset.Name, asset.Kind, NullString(asset.ParentId), now, now)
+		if err != nil {
+			return err
+		}
+
+		asset.Id = id
+		asset.CreatedAt, asset.UpdatedAt = now, now
+		return nil
+	}
+
+	result, err := as.db.ExecContext(ctx, `UPDATE assets SET name = $1, kind = $2, updated_at = $3 WHERE id = $4`, asset.Name, asset.Kind, now, asset.Id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return repository.ErrNotFound
+	}
+
+	asset.UpdatedAt = now
+	return nil
+}
+
+func (as *AssetRepository) FindAsset(ctx context.Context, id string) (*model.Asset, error) {
+	assets, err := as.listAssets(ctx, `SELECT id, name, kind, parent_id, created_at, updated_at FROM assets WHERE id = $1`, `SELECT asset_id, device_id FROM asset_devices WHERE asset_id = $1 ORDER BY device_id`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(assets) == 0 {
+		return nil, repository.ErrNotFound
+	}
+
+	return assets[0], nil
+}
+
+func (as *AssetRepository) ListAssets(ctx context.Context) ([]*model.Asset, error) {
+	return as.listAssets(ctx, `SELECT id, name, kind, parent_id, created_at, updated_at FROM assets ORDER BY name, id`, `SELECT asset_id, device_id FROM asset_devices ORDER BY device_id`)
+}
+
+func (as *AssetRepository) ListSubtree(ctx context.Context, id string) ([]*model.Asset, error) {
+	assets, err := as.listAssets(ctx, Subtree+`SELECT id, name, kind, parent_id, created_at, updated_at FROM assets WHERE id IN (SELECT id FROM subtree) ORDER BY name, id`, Subtree+`SELECT asset_id, device_id FROM asset_devices WHERE asset_id IN (SELECT id FROM subtree) ORDER BY device_id`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(assets) == 0 {
+		return nil, repository.ErrNotFound
+	}
+
+	return assets, nil
+}
+
+// listAssets reads the assets selected by assetsQuery and attaches the
+// devices selected by devicesQuery to them.
+func (as *AssetRepository) listAssets(ctx context.Context, assetsQuery, devicesQuery string, args ...any) ([]*model.Asset, error) {
+	rows, err := as.db.QueryContext(ctx, assetsQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var assets []*model.Asset
+	byId := make(map[string]*model.Asset)
+	for rows.Next() {
+		var asset model.Asset
+		var parentId sql.NullString
+		if err := rows.Scan(&asset.Id, &asset.Name, &asset.Kind, &parentId, &asset.CreatedAt, &asset.UpdatedAt); err != nil {
+			return nil, err
+		}
+		asset.ParentId = parentId.String
+		asset.DeviceIds = []string{}
+		assets = append(assets, &asset)
+		byId[asset.Id] = &asset
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	deviceRows, err := as.db.QueryContext(ctx, devicesQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer deviceRows.Close()
+
+	for deviceRows.Next() {
+		var assetId, deviceId string
+		if err := deviceRows.Scan(&assetId, &deviceId); err != nil {
+			return nil, err
+		}
+		if asset := byId[assetId]; asset != nil {
+			asset.DeviceIds = append(asset.DeviceIds, deviceId)
+		}
+	}
+	if err := deviceRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return assets, nil
+}
+
+func (as *AssetRepository) MoveAsset(ctx context.Context, id, parentId string) error {
+	tx, err := as.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if as.dialect.LockAssets != "" {
+		if _, err := tx.ExecContext(ctx, as.dialect.LockAssets); err != nil {
+			return err
+		}
+	}
+
+	if parentId != "" {
+		var cycle bool
+		if err := tx.QueryRowContext(ctx, Subtree+`SELECT EXISTS (SELECT 1 FROM subtree WHERE id = $2)`, id, parentId).Scan(&cycle); err != nil {
+			return err
+		}
+		if cycle {
+			return repository.ErrAssetCycle
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, `UPDATE assets SET parent_id = $1, updated_at = $2 WHERE id = $3`, NullString(parentId), time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return repository.ErrNotFound
+	}
+
+	return tx.Commit()
+}
+
+func (as *AssetRepository) DeleteAsset(ctx context.Context, id string) error {
+	tx, err := as.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var children int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM assets WHERE parent_id = $1`, id).Scan(&children); err != nil {
+		return err
+	}
+	if children > 0 {
+		return repository.ErrAssetNotEmpty
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM assets WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return repository.ErrNotFound
+	}
+
+	return tx.Commit()
+}
+
+func (as *AssetRepository) AttachDevice(ctx context.Context, assetId, deviceId string) error {
+	_, err := as.db.ExecContext(ctx, `INSERT INTO asset_devices (device_id, asset_id) VALUES ($1, $2) ON CONFLICT (device_id) DO UPDATE SET asset_id = excluded.asset_id`, deviceId, assetId)
+
+	return err
+}
+
+func (as *AssetRepository) DetachDevice(ctx context.Context, assetId, deviceId string) error {
+	result, err := as.db.ExecContext(ctx, `DELETE FROM asset_devices WHERE device_id = $1 AND asset_id = $2`, deviceId, assetId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return repository.ErrNotFound
+	}
+
+	return nil
+}
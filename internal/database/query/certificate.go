@@ -0,0 +1,23 @@
+package query
+
+import (
+	"database/sql"
+	"iot-platform/internal/model"
+)
+
+// CertificateColumns is the column list scanned by ScanCertificate, in order.
+const CertificateColumns = "fingerprint, device_id, subject, not_after, revoked_at, created_at"
+
+// ScanCertificate reads a row of CertificateColumns.
+func ScanCertificate(row scanner) (*model.DeviceCertificate, error) {
+	var certificate model.DeviceCertificate
+	var revokedAt sql.NullTime
+	if err := row.Scan(&certificate.Fingerprint, &certificate.DeviceId, &certificate.Subject, &certificate.NotAfter, &revokedAt, &certificate.CreatedAt); err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid {
+		certificate.RevokedAt = &revokedAt.Time
+	}
+
+	return &certificate, nil
+}
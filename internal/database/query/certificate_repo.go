@@ -0,0 +1,88 @@
+package query
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"iot-platform/internal/model"
+	"iot-platform/internal/repository"
+	"time"
+)
+
+type CertificateRepository struct {
+	db *sql.DB
+}
+
+func NewCertificateRepository(db *sql.DB) *CertificateRepository {
+	return &CertificateRepository{
+		db: db,
+	}
+}
+
+func (ce *CertificateRepository) SaveCertificate(ctx context.Context, certificate *model.DeviceCertificate) error {
+	if certificate.Fingerprint == "" || certificate.DeviceId == "" {
+		return errors.New("save argument error")
+	}
+
+	now := time.Now().UTC()
+	result, err := ce.db.ExecContext(ctx, `INSERT INTO device_certificates (fingerprint, device_id, subject, not_after, created_at) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (fingerprint) DO NOTHING`, certificate.Fingerprint, certificate.DeviceId, certificate.Subject, certificate.NotAfter.UTC(), now)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return repository.ErrDuplicateCertificate
+	}
+
+	certificate.CreatedAt = now
+	return nil
+}
+
+func (ce *CertificateRepository) FindCertificate(ctx context.Context, fingerprint string) (*model.DeviceCertificate, error) {
+	certificate, err := ScanCertificate(ce.db.QueryRowContext(ctx, `SELECT `+CertificateColumns+` FROM device_certificates WHERE fingerprint = $1`, fingerprint))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrNotFound
+	}
+
+	return certificate, err
+}
+
+func (ce *CertificateRepository) ListCertificates(ctx context.Context, deviceId string) ([]*model.DeviceCertificate, error) {
+	rows, err := ce.db.QueryContext(ctx, `SELECT `+CertificateColumns+` FROM device_certificates WHERE device_id = $1 ORDER BY created_at DESC, fingerprint`, deviceId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	certificates := []*model.DeviceCertificate{}
+	for rows.Next() {
+		certificate, err := ScanCertificate(rows)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	return certificates, rows.Err()
+}
+
+func (ce *CertificateRepository) RevokeCertificate(ctx context.Context, deviceId, fingerprint string) error {
+	result, err := ce.db.ExecContext(ctx, `UPDATE device_certificates SET revoked_at = COALESCE(revoked_at, $1) WHERE fingerprint = $2 AND device_id = $3`, time.Now().UTC(), fingerprint, deviceId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return repository.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package query
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"iot-platform/internal/model"
+	"iot-platform/internal/repository"
+)
+
+// DeviceColumns is the column list scanned by ScanDevice, in order.
+const DeviceColumns = "id, name, kind, api_key, state, serial, created_at, updated_at, deleted_at"
+
+// DeviceWhere returns the WHERE clause selecting the devices matched by
+// filter, numbering its placeholders from $1.
+func DeviceWhere(filter model.DeviceFilter) (string, []any) {
+	where := "WHERE deleted_at IS NULL"
+	if filter.Deleted {
+		where = "WHERE deleted_at IS NOT NULL"
+	}
+
+	var args []any
+	if filter.State != "" {
+		args = append(args, string(filter.State))
+		where += fmt.Sprintf(" AND state = $%d", len(args))
+	}
+
+	return where, args
+}
+
+// DeviceState returns the state a device is stored with; devices saved
+// without one are active.
+func DeviceState(device *model.Device) string {
+	if device.State == "" {
+		return string(model.DeviceActive)
+	}
+
+	return string(device.State)
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// ScanDevice reads a row of DeviceColumns. A missing row is
+// repository.ErrNotFound.
+func ScanDevice(row scanner) (*model.Device, error) {
+	var device model.Device
+	var serial sql.NullString
+	var deletedAt sql.NullTime
+	err := row.Scan(&device.Id, &device.Name, &device.Kind, &device.ApiKey, &device.State, &serial, &device.CreatedAt, &device.UpdatedAt, &deletedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	device.Serial = serial.String
+	if deletedAt.Valid {
+		device.DeletedAt = &deletedAt.Time
+	}
+
+	return &device, nil
+}
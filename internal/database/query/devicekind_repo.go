@@ -0,0 +1,164 @@
+package query
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"iot-platform/internal/model"
+	"iot-platform/internal/repository"
+	"time"
+)
+
+// definition is the versioned part of a kind, stored as JSON.
+type definition struct {
+	Description              string                  `json:"description"`
+	Metrics                  []model.MetricSchema    `json:"metrics"`
+	ReportingIntervalSeconds int                     `json:"reportingIntervalSeconds"`
+	Enforcement              model.SchemaEnforcement `json:"enforcement"`
+}
+
+type DeviceKindRepository struct {
+	db *sql.DB
+}
+
+func NewDeviceKindRepository(db *sql.DB) *DeviceKindRepository {
+	return &DeviceKindRepository{
+		db: db,
+	}
+}
+
+func (de *DeviceKindRepository) SaveDeviceKind(ctx context.Context, kind *model.DeviceKind) error {
+	if kind.Name == "" {
+		return errors.New("save argument error")
+	}
+
+	encoded, err := json.Marshal(definition{
+		Description:              kind.Description,
+		Metrics:                  kind.Metrics,
+		ReportingIntervalSeconds: kind.ReportingIntervalSeconds,
+		Enforcement:              kind.Enforcement,
+	})
+	if err != nil {
+		return err
+	}
+
+	tx, err := de.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var version int
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM device_kinds WHERE name = $1`, kind.Name).Scan(&version); err != nil {
+		return err
+	}
+
+	createdAt := time.Now().UTC()
+	if _, err := tx.ExecContext(ctx, `INSERT INTO device_kinds (name, version, definition, created_at) VALUES ($1, $2, $3, $4)`, kind.Name, version+1, string(encoded), createdAt); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	kind.Version = version + 1
+	kind.CreatedAt = createdAt
+	return nil
+}
+
+func (de *DeviceKindRepository) FindDeviceKind(ctx context.Context, name string, version int) (*model.DeviceKind, error) {
+	var row *sql.Row
+	if version == 0 {
+		row = de.db.QueryRowContext(ctx, `SELECT name, version, definition, created_at FROM device_kinds WHERE name = $1 ORDER BY version DESC LIMIT 1`, name)
+	} else {
+		row = de.db.QueryRowContext(ctx, `SELECT name, version, definition, created_at FROM device_kinds WHERE name = $1 AND version = $2`, name, version)
+	}
+
+	kind, err := scanDeviceKind(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrNotFound
+	}
+
+	return kind, err
+}
+
+func (de *DeviceKindRepository) ListDeviceKinds(ctx context.Context, page int, pageSize int) ([]*model.DeviceKind, error) {
+	rows, err := de.db.QueryContext(ctx, `SELECT k.name, k.version, k.definition, k.created_at FROM device_kinds k WHERE k.version = (SELECT MAX(version) FROM device_kinds WHERE name = k.name) ORDER BY k.name LIMIT $1 OFFSET $2`, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanDeviceKinds(rows)
+}
+
+func (de *DeviceKindRepository) ListDeviceKindVersions(ctx context.Context, name string) ([]*model.DeviceKind, error) {
+	rows, err := de.db.QueryContext(ctx, `SELECT name, version, definition, created_at FROM device_kinds WHERE name = $1 ORDER BY version`, name)
+	if err != nil {
+		return nil, err
+	}
+
+	kinds, err := scanDeviceKinds(rows)
+	if err == nil && len(kinds) == 0 {
+		return nil, repository.ErrNotFound
+	}
+
+	return kinds, err
+}
+
+func (de *DeviceKindRepository) DeleteDeviceKind(ctx context.Context, name string) error {
+	res, err := de.db.ExecContext(ctx, `DELETE FROM device_kinds WHERE name = $1`, name)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return repository.ErrNotFound
+	}
+
+	return nil
+}
+
+func scanDeviceKind(row scanner) (*model.DeviceKind, error) {
+	var kind model.DeviceKind
+	var encoded string
+	if err := row.Scan(&kind.Name, &kind.Version, &encoded, &kind.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	var def definition
+	if err := json.Unmarshal([]byte(encoded), &def); err != nil {
+		return nil, err
+	}
+	kind.Description = def.Description
+	kind.Metrics = def.Metrics
+	kind.ReportingIntervalSeconds = def.ReportingIntervalSeconds
+	kind.Enforcement = def.Enforcement
+
+	return &kind, nil
+}
+
+func scanDeviceKinds(rows *sql.Rows) ([]*model.DeviceKind, error) {
+	defer rows.Close()
+
+	var kinds []*model.DeviceKind
+	for rows.Next() {
+		kind, err := scanDeviceKind(rows)
+		if err != nil {
+			return nil, err
+		}
+		kinds = append(kinds, kind)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return kinds, nil
+}
@@ -0,0 +1,22 @@
+package query
+
+// Dialect holds what the SQL of the Postgres and SQLite repositories
+// differs in, which is mostly locking.
+type Dialect struct {
+	// ForUpdate follows a SELECT of rows the transaction goes on to
+	// change. SQLite needs none: a write transaction locks the whole
+	// database.
+	ForUpdate string
+	// LockAssets, when set, runs before an asset is moved. Concurrent moves
+	// could each pass the cycle check and create a cycle together, so they
+	// take turns.
+	LockAssets string
+	// InsertionOrder orders rows keyed by a random id in the order they
+	// were inserted, where their timestamps tie.
+	InsertionOrder string
+	// LockOutbox, when set, runs before a change is appended to the
+	// replication outbox. Sequence numbers are assigned when rows are
+	// inserted, not when they commit, so appends take turns until commit
+	// and the forwarder never sees a seq before every smaller one.
+	LockOutbox string
+}
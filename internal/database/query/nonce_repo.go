@@ -0,0 +1,44 @@
+package query
+
+import (
+	"context"
+	"database/sql"
+	"iot-platform/internal/repository"
+	"time"
+)
+
+type NonceRepository struct {
+	db *sql.DB
+}
+
+func NewNonceRepository(db *sql.DB) *NonceRepository {
+	return &NonceRepository{
+		db: db,
+	}
+}
+
+func (no *NonceRepository) UseNonce(ctx context.Context, deviceId, nonce string, usedAt time.Time) error {
+	result, err := no.db.ExecContext(ctx, `INSERT INTO device_nonces (device_id, nonce, used_at) VALUES ($1, $2, $3) ON CONFLICT (device_id, nonce) DO NOTHING`, deviceId, nonce, usedAt.UTC())
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return repository.ErrNonceUsed
+	}
+
+	return nil
+}
+
+func (no *NonceRepository) PruneNonces(ctx context.Context, before time.Time) (int64, error) {
+	result, err := no.db.ExecContext(ctx, `DELETE FROM device_nonces WHERE used_at < $1`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,130 @@
+package query
+
+import (
+	"context"
+	"database/sql"
+	"iot-platform/internal/model"
+)
+
+// Outbox appends changes to the replication outbox in the transaction that
+// makes them, so a change is forwarded if and only if it is stored. A nil
+// Outbox records nothing.
+type Outbox struct {
+	dialect Dialect
+}
+
+func NewOutbox(dialect Dialect) *Outbox {
+	return &Outbox{
+		dialect: dialect,
+	}
+}
+
+// Append adds change to the outbox within tx, and sets its seq and
+// creation time.
+func (o *Outbox) Append(ctx context.Context, tx *sql.Tx, change *model.Change) error {
+	if o == nil {
+		return nil
+	}
+
+	if o.dialect.LockOutbox != "" {
+		if _, err := tx.ExecContext(ctx, o.dialect.LockOutbox); err != nil {
+			return err
+		}
+	}
+
+	payload, err := encodePayload(change)
+	if err != nil {
+		return err
+	}
+
+	row := tx.QueryRowContext(ctx, `INSERT INTO replication_outbox (kind, payload) VALUES ($1, $2) RETURNING seq, created_at`, change.Kind, payload)
+	return row.Scan(&change.Seq, &change.CreatedAt)
+}
+
+// Execer runs statements on a database or within a transaction.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Record runs write and appends the change it made to the outbox in one
+// transaction. change runs after write, within the same transaction. A nil
+// Outbox runs write on db directly.
+func (o *Outbox) Record(ctx context.Context, db *sql.DB, write func(ex Execer) error, change func(ex Execer) (*model.Change, error)) error {
+	if o == nil {
+		return write(db)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := write(tx); err != nil {
+		return err
+	}
+
+	recorded, err := change(tx)
+	if err != nil {
+		return err
+	}
+
+	if err := o.Append(ctx, tx, recorded); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeviceSaved returns the change recording device id as it is stored now,
+// which upstream applies as a whole.
+func DeviceSaved(ctx context.Context, ex Execer, id string) (*model.Change, error) {
+	device, err := ScanDevice(ex.QueryRowContext(ctx, `SELECT `+DeviceColumns+` FROM devices WHERE id = $1`, id))
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Change{Kind: model.ChangeDeviceSaved, Device: device}, nil
+}
+
+// DeviceDeleted returns the change recording the delete of device id.
+func DeviceDeleted(id string) *model.Change {
+	return &model.Change{Kind: model.ChangeDeviceDeleted, Device: &model.Device{Id: id}}
+}
+
+// SensorDataCreated returns the change recording a stored reading. Reading
+// ids are assigned by each instance and mean nothing upstream, so the
+// change carries none.
+func SensorDataCreated(sensorData *model.SensorData) *model.Change {
+	reading := *sensorData
+	reading.Id = 0
+
+	return &model.Change{Kind: model.ChangeSensorDataCreated, SensorData: &reading}
+}
+
+// Options are what a repository's Options set.
+type Options struct {
+	Outbox *Outbox
+}
+
+// Option configures a Postgres or SQLite repository.
+type Option func(*Options)
+
+// WithOutbox makes a repository append the changes it makes to outbox, for
+// a gateway in edge mode to forward.
+func WithOutbox(outbox *Outbox) Option {
+	return func(options *Options) {
+		options.Outbox = outbox
+	}
+}
+
+// NewOptions applies opts to the defaults.
+func NewOptions(opts ...Option) Options {
+	var options Options
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return options
+}
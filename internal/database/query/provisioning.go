@@ -0,0 +1,58 @@
+package query
+
+import (
+	"database/sql"
+	"iot-platform/internal/model"
+	"time"
+)
+
+// EnrollmentTokenColumns is the column list scanned by ScanEnrollmentToken,
+// in order.
+const EnrollmentTokenColumns = "id, token_hash, kind, asset_id, max_uses, uses, expires_at, revoked_at, created_at"
+
+// ProvisioningEventColumns is the column list scanned by
+// ScanProvisioningEvent, in order.
+const ProvisioningEventColumns = "id, token_id, serial, device_id, remote_addr, error, created_at"
+
+// ScanEnrollmentToken reads a row of EnrollmentTokenColumns.
+func ScanEnrollmentToken(row scanner) (*model.EnrollmentToken, error) {
+	var token model.EnrollmentToken
+	var assetId sql.NullString
+	var expiresAt, revokedAt sql.NullTime
+	if err := row.Scan(&token.Id, &token.TokenHash, &token.Kind, &assetId, &token.MaxUses, &token.Uses, &expiresAt, &revokedAt, &token.CreatedAt); err != nil {
+		return nil, err
+	}
+	token.AssetId = assetId.String
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+
+	return &token, nil
+}
+
+// ScanProvisioningEvent reads a row of ProvisioningEventColumns.
+func ScanProvisioningEvent(row scanner) (*model.ProvisioningEvent, error) {
+	var event model.ProvisioningEvent
+	var tokenId, deviceId, remoteAddr, eventError sql.NullString
+	if err := row.Scan(&event.Id, &tokenId, &event.Serial, &deviceId, &remoteAddr, &eventError, &event.CreatedAt); err != nil {
+		return nil, err
+	}
+	event.TokenId = tokenId.String
+	event.DeviceId = deviceId.String
+	event.RemoteAddr = remoteAddr.String
+	event.Error = eventError.String
+
+	return &event, nil
+}
+
+// NullTime stores a nil t as NULL.
+func NullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+
+	return sql.NullTime{Time: *t, Valid: true}
+}
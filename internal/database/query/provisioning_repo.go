@@ -0,0 +1,186 @@
+package query
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"iot-platform/internal/model"
+	"iot-platform/internal/repository"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ProvisioningRepository struct {
+	db      *sql.DB
+	dialect Dialect
+	outbox  *Outbox
+}
+
+func NewProvisioningRepository(db *sql.DB, dialect Dialect, outbox *Outbox) *ProvisioningRepository {
+	return &ProvisioningRepository{
+		db:      db,
+		dialect: dialect,
+		outbox:  outbox,
+	}
+}
+
+func (pr *ProvisioningRepository) SaveEnrollmentToken(ctx context.Context, token *model.EnrollmentToken) error {
+	if token.TokenHash == "" || token.Kind == "" {
+		return errors.New("save argument error")
+	}
+
+	id := uuid.New().String()
+	now := time.Now().UTC()
+	_, err := pr.db.ExecContext(ctx, `INSERT INTO enrollment_tokens (id, token_hash, kind, asset_id, max_uses, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`, id, token.TokenHash, token.Kind, NullString(token.AssetId), token.MaxUses, NullTime(token.ExpiresAt), now)
+	if err != nil {
+		return err
+	}
+
+	token.Id = id
+	token.CreatedAt = now
+	return nil
+}
+
+func (pr *ProvisioningRepository) FindEnrollmentToken(ctx context.Context, id string) (*model.EnrollmentToken, error) {
+	token, err := ScanEnrollmentToken(pr.db.QueryRowContext(ctx, `SELECT `+EnrollmentTokenColumns+` FROM enrollment_tokens WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrNotFound
+	}
+
+	return token, err
+}
+
+func (pr *ProvisioningRepository) ListEnrollmentTokens(ctx context.Context) ([]*model.EnrollmentToken, error) {
+	rows, err := pr.db.QueryContext(ctx, `SELECT `+EnrollmentTokenColumns+` FROM enrollment_tokens ORDER BY created_at DESC, `+pr.dialect.InsertionOrder+` DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*model.EnrollmentToken{}
+	for rows.Next() {
+		token, err := ScanEnrollmentToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+func (pr *ProvisioningRepository) RevokeEnrollmentToken(ctx context.Context, id string) error {
+	result, err := pr.db.ExecContext(ctx, `UPDATE enrollment_tokens SET revoked_at = COALESCE(revoked_at, $1) WHERE id = $2`, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return repository.ErrNotFound
+	}
+
+	return nil
+}
+
+func (pr *ProvisioningRepository) ProvisionDevice(ctx context.Context, tokenHash string, device *model.Device) (string, error) {
+	tx, err := pr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	token, err := ScanEnrollmentToken(tx.QueryRowContext(ctx, `SELECT `+EnrollmentTokenColumns+` FROM enrollment_tokens WHERE token_hash = $1`+pr.dialect.ForUpdate, tokenHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("%w: unknown token", repository.ErrTokenRejected)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	if reason := token.Rejection(now); reason != "" {
+		return token.Id, fmt.Errorf("%w: token %s", repository.ErrTokenRejected, reason)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE enrollment_tokens SET uses = uses + 1 WHERE id = $1`, token.Id); err != nil {
+		return token.Id, err
+	}
+
+	id := uuid.New().String()
+	result, err := tx.ExecContext(ctx, `INSERT INTO devices (id, name, kind, api_key, state, serial, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT (serial) DO NOTHING`, id, device.Name, token.Kind, device.ApiKey, string(model.DeviceProvisioned), device.Serial, now, now)
+	if err != nil {
+		return token.Id, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return token.Id, err
+	}
+	if rowsAffected == 0 {
+		return token.Id, repository.ErrDuplicateSerial
+	}
+
+	if token.AssetId != "" {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO asset_devices (device_id, asset_id) VALUES ($1, $2)`, id, token.AssetId); err != nil {
+			return token.Id, err
+		}
+	}
+
+	// Tokens and their audit trail stay local; only the device is
+	// forwarded.
+	saved := *device
+	saved.Id, saved.Kind, saved.State = id, token.Kind, model.DeviceProvisioned
+	saved.CreatedAt, saved.UpdatedAt = now, now
+	if err := pr.outbox.Append(ctx, tx, &model.Change{Kind: model.ChangeDeviceSaved, Device: &saved}); err != nil {
+		return token.Id, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return token.Id, err
+	}
+
+	*device = saved
+	return token.Id, nil
+}
+
+func (pr *ProvisioningRepository) SaveProvisioningEvent(ctx context.Context, event *model.ProvisioningEvent) error {
+	now := time.Now().UTC()
+	err := pr.db.QueryRowContext(ctx, `INSERT INTO provisioning_events (token_id, serial, device_id, remote_addr, error, created_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`, NullString(event.TokenId), event.Serial, NullString(event.DeviceId), NullString(event.RemoteAddr), NullString(event.Error), now).Scan(&event.Id)
+	if err != nil {
+		return err
+	}
+
+	event.CreatedAt = now
+	return nil
+}
+
+func (pr *ProvisioningRepository) ListProvisioningEvents(ctx context.Context, tokenId string, limit int) ([]*model.ProvisioningEvent, error) {
+	var rows *sql.Rows
+	var err error
+	if tokenId == "" {
+		rows, err = pr.db.QueryContext(ctx, `SELECT `+ProvisioningEventColumns+` FROM provisioning_events ORDER BY id DESC LIMIT $1`, limit)
+	} else {
+		rows, err = pr.db.QueryContext(ctx, `SELECT `+ProvisioningEventColumns+` FROM provisioning_events WHERE token_id = $1 ORDER BY id DESC LIMIT $2`, tokenId, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*model.ProvisioningEvent{}
+	for rows.Next() {
+		event, err := ScanProvisioningEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
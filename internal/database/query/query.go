@@ -0,0 +1,242 @@
+// Package query holds the SQL shared by the Postgres and SQLite
+// repositories, and the repositories that differ in no more than a Dialect.
+// Both drivers accept the same $n placeholders and comparison syntax.
+package query
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"iot-platform/internal/model"
+	"strings"
+)
+
+// SensorDataColumns is the column list scanned by the sensor data
+// repositories, in order.
+const SensorDataColumns = "id, device_id, metric_name, value_type, metric_value, value_text, timestamp, violation, unit, original_unit, original_value, labels"
+
+// LatestColumns is the column list of sensor_data_latest, which mirrors
+// SensorDataColumns with the reading's id in sensor_data_id.
+const LatestColumns = "sensor_data_id, device_id, metric_name, value_type, metric_value, value_text, timestamp, violation, unit, original_unit, original_value, labels"
+
+// UpsertLatest returns the statement recording a stored reading as the
+// latest of its device and metric, unless a newer one is recorded already.
+func UpsertLatest(sensorData *model.SensorData) (string, []any) {
+	statement := "INSERT INTO sensor_data_latest (" + LatestColumns + ") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)" +
+		" ON CONFLICT (device_id, metric_name) DO UPDATE SET sensor_data_id = excluded.sensor_data_id, value_type = excluded.value_type, metric_value = excluded.metric_value, value_text = excluded.value_text, timestamp = excluded.timestamp, violation = excluded.violation, unit = excluded.unit, original_unit = excluded.original_unit, original_value = excluded.original_value, labels = excluded.labels" +
+		" WHERE excluded.timestamp > sensor_data_latest.timestamp OR (excluded.timestamp = sensor_data_latest.timestamp AND excluded.sensor_data_id > sensor_data_latest.sensor_data_id)"
+	args := []any{sensorData.Id, sensorData.DeviceId, sensorData.MetricName, ValueType(sensorData), sensorData.MetricValue, ValueText(sensorData), sensorData.Timestamp.UTC(), NullString(sensorData.Violation), NullString(sensorData.Unit), NullString(sensorData.OriginalUnit), sensorData.OriginalValue, Labels(sensorData)}
+
+	return statement, args
+}
+
+// RefreshLatest records the newest stored reading of device $1 and metric
+// $2 as their latest, once the previous latest is deleted.
+const RefreshLatest = "INSERT INTO sensor_data_latest (" + LatestColumns + ") SELECT " + SensorDataColumns + " FROM sensor_data WHERE device_id = $1 AND metric_name = $2 ORDER BY timestamp DESC, id DESC LIMIT 1"
+
+// SelectLatest returns the statement listing the latest readings ordered by
+// device and metric. An empty deviceId or metricName does not filter.
+func SelectLatest(deviceId, metricName string) (string, []any) {
+	var conditions []string
+	var args []any
+	if deviceId != "" {
+		args = append(args, deviceId)
+		conditions = append(conditions, fmt.Sprintf("device_id = $%d", len(args)))
+	}
+	if metricName != "" {
+		args = append(args, metricName)
+		conditions = append(conditions, fmt.Sprintf("metric_name = $%d", len(args)))
+	}
+
+	statement := "SELECT " + LatestColumns + " FROM sensor_data_latest"
+	if len(conditions) > 0 {
+		statement += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	return statement + " ORDER BY device_id, metric_name", args
+}
+
+// Where returns the WHERE clause, including the keyword, for q and its
+// arguments. Numeric filters and aggregations only ever see numeric rows.
+func Where(q model.SensorDataQuery, numericOnly bool) (string, []any) {
+	var conditions []string
+	var args []any
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if len(q.DeviceIds) > 0 {
+		placeholders := make([]string, len(q.DeviceIds))
+		for i, id := range q.DeviceIds {
+			args = append(args, id)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		conditions = append(conditions, "device_id IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if q.MetricName != "" {
+		add("metric_name = $%d", q.MetricName)
+	}
+	if !q.From.IsZero() {
+		add("timestamp >= $%d", q.From.UTC())
+	}
+	if !q.To.IsZero() {
+		add("timestamp < $%d", q.To.UTC())
+	}
+
+	valueType := q.ValueType
+	if numericOnly || q.Min != nil || q.Max != nil || q.Unit != "" {
+		valueType = model.ValueNumber
+	}
+	if valueType != "" {
+		add("value_type = $%d", string(valueType))
+	}
+	if q.Unit != "" {
+		add("unit = $%d", model.StorageUnit(q.Unit))
+	}
+	if q.Min != nil {
+		add("metric_value >= $%d", *q.Min)
+	}
+	if q.Max != nil {
+		add("metric_value <= $%d", *q.Max)
+	}
+	if q.Equals != nil {
+		add("value_text = $%d", string(q.Equals))
+	}
+	if q.After != nil {
+		timestamp := q.After.Timestamp.UTC()
+		args = append(args, timestamp, timestamp, q.After.Id)
+		conditions = append(conditions, fmt.Sprintf("(timestamp > $%d OR (timestamp = $%d AND id > $%d))", len(args)-2, len(args)-1, len(args)))
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// Select returns the statement listing the readings matched by q in time
+// order.
+func Select(q model.SensorDataQuery) (string, []any) {
+	where, args := Where(q, false)
+	statement := "SELECT " + SensorDataColumns + " FROM sensor_data" + where + " ORDER BY timestamp, id"
+
+	// SQLite only accepts OFFSET after a LIMIT, so an offset without a
+	// limit is ignored.
+	if q.Limit > 0 {
+		args = append(args, q.Limit)
+		statement += fmt.Sprintf(" LIMIT $%d", len(args))
+
+		if q.Offset > 0 {
+			args = append(args, q.Offset)
+			statement += fmt.Sprintf(" OFFSET $%d", len(args))
+		}
+	}
+
+	return statement, args
+}
+
+// DeleteByIds returns the statement deleting the readings with the given
+// ids.
+func DeleteByIds(ids []int64) (string, []any) {
+	placeholders := make([]string, len(ids))
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = id
+	}
+
+	return "DELETE FROM sensor_data WHERE id IN (" + strings.Join(placeholders, ", ") + ")", args
+}
+
+// Aggregate returns the statement applying fn to the numeric readings matched
+// by q. It yields the aggregate, which may be NULL, and the row count.
+func Aggregate(q model.SensorDataQuery, fn model.AggregateFunc) (string, []any, error) {
+	var expression string
+	switch fn {
+	case model.AggregateAvg:
+		expression = "AVG(metric_value)"
+	case model.AggregateMin:
+		expression = "MIN(metric_value)"
+	case model.AggregateMax:
+		expression = "MAX(metric_value)"
+	case model.AggregateSum:
+		expression = "SUM(metric_value)"
+	case model.AggregateCount:
+		expression = "COUNT(*)"
+	default:
+		return "", nil, fmt.Errorf("unknown aggregate %q", fn)
+	}
+
+	where, args := Where(q, true)
+	return "SELECT " + expression + ", COUNT(*) FROM sensor_data" + where, args, nil
+}
+
+// ValueType returns the value_type column for a reading.
+func ValueType(sensorData *model.SensorData) string {
+	if sensorData.ValueType == "" {
+		return string(model.ValueNumber)
+	}
+
+	return string(sensorData.ValueType)
+}
+
+// ValueText returns the value_text column for a reading, which is NULL for
+// numbers.
+func ValueText(sensorData *model.SensorData) sql.NullString {
+	if sensorData.ValueType.Numeric() {
+		return sql.NullString{}
+	}
+
+	return sql.NullString{String: string(sensorData.RawValue), Valid: true}
+}
+
+// RawValue converts a scanned value_text column back into a reading's
+// RawValue.
+func RawValue(text sql.NullString) json.RawMessage {
+	if !text.Valid {
+		return nil
+	}
+
+	return json.RawMessage(text.String)
+}
+
+// NullString stores empty strings as NULL.
+func NullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// SetUnit copies the scanned unit columns into a reading.
+func SetUnit(sensorData *model.SensorData, unit, originalUnit sql.NullString, originalValue sql.NullFloat64) {
+	sensorData.Unit = unit.String
+	sensorData.OriginalUnit = originalUnit.String
+	if originalValue.Valid {
+		value := originalValue.Float64
+		sensorData.OriginalValue = &value
+	}
+}
+
+// Labels returns the labels column for a reading, JSON or NULL when there
+// are none.
+func Labels(sensorData *model.SensorData) sql.NullString {
+	if len(sensorData.Labels) == 0 {
+		return sql.NullString{}
+	}
+
+	text, _ := json.Marshal(sensorData.Labels)
+	return sql.NullString{String: string(text), Valid: true}
+}
+
+// SetLabels copies a scanned labels column into a reading.
+func SetLabels(sensorData *model.SensorData, labels sql.NullString) {
+	if !labels.Valid {
+		return
+	}
+
+	json.Unmarshal([]byte(labels.String), &sensorData.Labels)
+}
+
+// Subtree is a common table expression naming subtree the ids of the asset
+// $1 and of every asset below it.
+const Subtree = "WITH RECURSIVE subtree (id) AS (SELECT id FROM assets WHERE id = $1 UNION SELECT a.id FROM assets a JOIN subtree s ON a.parent_id = s.id) "
@@ -0,0 +1,214 @@
+package query
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iot-platform/internal/model"
+	"time"
+)
+
+type ReplicationRepository struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+func NewReplicationRepository(db *sql.DB, dialect Dialect) *ReplicationRepository {
+	return &ReplicationRepository{
+		db:      db,
+		dialect: dialect,
+	}
+}
+
+func (re *ReplicationRepository) AppendChange(ctx context.Context, change *model.Change) error {
+	tx, err := re.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := NewOutbox(re.dialect).Append(ctx, tx, change); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (re *ReplicationRepository) ListChangesAfter(ctx context.Context, seq int64, limit int) ([]*model.Change, error) {
+	if limit <= 0 {
+		return nil, errors.New("invalid limit error")
+	}
+
+	rows, err := re.db.QueryContext(ctx, `SELECT seq, kind, payload, created_at FROM replication_outbox WHERE seq > $1 ORDER BY seq LIMIT $2`, seq, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []*model.Change
+	for rows.Next() {
+		var change model.Change
+		var payload string
+		if err := rows.Scan(&change.Seq, &change.Kind, &payload, &change.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := decodePayload(&change, payload); err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, &change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+func (re *ReplicationRepository) FindCheckpoint(ctx context.Context, target string) (int64, error) {
+	var seq int64
+	err := re.db.QueryRowContext(ctx, `SELECT seq FROM replication_checkpoints WHERE target = $1`, target).Scan(&seq)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+
+	return seq, err
+}
+
+func (re *ReplicationRepository) SaveCheckpoint(ctx context.Context, target string, seq int64) error {
+	_, err := re.db.ExecContext(ctx, `INSERT INTO replication_checkpoints (target, seq, updated_at) VALUES ($1, $2, $3) ON CONFLICT (target) DO UPDATE SET seq = EXCLUDED.seq, updated_at = EXCLUDED.updated_at`, target, seq, time.Now().UTC())
+	return err
+}
+
+func (re *ReplicationRepository) FindAppliedSeq(ctx context.Context, sourceId string) (int64, error) {
+	var seq int64
+	err := re.db.QueryRowContext(ctx, `SELECT seq FROM replication_sources WHERE source_id = $1`, sourceId).Scan(&seq)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+
+	return seq, err
+}
+
+func (re *ReplicationRepository) ApplyChanges(ctx context.Context, sourceId string, changes []*model.Change) (int64, error) {
+	if sourceId == "" {
+		return 0, errors.New("invalid source id error")
+	}
+
+	tx, err := re.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO replication_sources (source_id, seq) VALUES ($1, 0) ON CONFLICT (source_id) DO NOTHING`, sourceId); err != nil {
+		return 0, err
+	}
+
+	var last int64
+	if err := tx.QueryRowContext(ctx, `SELECT seq FROM replication_sources WHERE source_id = $1`+re.dialect.ForUpdate, sourceId).Scan(&last); err != nil {
+		return 0, err
+	}
+
+	for _, change := range changes {
+		if change.Seq <= last {
+			continue
+		}
+		if err := applyChange(ctx, tx, change); err != nil {
+			return 0, fmt.Errorf("apply change %d: %w", change.Seq, err)
+		}
+		last = change.Seq
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE replication_sources SET seq = $1, updated_at = $2 WHERE source_id = $3`, last, time.Now().UTC(), sourceId); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return last, nil
+}
+
+func applyChange(ctx context.Context, tx *sql.Tx, change *model.Change) error {
+	switch change.Kind {
+	case model.ChangeDeviceSaved:
+		device := change.Device
+		if device == nil || device.Id == "" {
+			return errors.New("missing device")
+		}
+		createdAt, updatedAt := orNow(device.CreatedAt), orNow(device.UpdatedAt)
+		_, err := tx.ExecContext(ctx, `INSERT INTO devices (id, name, kind, api_key, state, serial, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, kind = EXCLUDED.kind, api_key = EXCLUDED.api_key, state = EXCLUDED.state, serial = EXCLUDED.serial, updated_at = EXCLUDED.updated_at, deleted_at = NULL`, device.Id, device.Name, device.Kind, device.ApiKey, DeviceState(device), NullString(device.Serial), createdAt, updatedAt)
+		return err
+	case model.ChangeDeviceDeleted:
+		if change.Device == nil || change.Device.Id == "" {
+			return errors.New("missing device")
+		}
+		deletedAt := time.Now().UTC()
+		if change.Device.DeletedAt != nil {
+			deletedAt = *change.Device.DeletedAt
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE devices SET deleted_at = $1, updated_at = $1 WHERE id = $2 AND deleted_at IS NULL`, deletedAt, change.Device.Id)
+		return err
+	case model.ChangeSensorDataCreated:
+		sensorData := change.SensorData
+		if sensorData == nil || sensorData.DeviceId == "" || sensorData.MetricName == "" {
+			return errors.New("missing sensor data")
+		}
+		stored := *sensorData
+		stored.Timestamp = orNow(sensorData.Timestamp)
+		err := tx.QueryRowContext(ctx, `INSERT INTO sensor_data (device_id, metric_name, value_type, metric_value, value_text, timestamp, violation, unit, original_unit, original_value, labels, message_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id`, stored.DeviceId, stored.MetricName, ValueType(&stored), stored.MetricValue, ValueText(&stored), stored.Timestamp.UTC(), NullString(stored.Violation), NullString(stored.Unit), NullString(stored.OriginalUnit), stored.OriginalValue, Labels(&stored), NullString(stored.MessageId)).Scan(&stored.Id)
+		if err != nil {
+			return err
+		}
+		statement, args := UpsertLatest(&stored)
+		_, err = tx.ExecContext(ctx, statement, args...)
+		return err
+	default:
+		return fmt.Errorf("unknown change kind %q", change.Kind)
+	}
+}
+
+func encodePayload(change *model.Change) (string, error) {
+	var payload any
+	switch change.Kind {
+	case model.ChangeDeviceSaved, model.ChangeDeviceDeleted:
+		payload = change.Device
+	case model.ChangeSensorDataCreated:
+		payload = change.SensorData
+	default:
+		return "", fmt.Errorf("unknown change kind %q", change.Kind)
+	}
+
+	bytes, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	return string(bytes), nil
+}
+
+func decodePayload(change *model.Change, payload string) error {
+	switch change.Kind {
+	case model.ChangeDeviceSaved, model.ChangeDeviceDeleted:
+		change.Device = &model.Device{}
+		return json.Unmarshal([]byte(payload), change.Device)
+	case model.ChangeSensorDataCreated:
+		change.SensorData = &model.SensorData{}
+		return json.Unmarshal([]byte(payload), change.SensorData)
+	default:
+		return fmt.Errorf("unknown change kind %q", change.Kind)
+	}
+}
+
+func orNow(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Now().UTC()
+	}
+
+	return t
+}
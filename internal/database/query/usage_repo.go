@@ -0,0 +1,66 @@
+package query
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"iot-platform/internal/model"
+	"iot-platform/internal/repository"
+)
+
+type UsageRepository struct {
+	db *sql.DB
+}
+
+func NewUsageRepository(db *sql.DB) *UsageRepository {
+	return &UsageRepository{
+		db: db,
+	}
+}
+
+func (us *UsageRepository) AddUsage(ctx context.Context, tenantId, day string, readings, quota int64) (int64, error) {
+	if readings <= quota {
+		// The conflict clause only adds the readings while they fit the
+		// quota, and returns no row otherwise.
+		var usage int64
+		err := us.db.QueryRowContext(ctx, `INSERT INTO tenant_usage (tenant_id, day, readings) VALUES ($1, $2, $3)
+			ON CONFLICT (tenant_id, day) DO UPDATE SET readings = tenant_usage.readings + excluded.readings
+			WHERE tenant_usage.readings + excluded.readings <= $4
+			RETURNING readings`, tenantId, day, readings, quota).Scan(&usage)
+		if !errors.Is(err, sql.ErrNoRows) {
+			return usage, err
+		}
+	}
+
+	var usage int64
+	err := us.db.QueryRowContext(ctx, `SELECT readings FROM tenant_usage WHERE tenant_id = $1 AND day = $2`, tenantId, day).Scan(&usage)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	return usage, repository.ErrQuotaExceeded
+}
+
+func (us *UsageRepository) RefundUsage(ctx context.Context, tenantId, day string, readings int64) error {
+	_, err := us.db.ExecContext(ctx, `UPDATE tenant_usage SET readings = CASE WHEN readings > $1 THEN readings - $1 ELSE 0 END WHERE tenant_id = $2 AND day = $3`, readings, tenantId, day)
+	return err
+}
+
+func (us *UsageRepository) ListUsage(ctx context.Context, day string) ([]*model.TenantUsage, error) {
+	rows, err := us.db.QueryContext(ctx, `SELECT tenant_id, day, readings FROM tenant_usage WHERE day = $1 ORDER BY tenant_id`, day)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usages := []*model.TenantUsage{}
+	for rows.Next() {
+		usage := &model.TenantUsage{}
+		if err := rows.Scan(&usage.TenantId, &usage.Day, &usage.Readings); err != nil {
+			return nil, err
+		}
+		usages = append(usages, usage)
+	}
+
+	return usages, rows.Err()
+}
@@ -0,0 +1,22 @@
+package asset
+
+import (
+	"database/sql"
+	"errors"
+	"iot-platform/internal/database/query"
+	"iot-platform/internal/database/sqlite"
+)
+
+type AssetSqliteRepository struct {
+	*query.AssetRepository
+}
+
+func NewAssetSqliteRepository(db *sql.DB) (*AssetSqliteRepository, error) {
+	if err := db.Ping(); err != nil {
+		return nil, errors.New("failed to connect to the database: " + err.Error())
+	}
+
+	return &AssetSqliteRepository{
+		AssetRepository: query.NewAssetRepository(db, sqlite.Dialect),
+	}, nil
+}
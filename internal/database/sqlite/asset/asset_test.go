@@ -0,0 +1,11 @@
+package asset_test
+
+import (
+	"iot-platform/internal/database/sqlite/sqlitetest"
+	"iot-platform/internal/repository/repositorytest"
+	"testing"
+)
+
+func TestAssetSqliteRepository(t *testing.T) {
+	repositorytest.TestAssetsRepository(t, sqlitetest.NewRepositories)
+}
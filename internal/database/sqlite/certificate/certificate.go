@@ -0,0 +1,21 @@
+package certificate
+
+import (
+	"database/sql"
+	"errors"
+	"iot-platform/internal/database/query"
+)
+
+type CertificateSqliteRepository struct {
+	*query.CertificateRepository
+}
+
+func NewCertificateSqliteRepository(db *sql.DB) (*CertificateSqliteRepository, error) {
+	if err := db.Ping(); err != nil {
+		return nil, errors.New("failed to connect to the database: " + err.Error())
+	}
+
+	return &CertificateSqliteRepository{
+		CertificateRepository: query.NewCertificateRepository(db),
+	}, nil
+}
@@ -0,0 +1,11 @@
+package certificate_test
+
+import (
+	"iot-platform/internal/database/sqlite/sqlitetest"
+	"iot-platform/internal/repository/repositorytest"
+	"testing"
+)
+
+func TestCertificateSqliteRepository(t *testing.T) {
+	repositorytest.TestCertificatesRepository(t, sqlitetest.NewRepositories)
+}
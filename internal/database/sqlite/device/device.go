@@ -0,0 +1,148 @@
+package device
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"iot-platform/internal/database/query"
+	"iot-platform/internal/model"
+	"iot-platform/internal/repository"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type DeviceSqliteRepository struct {
+	db     *sql.DB
+	outbox *query.Outbox
+}
+
+func NewDeviceSqliteRepository(db *sql.DB, opts ...query.Option) (*DeviceSqliteRepository, error) {
+	if err := db.Ping(); err != nil {
+		return nil, errors.New("failed to connect to the database: " + err.Error())
+	}
+
+	return &DeviceSqliteRepository{
+		db:     db,
+		outbox: query.NewOptions(opts...).Outbox,
+	}, nil
+}
+
+func (de *DeviceSqliteRepository) SaveDevice(ctx context.Context, device *model.Device) (string, error) {
+	id := device.Id
+	err := de.outbox.Record(ctx, de.db, func(ex query.Execer) error {
+		if id == "" {
+			id = uuid.New().String()
+			_, err := ex.ExecContext(ctx, `INSERT INTO devices (id, name, kind, api_key, state) VALUES ($1, $2, $3, $4, $5)`, id, device.Name, device.Kind, device.ApiKey, query.DeviceState(device))
+			return err
+		}
+
+		_, err := ex.ExecContext(ctx, `UPDATE devices SET name = $1, kind = $2, api_key = $3, updated_at = $4 WHERE id = $5`, device.Name, device.Kind, device.ApiKey, time.Now().UTC(), id)
+		return err
+	}, func(ex query.Execer) (*model.Change, error) {
+		return query.DeviceSaved(ctx, ex, id)
+	})
+
+	return id, err
+}
+
+func (de *DeviceSqliteRepository) FindDeviceById(ctx context.Context, id string) (*model.Device, error) {
+	row := de.db.QueryRowContext(ctx, `SELECT `+query.DeviceColumns+` FROM devices WHERE id = $1 AND deleted_at IS NULL`, id)
+
+	return query.ScanDevice(row)
+}
+
+func (de *DeviceSqliteRepository) DeleteDevice(ctx context.Context, id string) error {
+	return de.outbox.Record(ctx, de.db, func(ex query.Execer) error {
+		now := time.Now().UTC()
+		res, err := ex.ExecContext(ctx, `UPDATE devices SET deleted_at = $1, updated_at = $2 WHERE id = $3 AND deleted_at IS NULL`, now, now, id)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return fmt.Errorf("no device found with id: %s", id)
+		}
+
+		return nil
+	}, func(ex query.Execer) (*model.Change, error) {
+		return query.DeviceDeleted(id), nil
+	})
+}
+
+func (de *DeviceSqliteRepository) RestoreDevice(ctx context.Context, id string) error {
+	return de.outbox.Record(ctx, de.db, func(ex query.Execer) error {
+		res, err := ex.ExecContext(ctx, `UPDATE devices SET deleted_at = NULL, updated_at = $1 WHERE id = $2 AND deleted_at IS NOT NULL`, time.Now().UTC(), id)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return repository.ErrNotFound
+		}
+
+		return nil
+	}, func(ex query.Execer) (*model.Change, error) {
+		return query.DeviceSaved(ctx, ex, id)
+	})
+}
+
+func (de *DeviceSqliteRepository) UpdateDeviceState(ctx context.Context, id string, from, to model.DeviceState) error {
+	return de.outbox.Record(ctx, de.db, func(ex query.Execer) error {
+		res, err := ex.ExecContext(ctx, `UPDATE devices SET state = $1, updated_at = $2 WHERE id = $3 AND state = $4 AND deleted_at IS NULL`, string(to), time.Now().UTC(), id, string(from))
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return repository.ErrNotFound
+		}
+
+		return nil
+	}, func(ex query.Execer) (*model.Change, error) {
+		return query.DeviceSaved(ctx, ex, id)
+	})
+}
+
+func (de *DeviceSqliteRepository) ListDevices(ctx context.Context, filter model.DeviceFilter, page int, pageSize int) ([]*model.Device, error) {
+	where, args := query.DeviceWhere(filter)
+	args = append(args, pageSize, (page-1)*pageSize)
+	rows, err := de.db.QueryContext(ctx, fmt.Sprintf(`SELECT %s FROM devices %s ORDER BY created_at, rowid LIMIT $%d OFFSET $%d`, query.DeviceColumns, where, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var devices []*model.Device
+	for rows.Next() {
+		device, err := query.ScanDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		devices = append(devices, device)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return devices, nil
+}
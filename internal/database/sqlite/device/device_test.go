@@ -0,0 +1,11 @@
+package device_test
+
+import (
+	"iot-platform/internal/database/sqlite/sqlitetest"
+	"iot-platform/internal/repository/repositorytest"
+	"testing"
+)
+
+func TestDeviceSqliteRepository(t *testing.T) {
+	repositorytest.TestDevicesRepository(t, sqlitetest.NewRepositories)
+}
@@ -0,0 +1,21 @@
+package devicekind
+
+import (
+	"database/sql"
+	"errors"
+	"iot-platform/internal/database/query"
+)
+
+type DeviceKindSqliteRepository struct {
+	*query.DeviceKindRepository
+}
+
+func NewDeviceKindSqliteRepository(db *sql.DB) (*DeviceKindSqliteRepository, error) {
+	if err := db.Ping(); err != nil {
+		return nil, errors.New("failed to connect to the database: " + err.Error())
+	}
+
+	return &DeviceKindSqliteRepository{
+		DeviceKindRepository: query.NewDeviceKindRepository(db),
+	}, nil
+}
@@ -0,0 +1,11 @@
+package devicekind_test
+
+import (
+	"iot-platform/internal/database/sqlite/sqlitetest"
+	"iot-platform/internal/repository/repositorytest"
+	"testing"
+)
+
+func TestDeviceKindSqliteRepository(t *testing.T) {
+	repositorytest.TestDeviceKindsRepository(t, sqlitetest.NewRepositories)
+}
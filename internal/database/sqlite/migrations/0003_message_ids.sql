@@ -0,0 +1,10 @@
+ALTER TABLE sensor_data ADD COLUMN message_id TEXT;
+
+CREATE TABLE IF NOT EXISTS sensor_data_messages (
+    device_id TEXT NOT NULL,
+    message_id TEXT NOT NULL,
+    received_at DATETIME NOT NULL,
+    PRIMARY KEY (device_id, message_id)
+);
+
+CREATE INDEX IF NOT EXISTS sensor_data_messages_received_at_idx ON sensor_data_messages (received_at);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS device_kinds (
+    name TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    definition TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (name, version)
+);
+
+ALTER TABLE sensor_data ADD COLUMN violation TEXT;
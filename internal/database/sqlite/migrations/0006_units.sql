@@ -0,0 +1,3 @@
+ALTER TABLE sensor_data ADD COLUMN unit TEXT;
+ALTER TABLE sensor_data ADD COLUMN original_unit TEXT;
+ALTER TABLE sensor_data ADD COLUMN original_value REAL;
@@ -0,0 +1 @@
+ALTER TABLE sensor_data ADD COLUMN labels TEXT;
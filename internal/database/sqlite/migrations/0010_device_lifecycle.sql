@@ -0,0 +1,4 @@
+ALTER TABLE devices ADD COLUMN state TEXT NOT NULL DEFAULT 'active';
+ALTER TABLE devices ADD COLUMN deleted_at DATETIME;
+
+CREATE INDEX IF NOT EXISTS devices_state_idx ON devices (state);
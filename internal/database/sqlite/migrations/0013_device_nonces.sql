@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS device_nonces (
+    device_id TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    used_at DATETIME NOT NULL,
+    PRIMARY KEY (device_id, nonce)
+);
+
+CREATE INDEX IF NOT EXISTS device_nonces_used_at_idx ON device_nonces (used_at);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS tenant_usage (
+    tenant_id TEXT NOT NULL,
+    day TEXT NOT NULL,
+    readings INTEGER NOT NULL,
+    PRIMARY KEY (tenant_id, day)
+);
@@ -0,0 +1,21 @@
+package nonce
+
+import (
+	"database/sql"
+	"errors"
+	"iot-platform/internal/database/query"
+)
+
+type NonceSqliteRepository struct {
+	*query.NonceRepository
+}
+
+func NewNonceSqliteRepository(db *sql.DB) (*NonceSqliteRepository, error) {
+	if err := db.Ping(); err != nil {
+		return nil, errors.New("failed to connect to the database: " + err.Error())
+	}
+
+	return &NonceSqliteRepository{
+		NonceRepository: query.NewNonceRepository(db),
+	}, nil
+}
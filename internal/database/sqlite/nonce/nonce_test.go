@@ -0,0 +1,11 @@
+package nonce_test
+
+import (
+	"iot-platform/internal/database/sqlite/sqlitetest"
+	"iot-platform/internal/repository/repositorytest"
+	"testing"
+)
+
+func TestNonceSqliteRepository(t *testing.T) {
+	repositorytest.TestNoncesRepository(t, sqlitetest.NewRepositories)
+}
@@ -0,0 +1,22 @@
+package provisioning
+
+import (
+	"database/sql"
+	"errors"
+	"iot-platform/internal/database/query"
+	"iot-platform/internal/database/sqlite"
+)
+
+type ProvisioningSqliteRepository struct {
+	*query.ProvisioningRepository
+}
+
+func NewProvisioningSqliteRepository(db *sql.DB, opts ...query.Option) (*ProvisioningSqliteRepository, error) {
+	if err := db.Ping(); err != nil {
+		return nil, errors.New("failed to connect to the database: " + err.Error())
+	}
+
+	return &ProvisioningSqliteRepository{
+		ProvisioningRepository: query.NewProvisioningRepository(db, sqlite.Dialect, query.NewOptions(opts...).Outbox),
+	}, nil
+}
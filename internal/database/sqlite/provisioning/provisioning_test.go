@@ -0,0 +1,11 @@
+package provisioning_test
+
+import (
+	"iot-platform/internal/database/sqlite/sqlitetest"
+	"iot-platform/internal/repository/repositorytest"
+	"testing"
+)
+
+func TestProvisioningSqliteRepository(t *testing.T) {
+	repositorytest.TestProvisioningRepository(t, sqlitetest.NewRepositories)
+}
@@ -0,0 +1,22 @@
+package replication
+
+import (
+	"database/sql"
+	"errors"
+	"iot-platform/internal/database/query"
+	"iot-platform/internal/database/sqlite"
+)
+
+type ReplicationSqliteRepository struct {
+	*query.ReplicationRepository
+}
+
+func NewReplicationSqliteRepository(db *sql.DB) (*ReplicationSqliteRepository, error) {
+	if err := db.Ping(); err != nil {
+		return nil, errors.New("failed to connect to the database: " + err.Error())
+	}
+
+	return &ReplicationSqliteRepository{
+		ReplicationRepository: query.NewReplicationRepository(db, sqlite.Dialect),
+	}, nil
+}
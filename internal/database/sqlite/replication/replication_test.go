@@ -0,0 +1,11 @@
+package replication_test
+
+import (
+	"iot-platform/internal/database/sqlite/sqlitetest"
+	"iot-platform/internal/repository/repositorytest"
+	"testing"
+)
+
+func TestReplicationSqliteRepository(t *testing.T) {
+	repositorytest.TestReplicationRepository(t, sqlitetest.NewRepositories)
+}
@@ -0,0 +1,340 @@
+package sensordata
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"iot-platform/internal/database/query"
+	"iot-platform/internal/model"
+	"iot-platform/internal/repository"
+	"time"
+)
+
+type SensorDataSqliteRepository struct {
+	db     *sql.DB
+	outbox *query.Outbox
+}
+
+func NewSensorDataSqliteRepository(db *sql.DB, opts ...query.Option) (*SensorDataSqliteRepository, error) {
+	if err := db.Ping(); err != nil {
+		return nil, errors.New("failed to connect to the database: " + err.Error())
+	}
+
+	return &SensorDataSqliteRepository{
+		db:     db,
+		outbox: query.NewOptions(opts...).Outbox,
+	}, nil
+}
+
+func (se *SensorDataSqliteRepository) SaveSensorData(ctx context.Context, sensorData *model.SensorData) error {
+	if sensorData.DeviceId == "" || sensorData.MetricName == "" {
+		return errors.New("save argument error")
+	}
+
+	if sensorData.Timestamp.IsZero() {
+		sensorData.Timestamp = time.Now()
+	}
+	sensorData.Timestamp = sensorData.Timestamp.UTC()
+
+	if sensorData.MessageId != "" {
+		return se.saveSensorDataOnce(ctx, sensorData)
+	}
+
+	tx, err := se.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, "INSERT INTO sensor_data (device_id, metric_name, value_type, metric_value, value_text, timestamp, violation, unit, original_unit, original_value, labels) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id", sensorData.DeviceId, sensorData.MetricName, query.ValueType(sensorData), sensorData.MetricValue, query.ValueText(sensorData), sensorData.Timestamp, query.NullString(sensorData.Violation), query.NullString(sensorData.Unit), query.NullString(sensorData.OriginalUnit), sensorData.OriginalValue, query.Labels(sensorData)).Scan(&sensorData.Id)
+	if err != nil {
+		return err
+	}
+
+	if err := saveLatest(ctx, tx, sensorData); err != nil {
+		return err
+	}
+
+	if err := se.outbox.Append(ctx, tx, query.SensorDataCreated(sensorData)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// saveSensorDataOnce claims the device's message id and stores the reading in
+// the same transaction, so a retried message is never stored twice.
+func (se *SensorDataSqliteRepository) saveSensorDataOnce(ctx context.Context, sensorData *model.SensorData) error {
+	tx, err := se.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "INSERT INTO sensor_data_messages (device_id, message_id, received_at) VALUES ($1, $2, $3) ON CONFLICT (device_id, message_id) DO NOTHING", sensorData.DeviceId, sensorData.MessageId, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return repository.ErrDuplicateMessage
+	}
+
+	err = tx.QueryRowContext(ctx, "INSERT INTO sensor_data (device_id, metric_name, value_type, metric_value, value_text, timestamp, violation, unit, original_unit, original_value, labels, message_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id", sensorData.DeviceId, sensorData.MetricName, query.ValueType(sensorData), sensorData.MetricValue, query.ValueText(sensorData), sensorData.Timestamp, query.NullString(sensorData.Violation), query.NullString(sensorData.Unit), query.NullString(sensorData.OriginalUnit), sensorData.OriginalValue, query.Labels(sensorData), sensorData.MessageId).Scan(&sensorData.Id)
+	if err != nil {
+		return err
+	}
+
+	if err := saveLatest(ctx, tx, sensorData); err != nil {
+		return err
+	}
+
+	if err := se.outbox.Append(ctx, tx, query.SensorDataCreated(sensorData)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// saveLatest records a reading stored in tx as the latest of its device and
+// metric, unless a newer one is recorded already.
+func saveLatest(ctx context.Context, tx *sql.Tx, sensorData *model.SensorData) error {
+	statement, args := query.UpsertLatest(sensorData)
+	_, err := tx.ExecContext(ctx, statement, args...)
+
+	return err
+}
+
+func (se *SensorDataSqliteRepository) PruneMessageIds(ctx context.Context, before time.Time) (int64, error) {
+	result, err := se.db.ExecContext(ctx, "DELETE FROM sensor_data_messages WHERE received_at < $1", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (se *SensorDataSqliteRepository) FindSensorDataById(ctx context.Context, id int64) (*model.SensorData, error) {
+	if id == 0 {
+		return nil, errors.New("invalid id error")
+	}
+
+	row := se.db.QueryRowContext(ctx, "SELECT id, device_id, metric_name, value_type, metric_value, value_text, timestamp, violation, unit, original_unit, original_value, labels FROM sensor_data WHERE id = $1", id)
+
+	var sensorData model.SensorData
+	var text, violation, unit, originalUnit, labels sql.NullString
+	var originalValue sql.NullFloat64
+	err := row.Scan(&sensorData.Id, &sensorData.DeviceId, &sensorData.MetricName, &sensorData.ValueType, &sensorData.MetricValue, &text, &sensorData.Timestamp, &violation, &unit, &originalUnit, &originalValue, &labels)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("not found error")
+	}
+	if err != nil {
+		return nil, errors.New("scan error")
+	}
+	sensorData.RawValue = query.RawValue(text)
+	sensorData.Violation = violation.String
+	query.SetUnit(&sensorData, unit, originalUnit, originalValue)
+	query.SetLabels(&sensorData, labels)
+
+	return &sensorData, nil
+}
+
+func (se *SensorDataSqliteRepository) FindSensorDataByDeviceId(ctx context.Context, deviceId string) ([]*model.SensorData, error) {
+	if deviceId == "" {
+		return nil, errors.New("invalid device id error")
+	}
+
+	rows, err := se.db.QueryContext(ctx, "SELECT id, metric_name, value_type, metric_value, value_text, timestamp, violation, unit, original_unit, original_value, labels FROM sensor_data WHERE device_id = $1 ORDER BY id", deviceId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sensorDataList []*model.SensorData
+	for rows.Next() {
+		var sensorData model.SensorData
+		var text, violation, unit, originalUnit, labels sql.NullString
+		var originalValue sql.NullFloat64
+		err = rows.Scan(&sensorData.Id, &sensorData.MetricName, &sensorData.ValueType, &sensorData.MetricValue, &text, &sensorData.Timestamp, &violation, &unit, &originalUnit, &originalValue, &labels)
+		if err != nil {
+			return nil, errors.New("scan error")
+		}
+
+		sensorData.DeviceId = deviceId
+		sensorData.RawValue = query.RawValue(text)
+		sensorData.Violation = violation.String
+		query.SetUnit(&sensorData, unit, originalUnit, originalValue)
+		query.SetLabels(&sensorData, labels)
+		sensorDataList = append(sensorDataList, &sensorData)
+	}
+
+	if len(sensorDataList) == 0 {
+		return nil, errors.New("not found error")
+	}
+
+	return sensorDataList, nil
+}
+
+func (se *SensorDataSqliteRepository) DeleteSensorData(ctx context.Context, id int64) error {
+	if id == 0 {
+		return errors.New("invalid id error")
+	}
+
+	tx, err := se.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM sensor_data WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("not found error")
+	}
+
+	// A deleted latest reading is replaced by the newest one left.
+	var deviceId, metricName string
+	err = tx.QueryRowContext(ctx, "DELETE FROM sensor_data_latest WHERE sensor_data_id = $1 RETURNING device_id, metric_name", id).Scan(&deviceId, &metricName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return tx.Commit()
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, query.RefreshLatest, deviceId, metricName); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (se *SensorDataSqliteRepository) DeleteSensorDataByIds(ctx context.Context, ids []int64) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	statement, args := query.DeleteByIds(ids)
+	result, err := se.db.ExecContext(ctx, statement, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (se *SensorDataSqliteRepository) ListSensorData(ctx context.Context, page int, pageSize int) ([]*model.SensorData, error) {
+	if page <= 0 {
+		return nil, errors.New("invalid page error")
+	}
+	if pageSize <= 0 {
+		return nil, errors.New("invalid page size error")
+	}
+
+	offset := (page - 1) * pageSize
+	rows, err := se.db.QueryContext(ctx, "SELECT id, device_id, metric_name, value_type, metric_value, value_text, timestamp, violation, unit, original_unit, original_value, labels FROM sensor_data ORDER BY id LIMIT $1 OFFSET $2", pageSize, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sensorDataList []*model.SensorData
+	for rows.Next() {
+		var sensorData model.SensorData
+		var text, violation, unit, originalUnit, labels sql.NullString
+		var originalValue sql.NullFloat64
+		err = rows.Scan(&sensorData.Id, &sensorData.DeviceId, &sensorData.MetricName, &sensorData.ValueType, &sensorData.MetricValue, &text, &sensorData.Timestamp, &violation, &unit, &originalUnit, &originalValue, &labels)
+		if err != nil {
+			return nil, errors.New("scan error")
+		}
+		sensorData.RawValue = query.RawValue(text)
+		sensorData.Violation = violation.String
+		query.SetUnit(&sensorData, unit, originalUnit, originalValue)
+		query.SetLabels(&sensorData, labels)
+		sensorDataList = append(sensorDataList, &sensorData)
+	}
+
+	if len(sensorDataList) == 0 {
+		return nil, errors.New("not found error")
+	}
+
+	return sensorDataList, nil
+}
+
+func (se *SensorDataSqliteRepository) QuerySensorData(ctx context.Context, q model.SensorDataQuery) ([]*model.SensorData, error) {
+	statement, args := query.Select(q)
+	rows, err := se.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSensorData(rows)
+}
+
+// ListLatestSensorData returns the newest reading of every device and metric,
+// ordered by device and metric. Readings moved to the archive stay the latest
+// until a newer one arrives.
+func (se *SensorDataSqliteRepository) ListLatestSensorData(ctx context.Context, deviceId, metricName string) ([]*model.SensorData, error) {
+	statement, args := query.SelectLatest(deviceId, metricName)
+	rows, err := se.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSensorData(rows)
+}
+
+// scanSensorData reads rows of query.SensorDataColumns.
+func scanSensorData(rows *sql.Rows) ([]*model.SensorData, error) {
+	var sensorDataList []*model.SensorData
+	for rows.Next() {
+		var sensorData model.SensorData
+		var text, violation, unit, originalUnit, labels sql.NullString
+		var originalValue sql.NullFloat64
+		err := rows.Scan(&sensorData.Id, &sensorData.DeviceId, &sensorData.MetricName, &sensorData.ValueType, &sensorData.MetricValue, &text, &sensorData.Timestamp, &violation, &unit, &originalUnit, &originalValue, &labels)
+		if err != nil {
+			return nil, err
+		}
+		sensorData.RawValue = query.RawValue(text)
+		sensorData.Violation = violation.String
+		query.SetUnit(&sensorData, unit, originalUnit, originalValue)
+		query.SetLabels(&sensorData, labels)
+		sensorDataList = append(sensorDataList, &sensorData)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sensorDataList, nil
+}
+
+func (se *SensorDataSqliteRepository) AggregateSensorData(ctx context.Context, q model.SensorDataQuery, fn model.AggregateFunc) (*model.Aggregate, error) {
+	statement, args, err := query.Aggregate(q, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	var value sql.NullFloat64
+	aggregate := model.Aggregate{Func: fn}
+	if err := se.db.QueryRowContext(ctx, statement, args...).Scan(&value, &aggregate.Count); err != nil {
+		return nil, err
+	}
+	aggregate.Value = value.Float64
+
+	return &aggregate, nil
+}
@@ -0,0 +1,11 @@
+package sensordata_test
+
+import (
+	"iot-platform/internal/database/sqlite/sqlitetest"
+	"iot-platform/internal/repository/repositorytest"
+	"testing"
+)
+
+func TestSensorDataSqliteRepository(t *testing.T) {
+	repositorytest.TestSensorDataRepository(t, sqlitetest.NewRepositories)
+}
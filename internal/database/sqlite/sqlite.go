@@ -0,0 +1,49 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"io/fs"
+	"iot-platform/internal/database/migrate"
+	"iot-platform/internal/database/query"
+
+	_ "modernc.org/sqlite"
+)
+
+// Dialect is what the shared repositories of package query need to know
+// about SQLite.
+var Dialect = query.Dialect{
+	InsertionOrder: "rowid",
+}
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// InitDb opens the SQLite database file at path, creating it if needed.
+// Foreign keys are enforced and times are stored in a format SQLite's own
+// date functions understand.
+func InitDb(path string) (*sql.DB, error) {
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_time_format=sqlite"
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite serialises writers anyway; a single connection avoids
+	// SQLITE_BUSY errors between pooled connections.
+	db.SetMaxOpenConns(1)
+
+	return db, nil
+}
+
+// Migrate brings the SQLite schema up to date.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	scripts, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return err
+	}
+
+	return migrate.Up(ctx, db, scripts)
+}
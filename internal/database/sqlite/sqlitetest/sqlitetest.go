@@ -0,0 +1,95 @@
+// Package sqlitetest runs the shared repository tests against a SQLite file
+// in the test's temporary directory.
+package sqlitetest
+
+import (
+	"context"
+	"database/sql"
+	"iot-platform/internal/database/query"
+	"iot-platform/internal/database/sqlite"
+	"iot-platform/internal/database/sqlite/asset"
+	"iot-platform/internal/database/sqlite/certificate"
+	"iot-platform/internal/database/sqlite/device"
+	"iot-platform/internal/database/sqlite/devicekind"
+	"iot-platform/internal/database/sqlite/nonce"
+	"iot-platform/internal/database/sqlite/provisioning"
+	"iot-platform/internal/database/sqlite/replication"
+	"iot-platform/internal/database/sqlite/sensordata"
+	"iot-platform/internal/database/sqlite/usage"
+	"iot-platform/internal/repository/repositorytest"
+	"path/filepath"
+	"testing"
+)
+
+// NewRepositories creates and migrates a fresh database and returns
+// repositories bound to it. The database is closed when the test ends.
+func NewRepositories(t *testing.T) repositorytest.Repositories {
+	return RepositoriesFor(t, OpenDb(t))
+}
+
+// NewRecordingRepositories is NewRepositories for an edge gateway: device
+// and reading writes append their changes to the replication outbox.
+func NewRecordingRepositories(t *testing.T) repositorytest.Repositories {
+	return RepositoriesFor(t, OpenDb(t), query.WithOutbox(query.NewOutbox(sqlite.Dialect)))
+}
+
+// OpenDb creates and migrates a fresh database file.
+func OpenDb(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sqlite.InitDb(filepath.Join(t.TempDir(), "iot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := sqlite.Migrate(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+// RepositoriesFor returns repositories bound to an already migrated db.
+func RepositoriesFor(t *testing.T, db *sql.DB, opts ...query.Option) repositorytest.Repositories {
+	t.Helper()
+
+	devices, err := device.NewDeviceSqliteRepository(db, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deviceKinds, err := devicekind.NewDeviceKindSqliteRepository(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensorData, err := sensordata.NewSensorDataSqliteRepository(db, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicationRepo, err := replication.NewReplicationSqliteRepository(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assets, err := asset.NewAssetSqliteRepository(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provisioningRepo, err := provisioning.NewProvisioningSqliteRepository(db, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificates, err := certificate.NewCertificateSqliteRepository(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonces, err := nonce.NewNonceSqliteRepository(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usages, err := usage.NewUsageSqliteRepository(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return repositorytest.Repositories{Devices: devices, DeviceKinds: deviceKinds, SensorData: sensorData, Replication: replicationRepo, Assets: assets, Provisioning: provisioningRepo, Certificates: certificates, Nonces: nonces, Usage: usages}
+}
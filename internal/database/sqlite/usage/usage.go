@@ -0,0 +1,21 @@
+package usage
+
+import (
+	"database/sql"
+	"errors"
+	"iot-platform/internal/database/query"
+)
+
+type UsageSqliteRepository struct {
+	*query.UsageRepository
+}
+
+func NewUsageSqliteRepository(db *sql.DB) (*UsageSqliteRepository, error) {
+	if err := db.Ping(); err != nil {
+		return nil, errors.New("failed to connect to the database: " + err.Error())
+	}
+
+	return &UsageSqliteRepository{
+		UsageRepository: query.NewUsageRepository(db),
+	}, nil
+}
@@ -0,0 +1,11 @@
+package usage_test
+
+import (
+	"iot-platform/internal/database/sqlite/sqlitetest"
+	"iot-platform/internal/repository/repositorytest"
+	"testing"
+)
+
+func TestUsageSqliteRepository(t *testing.T) {
+	repositorytest.TestUsageRepository(t, sqlitetest.NewRepositories)
+}
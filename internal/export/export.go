@@ -0,0 +1,398 @@
+// Package export writes sensor data to Parquet files for analytics, one
+// directory per job:
+//
+//	<dir>/<job id>/manifest.json
+//	<dir>/<job id>/date=2026-04-01/metric=temperature/part-00000.parquet
+//
+// Jobs work through their time range a UTC day at a time and record every
+// finished day in the manifest, so an interrupted job resumes at the first
+// unfinished day.
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iot-platform/internal/model"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+const manifestName = "manifest.json"
+
+var (
+	ErrInvalidExport   = errors.New("invalid export request")
+	ErrExportNotFound  = errors.New("export not found")
+	ErrExportRunning   = errors.New("export is already running")
+	ErrExportCompleted = errors.New("export is already completed")
+)
+
+// Source reads the readings of a query a page at a time, like
+// SensorDataService.ExportSensorData.
+type Source interface {
+	ExportSensorData(ctx context.Context, q model.SensorDataQuery, fn func([]*model.SensorData) error) error
+}
+
+// Request selects what a job exports. No device ids means every device;
+// From is inclusive and To exclusive.
+type Request struct {
+	DeviceIds  []string  `json:"deviceIds,omitempty"`
+	MetricName string    `json:"metric,omitempty"`
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+}
+
+// File is one Parquet file written by a job, its path relative to the
+// job's directory.
+type File struct {
+	Path         string    `json:"path"`
+	Date         string    `json:"date"`
+	Metric       string    `json:"metric"`
+	Rows         int64     `json:"rows"`
+	Bytes        int64     `json:"bytes"`
+	MinTimestamp time.Time `json:"minTimestamp"`
+	MaxTimestamp time.Time `json:"maxTimestamp"`
+}
+
+// Manifest describes a job and the files it has written so far.
+type Manifest struct {
+	Id            string    `json:"id"`
+	Status        string    `json:"status"`
+	Error         string    `json:"error,omitempty"`
+	Request       Request   `json:"request"`
+	CompletedDays []string  `json:"completedDays"`
+	Files         []File    `json:"files"`
+	Rows          int64     `json:"rows"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+type Exporter struct {
+	dir    string
+	source Source
+
+	mu      sync.Mutex
+	running map[string]bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func NewExporter(dir string, source Source) (*Exporter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Exporter{
+		dir:     dir,
+		source:  source,
+		running: make(map[string]bool),
+		ctx:     ctx,
+		cancel:  cancel,
+	}, nil
+}
+
+// Start validates request and runs it as a new job in the background.
+func (e *Exporter) Start(request Request) (*Manifest, error) {
+	if request.From.IsZero() || request.To.IsZero() || !request.From.Before(request.To) {
+		return nil, fmt.Errorf("%w: from and to are required and from must be before to", ErrInvalidExport)
+	}
+	request.From, request.To = request.From.UTC(), request.To.UTC()
+
+	now := time.Now().UTC()
+	manifest := &Manifest{
+		Id:            uuid.NewString(),
+		Status:        StatusRunning,
+		Request:       request,
+		CompletedDays: []string{},
+		Files:         []File{},
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := os.MkdirAll(e.jobDir(manifest.Id), 0o755); err != nil {
+		return nil, err
+	}
+	if err := e.save(manifest); err != nil {
+		return nil, err
+	}
+
+	e.run(manifest)
+	return manifest, nil
+}
+
+// Resume runs a failed or interrupted job again from its first unfinished
+// day.
+func (e *Exporter) Resume(id string) (*Manifest, error) {
+	manifest, err := e.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Status == StatusCompleted {
+		return nil, ErrExportCompleted
+	}
+
+	e.mu.Lock()
+	running := e.running[id]
+	e.mu.Unlock()
+	if running {
+		return nil, ErrExportRunning
+	}
+
+	manifest.Status = StatusRunning
+	manifest.Error = ""
+	if err := e.save(manifest); err != nil {
+		return nil, err
+	}
+
+	e.run(manifest)
+	return manifest, nil
+}
+
+// ResumeInterrupted resumes the jobs that were running when the process
+// last stopped.
+func (e *Exporter) ResumeInterrupted() {
+	manifests, err := e.List()
+	if err != nil {
+		log.Printf("Failed to list exports: %v", err)
+		return
+	}
+
+	for _, manifest := range manifests {
+		if manifest.Status != StatusRunning {
+			continue
+		}
+		if _, err := e.Resume(manifest.Id); err != nil {
+			log.Printf("Failed to resume export %s: %v", manifest.Id, err)
+		}
+	}
+}
+
+func (e *Exporter) Get(id string) (*Manifest, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrExportNotFound
+	}
+
+	data, err := os.ReadFile(filepath.Join(e.jobDir(id), manifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrExportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+
+	return &manifest, nil
+}
+
+// List returns every job, newest first.
+func (e *Exporter) List() ([]*Manifest, error) {
+	entries, err := os.ReadDir(e.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := []*Manifest{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		manifest, err := e.Get(entry.Name())
+		if err != nil {
+			continue
+		}
+		manifests = append(manifests, manifest)
+	}
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].CreatedAt.After(manifests[j].CreatedAt) })
+
+	return manifests, nil
+}
+
+// Dir returns the directory holding a job's files.
+func (e *Exporter) Dir(id string) (string, error) {
+	if _, err := e.Get(id); err != nil {
+		return "", err
+	}
+
+	return e.jobDir(id), nil
+}
+
+// Close stops running jobs, leaving them to be resumed, and waits for them.
+func (e *Exporter) Close() {
+	e.cancel()
+	e.wg.Wait()
+}
+
+func (e *Exporter) jobDir(id string) string {
+	return filepath.Join(e.dir, id)
+}
+
+func (e *Exporter) run(manifest *Manifest) {
+	e.mu.Lock()
+	if e.running[manifest.Id] {
+		e.mu.Unlock()
+		return
+	}
+	e.running[manifest.Id] = true
+	e.mu.Unlock()
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		defer func() {
+			e.mu.Lock()
+			delete(e.running, manifest.Id)
+			e.mu.Unlock()
+		}()
+
+		err := e.export(e.ctx, manifest)
+		switch {
+		case err == nil:
+			manifest.Status = StatusCompleted
+			log.Printf("Export %s completed with %d rows in %d files", manifest.Id, manifest.Rows, len(manifest.Files))
+		case e.ctx.Err() != nil:
+			// Shutting down; the job stays running and resumes on start.
+			return
+		default:
+			manifest.Status = StatusFailed
+			manifest.Error = err.Error()
+			log.Printf("Export %s failed: %v", manifest.Id, err)
+		}
+		if err := e.save(manifest); err != nil {
+			log.Printf("Failed to save export manifest %s: %v", manifest.Id, err)
+		}
+	}()
+}
+
+func (e *Exporter) export(ctx context.Context, manifest *Manifest) error {
+	completed := make(map[string]bool, len(manifest.CompletedDays))
+	for _, day := range manifest.CompletedDays {
+		completed[day] = true
+	}
+
+	request := manifest.Request
+	for day := request.From.Truncate(24 * time.Hour); day.Before(request.To); day = day.Add(24 * time.Hour) {
+		date := day.Format(time.DateOnly)
+		if completed[date] {
+			continue
+		}
+
+		files, err := e.exportDay(ctx, manifest, day)
+		if err != nil {
+			return fmt.Errorf("export %s: %w", date, err)
+		}
+
+		for _, file := range files {
+			manifest.Rows += file.Rows
+		}
+		manifest.Files = append(manifest.Files, files...)
+		manifest.CompletedDays = append(manifest.CompletedDays, date)
+		if err := e.save(manifest); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// exportDay writes one day of the job, a file per metric, streaming pages
+// of readings into row groups.
+func (e *Exporter) exportDay(ctx context.Context, manifest *Manifest, day time.Time) ([]File, error) {
+	date := day.Format(time.DateOnly)
+	dayDir := filepath.Join(e.jobDir(manifest.Id), "date="+date)
+	// Whatever an interrupted run left of this day is redone.
+	if err := os.RemoveAll(dayDir); err != nil {
+		return nil, err
+	}
+
+	request := manifest.Request
+	q := model.SensorDataQuery{
+		DeviceIds:  request.DeviceIds,
+		MetricName: request.MetricName,
+		From:       maxTime(day, request.From),
+		To:         minTime(day.Add(24*time.Hour), request.To),
+	}
+
+	writers := make(map[string]*partitionWriter)
+	err := e.source.ExportSensorData(ctx, q, func(sensorDataList []*model.SensorData) error {
+		for _, sensorData := range sensorDataList {
+			writer, ok := writers[sensorData.MetricName]
+			if !ok {
+				var err error
+				writer, err = newPartitionWriter(dayDir, date, sensorData.MetricName)
+				if err != nil {
+					return err
+				}
+				writers[sensorData.MetricName] = writer
+			}
+			if err := writer.write(sensorData); err != nil {
+				return err
+			}
+		}
+		return ctx.Err()
+	})
+
+	files := make([]File, 0, len(writers))
+	for _, writer := range writers {
+		file, closeErr := writer.close()
+		if err == nil {
+			err = closeErr
+		}
+		files = append(files, file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	return files, nil
+}
+
+// save writes the manifest atomically.
+func (e *Exporter) save(manifest *Manifest) error {
+	manifest.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(e.jobDir(manifest.Id), manifestName)
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+
+	return b
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+
+	return b
+}
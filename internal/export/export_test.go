@@ -0,0 +1,167 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"iot-platform/internal/model"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// fakeSource serves readings from memory, a reading per page, and fails
+// queries for the days in failDays.
+type fakeSource struct {
+	mu       sync.Mutex
+	readings []*model.SensorData
+	failDays map[string]bool
+	queried  []string
+}
+
+func (f *fakeSource) ExportSensorData(ctx context.Context, q model.SensorDataQuery, fn func([]*model.SensorData) error) error {
+	f.mu.Lock()
+	date := q.From.Format(time.DateOnly)
+	f.queried = append(f.queried, date)
+	fail := f.failDays[date]
+	f.mu.Unlock()
+	if fail {
+		return errors.New("database unavailable")
+	}
+
+	for _, sensorData := range f.readings {
+		if sensorData.Timestamp.Before(q.From) || !sensorData.Timestamp.Before(q.To) {
+			continue
+		}
+		if err := fn([]*model.SensorData{sensorData}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func waitForExport(t *testing.T, exporter *Exporter, id string) *Manifest {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		exporter.mu.Lock()
+		running := exporter.running[id]
+		exporter.mu.Unlock()
+		if !running {
+			manifest, err := exporter.Get(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return manifest
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("export %s did not finish", id)
+	return nil
+}
+
+func TestExporter(t *testing.T) {
+	day := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	source := &fakeSource{
+		readings: []*model.SensorData{
+			{Id: 1, DeviceId: "dev-1", MetricName: "temperature", MetricValue: 21.5, Unit: "°C", Timestamp: day.Add(time.Hour), Labels: map[string]string{"room": "a"}},
+			{Id: 2, DeviceId: "dev-1", MetricName: "status", ValueType: model.ValueString, RawValue: []byte(`"ok"`), Timestamp: day.Add(2 * time.Hour)},
+			{Id: 3, DeviceId: "dev-1", MetricName: "temperature", MetricValue: 22, Timestamp: day.Add(3 * time.Hour)},
+			{Id: 4, DeviceId: "dev-1", MetricName: "temperature", MetricValue: 23, Timestamp: day.Add(25 * time.Hour)},
+		},
+		failDays: map[string]bool{"2026-04-02": true},
+	}
+
+	exporter, err := NewExporter(t.TempDir(), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Close()
+
+	if _, err := exporter.Start(Request{From: day, To: day}); !errors.Is(err, ErrInvalidExport) {
+		t.Fatalf("expected ErrInvalidExport, got %v", err)
+	}
+
+	started, err := exporter.Start(Request{DeviceIds: []string{"dev-1"}, From: day, To: day.Add(48 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := waitForExport(t, exporter, started.Id)
+	if manifest.Status != StatusFailed || manifest.Error == "" {
+		t.Fatalf("expected the export to fail on the second day, got %+v", manifest)
+	}
+	if len(manifest.CompletedDays) != 1 || manifest.CompletedDays[0] != "2026-04-01" {
+		t.Fatalf("expected the first day to be completed, got %v", manifest.CompletedDays)
+	}
+	if len(manifest.Files) != 2 || manifest.Rows != 3 {
+		t.Fatalf("expected 3 rows in 2 files, got %d rows in %+v", manifest.Rows, manifest.Files)
+	}
+
+	file := manifest.Files[1]
+	if file.Path != "date=2026-04-01/metric=temperature/part-00000.parquet" || file.Rows != 2 || file.Bytes == 0 {
+		t.Fatalf("unexpected file %+v", file)
+	}
+	if !file.MinTimestamp.Equal(day.Add(time.Hour)) || !file.MaxTimestamp.Equal(day.Add(3*time.Hour)) {
+		t.Fatalf("unexpected timestamp range %v - %v", file.MinTimestamp, file.MaxTimestamp)
+	}
+
+	dir, err := exporter.Dir(manifest.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := parquet.ReadFile[Row](filepath.Join(dir, file.Path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Id != 1 || *rows[0].Value != 21.5 || *rows[0].Unit != "°C" || rows[0].Labels["room"] != "a" {
+		t.Fatalf("unexpected rows %+v", rows)
+	}
+	if rows[0].Timestamp != day.Add(time.Hour).UnixMicro() || rows[1].Unit != nil {
+		t.Fatalf("unexpected rows %+v", rows)
+	}
+
+	status, err := parquet.ReadFile[Row](filepath.Join(dir, manifest.Files[0].Path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status) != 1 || status[0].Value != nil || *status[0].ValueText != `"ok"` {
+		t.Fatalf("unexpected rows %+v", status)
+	}
+
+	source.mu.Lock()
+	source.failDays = nil
+	source.queried = nil
+	source.mu.Unlock()
+
+	if _, err := exporter.Resume(manifest.Id); err != nil {
+		t.Fatal(err)
+	}
+	manifest = waitForExport(t, exporter, manifest.Id)
+	if manifest.Status != StatusCompleted || manifest.Rows != 4 || len(manifest.Files) != 3 {
+		t.Fatalf("expected the resumed export to complete with 4 rows, got %+v", manifest)
+	}
+	if len(source.queried) != 1 || source.queried[0] != "2026-04-02" {
+		t.Fatalf("expected only the unfinished day to be exported again, got %v", source.queried)
+	}
+	if _, err := exporter.Resume(manifest.Id); !errors.Is(err, ErrExportCompleted) {
+		t.Fatalf("expected ErrExportCompleted, got %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "date=2026-04-02", "metric=temperature", "part-00000.parquet")); err != nil {
+		t.Fatal(err)
+	}
+
+	manifests, err := exporter.List()
+	if err != nil || len(manifests) != 1 {
+		t.Fatalf("expected one export, got %v, %v", manifests, err)
+	}
+	if _, err := exporter.Get("../etc"); !errors.Is(err, ErrExportNotFound) {
+		t.Fatalf("expected ErrExportNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package export
+
+import (
+	"iot-platform/internal/model"
+	"os"
+	"path/filepath"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// rowGroupSize is how many rows are buffered per file before they are
+// written out as a row group.
+const rowGroupSize = 10000
+
+// Row is the Parquet schema of exported readings. Numbers are in value and
+// every other type in value_text as JSON.
+type Row struct {
+	Id            int64             `parquet:"id"`
+	DeviceId      string            `parquet:"device_id,dict"`
+	MetricName    string            `parquet:"metric_name,dict"`
+	ValueType     string            `parquet:"value_type,dict"`
+	Value         *float64          `parquet:"value,optional"`
+	ValueText     *string           `parquet:"value_text,optional"`
+	Unit          *string           `parquet:"unit,optional,dict"`
+	OriginalUnit  *string           `parquet:"original_unit,optional,dict"`
+	OriginalValue *float64          `parquet:"original_value,optional"`
+	Timestamp     int64             `parquet:"timestamp,timestamp(microsecond:utc)"`
+	Violation     *string           `parquet:"violation,optional"`
+	Labels        map[string]string `parquet:"labels,optional"`
+}
+
+func rowOf(sensorData *model.SensorData) Row {
+	row := Row{
+		Id:            sensorData.Id,
+		DeviceId:      sensorData.DeviceId,
+		MetricName:    sensorData.MetricName,
+		ValueType:     string(sensorData.ValueType),
+		Unit:          optional(sensorData.Unit),
+		OriginalUnit:  optional(sensorData.OriginalUnit),
+		OriginalValue: sensorData.OriginalValue,
+		Timestamp:     sensorData.Timestamp.UnixMicro(),
+		Violation:     optional(sensorData.Violation),
+		Labels:        sensorData.Labels,
+	}
+	if row.ValueType == "" {
+		row.ValueType = string(model.ValueNumber)
+	}
+
+	if sensorData.ValueType.Numeric() {
+		value := sensorData.MetricValue
+		row.Value = &value
+	} else {
+		text := string(sensorData.RawValue)
+		row.ValueText = &text
+	}
+
+	return row
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return &s
+}
+
+// partitionWriter writes the readings of one date and metric. The file is
+// written under a temporary name and renamed once complete.
+type partitionWriter struct {
+	file   *os.File
+	writer *parquet.GenericWriter[Row]
+	buffer []Row
+	path   string
+	info   File
+}
+
+func newPartitionWriter(dayDir, date, metric string) (*partitionWriter, error) {
+	dir := filepath.Join(dayDir, "metric="+metric)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, "part-00000.parquet")
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+
+	return &partitionWriter{
+		file:   file,
+		writer: parquet.NewGenericWriter[Row](file, parquet.Compression(&parquet.Zstd)),
+		buffer: make([]Row, 0, rowGroupSize),
+		path:   path,
+		info: File{
+			Path:   filepath.ToSlash(filepath.Join("date="+date, "metric="+metric, "part-00000.parquet")),
+			Date:   date,
+			Metric: metric,
+		},
+	}, nil
+}
+
+func (p *partitionWriter) write(sensorData *model.SensorData) error {
+	if p.info.Rows == 0 || sensorData.Timestamp.Before(p.info.MinTimestamp) {
+		p.info.MinTimestamp = sensorData.Timestamp.UTC()
+	}
+	if sensorData.Timestamp.After(p.info.MaxTimestamp) {
+		p.info.MaxTimestamp = sensorData.Timestamp.UTC()
+	}
+	p.info.Rows++
+
+	p.buffer = append(p.buffer, rowOf(sensorData))
+	if len(p.buffer) < rowGroupSize {
+		return nil
+	}
+
+	return p.flush()
+}
+
+func (p *partitionWriter) flush() error {
+	if len(p.buffer) == 0 {
+		return nil
+	}
+	if _, err := p.writer.Write(p.buffer); err != nil {
+		return err
+	}
+	p.buffer = p.buffer[:0]
+
+	return p.writer.Flush()
+}
+
+func (p *partitionWriter) close() (File, error) {
+	err := p.flush()
+	if closeErr := p.writer.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := p.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return p.info, err
+	}
+
+	if err := os.Rename(p.path+".tmp", p.path); err != nil {
+		return p.info, err
+	}
+	stat, err := os.Stat(p.path)
+	if err != nil {
+		return p.info, err
+	}
+	p.info.Bytes = stat.Size()
+
+	return p.info, nil
+}
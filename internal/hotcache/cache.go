@@ -0,0 +1,426 @@
+// Package hotcache keeps the recent numeric readings of every device and
+// metric in memory, compressed Gorilla style, so that queries over the last
+// hour or so need not reach the database.
+//
+// The cache only answers a query when it is sure to hold every reading the
+// query may match. Each series tracks the time from which it is complete:
+// readings it cannot hold, such as strings, late readings and deleted
+// ones, move that time past themselves.
+package hotcache
+
+import (
+	"cmp"
+	"context"
+	"iot-platform/internal/model"
+	"log"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// blockPoints bounds the points of a block, the unit of eviction.
+	blockPoints = 512
+	// blockOverhead and seriesOverhead approximate the memory used besides
+	// the encoded points.
+	blockOverhead  = 160
+	seriesOverhead = 200
+	// loadPageSize is how many readings Load reads at a time.
+	loadPageSize = 10000
+)
+
+// Source provides the readings the cache is loaded from, such as the
+// sensor data repository.
+type Source interface {
+	QuerySensorData(ctx context.Context, q model.SensorDataQuery) ([]*model.SensorData, error)
+}
+
+// block holds consecutive points of a series sharing their unit and labels.
+type block struct {
+	unit         string
+	originalUnit string
+	labels       map[string]string
+
+	bits        bitWriter
+	timestamps  deltaEncoder
+	ids         deltaEncoder
+	values      xorEncoder
+	originals   xorEncoder
+	count       int
+	first, last time.Time
+	size        int
+}
+
+func newBlock(sensorData *model.SensorData) *block {
+	return &block{
+		unit:         sensorData.Unit,
+		originalUnit: sensorData.OriginalUnit,
+		labels:       maps.Clone(sensorData.Labels),
+		first:        sensorData.Timestamp,
+	}
+}
+
+// accepts reports whether a reading can be appended to the block.
+func (b *block) accepts(sensorData *model.SensorData) bool {
+	return b.count < blockPoints &&
+		b.unit == sensorData.Unit &&
+		b.originalUnit == sensorData.OriginalUnit &&
+		maps.Equal(b.labels, sensorData.Labels)
+}
+
+func (b *block) append(sensorData *model.SensorData) {
+	b.timestamps.write(&b.bits, sensorData.Timestamp.UnixNano())
+	b.ids.write(&b.bits, sensorData.Id)
+	b.values.write(&b.bits, sensorData.MetricValue)
+	if b.originalUnit != "" {
+		b.originals.write(&b.bits, *sensorData.OriginalValue)
+	}
+	b.count++
+	b.last = sensorData.Timestamp
+}
+
+func (b *block) memSize() int {
+	size := blockOverhead + cap(b.bits.buf) + len(b.unit) + len(b.originalUnit)
+	for key, value := range b.labels {
+		size += len(key) + len(value) + 32
+	}
+
+	return size
+}
+
+// points decodes the block, passing every reading to fn.
+func (b *block) points(deviceId, metricName string, fn func(*model.SensorData)) error {
+	r := bitReader{buf: b.bits.buf}
+	var timestamps, ids deltaDecoder
+	var values, originals xorDecoder
+	for i := 0; i < b.count; i++ {
+		timestamp, err := timestamps.read(&r)
+		if err != nil {
+			return err
+		}
+		id, err := ids.read(&r)
+		if err != nil {
+			return err
+		}
+		value, err := values.read(&r)
+		if err != nil {
+			return err
+		}
+
+		sensorData := &model.SensorData{
+			Id:          id,
+			DeviceId:    deviceId,
+			MetricName:  metricName,
+			ValueType:   model.ValueNumber,
+			MetricValue: value,
+			Timestamp:   time.Unix(0, timestamp).UTC(),
+			Unit:        b.unit,
+			Labels:      maps.Clone(b.labels),
+		}
+		if b.originalUnit != "" {
+			original, err := originals.read(&r)
+			if err != nil {
+				return err
+			}
+			sensorData.OriginalUnit = b.originalUnit
+			sensorData.OriginalValue = &original
+		}
+		fn(sensorData)
+	}
+
+	return nil
+}
+
+type series struct {
+	deviceId   string
+	metricName string
+	// from is the time from which the series holds every reading.
+	from   time.Time
+	blocks []*block
+}
+
+// invalidate gives up on the readings up to and including t.
+func (s *series) invalidate(t time.Time) {
+	if next := t.Add(time.Nanosecond); next.After(s.from) {
+		s.from = next
+	}
+}
+
+func (s *series) lastTimestamp() time.Time {
+	if len(s.blocks) == 0 {
+		return time.Time{}
+	}
+
+	return s.blocks[len(s.blocks)-1].last
+}
+
+type Cache struct {
+	window time.Duration
+	budget int
+	now    func() time.Time
+
+	mu sync.RWMutex
+	// from is when the cache started to hold every reading, zero until it
+	// is loaded.
+	from    time.Time
+	devices map[string]map[string]*series
+	size    int
+}
+
+// NewCache returns a cache holding window's worth of readings in at most
+// budget bytes. It holds nothing until loaded.
+func NewCache(window time.Duration, budget int) *Cache {
+	return &Cache{
+		window:  window,
+		budget:  budget,
+		now:     time.Now,
+		devices: make(map[string]map[string]*series),
+	}
+}
+
+// Load fills the cache with the readings of the last window from source.
+// Readings stored while it runs must be added afterwards.
+func (c *Cache) Load(ctx context.Context, source Source) error {
+	from := c.now().Add(-c.window)
+	c.mu.Lock()
+	c.from = from
+	c.mu.Unlock()
+
+	q := model.SensorDataQuery{From: from, Limit: loadPageSize}
+	loaded := 0
+	for {
+		sensorDataList, err := source.QuerySensorData(ctx, q)
+		if err != nil {
+			c.mu.Lock()
+			c.from = time.Time{}
+			c.mu.Unlock()
+			return err
+		}
+		for _, sensorData := range sensorDataList {
+			c.Add(sensorData)
+		}
+		loaded += len(sensorDataList)
+
+		if len(sensorDataList) < loadPageSize {
+			break
+		}
+		last := sensorDataList[len(sensorDataList)-1]
+		q.After = &model.SensorDataCursor{Timestamp: last.Timestamp, Id: last.Id}
+	}
+	log.Printf("Hot cache loaded %d readings using %d bytes", loaded, c.Size())
+
+	return nil
+}
+
+// cacheable reports whether the cache can hold a reading.
+func cacheable(sensorData *model.SensorData) bool {
+	return sensorData.ValueType.Numeric() &&
+		sensorData.Violation == "" &&
+		sensorData.Id != 0 &&
+		(sensorData.OriginalUnit == "") == (sensorData.OriginalValue == nil)
+}
+
+// Add records a stored reading.
+func (c *Cache) Add(sensorData *model.SensorData) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.from.IsZero() {
+		return
+	}
+
+	s := c.series(sensorData.DeviceId, sensorData.MetricName)
+	timestamp := sensorData.Timestamp
+	if !cacheable(sensorData) || timestamp.Before(s.lastTimestamp()) || timestamp.Before(c.now().Add(-c.window)) {
+		s.invalidate(timestamp)
+		return
+	}
+
+	var b *block
+	if len(s.blocks) > 0 && s.blocks[len(s.blocks)-1].accepts(sensorData) {
+		b = s.blocks[len(s.blocks)-1]
+		c.size -= b.size
+	} else {
+		b = newBlock(sensorData)
+		s.blocks = append(s.blocks, b)
+	}
+	b.append(sensorData)
+	b.size = b.memSize()
+	c.size += b.size
+
+	if c.size > c.budget {
+		c.shrink(c.budget * 9 / 10)
+	}
+}
+
+// Remove forgets a deleted reading.
+func (c *Cache) Remove(sensorData *model.SensorData) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if metrics, ok := c.devices[sensorData.DeviceId]; ok {
+		if s, ok := metrics[sensorData.MetricName]; ok {
+			s.invalidate(sensorData.Timestamp)
+		}
+	}
+}
+
+func (c *Cache) series(deviceId, metricName string) *series {
+	metrics, ok := c.devices[deviceId]
+	if !ok {
+		metrics = make(map[string]*series)
+		c.devices[deviceId] = metrics
+	}
+
+	s, ok := metrics[metricName]
+	if !ok {
+		s = &series{deviceId: deviceId, metricName: metricName, from: c.from}
+		metrics[metricName] = s
+		c.size += seriesOverhead
+	}
+
+	return s
+}
+
+// QuerySensorData returns the readings matched by q in time order, the way
+// a SensorDataRepository does. It reports false when q reaches back further
+// than the cache holds every reading for.
+func (c *Cache) QuerySensorData(q model.SensorDataQuery) ([]*model.SensorData, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.from.IsZero() || q.From.IsZero() || q.From.Before(c.from) || q.From.Before(c.now().Add(-c.window)) {
+		return nil, false
+	}
+
+	var matched []*series
+	for deviceId, metrics := range c.devices {
+		if len(q.DeviceIds) > 0 && !slices.Contains(q.DeviceIds, deviceId) {
+			continue
+		}
+		for metricName, s := range metrics {
+			if q.MetricName != "" && q.MetricName != metricName {
+				continue
+			}
+			if q.From.Before(s.from) {
+				return nil, false
+			}
+			matched = append(matched, s)
+		}
+	}
+
+	var sensorDataList []*model.SensorData
+	for _, s := range matched {
+		for _, b := range s.blocks {
+			if b.last.Before(q.From) || !q.To.IsZero() && !b.first.Before(q.To) {
+				continue
+			}
+			err := b.points(s.deviceId, s.metricName, func(sensorData *model.SensorData) {
+				if q.Matches(sensorData, false) {
+					sensorDataList = append(sensorDataList, sensorData)
+				}
+			})
+			if err != nil {
+				log.Printf("hot cache block of %s/%s is corrupt: %v", s.deviceId, s.metricName, err)
+				return nil, false
+			}
+		}
+	}
+
+	slices.SortFunc(sensorDataList, func(a, b *model.SensorData) int {
+		if order := a.Timestamp.Compare(b.Timestamp); order != 0 {
+			return order
+		}
+		return cmp.Compare(a.Id, b.Id)
+	})
+	if q.Limit > 0 {
+		start := min(q.Offset, len(sensorDataList))
+		sensorDataList = sensorDataList[start:min(start+q.Limit, len(sensorDataList))]
+	}
+
+	return sensorDataList, true
+}
+
+// Size returns the approximate memory the cache uses, in bytes.
+func (c *Cache) Size() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.size
+}
+
+// Run drops readings that have left the window every minute until ctx is
+// cancelled.
+func (c *Cache) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		c.Expire()
+	}
+}
+
+// Expire drops the blocks that have entirely left the window, and the
+// series left empty.
+func (c *Cache) Expire() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cutoff := c.now().Add(-c.window)
+	for deviceId, metrics := range c.devices {
+		for metricName, s := range metrics {
+			for len(s.blocks) > 0 && s.blocks[0].last.Before(cutoff) {
+				c.evict(s)
+			}
+			if len(s.blocks) == 0 && !s.from.After(cutoff) {
+				delete(metrics, metricName)
+				c.size -= seriesOverhead
+			}
+		}
+		if len(metrics) == 0 {
+			delete(c.devices, deviceId)
+		}
+	}
+}
+
+// shrink evicts the oldest blocks until the cache fits in target bytes.
+func (c *Cache) shrink(target int) {
+	type candidate struct {
+		series *series
+		last   time.Time
+	}
+	var candidates []candidate
+	for _, metrics := range c.devices {
+		for _, s := range metrics {
+			for _, b := range s.blocks {
+				candidates = append(candidates, candidate{s, b.last})
+			}
+		}
+	}
+	// The blocks of a series are in time order, so each is the oldest of
+	// its series by the time it is evicted.
+	slices.SortFunc(candidates, func(a, b candidate) int { return a.last.Compare(b.last) })
+
+	for _, candidate := range candidates {
+		if c.size <= target {
+			return
+		}
+		c.evict(candidate.series)
+	}
+}
+
+// evict drops the oldest block of a series, which then no longer holds
+// every reading up to the block's last.
+func (c *Cache) evict(s *series) {
+	b := s.blocks[0]
+	s.blocks = s.blocks[1:]
+	s.invalidate(b.last)
+	c.size -= b.size
+}
@@ -0,0 +1,205 @@
+package hotcache
+
+import (
+	"context"
+	"iot-platform/internal/database/sqlite/sqlitetest"
+	"iot-platform/internal/model"
+	"iot-platform/internal/service"
+	"testing"
+	"time"
+)
+
+type fakeSource struct {
+	readings []*model.SensorData
+}
+
+func (f *fakeSource) QuerySensorData(ctx context.Context, q model.SensorDataQuery) ([]*model.SensorData, error) {
+	var matched []*model.SensorData
+	for _, sensorData := range f.readings {
+		if q.Matches(sensorData, false) {
+			matched = append(matched, sensorData)
+		}
+	}
+
+	return matched[:min(len(matched), q.Limit)], nil
+}
+
+func newTestCache(t *testing.T, now time.Time, readings ...*model.SensorData) *Cache {
+	t.Helper()
+
+	cache := NewCache(time.Hour, 1<<20)
+	cache.now = func() time.Time { return now }
+	if err := cache.Load(context.Background(), &fakeSource{readings: readings}); err != nil {
+		t.Fatal(err)
+	}
+
+	return cache
+}
+
+func reading(id int64, deviceId, metricName string, value float64, timestamp time.Time) *model.SensorData {
+	return &model.SensorData{Id: id, DeviceId: deviceId, MetricName: metricName, ValueType: model.ValueNumber, MetricValue: value, Timestamp: timestamp}
+}
+
+func TestCache(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	cache := newTestCache(t, now,
+		reading(1, "dev-1", "temperature", 20, now.Add(-2*time.Hour)),
+		reading(2, "dev-1", "temperature", 21, now.Add(-30*time.Minute)),
+		reading(3, "dev-2", "temperature", 15, now.Add(-20*time.Minute)),
+	)
+
+	fahrenheit := 71.6
+	cache.Add(&model.SensorData{Id: 4, DeviceId: "dev-1", MetricName: "temperature", ValueType: model.ValueNumber, MetricValue: 22, Unit: "°C", OriginalUnit: "°F", OriginalValue: &fahrenheit, Timestamp: now.Add(-10 * time.Minute), Labels: map[string]string{"room": "a"}})
+	cache.Add(reading(5, "dev-1", "temperature", 23, now.Add(-5*time.Minute)))
+
+	list, ok := cache.QuerySensorData(model.SensorDataQuery{DeviceIds: []string{"dev-1"}, MetricName: "temperature", From: now.Add(-time.Hour)})
+	if !ok || len(list) != 3 {
+		t.Fatalf("expected 3 cached readings, got %v, %v", list, ok)
+	}
+	if list[0].Id != 2 || list[1].Id != 4 || list[2].Id != 5 || list[2].MetricValue != 23 {
+		t.Fatalf("unexpected readings %+v %+v %+v", list[0], list[1], list[2])
+	}
+	if list[1].Unit != "°C" || list[1].OriginalUnit != "°F" || *list[1].OriginalValue != 71.6 || list[1].Labels["room"] != "a" || list[0].Labels != nil {
+		t.Fatalf("expected units and labels to be kept, got %+v", list[1])
+	}
+
+	all, ok := cache.QuerySensorData(model.SensorDataQuery{From: now.Add(-time.Hour), Min: ptr(21.5), Limit: 1, Offset: 1})
+	if !ok || len(all) != 1 || all[0].Id != 5 {
+		t.Fatalf("expected the second reading above 21.5, got %v, %v", all, ok)
+	}
+
+	if _, ok := cache.QuerySensorData(model.SensorDataQuery{From: now.Add(-2 * time.Hour)}); ok {
+		t.Error("expected a query reaching past the window to miss")
+	}
+	if _, ok := cache.QuerySensorData(model.SensorDataQuery{}); ok {
+		t.Error("expected an unbounded query to miss")
+	}
+
+	// A string reading cannot be cached, so its series is only complete
+	// after it.
+	cache.Add(&model.SensorData{Id: 6, DeviceId: "dev-2", MetricName: "temperature", ValueType: model.ValueString, RawValue: []byte(`"n/a"`), Timestamp: now.Add(-15 * time.Minute)})
+	if _, ok := cache.QuerySensorData(model.SensorDataQuery{From: now.Add(-time.Hour)}); ok {
+		t.Error("expected a miss for a series holding a string reading")
+	}
+	if list, ok := cache.QuerySensorData(model.SensorDataQuery{DeviceIds: []string{"dev-1"}, From: now.Add(-time.Hour)}); !ok || len(list) != 3 {
+		t.Errorf("expected other series to still hit, got %v, %v", list, ok)
+	}
+	if list, ok := cache.QuerySensorData(model.SensorDataQuery{From: now.Add(-14 * time.Minute)}); !ok || len(list) != 2 {
+		t.Errorf("expected a hit after the string reading, got %v, %v", list, ok)
+	}
+
+	// So does a late reading.
+	cache.Add(reading(7, "dev-1", "temperature", 19, now.Add(-8*time.Minute)))
+	if _, ok := cache.QuerySensorData(model.SensorDataQuery{DeviceIds: []string{"dev-1"}, From: now.Add(-9 * time.Minute)}); ok {
+		t.Error("expected a miss before a late reading")
+	}
+
+	// And a deleted one.
+	cache.Remove(reading(5, "dev-1", "temperature", 23, now.Add(-5*time.Minute)))
+	if _, ok := cache.QuerySensorData(model.SensorDataQuery{DeviceIds: []string{"dev-1"}, From: now.Add(-6 * time.Minute)}); ok {
+		t.Error("expected a miss before a deleted reading")
+	}
+	if list, ok := cache.QuerySensorData(model.SensorDataQuery{DeviceIds: []string{"dev-1"}, From: now.Add(-4 * time.Minute)}); !ok || len(list) != 0 {
+		t.Errorf("expected an empty hit after the deleted reading, got %v, %v", list, ok)
+	}
+
+	// New series are complete from the load.
+	cache.Add(reading(8, "dev-3", "humidity", 40, now))
+	if list, ok := cache.QuerySensorData(model.SensorDataQuery{DeviceIds: []string{"dev-3"}, From: now.Add(-time.Hour)}); !ok || len(list) != 1 {
+		t.Errorf("expected the new series to hit, got %v, %v", list, ok)
+	}
+}
+
+func TestCacheBeforeLoad(t *testing.T) {
+	now := time.Now()
+	cache := NewCache(time.Hour, 1<<20)
+	cache.Add(reading(1, "dev-1", "temperature", 20, now))
+
+	if _, ok := cache.QuerySensorData(model.SensorDataQuery{From: now.Add(-time.Minute)}); ok {
+		t.Error("expected an unloaded cache to miss")
+	}
+}
+
+func TestCacheBudgetAndExpiry(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	cache := newTestCache(t, now)
+	cache.budget = 8 << 10
+
+	start := now.Add(-50 * time.Minute)
+	for i := 0; i < 3000; i++ {
+		deviceId := []string{"dev-1", "dev-2"}[i%2]
+		cache.Add(reading(int64(i+1), deviceId, "temperature", float64(i%100)*1.7, start.Add(time.Duration(i)*time.Second)))
+	}
+	if cache.Size() > cache.budget {
+		t.Fatalf("expected the cache to stay within %d bytes, got %d", cache.budget, cache.Size())
+	}
+
+	// The oldest blocks were evicted, so only recent queries still hit.
+	if _, ok := cache.QuerySensorData(model.SensorDataQuery{From: start}); ok {
+		t.Error("expected a miss for evicted readings")
+	}
+	recent, ok := cache.QuerySensorData(model.SensorDataQuery{From: start.Add(2990 * time.Second)})
+	if !ok || len(recent) != 10 {
+		t.Fatalf("expected the 10 most recent readings, got %d, %v", len(recent), ok)
+	}
+
+	cache.now = func() time.Time { return now.Add(2 * time.Hour) }
+	cache.Expire()
+	if len(cache.devices) != 0 || cache.Size() != 0 {
+		t.Errorf("expected expired readings to be dropped, got %d devices in %d bytes", len(cache.devices), cache.Size())
+	}
+}
+
+func TestCacheWithService(t *testing.T) {
+	ctx := context.Background()
+	repos := sqlitetest.NewRepositories(t)
+	deviceId, err := repos.Devices.SaveDevice(ctx, &model.Device{Name: "Boiler", Kind: "thermometer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewCache(time.Hour, 1<<20)
+	if err := cache.Load(ctx, repos.SensorData); err != nil {
+		t.Fatal(err)
+	}
+	sensorDataService := service.NewSensorDataService(repos.SensorData, service.WithCache(cache))
+
+	now := time.Now().UTC()
+	for i := 0; i < 3; i++ {
+		if err := sensorDataService.CreateSensorData(ctx, &model.SensorData{DeviceId: deviceId, MetricName: "temperature", MetricValue: float64(20 + i), Timestamp: now.Add(time.Duration(i-3) * time.Minute)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	q := model.SensorDataQuery{DeviceIds: []string{deviceId}, From: now.Add(-10 * time.Minute)}
+	cached, ok := cache.QuerySensorData(q)
+	if !ok || len(cached) != 3 {
+		t.Fatalf("expected 3 cached readings, got %v, %v", cached, ok)
+	}
+	stored, err := repos.SensorData.QuerySensorData(ctx, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range stored {
+		if cached[i].Id != stored[i].Id || cached[i].MetricValue != stored[i].MetricValue || !cached[i].Timestamp.Equal(stored[i].Timestamp) {
+			t.Errorf("expected cached %+v to equal stored %+v", cached[i], stored[i])
+		}
+	}
+
+	avg, err := sensorDataService.AggregateSensorData(ctx, q, model.AggregateAvg)
+	if err != nil || avg.Count != 3 || avg.Value != 21 {
+		t.Fatalf("expected an average of 21 over 3 readings, got %+v, %v", avg, err)
+	}
+
+	if err := sensorDataService.DeleteSensorData(ctx, stored[2].Id); err != nil {
+		t.Fatal(err)
+	}
+	list, err := sensorDataService.QuerySensorData(ctx, q)
+	if err != nil || len(list) != 2 {
+		t.Fatalf("expected the deleted reading to be gone, got %v, %v", list, err)
+	}
+}
+
+func ptr(f float64) *float64 {
+	return &f
+}
@@ -0,0 +1,288 @@
+package hotcache
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// The encoding follows Facebook's Gorilla paper: the first point of a block
+// is stored in full, later timestamps as the delta of their deltas and later
+// values as the XOR with the previous value. Ids are encoded like
+// timestamps; they grow with every insert and usually by a steady step per
+// series.
+
+var errShortBlock = errors.New("hotcache: truncated block")
+
+type bitWriter struct {
+	buf  []byte
+	free uint8 // unused bits in the last byte
+}
+
+func (w *bitWriter) writeBit(bit bool) {
+	if w.free == 0 {
+		w.buf = append(w.buf, 0)
+		w.free = 8
+	}
+	w.free--
+	if bit {
+		w.buf[len(w.buf)-1] |= 1 << w.free
+	}
+}
+
+// writeBits writes the low n bits of v, most significant first.
+func (w *bitWriter) writeBits(v uint64, n int) {
+	for n > 0 {
+		if w.free == 0 {
+			w.buf = append(w.buf, 0)
+			w.free = 8
+		}
+		take := min(n, int(w.free))
+		chunk := byte(v>>(n-take)) & byte(1<<take-1)
+		w.free -= uint8(take)
+		w.buf[len(w.buf)-1] |= chunk << w.free
+		n -= take
+	}
+}
+
+type bitReader struct {
+	buf []byte
+	pos int // in bits
+}
+
+func (r *bitReader) readBit() (bool, error) {
+	if r.pos >= len(r.buf)*8 {
+		return false, errShortBlock
+	}
+	bit := r.buf[r.pos/8]&(1<<(7-r.pos%8)) != 0
+	r.pos++
+
+	return bit, nil
+}
+
+func (r *bitReader) readBits(n int) (uint64, error) {
+	if r.pos+n > len(r.buf)*8 {
+		return 0, errShortBlock
+	}
+
+	var v uint64
+	for n > 0 {
+		offset := r.pos % 8
+		take := min(n, 8-offset)
+		chunk := r.buf[r.pos/8] >> (8 - offset - take) & byte(1<<take-1)
+		v = v<<take | uint64(chunk)
+		r.pos += take
+		n -= take
+	}
+
+	return v, nil
+}
+
+// deltaEncoder encodes a sequence of integers as the delta of their deltas,
+// in buckets of 0, 7, 9, 12, 32 or 64 bits.
+type deltaEncoder struct {
+	prev  int64
+	delta int64
+	count int
+}
+
+var deltaBuckets = []struct {
+	prefix uint64
+	length int // of the prefix
+	bits   int
+}{
+	{0b10, 2, 7},
+	{0b110, 3, 9},
+	{0b1110, 4, 12},
+	{0b11110, 5, 32},
+}
+
+func (e *deltaEncoder) write(w *bitWriter, v int64) {
+	defer func() { e.count++ }()
+
+	switch e.count {
+	case 0:
+		w.writeBits(uint64(v), 64)
+		e.prev = v
+		return
+	case 1:
+		e.delta = v - e.prev
+		e.prev = v
+		writeDelta(w, e.delta)
+		return
+	}
+
+	delta := v - e.prev
+	writeDelta(w, delta-e.delta)
+	e.prev, e.delta = v, delta
+}
+
+func writeDelta(w *bitWriter, dod int64) {
+	if dod == 0 {
+		w.writeBit(false)
+		return
+	}
+	for _, bucket := range deltaBuckets {
+		if -1<<(bucket.bits-1) <= dod && dod < 1<<(bucket.bits-1) {
+			w.writeBits(bucket.prefix, bucket.length)
+			w.writeBits(uint64(dod), bucket.bits)
+			return
+		}
+	}
+	w.writeBits(0b11111, 5)
+	w.writeBits(uint64(dod), 64)
+}
+
+type deltaDecoder struct {
+	prev  int64
+	delta int64
+	count int
+}
+
+func (d *deltaDecoder) read(r *bitReader) (int64, error) {
+	defer func() { d.count++ }()
+
+	if d.count == 0 {
+		v, err := r.readBits(64)
+		d.prev = int64(v)
+		return d.prev, err
+	}
+
+	dod, err := readDelta(r)
+	if err != nil {
+		return 0, err
+	}
+	if d.count == 1 {
+		d.delta = dod
+	} else {
+		d.delta += dod
+	}
+	d.prev += d.delta
+
+	return d.prev, nil
+}
+
+func readDelta(r *bitReader) (int64, error) {
+	n := 0
+	for n < 5 {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if !bit {
+			break
+		}
+		n++
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	size := 64
+	if n <= len(deltaBuckets) {
+		size = deltaBuckets[n-1].bits
+	}
+	v, err := r.readBits(size)
+	if err != nil {
+		return 0, err
+	}
+
+	// Sign extend.
+	return int64(v<<(64-size)) >> (64 - size), nil
+}
+
+// xorEncoder encodes a sequence of floats as the XOR with their
+// predecessor, storing only the meaningful bits.
+type xorEncoder struct {
+	prev     uint64
+	leading  int
+	trailing int
+	count    int
+}
+
+func (e *xorEncoder) write(w *bitWriter, f float64) {
+	v := math.Float64bits(f)
+	defer func() {
+		e.prev = v
+		e.count++
+	}()
+
+	if e.count == 0 {
+		w.writeBits(v, 64)
+		e.leading = -1
+		return
+	}
+
+	x := v ^ e.prev
+	if x == 0 {
+		w.writeBit(false)
+		return
+	}
+	w.writeBit(true)
+
+	leading := min(bits.LeadingZeros64(x), 31)
+	trailing := bits.TrailingZeros64(x)
+	if e.leading >= 0 && leading >= e.leading && trailing >= e.trailing {
+		w.writeBit(false)
+		w.writeBits(x>>e.trailing, 64-e.leading-e.trailing)
+		return
+	}
+
+	e.leading, e.trailing = leading, trailing
+	significant := 64 - leading - trailing
+	w.writeBit(true)
+	w.writeBits(uint64(leading), 5)
+	// 64 significant bits do not fit in 6 bits and are written as 0.
+	w.writeBits(uint64(significant)&63, 6)
+	w.writeBits(x>>trailing, significant)
+}
+
+type xorDecoder struct {
+	prev     uint64
+	leading  int
+	trailing int
+	count    int
+}
+
+func (d *xorDecoder) read(r *bitReader) (float64, error) {
+	defer func() { d.count++ }()
+
+	if d.count == 0 {
+		v, err := r.readBits(64)
+		d.prev = v
+		return math.Float64frombits(v), err
+	}
+
+	changed, err := r.readBit()
+	if err != nil || !changed {
+		return math.Float64frombits(d.prev), err
+	}
+
+	window, err := r.readBit()
+	if err != nil {
+		return 0, err
+	}
+	if window {
+		leading, err := r.readBits(5)
+		if err != nil {
+			return 0, err
+		}
+		significant, err := r.readBits(6)
+		if err != nil {
+			return 0, err
+		}
+		if significant == 0 {
+			significant = 64
+		}
+		d.leading = int(leading)
+		d.trailing = 64 - int(leading) - int(significant)
+	}
+
+	x, err := r.readBits(64 - d.leading - d.trailing)
+	if err != nil {
+		return 0, err
+	}
+	d.prev ^= x << d.trailing
+
+	return math.Float64frombits(d.prev), nil
+}
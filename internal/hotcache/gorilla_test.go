@@ -0,0 +1,85 @@
+package hotcache
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestGorillaRoundTrip(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	timestamps := []int64{1_700_000_000_000_000_000}
+	ids := []int64{1}
+	values := []float64{21.5}
+	for i := 1; i < 2000; i++ {
+		step := int64(1_000_000_000)
+		switch i % 7 {
+		case 3:
+			step += random.Int63n(1000) - 500
+		case 5:
+			step *= random.Int63n(1 << 20)
+		}
+		timestamps = append(timestamps, timestamps[i-1]+step)
+		ids = append(ids, ids[i-1]+1+random.Int63n(3))
+
+		value := values[i-1]
+		switch i % 5 {
+		case 1:
+			value += random.NormFloat64()
+		case 2:
+			value = math.Round(value)
+		case 3:
+			value = random.Float64() * 1e12
+		case 4:
+			value = [...]float64{0, -0.0, math.Inf(1), math.NaN(), math.MaxFloat64, math.SmallestNonzeroFloat64}[i%6]
+		}
+		values = append(values, value)
+	}
+
+	var w bitWriter
+	var timestampEncoder, idEncoder deltaEncoder
+	var valueEncoder xorEncoder
+	for i := range timestamps {
+		timestampEncoder.write(&w, timestamps[i])
+		idEncoder.write(&w, ids[i])
+		valueEncoder.write(&w, values[i])
+	}
+
+	r := bitReader{buf: w.buf}
+	var timestampDecoder, idDecoder deltaDecoder
+	var valueDecoder xorDecoder
+	for i := range timestamps {
+		timestamp, err := timestampDecoder.read(&r)
+		if err != nil || timestamp != timestamps[i] {
+			t.Fatalf("point %d: expected timestamp %d, got %d, %v", i, timestamps[i], timestamp, err)
+		}
+		id, err := idDecoder.read(&r)
+		if err != nil || id != ids[i] {
+			t.Fatalf("point %d: expected id %d, got %d, %v", i, ids[i], id, err)
+		}
+		value, err := valueDecoder.read(&r)
+		if err != nil || math.Float64bits(value) != math.Float64bits(values[i]) {
+			t.Fatalf("point %d: expected value %v, got %v, %v", i, values[i], value, err)
+		}
+	}
+	if _, err := timestampDecoder.read(&r); err != errShortBlock {
+		t.Errorf("expected errShortBlock past the end, got %v", err)
+	}
+}
+
+func TestGorillaCompressesRegularSeries(t *testing.T) {
+	var w bitWriter
+	var timestamps, ids deltaEncoder
+	var values xorEncoder
+	for i := 0; i < 1000; i++ {
+		timestamps.write(&w, int64(i)*10_000_000_000)
+		ids.write(&w, int64(i))
+		values.write(&w, 20+float64(i%4)*0.5)
+	}
+
+	// Uncompressed, each point takes 24 bytes.
+	if len(w.buf) > 4000 {
+		t.Errorf("expected regular points to compress below 4 bytes each, got %d bytes", len(w.buf))
+	}
+}
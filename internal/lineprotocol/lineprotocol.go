@@ -0,0 +1,260 @@
+// Package lineprotocol parses InfluxDB line protocol:
+//
+//	measurement[,tag=value...] field=value[,field=value...] [timestamp]
+package lineprotocol
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Point is one parsed line. Field values are float64, int64, uint64, string
+// or bool.
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]any
+	// Time is zero when the line had no timestamp.
+	Time time.Time
+}
+
+// ParseError describes a line that could not be parsed, worded like
+// InfluxDB's own errors.
+type ParseError struct {
+	Line   int
+	Text   string
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("unable to parse '%s': %s", e.Text, e.Reason)
+}
+
+// ParsePrecision maps the precision parameter of a write to the unit of its
+// timestamps. An empty precision means nanoseconds.
+func ParsePrecision(precision string) (time.Duration, error) {
+	switch precision {
+	case "", "n", "ns":
+		return time.Nanosecond, nil
+	case "u", "us", "µ":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	case "m":
+		return time.Minute, nil
+	case "h":
+		return time.Hour, nil
+	default:
+		return 0, fmt.Errorf("invalid precision %q", precision)
+	}
+}
+
+// Parse parses every line of data. Lines that fail to parse are reported
+// and skipped, the others returned.
+func Parse(data string, precision time.Duration) ([]Point, []*ParseError) {
+	var points []Point
+	var parseErrors []*ParseError
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		point, err := ParseLine(line, precision)
+		if err != nil {
+			parseErrors = append(parseErrors, &ParseError{Line: i + 1, Text: line, Reason: err.Error()})
+			continue
+		}
+		points = append(points, point)
+	}
+
+	return points, parseErrors
+}
+
+func ParseLine(line string, precision time.Duration) (Point, error) {
+	point := Point{Tags: map[string]string{}, Fields: map[string]any{}}
+
+	key, i := scan(line, 0, " ", false)
+	if key == "" {
+		return point, errors.New("missing measurement")
+	}
+	parts := split(key, ',')
+	point.Measurement = unescape(parts[0])
+	if point.Measurement == "" {
+		return point, errors.New("missing measurement")
+	}
+	for _, tag := range parts[1:] {
+		pair := split(tag, '=')
+		if len(pair) != 2 || pair[0] == "" || pair[1] == "" {
+			return point, errors.New("missing tag value")
+		}
+		point.Tags[unescape(pair[0])] = unescape(pair[1])
+	}
+
+	i = skipSpaces(line, i)
+	fields, i := scan(line, i, " ", true)
+	if fields == "" {
+		return point, errors.New("missing fields")
+	}
+	for _, field := range splitFields(fields) {
+		name, value, ok := cutUnescaped(field, '=')
+		if !ok || name == "" {
+			return point, errors.New("missing field value")
+		}
+		parsed, err := parseValue(value)
+		if err != nil {
+			return point, fmt.Errorf("invalid field %q: %v", unescape(name), err)
+		}
+		point.Fields[unescape(name)] = parsed
+	}
+
+	i = skipSpaces(line, i)
+	if i < len(line) {
+		timestamp, err := strconv.ParseInt(line[i:], 10, 64)
+		if err != nil {
+			return point, errors.New("bad timestamp")
+		}
+		point.Time = timeOf(timestamp, precision)
+	}
+
+	return point, nil
+}
+
+func timeOf(timestamp int64, precision time.Duration) time.Time {
+	if precision == time.Nanosecond {
+		return time.Unix(0, timestamp).UTC()
+	}
+
+	unit := int64(precision)
+	perSecond := int64(time.Second) / unit
+	if perSecond > 0 {
+		return time.Unix(timestamp/perSecond, timestamp%perSecond*unit).UTC()
+	}
+
+	return time.Unix(timestamp*(unit/int64(time.Second)), 0).UTC()
+}
+
+// scan returns line from i up to the first unescaped stop character, and
+// the index of that character. Inside quotes, when allowed, stops do not
+// count.
+func scan(line string, i int, stops string, quotes bool) (string, int) {
+	start := i
+	quoted := false
+	for i < len(line) {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line):
+			i += 2
+			continue
+		case quotes && c == '"':
+			quoted = !quoted
+		case !quoted && strings.IndexByte(stops, c) >= 0:
+			return line[start:i], i
+		}
+		i++
+	}
+
+	return line[start:], i
+}
+
+func skipSpaces(line string, i int) int {
+	for i < len(line) && line[i] == ' ' {
+		i++
+	}
+
+	return i
+}
+
+// split splits s on unescaped occurrences of sep.
+func split(s string, sep byte) []string {
+	var parts []string
+	for {
+		part, i := scan(s, 0, string(sep), false)
+		parts = append(parts, part)
+		if i >= len(s) {
+			return parts
+		}
+		s = s[i+1:]
+	}
+}
+
+// splitFields splits the field set on commas outside string values.
+func splitFields(s string) []string {
+	var fields []string
+	for {
+		field, i := scan(s, 0, ",", true)
+		fields = append(fields, field)
+		if i >= len(s) {
+			return fields
+		}
+		s = s[i+1:]
+	}
+}
+
+func cutUnescaped(s string, sep byte) (string, string, bool) {
+	before, i := scan(s, 0, string(sep), false)
+	if i >= len(s) {
+		return s, "", false
+	}
+
+	return before, s[i+1:], true
+}
+
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`, ="\`, s[i+1]) >= 0 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
+
+func parseValue(value string) (any, error) {
+	if value == "" {
+		return nil, errors.New("empty value")
+	}
+
+	if value[0] == '"' {
+		if len(value) < 2 || value[len(value)-1] != '"' {
+			return nil, errors.New("unterminated string")
+		}
+		return unescape(value[1 : len(value)-1]), nil
+	}
+
+	switch value {
+	case "t", "T", "true", "True", "TRUE":
+		return true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return false, nil
+	}
+
+	switch value[len(value)-1] {
+	case 'i':
+		return strconv.ParseInt(value[:len(value)-1], 10, 64)
+	case 'u':
+		return strconv.ParseUint(value[:len(value)-1], 10, 64)
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, errors.New("invalid number")
+	}
+	if math.IsNaN(number) || math.IsInf(number, 0) {
+		return nil, errors.New("invalid number")
+	}
+
+	return number, nil
+}
@@ -0,0 +1,79 @@
+package lineprotocol_test
+
+import (
+	"iot-platform/internal/lineprotocol"
+	"testing"
+	"time"
+)
+
+func TestParseLine(t *testing.T) {
+	point, err := lineprotocol.ParseLine(`weather\ station,site=north\,east,deviceId=dev-1 temp=21.5,count=3i,total=7u,ok=t,note="said \"hi\", left" 1700000000000000000`, time.Nanosecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if point.Measurement != "weather station" {
+		t.Errorf("unexpected measurement %q", point.Measurement)
+	}
+	if point.Tags["site"] != "north,east" || point.Tags["deviceId"] != "dev-1" {
+		t.Errorf("unexpected tags %v", point.Tags)
+	}
+	want := map[string]any{"temp": 21.5, "count": int64(3), "total": uint64(7), "ok": true, "note": `said "hi", left`}
+	for key, value := range want {
+		if point.Fields[key] != value {
+			t.Errorf("field %s: expected %v, got %v", key, value, point.Fields[key])
+		}
+	}
+	if !point.Time.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("unexpected time %s", point.Time)
+	}
+}
+
+func TestParsePrecision(t *testing.T) {
+	for precision, want := range map[string]time.Time{
+		"s":  time.Unix(1700000000, 0),
+		"ms": time.Unix(1700000, 0),
+		"us": time.Unix(1700, 0),
+		"h":  time.Unix(1700000000*3600, 0),
+	} {
+		unit, err := lineprotocol.ParsePrecision(precision)
+		if err != nil {
+			t.Fatal(err)
+		}
+		point, err := lineprotocol.ParseLine("m v=1 1700000000", unit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !point.Time.Equal(want) {
+			t.Errorf("precision %s: expected %s, got %s", precision, want, point.Time)
+		}
+	}
+
+	if _, err := lineprotocol.ParsePrecision("d"); err == nil {
+		t.Error("expected an unknown precision to fail")
+	}
+}
+
+func TestParse_SkipsInvalidLines(t *testing.T) {
+	data := "# comment\n" +
+		"cpu usage=1\n" +
+		"\n" +
+		"cpu\n" +
+		"cpu usage=\n" +
+		"cpu,host usage=1\n" +
+		"cpu usage=abc\n" +
+		"cpu usage=1 tomorrow\n" +
+		`cpu msg="unterminated` + "\n" +
+		"mem free=2i 1700000000000000000\n"
+
+	points, parseErrors := lineprotocol.Parse(data, time.Nanosecond)
+	if len(points) != 2 {
+		t.Errorf("expected 2 points, got %d", len(points))
+	}
+	if len(parseErrors) != 6 {
+		t.Fatalf("expected 6 errors, got %d: %v", len(parseErrors), parseErrors)
+	}
+	if parseErrors[0].Line != 4 || parseErrors[0].Error() != "unable to parse 'cpu': missing fields" {
+		t.Errorf("unexpected first error %+v", parseErrors[0])
+	}
+}
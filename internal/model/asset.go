@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// Asset is a node of the asset tree, such as a site, building, floor or room.
+// Roots have no ParentId. A device is attached to at most one asset, and
+// belongs to every asset above it as well.
+type Asset struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	ParentId  string    `json:"parentId,omitempty"`
+	DeviceIds []string  `json:"deviceIds"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
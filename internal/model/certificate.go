@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// DeviceCertificate registers an X.509 client certificate, by the SHA-256
+// fingerprint of its DER encoding, as a credential of a device. Revoked
+// certificates stay registered so that they cannot be registered again.
+type DeviceCertificate struct {
+	Fingerprint string     `json:"fingerprint"`
+	DeviceId    string     `json:"deviceId"`
+	Subject     string     `json:"subject"`
+	NotAfter    time.Time  `json:"notAfter"`
+	RevokedAt   *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
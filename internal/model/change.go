@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+type ChangeKind string
+
+const (
+	ChangeDeviceSaved       ChangeKind = "device.saved"
+	ChangeDeviceDeleted     ChangeKind = "device.deleted"
+	ChangeSensorDataCreated ChangeKind = "sensorData.created"
+)
+
+// Change is one entry of the replication outbox. Exactly one of Device or
+// SensorData is set, depending on Kind; a deleted device only carries its Id.
+type Change struct {
+	Seq        int64       `json:"seq"`
+	Kind       ChangeKind  `json:"kind"`
+	Device     *Device     `json:"device,omitempty"`
+	SensorData *SensorData `json:"sensorData,omitempty"`
+	CreatedAt  time.Time   `json:"createdAt"`
+}
@@ -1,12 +1,65 @@
 package model
 
-import "time"
+import (
+	"slices"
+	"time"
+)
+
+// DeviceState is where a device is in its lifecycle. Devices start out
+// provisioned or active, may be suspended and resumed, and end up
+// decommissioned, which is final.
+type DeviceState string
+
+const (
+	DeviceProvisioned    DeviceState = "provisioned"
+	DeviceActive         DeviceState = "active"
+	DeviceSuspended      DeviceState = "suspended"
+	DeviceDecommissioned DeviceState = "decommissioned"
+)
+
+var deviceTransitions = map[DeviceState][]DeviceState{
+	DeviceProvisioned: {DeviceActive, DeviceDecommissioned},
+	DeviceActive:      {DeviceSuspended, DeviceDecommissioned},
+	DeviceSuspended:   {DeviceActive, DeviceDecommissioned},
+}
+
+func (s DeviceState) Valid() bool {
+	switch s {
+	case DeviceProvisioned, DeviceActive, DeviceSuspended, DeviceDecommissioned:
+		return true
+	}
+
+	return false
+}
+
+// CanTransition reports whether a device in state s may move to next.
+func (s DeviceState) CanTransition(next DeviceState) bool {
+	return slices.Contains(deviceTransitions[s], next)
+}
+
+// Ingests reports whether readings of a device in state s are accepted.
+func (s DeviceState) Ingests() bool {
+	return s == DeviceProvisioned || s == DeviceActive
+}
 
 type Device struct {
-	Id        string    `json:"id"`
-	Name      string    `json:"name"`
-	Kind      string    `json:"type"`
-	ApiKey    string    `json:"apiKey"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	Id     string      `json:"id"`
+	Name   string      `json:"name"`
+	Kind   string      `json:"type"`
+	ApiKey string      `json:"apiKey"`
+	State  DeviceState `json:"state,omitempty"`
+	// Serial is the hardware serial of devices that provisioned themselves.
+	Serial string `json:"serial,omitempty"`
+	// DeletedAt is set for soft-deleted devices, which keep their readings
+	// and can be restored.
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+// DeviceFilter selects devices. Deleted devices are left out, unless Deleted
+// is set, which selects only them.
+type DeviceFilter struct {
+	State   DeviceState
+	Deleted bool
 }
@@ -0,0 +1,46 @@
+package model
+
+import "time"
+
+type SchemaEnforcement string
+
+const (
+	// EnforceReject refuses readings that do not match the kind's schema.
+	EnforceReject SchemaEnforcement = "reject"
+	// EnforceFlag stores such readings with their Violation set.
+	EnforceFlag SchemaEnforcement = "flag"
+)
+
+// MetricSchema describes one metric a device kind may report. Min and Max
+// only apply to numeric metrics.
+type MetricSchema struct {
+	Name      string    `json:"name"`
+	Unit      string    `json:"unit,omitempty"`
+	ValueType ValueType `json:"valueType"`
+	Min       *float64  `json:"min,omitempty"`
+	Max       *float64  `json:"max,omitempty"`
+}
+
+// DeviceKind is one version of a kind's definition. Every update stores a new
+// version; the highest version is the one readings are validated against.
+type DeviceKind struct {
+	Name                     string            `json:"name"`
+	Version                  int               `json:"version"`
+	Description              string            `json:"description"`
+	Metrics                  []MetricSchema    `json:"metrics"`
+	ReportingIntervalSeconds int               `json:"reportingIntervalSeconds"`
+	Enforcement              SchemaEnforcement `json:"enforcement"`
+	CreatedAt                time.Time         `json:"createdAt"`
+}
+
+// Metric returns the schema of the named metric, or nil if the kind does not
+// define it.
+func (k *DeviceKind) Metric(name string) *MetricSchema {
+	for i := range k.Metrics {
+		if k.Metrics[i].Name == name {
+			return &k.Metrics[i]
+		}
+	}
+
+	return nil
+}
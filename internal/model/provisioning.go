@@ -0,0 +1,46 @@
+package model
+
+import "time"
+
+// EnrollmentToken lets devices provision themselves. Every device provisioned
+// with it gets its Kind and is attached to its AssetId, the group the token
+// enrolls into, if any. The token itself is only known when it is created;
+// the platform keeps its hash.
+type EnrollmentToken struct {
+	Id        string     `json:"id"`
+	TokenHash string     `json:"-"`
+	Kind      string     `json:"kind"`
+	AssetId   string     `json:"assetId,omitempty"`
+	MaxUses   int        `json:"maxUses"`
+	Uses      int        `json:"uses"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// ProvisioningEvent audits one attempt to provision a device. TokenId is
+// empty when the token was unknown, and Error when the attempt succeeded.
+type ProvisioningEvent struct {
+	Id         int64     `json:"id"`
+	TokenId    string    `json:"tokenId,omitempty"`
+	Serial     string    `json:"serial"`
+	DeviceId   string    `json:"deviceId,omitempty"`
+	RemoteAddr string    `json:"remoteAddr,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// Rejection returns why the token cannot provision a device at now, or ""
+// when it can.
+func (t *EnrollmentToken) Rejection(now time.Time) string {
+	switch {
+	case t.RevokedAt != nil:
+		return "revoked"
+	case t.ExpiresAt != nil && !now.Before(*t.ExpiresAt):
+		return "expired"
+	case t.Uses >= t.MaxUses:
+		return "used up"
+	}
+
+	return ""
+}
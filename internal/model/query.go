@@ -0,0 +1,149 @@
+package model
+
+import (
+	"encoding/json"
+	"math"
+	"slices"
+	"time"
+)
+
+// SensorDataQuery selects readings. Zero-valued fields do not filter; From is
+// inclusive and To exclusive.
+type SensorDataQuery struct {
+	DeviceIds  []string
+	MetricName string
+	From       time.Time
+	To         time.Time
+	ValueType  ValueType
+	// Min and Max bound numeric values and imply ValueNumber.
+	Min *float64
+	Max *float64
+	// Equals matches the canonical JSON of a non-numeric value.
+	Equals json.RawMessage
+	// Unit selects readings stored in the same dimension and is the unit
+	// results, Min and Max are expressed in. It implies ValueNumber.
+	Unit string
+	// AssetId selects the devices attached to the asset or anywhere below
+	// it. The service resolves it into DeviceIds.
+	AssetId string
+	// After resumes a time-ordered listing after the given reading, paging
+	// without the cost of large offsets.
+	After  *SensorDataCursor
+	Limit  int
+	Offset int
+}
+
+// SensorDataCursor is the position of a reading in time order.
+type SensorDataCursor struct {
+	Timestamp time.Time
+	Id        int64
+}
+
+type AggregateFunc string
+
+const (
+	AggregateAvg   AggregateFunc = "avg"
+	AggregateMin   AggregateFunc = "min"
+	AggregateMax   AggregateFunc = "max"
+	AggregateSum   AggregateFunc = "sum"
+	AggregateCount AggregateFunc = "count"
+)
+
+func (f AggregateFunc) Valid() bool {
+	switch f {
+	case AggregateAvg, AggregateMin, AggregateMax, AggregateSum, AggregateCount:
+		return true
+	}
+
+	return false
+}
+
+// Aggregate is the result of applying Func to the numeric readings matched by
+// a query. Value is meaningless when Count is zero.
+type Aggregate struct {
+	Func  AggregateFunc `json:"func"`
+	Value float64       `json:"value"`
+	Count int64         `json:"count"`
+}
+
+// Matches reports whether q selects sensorData, applying the same conditions
+// as the repositories. With numericOnly it only selects numbers, as
+// aggregates do.
+func (q SensorDataQuery) Matches(sensorData *SensorData, numericOnly bool) bool {
+	if len(q.DeviceIds) > 0 && !slices.Contains(q.DeviceIds, sensorData.DeviceId) {
+		return false
+	}
+	if q.MetricName != "" && q.MetricName != sensorData.MetricName {
+		return false
+	}
+	if !q.From.IsZero() && sensorData.Timestamp.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !sensorData.Timestamp.Before(q.To) {
+		return false
+	}
+
+	valueType := q.ValueType
+	if numericOnly || q.Min != nil || q.Max != nil || q.Unit != "" {
+		valueType = ValueNumber
+	}
+	storedType := sensorData.ValueType
+	if storedType == "" {
+		storedType = ValueNumber
+	}
+	if valueType != "" && storedType != valueType {
+		return false
+	}
+	if q.Unit != "" && sensorData.Unit != StorageUnit(q.Unit) {
+		return false
+	}
+	if q.Min != nil && sensorData.MetricValue < *q.Min {
+		return false
+	}
+	if q.Max != nil && sensorData.MetricValue > *q.Max {
+		return false
+	}
+	if q.Equals != nil && (storedType.Numeric() || string(sensorData.RawValue) != string(q.Equals)) {
+		return false
+	}
+	if q.After != nil {
+		if sensorData.Timestamp.Before(q.After.Timestamp) {
+			return false
+		}
+		if sensorData.Timestamp.Equal(q.After.Timestamp) && sensorData.Id <= q.After.Id {
+			return false
+		}
+	}
+
+	return true
+}
+
+// AggregateOf applies fn to the values of readings, which must be numeric.
+func AggregateOf(fn AggregateFunc, sensorDataList []*SensorData) *Aggregate {
+	aggregate := &Aggregate{Func: fn, Count: int64(len(sensorDataList))}
+	if len(sensorDataList) == 0 {
+		return aggregate
+	}
+
+	sum, low, high := 0.0, math.Inf(1), math.Inf(-1)
+	for _, sensorData := range sensorDataList {
+		sum += sensorData.MetricValue
+		low = math.Min(low, sensorData.MetricValue)
+		high = math.Max(high, sensorData.MetricValue)
+	}
+
+	switch fn {
+	case AggregateAvg:
+		aggregate.Value = sum / float64(len(sensorDataList))
+	case AggregateMin:
+		aggregate.Value = low
+	case AggregateMax:
+		aggregate.Value = high
+	case AggregateSum:
+		aggregate.Value = sum
+	case AggregateCount:
+		aggregate.Value = float64(len(sensorDataList))
+	}
+
+	return aggregate
+}
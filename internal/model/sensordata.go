@@ -1,11 +1,96 @@
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
 
+const (
+	MaxMetricNameLength = 64
+	// MaxClockSkew is how far in the future a reading's timestamp may be.
+	MaxClockSkew = 5 * time.Minute
+)
+
+// SensorData is a single metric reading. Numeric readings carry their value in
+// MetricValue; every other value type carries its canonical JSON encoding in
+// RawValue and leaves MetricValue at zero.
 type SensorData struct {
-	Id          int64     `json:"id"`
-	DeviceId    string    `json:"deviceId"`
-	MetricName  string    `json:"metricName"`
-	MetricValue float64   `json:"metricValue"`
-	Timestamp   time.Time `json:"timestamp"`
+	Id          int64           `json:"id"`
+	DeviceId    string          `json:"deviceId"`
+	MetricName  string          `json:"metricName"`
+	ValueType   ValueType       `json:"valueType,omitempty"`
+	MetricValue float64         `json:"metricValue"`
+	RawValue    json.RawMessage `json:"rawValue,omitempty"`
+	Timestamp   time.Time       `json:"timestamp"`
+	MessageId   string          `json:"messageId,omitempty"`
+	// Violation explains why the reading does not match its device kind's
+	// schema. It is only set on readings stored in flag mode.
+	Violation string `json:"violation,omitempty"`
+	// Unit is the unit MetricValue is stored in. Known units are normalized
+	// to the canonical unit of their dimension; the reported unit and value
+	// are kept in OriginalUnit and OriginalValue.
+	Unit          string   `json:"unit,omitempty"`
+	OriginalUnit  string   `json:"originalUnit,omitempty"`
+	OriginalValue *float64 `json:"originalValue,omitempty"`
+	// Labels are free-form key/value pairs describing the reading, such as
+	// the tags of a line protocol point.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Value returns the reading's value as it should appear in JSON.
+func (s *SensorData) Value() any {
+	if s.ValueType.Numeric() {
+		return s.MetricValue
+	}
+
+	return s.RawValue
+}
+
+// NormalizeUnit converts a numeric reading in a known unit to the canonical
+// unit of its dimension. Readings without a unit, or in a unit that is not
+// known, are stored as reported.
+func (s *SensorData) NormalizeUnit() {
+	if s.Unit == "" || !s.ValueType.Numeric() || s.OriginalUnit != "" {
+		return
+	}
+
+	unit, ok := LookupUnit(s.Unit)
+	if !ok {
+		return
+	}
+
+	canonical := unit.Canonical()
+	if unit.Symbol == canonical.Symbol {
+		s.Unit = canonical.Symbol
+		return
+	}
+
+	value, err := ConvertUnit(s.MetricValue, unit.Symbol, canonical.Symbol)
+	if err != nil {
+		return
+	}
+	original := s.MetricValue
+	s.OriginalUnit = s.Unit
+	s.OriginalValue = &original
+	s.Unit = canonical.Symbol
+	s.MetricValue = value
+}
+
+// ValidateMetricName accepts names of letters, digits, '_', '-' and '.'.
+func ValidateMetricName(name string) error {
+	if name == "" {
+		return errors.New("metric name is empty")
+	}
+	if len(name) > MaxMetricNameLength {
+		return fmt.Errorf("metric name is longer than %d characters", MaxMetricNameLength)
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.') {
+			return fmt.Errorf("metric name contains invalid character %q", c)
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,130 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Unit is a measurement unit that can be converted to the canonical unit of
+// its dimension: canonical = (value + offset) * num / den. Keeping the factor
+// as a fraction makes round trips such as 212 degF -> 100 Cel -> 212 degF
+// exact.
+type Unit struct {
+	Symbol    string
+	Dimension string
+	offset    float64
+	num       float64
+	den       float64
+}
+
+var units = map[string]Unit{
+	"Cel":  {Symbol: "Cel", Dimension: "temperature", num: 1, den: 1},
+	"K":    {Symbol: "K", Dimension: "temperature", offset: -273.15, num: 1, den: 1},
+	"degF": {Symbol: "degF", Dimension: "temperature", offset: -32, num: 5, den: 9},
+
+	"Pa":   {Symbol: "Pa", Dimension: "pressure", num: 1, den: 1},
+	"hPa":  {Symbol: "hPa", Dimension: "pressure", num: 100, den: 1},
+	"kPa":  {Symbol: "kPa", Dimension: "pressure", num: 1000, den: 1},
+	"bar":  {Symbol: "bar", Dimension: "pressure", num: 100000, den: 1},
+	"mbar": {Symbol: "mbar", Dimension: "pressure", num: 100, den: 1},
+	"psi":  {Symbol: "psi", Dimension: "pressure", num: 6894.757293168, den: 1},
+
+	"m":  {Symbol: "m", Dimension: "length", num: 1, den: 1},
+	"mm": {Symbol: "mm", Dimension: "length", num: 1, den: 1000},
+	"cm": {Symbol: "cm", Dimension: "length", num: 1, den: 100},
+	"km": {Symbol: "km", Dimension: "length", num: 1000, den: 1},
+	"in": {Symbol: "in", Dimension: "length", num: 0.0254, den: 1},
+	"ft": {Symbol: "ft", Dimension: "length", num: 0.3048, den: 1},
+
+	"m/s":  {Symbol: "m/s", Dimension: "speed", num: 1, den: 1},
+	"km/h": {Symbol: "km/h", Dimension: "speed", num: 1000, den: 3600},
+	"mph":  {Symbol: "mph", Dimension: "speed", num: 0.44704, den: 1},
+
+	"W":  {Symbol: "W", Dimension: "power", num: 1, den: 1},
+	"kW": {Symbol: "kW", Dimension: "power", num: 1000, den: 1},
+
+	"J":   {Symbol: "J", Dimension: "energy", num: 1, den: 1},
+	"Wh":  {Symbol: "Wh", Dimension: "energy", num: 3600, den: 1},
+	"kWh": {Symbol: "kWh", Dimension: "energy", num: 3600000, den: 1},
+}
+
+var unitAliases = map[string]string{
+	"C":       "Cel",
+	"°C":      "Cel",
+	"celsius": "Cel",
+	"F":       "degF",
+	"°F":      "degF",
+	"[degF]":  "degF",
+	"kelvin":  "K",
+}
+
+// canonicalUnits are the units readings are stored in, one per dimension.
+var canonicalUnits = map[string]string{
+	"temperature": "Cel",
+	"pressure":    "Pa",
+	"length":      "m",
+	"speed":       "m/s",
+	"power":       "W",
+	"energy":      "J",
+}
+
+// LookupUnit resolves a unit symbol or one of its aliases.
+func LookupUnit(symbol string) (Unit, bool) {
+	if alias, ok := unitAliases[symbol]; ok {
+		symbol = alias
+	} else if alias, ok := unitAliases[strings.ToLower(symbol)]; ok {
+		symbol = alias
+	}
+
+	unit, ok := units[symbol]
+	return unit, ok
+}
+
+// StorageUnit returns the unit readings reported in symbol are stored in:
+// the canonical unit of its dimension, or symbol itself if it is not known.
+func StorageUnit(symbol string) string {
+	unit, ok := LookupUnit(symbol)
+	if !ok {
+		return symbol
+	}
+
+	return unit.Canonical().Symbol
+}
+
+// Canonical returns the unit readings of u's dimension are stored in.
+func (u Unit) Canonical() Unit {
+	return units[canonicalUnits[u.Dimension]]
+}
+
+// ConvertUnit converts value from one unit to another of the same dimension.
+func ConvertUnit(value float64, from, to string) (float64, error) {
+	fromUnit, ok := LookupUnit(from)
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", from)
+	}
+	toUnit, ok := LookupUnit(to)
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", to)
+	}
+	if fromUnit.Dimension != toUnit.Dimension {
+		return 0, fmt.Errorf("cannot convert %s to %s", fromUnit.Symbol, toUnit.Symbol)
+	}
+
+	canonical := (value + fromUnit.offset) * fromUnit.num / fromUnit.den
+	return canonical*toUnit.den/toUnit.num - toUnit.offset, nil
+}
+
+// ConvertSum converts the sum of count values, which unlike a single value
+// accumulates the offset of both units once per value.
+func ConvertSum(sum float64, count int64, from, to string) (float64, error) {
+	converted, err := ConvertUnit(sum, from, to)
+	if err != nil {
+		return 0, err
+	}
+	zero, err := ConvertUnit(0, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	return converted + zero*float64(count-1), nil
+}
@@ -0,0 +1,64 @@
+package model_test
+
+import (
+	"iot-platform/internal/model"
+	"math"
+	"testing"
+)
+
+func TestConvertUnit(t *testing.T) {
+	tests := []struct {
+		value   float64
+		from    string
+		to      string
+		want    float64
+		wantErr bool
+	}{
+		{value: 212, from: "degF", to: "Cel", want: 100},
+		{value: -40, from: "Cel", to: "°F", want: -40},
+		{value: 0, from: "Cel", to: "K", want: 273.15},
+		{value: 1013.25, from: "hPa", to: "Pa", want: 101325},
+		{value: 1, from: "psi", to: "hPa", want: 68.94757293168},
+		{value: 36, from: "km/h", to: "m/s", want: 10},
+		{value: 1, from: "Cel", to: "Pa", wantErr: true},
+		{value: 1, from: "furlong", to: "m", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		got, err := model.ConvertUnit(tc.value, tc.from, tc.to)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ConvertUnit(%g, %s, %s): expected error", tc.value, tc.from, tc.to)
+			}
+			continue
+		}
+		if err != nil || math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("ConvertUnit(%g, %s, %s) = %g, %v; want %g", tc.value, tc.from, tc.to, got, err, tc.want)
+		}
+	}
+}
+
+func TestConvertSum(t *testing.T) {
+	// 10 Cel + 20 Cel is 50 degF + 68 degF.
+	got, err := model.ConvertSum(30, 2, "Cel", "degF")
+	if err != nil || math.Abs(got-118) > 1e-9 {
+		t.Errorf("ConvertSum = %g, %v; want 118", got, err)
+	}
+}
+
+func TestSensorData_NormalizeUnit(t *testing.T) {
+	sensorData := &model.SensorData{MetricName: "temperature", MetricValue: 212, Unit: "F"}
+	sensorData.NormalizeUnit()
+	if sensorData.Unit != "Cel" || math.Abs(sensorData.MetricValue-100) > 1e-9 {
+		t.Errorf("expected 100 Cel, got %g %s", sensorData.MetricValue, sensorData.Unit)
+	}
+	if sensorData.OriginalUnit != "F" || sensorData.OriginalValue == nil || *sensorData.OriginalValue != 212 {
+		t.Errorf("expected the original 212 F to be kept, got %+v", sensorData)
+	}
+
+	unknown := &model.SensorData{MetricName: "co2", MetricValue: 400, Unit: "ppm"}
+	unknown.NormalizeUnit()
+	if unknown.Unit != "ppm" || unknown.MetricValue != 400 || unknown.OriginalUnit != "" {
+		t.Errorf("expected unknown unit to be stored as reported, got %+v", unknown)
+	}
+}
@@ -0,0 +1,11 @@
+package model
+
+// TenantUsage counts the readings a tenant ingested on Day, a UTC date such
+// as 2006-01-02. Quota is the most it may ingest that day, or 0 when it has
+// no quota.
+type TenantUsage struct {
+	TenantId string `json:"tenantId"`
+	Day      string `json:"day"`
+	Readings int64  `json:"readings"`
+	Quota    int64  `json:"quota,omitempty"`
+}
@@ -0,0 +1,157 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+type ValueType string
+
+const (
+	ValueNumber ValueType = "number"
+	ValueBool   ValueType = "bool"
+	ValueString ValueType = "string"
+	ValueGeo    ValueType = "geo"
+	ValueJSON   ValueType = "json"
+)
+
+// MaxRawValueSize bounds the encoded size of string, geo and JSON values.
+const MaxRawValueSize = 1024
+
+// GeoPoint is a WGS84 position. Alt is in metres and optional.
+type GeoPoint struct {
+	Lat float64  `json:"lat"`
+	Lon float64  `json:"lon"`
+	Alt *float64 `json:"alt,omitempty"`
+}
+
+// Valid reports whether t is one of the known value types.
+func (t ValueType) Valid() bool {
+	switch t {
+	case ValueNumber, ValueBool, ValueString, ValueGeo, ValueJSON:
+		return true
+	}
+
+	return false
+}
+
+// Numeric reports whether values of type t can be aggregated. The empty type
+// is treated as a number for readings stored before value types existed.
+func (t ValueType) Numeric() bool {
+	return t == ValueNumber || t == ""
+}
+
+// ParseValue decodes a JSON metric value. The type is inferred unless hint is
+// given: numbers, booleans and strings map to their own types, an object with
+// numeric lat and lon is a geo point and any other object is JSON. Numbers
+// are returned as a float; every other type is returned in canonical JSON so
+// that equal values are stored identically.
+func ParseValue(raw json.RawMessage, hint ValueType) (ValueType, float64, json.RawMessage, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return "", 0, nil, errors.New("value is required")
+	}
+	if hint != "" && !hint.Valid() {
+		return "", 0, nil, fmt.Errorf("unknown value type %q", hint)
+	}
+
+	valueType := hint
+	if valueType == "" {
+		valueType = inferValueType(raw)
+	}
+
+	var canonical any
+	switch valueType {
+	case ValueNumber:
+		var number float64
+		if err := json.Unmarshal(raw, &number); err != nil {
+			return "", 0, nil, errors.New("value is not a number")
+		}
+		if math.IsNaN(number) || math.IsInf(number, 0) {
+			return "", 0, nil, errors.New("value is not a finite number")
+		}
+		return ValueNumber, number, nil, nil
+	case ValueBool:
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return "", 0, nil, errors.New("value is not a boolean")
+		}
+		canonical = b
+	case ValueString:
+		var str string
+		if err := json.Unmarshal(raw, &str); err != nil {
+			return "", 0, nil, errors.New("value is not a string")
+		}
+		canonical = str
+	case ValueGeo:
+		point, err := parseGeoPoint(raw)
+		if err != nil {
+			return "", 0, nil, err
+		}
+		canonical = point
+	case ValueJSON:
+		var object map[string]any
+		if err := json.Unmarshal(raw, &object); err != nil {
+			return "", 0, nil, errors.New("value is not a JSON object")
+		}
+		canonical = object
+	default:
+		return "", 0, nil, errors.New("value has an unsupported type")
+	}
+
+	encoded, err := json.Marshal(canonical)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	if len(encoded) > MaxRawValueSize {
+		return "", 0, nil, fmt.Errorf("value is larger than %d bytes", MaxRawValueSize)
+	}
+
+	return valueType, 0, encoded, nil
+}
+
+func inferValueType(raw json.RawMessage) ValueType {
+	switch raw[0] {
+	case 't', 'f':
+		return ValueBool
+	case '"':
+		return ValueString
+	case '{':
+		if _, err := parseGeoPoint(raw); err == nil {
+			return ValueGeo
+		}
+		return ValueJSON
+	case '[':
+		return ""
+	}
+
+	return ValueNumber
+}
+
+func parseGeoPoint(raw json.RawMessage) (*GeoPoint, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, errors.New("value is not a geo point")
+	}
+	for key := range fields {
+		if key != "lat" && key != "lon" && key != "alt" {
+			return nil, fmt.Errorf("geo point has unknown field %q", key)
+		}
+	}
+	if fields["lat"] == nil || fields["lon"] == nil {
+		return nil, errors.New("geo point requires lat and lon")
+	}
+
+	var point GeoPoint
+	if err := json.Unmarshal(raw, &point); err != nil {
+		return nil, errors.New("geo point coordinates must be numbers")
+	}
+	if point.Lat < -90 || point.Lat > 90 || point.Lon < -180 || point.Lon > 180 {
+		return nil, errors.New("geo point is out of range")
+	}
+
+	return &point, nil
+}
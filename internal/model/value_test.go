@@ -0,0 +1,50 @@
+package model_test
+
+import (
+	"encoding/json"
+	"iot-platform/internal/model"
+	"testing"
+)
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		raw      string
+		hint     model.ValueType
+		wantType model.ValueType
+		wantNum  float64
+		wantRaw  string
+		wantErr  bool
+	}{
+		{raw: `21.5`, wantType: model.ValueNumber, wantNum: 21.5},
+		{raw: `0`, wantType: model.ValueNumber},
+		{raw: `-4`, wantType: model.ValueNumber, wantNum: -4},
+		{raw: `true`, wantType: model.ValueBool, wantRaw: `true`},
+		{raw: `"1.2.3"`, wantType: model.ValueString, wantRaw: `"1.2.3"`},
+		{raw: `{"lon": 13.4, "lat": 52.5}`, wantType: model.ValueGeo, wantRaw: `{"lat":52.5,"lon":13.4}`},
+		{raw: `{"lat": 52.5, "lon": 13.4}`, hint: model.ValueJSON, wantType: model.ValueJSON, wantRaw: `{"lat":52.5,"lon":13.4}`},
+		{raw: `{"mode": "eco", "level": 2}`, wantType: model.ValueJSON, wantRaw: `{"level":2,"mode":"eco"}`},
+		{raw: `{"lat": 91, "lon": 0}`, hint: model.ValueGeo, wantErr: true},
+		{raw: `"21"`, hint: model.ValueNumber, wantErr: true},
+		{raw: `[1, 2]`, wantErr: true},
+		{raw: `null`, wantErr: true},
+		{raw: ``, wantErr: true},
+		{raw: `1`, hint: "complex", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		valueType, number, raw, err := model.ParseValue(json.RawMessage(tc.raw), tc.hint)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseValue(%s, %q): expected error", tc.raw, tc.hint)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseValue(%s, %q): unexpected error %v", tc.raw, tc.hint, err)
+			continue
+		}
+		if valueType != tc.wantType || number != tc.wantNum || string(raw) != tc.wantRaw {
+			t.Errorf("ParseValue(%s, %q) = %s, %v, %s; want %s, %v, %s", tc.raw, tc.hint, valueType, number, raw, tc.wantType, tc.wantNum, tc.wantRaw)
+		}
+	}
+}
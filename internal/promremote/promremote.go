@@ -0,0 +1,188 @@
+// Package promremote decodes Prometheus remote_write requests (version 1,
+// prometheus.WriteRequest). Only series and their float samples are read;
+// metadata, exemplars and native histograms are skipped.
+package promremote
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+type Sample struct {
+	Value float64
+	// Timestamp is in milliseconds since the epoch.
+	Timestamp int64
+}
+
+type TimeSeries struct {
+	Labels  []Label
+	Samples []Sample
+}
+
+// Label returns the value of the named label, or "".
+func (ts TimeSeries) Label(name string) string {
+	for _, label := range ts.Labels {
+		if label.Name == name {
+			return label.Value
+		}
+	}
+
+	return ""
+}
+
+// staleNaN is the value Prometheus writes to mark a series as stale.
+const staleNaN uint64 = 0x7ff0000000000002
+
+// IsStaleMarker reports whether a sample only marks its series as stale.
+func IsStaleMarker(value float64) bool {
+	return math.Float64bits(value) == staleNaN
+}
+
+var errMalformed = errors.New("malformed remote write request")
+
+// Decode decompresses and decodes a snappy-compressed WriteRequest.
+func Decode(compressed []byte) ([]TimeSeries, error) {
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snappy body: %w", err)
+	}
+
+	return Unmarshal(data)
+}
+
+// Unmarshal decodes an uncompressed WriteRequest.
+func Unmarshal(data []byte) ([]TimeSeries, error) {
+	var series []TimeSeries
+	err := fields(data, func(number protowire.Number, typ protowire.Type, value []byte) error {
+		if number != 1 || typ != protowire.BytesType {
+			return nil
+		}
+		ts, err := unmarshalTimeSeries(value)
+		if err != nil {
+			return err
+		}
+		series = append(series, ts)
+		return nil
+	})
+
+	return series, err
+}
+
+func unmarshalTimeSeries(data []byte) (TimeSeries, error) {
+	var ts TimeSeries
+	err := fields(data, func(number protowire.Number, typ protowire.Type, value []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch number {
+		case 1:
+			var label Label
+			err := fields(value, func(number protowire.Number, typ protowire.Type, value []byte) error {
+				if typ != protowire.BytesType {
+					return nil
+				}
+				switch number {
+				case 1:
+					label.Name = string(value)
+				case 2:
+					label.Value = string(value)
+				}
+				return nil
+			})
+			ts.Labels = append(ts.Labels, label)
+			return err
+		case 2:
+			var sample Sample
+			err := fields(value, func(number protowire.Number, typ protowire.Type, value []byte) error {
+				switch {
+				case number == 1 && typ == protowire.Fixed64Type:
+					bits, _ := protowire.ConsumeFixed64(value)
+					sample.Value = math.Float64frombits(bits)
+				case number == 2 && typ == protowire.VarintType:
+					v, _ := protowire.ConsumeVarint(value)
+					sample.Timestamp = int64(v)
+				}
+				return nil
+			})
+			ts.Samples = append(ts.Samples, sample)
+			return err
+		}
+		return nil
+	})
+
+	return ts, err
+}
+
+// fields calls fn with every field of a message. Length-delimited values are
+// passed without their length; fixed and varint values undecoded.
+func fields(data []byte, fn func(number protowire.Number, typ protowire.Type, value []byte) error) error {
+	for len(data) > 0 {
+		number, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return errMalformed
+		}
+		data = data[n:]
+
+		var value []byte
+		switch typ {
+		case protowire.BytesType:
+			v, m := protowire.ConsumeBytes(data)
+			if m < 0 {
+				return errMalformed
+			}
+			value, n = v, m
+		default:
+			n = protowire.ConsumeFieldValue(number, typ, data)
+			if n < 0 {
+				return errMalformed
+			}
+			value = data[:n]
+		}
+		data = data[n:]
+
+		if err := fn(number, typ, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Encode builds a snappy-compressed WriteRequest, as Prometheus sends it.
+func Encode(series []TimeSeries) []byte {
+	var request []byte
+	for _, ts := range series {
+		var message []byte
+		for _, label := range ts.Labels {
+			var l []byte
+			l = protowire.AppendTag(l, 1, protowire.BytesType)
+			l = protowire.AppendString(l, label.Name)
+			l = protowire.AppendTag(l, 2, protowire.BytesType)
+			l = protowire.AppendString(l, label.Value)
+			message = protowire.AppendTag(message, 1, protowire.BytesType)
+			message = protowire.AppendBytes(message, l)
+		}
+		for _, sample := range ts.Samples {
+			var s []byte
+			s = protowire.AppendTag(s, 1, protowire.Fixed64Type)
+			s = protowire.AppendFixed64(s, math.Float64bits(sample.Value))
+			s = protowire.AppendTag(s, 2, protowire.VarintType)
+			s = protowire.AppendVarint(s, uint64(sample.Timestamp))
+			message = protowire.AppendTag(message, 2, protowire.BytesType)
+			message = protowire.AppendBytes(message, s)
+		}
+		request = protowire.AppendTag(request, 1, protowire.BytesType)
+		request = protowire.AppendBytes(request, message)
+	}
+
+	return snappy.Encode(nil, request)
+}
@@ -0,0 +1,44 @@
+package promremote_test
+
+import (
+	"iot-platform/internal/promremote"
+	"math"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	series := []promremote.TimeSeries{
+		{
+			Labels:  []promremote.Label{{Name: "__name__", Value: "modbus_register"}, {Name: "instance", Value: "plc-1"}},
+			Samples: []promremote.Sample{{Value: 1.5, Timestamp: 1777629600000}, {Value: -2, Timestamp: 1777629615000}},
+		},
+		{
+			Labels:  []promremote.Label{{Name: "__name__", Value: "up"}},
+			Samples: []promremote.Sample{{Value: math.Float64frombits(0x7ff0000000000002), Timestamp: 1}},
+		},
+	}
+
+	decoded, err := promremote.Decode(promremote.Encode(series))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decoded) != 2 || decoded[0].Label("instance") != "plc-1" || decoded[0].Label("job") != "" {
+		t.Fatalf("unexpected series %+v", decoded)
+	}
+	if samples := decoded[0].Samples; len(samples) != 2 || samples[1].Value != -2 || samples[1].Timestamp != 1777629615000 {
+		t.Errorf("unexpected samples %+v", samples)
+	}
+	if !promremote.IsStaleMarker(decoded[1].Samples[0].Value) {
+		t.Error("expected a stale marker")
+	}
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	if _, err := promremote.Decode([]byte("not snappy")); err == nil {
+		t.Error("expected an invalid snappy body to fail")
+	}
+	if _, err := promremote.Unmarshal([]byte{0x0a, 0x05, 0x01}); err == nil {
+		t.Error("expected a truncated message to fail")
+	}
+}
@@ -0,0 +1,198 @@
+// Package ratelimit limits how fast devices and API consumers may go with
+// token buckets. A bucket holds up to a burst of tokens and refills at a
+// steady rate; every reading or request takes a token out of it.
+//
+// Buckets live in memory, so each instance of the API enforces its limits on
+// its own.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// idleTTL is how long a bucket is kept once it is full again. Dropping it
+// changes nothing but its counters, as it would be created full.
+const idleTTL = 10 * time.Minute
+
+// Rate refills a bucket with PerSecond tokens a second, up to Burst. Burst
+// defaults to a second's worth of tokens. A rate of zero is unlimited.
+type Rate struct {
+	PerSecond float64 `json:"perSecond"`
+	Burst     int     `json:"burst"`
+}
+
+// Unlimited reports whether the rate lets everything through.
+func (r Rate) Unlimited() bool {
+	return r.PerSecond <= 0
+}
+
+func (r Rate) burst() float64 {
+	if r.Burst > 0 {
+		return float64(r.Burst)
+	}
+	return max(math.Ceil(r.PerSecond), 1)
+}
+
+// Decision is the outcome of Take. Limit is the size of the bucket and
+// Remaining the whole tokens left in it; Reset is how long until it is full
+// again and RetryAfter, when it is empty, how long until the next token.
+type Decision struct {
+	Taken      int
+	Limited    int
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Counters tell how many tokens were taken from a bucket, and how many were
+// asked for in vain.
+type Counters struct {
+	Key     string  `json:"key"`
+	Tokens  float64 `json:"tokens"`
+	Taken   int64   `json:"taken"`
+	Limited int64   `json:"limited"`
+}
+
+// Stats are the counters of a Limiter. Taken and Limited add up every bucket
+// since the limiter was created, including the ones dropped since.
+type Stats struct {
+	Taken   int64      `json:"taken"`
+	Limited int64      `json:"limited"`
+	Buckets []Counters `json:"buckets"`
+}
+
+type bucket struct {
+	rate    Rate
+	tokens  float64
+	updated time.Time
+	taken   int64
+	limited int64
+}
+
+// refill adds the tokens earned since the bucket was last updated.
+func (b *bucket) refill(now time.Time) {
+	b.tokens = min(b.tokens+now.Sub(b.updated).Seconds()*b.rate.PerSecond, b.rate.burst())
+	b.updated = now
+}
+
+// untilFull returns how long the bucket takes to fill up.
+func (b *bucket) untilFull() time.Duration {
+	return seconds((b.rate.burst() - b.tokens) / b.rate.PerSecond)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
+
+// Limiter holds a bucket per key, such as a device or API consumer id.
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	taken   int64
+	limited int64
+	now     func() time.Time
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Take takes up to n tokens out of the bucket of key, which refills at rate.
+// Buckets start out full, and follow changes of rate from the next Take.
+// Unlimited rates take every token without keeping a bucket.
+func (l *Limiter) Take(key string, rate Rate, n int) Decision {
+	if rate.Unlimited() {
+		return Decision{Taken: n}
+	}
+
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{rate: rate, tokens: rate.burst(), updated: now}
+		l.buckets[key] = b
+	}
+	b.refill(now)
+	if b.rate != rate {
+		b.rate = rate
+		b.tokens = min(b.tokens, rate.burst())
+	}
+
+	taken := min(n, int(b.tokens))
+	b.tokens -= float64(taken)
+	b.taken += int64(taken)
+	b.limited += int64(n - taken)
+	l.taken += int64(taken)
+	l.limited += int64(n - taken)
+
+	decision := Decision{
+		Taken:     taken,
+		Limited:   n - taken,
+		Limit:     int(rate.burst()),
+		Remaining: int(b.tokens),
+		Reset:     b.untilFull(),
+	}
+	if b.tokens < 1 {
+		decision.RetryAfter = seconds((1 - b.tokens) / rate.PerSecond)
+	}
+
+	return decision
+}
+
+// Stats returns the counters of the limiter and of its buckets, ordered by
+// key.
+func (l *Limiter) Stats() Stats {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := Stats{Taken: l.taken, Limited: l.limited, Buckets: make([]Counters, 0, len(l.buckets))}
+	for key, b := range l.buckets {
+		b.refill(now)
+		stats.Buckets = append(stats.Buckets, Counters{Key: key, Tokens: b.tokens, Taken: b.taken, Limited: b.limited})
+	}
+	sort.Slice(stats.Buckets, func(i, j int) bool {
+		return stats.Buckets[i].Key < stats.Buckets[j].Key
+	})
+
+	return stats
+}
+
+// Expire drops the buckets that have been full for longer than idleTTL.
+func (l *Limiter) Expire() {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, b := range l.buckets {
+		if b.updated.Add(b.untilFull() + idleTTL).Before(now) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Run expires idle buckets every minute until ctx is cancelled.
+func (l *Limiter) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		l.Expire()
+	}
+}
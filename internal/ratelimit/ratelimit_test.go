@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter_Take(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter()
+	l.now = func() time.Time { return now }
+	rate := Rate{PerSecond: 2, Burst: 5}
+
+	decision := l.Take("device-1", rate, 3)
+	if decision.Taken != 3 || decision.Limited != 0 || decision.Limit != 5 || decision.Remaining != 2 {
+		t.Fatalf("expected 3 tokens out of a full bucket, got %+v", decision)
+	}
+	if decision.Reset != 1500*time.Millisecond {
+		t.Errorf("expected the bucket to be full in 1.5s, got %v", decision.Reset)
+	}
+
+	decision = l.Take("device-1", rate, 4)
+	if decision.Taken != 2 || decision.Limited != 2 || decision.Remaining != 0 || decision.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("expected 2 of 4 tokens and a retry in 0.5s, got %+v", decision)
+	}
+	if decision := l.Take("device-2", rate, 1); decision.Taken != 1 {
+		t.Errorf("expected buckets to be per key, got %+v", decision)
+	}
+
+	now = now.Add(time.Second)
+	if decision := l.Take("device-1", rate, 3); decision.Taken != 2 {
+		t.Errorf("expected 2 tokens refilled after a second, got %+v", decision)
+	}
+	now = now.Add(time.Hour)
+	if decision := l.Take("device-1", rate, 10); decision.Taken != 5 {
+		t.Errorf("expected the refill to stop at the burst, got %+v", decision)
+	}
+	if decision := l.Take("device-1", Rate{}, 100); decision.Taken != 100 {
+		t.Errorf("expected a zero rate to be unlimited, got %+v", decision)
+	}
+
+	stats := l.Stats()
+	if stats.Taken != 13 || stats.Limited != 8 || len(stats.Buckets) != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if counters := stats.Buckets[0]; counters.Key != "device-1" || counters.Taken != 12 || counters.Limited != 8 {
+		t.Errorf("unexpected counters: %+v", counters)
+	}
+
+	now = now.Add(idleTTL + time.Minute)
+	l.Expire()
+	if stats := l.Stats(); len(stats.Buckets) != 0 || stats.Taken != 13 {
+		t.Errorf("expected idle buckets to be dropped and totals kept, got %+v", stats)
+	}
+}
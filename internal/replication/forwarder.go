@@ -0,0 +1,116 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iot-platform/internal/model"
+	"iot-platform/internal/repository"
+	"log"
+	"time"
+)
+
+// Upstream receives batches of changes from this instance.
+type Upstream interface {
+	// PushChanges sends changes that directly follow afterSeq and returns the
+	// last sequence the upstream has applied for sourceId.
+	PushChanges(ctx context.Context, sourceId string, afterSeq int64, changes []*model.Change) (int64, error)
+}
+
+// GapError is returned by an Upstream that has not applied everything up to
+// the afterSeq of a push, for example because it was restored from a backup.
+// The forwarder rewinds to LastSeq and resends from there.
+type GapError struct {
+	LastSeq int64
+}
+
+func (e *GapError) Error() string {
+	return fmt.Sprintf("upstream is behind: last applied seq %d", e.LastSeq)
+}
+
+const maxBackoff = 5 * time.Minute
+
+// Forwarder ships the outbox to an upstream in order, remembering how far it
+// got in a checkpoint so that it resumes where it left off after a restart or
+// a lost connection.
+type Forwarder struct {
+	repo      repository.ReplicationRepository
+	upstream  Upstream
+	sourceId  string
+	target    string
+	batchSize int
+	interval  time.Duration
+}
+
+func NewForwarder(repo repository.ReplicationRepository, upstream Upstream, sourceId, target string, batchSize int, interval time.Duration) *Forwarder {
+	return &Forwarder{
+		repo:      repo,
+		upstream:  upstream,
+		sourceId:  sourceId,
+		target:    target,
+		batchSize: batchSize,
+		interval:  interval,
+	}
+}
+
+// Sync forwards everything pending and returns the number of changes the
+// upstream acknowledged.
+func (f *Forwarder) Sync(ctx context.Context) (int, error) {
+	checkpoint, err := f.repo.FindCheckpoint(ctx, f.target)
+	if err != nil {
+		return 0, err
+	}
+
+	forwarded := 0
+	for {
+		changes, err := f.repo.ListChangesAfter(ctx, checkpoint, f.batchSize)
+		if err != nil {
+			return forwarded, err
+		}
+		if len(changes) == 0 {
+			return forwarded, nil
+		}
+
+		lastSeq, err := f.upstream.PushChanges(ctx, f.sourceId, checkpoint, changes)
+		var gap *GapError
+		if errors.As(err, &gap) {
+			log.Printf("replication: %s is at seq %d, rewinding from %d", f.target, gap.LastSeq, checkpoint)
+			lastSeq = gap.LastSeq
+		} else if err != nil {
+			return forwarded, err
+		} else if lastSeq <= checkpoint {
+			return forwarded, fmt.Errorf("upstream did not advance past seq %d", checkpoint)
+		} else {
+			forwarded += len(changes)
+		}
+
+		if err := f.repo.SaveCheckpoint(ctx, f.target, lastSeq); err != nil {
+			return forwarded, err
+		}
+		checkpoint = lastSeq
+	}
+}
+
+// Run calls Sync every interval until ctx is cancelled, backing off
+// exponentially while the upstream is unreachable.
+func (f *Forwarder) Run(ctx context.Context) {
+	wait := f.interval
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		n, err := f.Sync(ctx)
+		if err != nil {
+			wait = min(wait*2, maxBackoff)
+			log.Printf("replication: sync to %s failed, retrying in %s: %v", f.target, wait, err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("replication: forwarded %d changes to %s", n, f.target)
+		}
+		wait = f.interval
+	}
+}
@@ -0,0 +1,339 @@
+package replication_test
+
+import (
+	"context"
+	"errors"
+	"iot-platform/internal/api/http/handler"
+	"iot-platform/internal/database/postgres/postgrestest"
+	"iot-platform/internal/database/query"
+	"iot-platform/internal/database/sqlite"
+	"iot-platform/internal/database/sqlite/sqlitetest"
+	"iot-platform/internal/model"
+	"iot-platform/internal/replication"
+	"iot-platform/internal/repository/repositorytest"
+	"iot-platform/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type instance struct {
+	repos      repositorytest.Repositories
+	devices    *service.DeviceService
+	sensorData *service.SensorDataService
+}
+
+func newEdge(t *testing.T) instance {
+	return newInstance(sqlitetest.NewRecordingRepositories(t))
+}
+
+func newInstance(repos repositorytest.Repositories) instance {
+	return instance{
+		repos:      repos,
+		devices:    service.NewDevicesService(repos.Devices),
+		sensorData: service.NewSensorDataService(repos.SensorData),
+	}
+}
+
+func newCentral(t *testing.T, token string) (repositorytest.Repositories, *httptest.Server) {
+	repos := sqlitetest.NewRepositories(t)
+
+	replicationHandler := handler.NewReplicationHandler(*service.NewReplicationService(repos.Replication), token)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /replication/changes", replicationHandler.ReceiveChanges)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return repos, server
+}
+
+// flakyUpstream fails every push while offline is set.
+type flakyUpstream struct {
+	replication.Upstream
+	offline bool
+}
+
+func (u *flakyUpstream) PushChanges(ctx context.Context, sourceId string, afterSeq int64, changes []*model.Change) (int64, error) {
+	if u.offline {
+		return 0, errors.New("network unreachable")
+	}
+	return u.Upstream.PushChanges(ctx, sourceId, afterSeq, changes)
+}
+
+func countReadings(t *testing.T, repos repositorytest.Repositories, deviceId string) int {
+	t.Helper()
+	readings, err := repos.SensorData.FindSensorDataByDeviceId(context.Background(), deviceId)
+	if err != nil {
+		return 0
+	}
+	return len(readings)
+}
+
+func TestForwarder_StoreAndForward(t *testing.T) {
+	ctx := context.Background()
+	edge := newEdge(t)
+	central, server := newCentral(t, "secret")
+
+	upstream := &flakyUpstream{Upstream: replication.NewHTTPUpstream(server.URL, "secret", server.Client()), offline: true}
+	forwarder := replication.NewForwarder(edge.repos.Replication, upstream, "edge-1", "central", 2, time.Second)
+
+	deviceId, err := edge.devices.CreateDevice(ctx, &model.Device{Name: "Boiler", Kind: "thermometer", ApiKey: "key-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		reading := &model.SensorData{DeviceId: deviceId, MetricName: "temperature", MetricValue: float64(20 + i), Timestamp: base.Add(time.Duration(i) * time.Minute)}
+		if err := edge.sensorData.CreateSensorData(ctx, reading); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := forwarder.Sync(ctx); err == nil {
+		t.Fatal("expected sync to fail while offline")
+	}
+	if countReadings(t, edge.repos, deviceId) != 3 {
+		t.Fatal("expected the edge to keep ingesting while offline")
+	}
+
+	upstream.offline = false
+	forwarded, err := forwarder.Sync(ctx)
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if forwarded != 4 {
+		t.Errorf("expected 4 changes forwarded, got %d", forwarded)
+	}
+
+	device, err := central.Devices.FindDeviceById(ctx, deviceId)
+	if err != nil || device.Name != "Boiler" {
+		t.Fatalf("expected device on central, got %+v, %v", device, err)
+	}
+	readings, err := central.SensorData.FindSensorDataByDeviceId(ctx, deviceId)
+	if err != nil || len(readings) != 3 {
+		t.Fatalf("expected 3 readings on central, got %d, %v", len(readings), err)
+	}
+	for i, reading := range readings {
+		if !reading.Timestamp.Equal(base.Add(time.Duration(i) * time.Minute)) {
+			t.Errorf("reading %d: expected original timestamp, got %s", i, reading.Timestamp)
+		}
+	}
+
+	checkpoint, err := edge.repos.Replication.FindCheckpoint(ctx, "central")
+	if err != nil || checkpoint != 4 {
+		t.Errorf("expected checkpoint 4, got %d, %v", checkpoint, err)
+	}
+
+	// Losing the checkpoint resends everything; the central side must not
+	// store any of it twice.
+	if err := edge.repos.Replication.SaveCheckpoint(ctx, "central", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := forwarder.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if n := countReadings(t, central, deviceId); n != 3 {
+		t.Errorf("expected 3 readings on central after resend, got %d", n)
+	}
+
+	if err := edge.devices.DeleteDevice(ctx, deviceId); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := forwarder.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if _, err := central.Devices.FindDeviceById(ctx, deviceId); err == nil {
+		t.Error("expected device delete to be forwarded")
+	}
+}
+
+func TestForwarder_RewindsWhenUpstreamIsBehind(t *testing.T) {
+	ctx := context.Background()
+	edge := newEdge(t)
+
+	deviceId, err := edge.devices.CreateDevice(ctx, &model.Device{Name: "Boiler", Kind: "thermometer", ApiKey: "key-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := edge.sensorData.CreateSensorData(ctx, &model.SensorData{DeviceId: deviceId, MetricName: "temperature", MetricValue: 20}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The edge believes everything was forwarded, but the central instance
+	// starts from an empty database.
+	if err := edge.repos.Replication.SaveCheckpoint(ctx, "central", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := edge.sensorData.CreateSensorData(ctx, &model.SensorData{DeviceId: deviceId, MetricName: "temperature", MetricValue: 21}); err != nil {
+		t.Fatal(err)
+	}
+
+	central, server := newCentral(t, "secret")
+	forwarder := replication.NewForwarder(edge.repos.Replication, replication.NewHTTPUpstream(server.URL, "secret", server.Client()), "edge-1", "central", 10, time.Second)
+	if _, err := forwarder.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	if n := countReadings(t, central, deviceId); n != 2 {
+		t.Errorf("expected 2 readings on central, got %d", n)
+	}
+}
+
+func TestForwarder_FailedAppendStoresNothing(t *testing.T) {
+	ctx := context.Background()
+	db := sqlitetest.OpenDb(t)
+	edge := newInstance(sqlitetest.RepositoriesFor(t, db, query.WithOutbox(query.NewOutbox(sqlite.Dialect))))
+	central, server := newCentral(t, "secret")
+	forwarder := replication.NewForwarder(edge.repos.Replication, replication.NewHTTPUpstream(server.URL, "secret", server.Client()), "edge-1", "central", 10, time.Second)
+
+	deviceId, err := edge.devices.CreateDevice(ctx, &model.Device{Name: "Boiler", Kind: "thermometer", ApiKey: "key-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.ExecContext(ctx, `CREATE TRIGGER outbox_down BEFORE INSERT ON replication_outbox BEGIN SELECT RAISE(ABORT, 'outbox down'); END`); err != nil {
+		t.Fatal(err)
+	}
+	if err := edge.sensorData.CreateSensorData(ctx, &model.SensorData{DeviceId: deviceId, MetricName: "temperature", MetricValue: 20}); err == nil {
+		t.Fatal("expected the reading to fail with its outbox row")
+	}
+	if err := edge.devices.UpdateDevice(ctx, deviceId, &model.Device{Name: "Renamed", Kind: "thermometer", ApiKey: "key-1"}); err == nil {
+		t.Fatal("expected the device update to fail with its outbox row")
+	}
+	if n := countReadings(t, edge.repos, deviceId); n != 0 {
+		t.Errorf("expected the failed reading not to be stored, got %d", n)
+	}
+	if device, err := edge.repos.Devices.FindDeviceById(ctx, deviceId); err != nil || device.Name != "Boiler" {
+		t.Errorf("expected the failed update not to be stored, got %+v, %v", device, err)
+	}
+
+	// The client retries once the outbox is back; the reading must reach
+	// central exactly once.
+	if _, err := db.ExecContext(ctx, `DROP TRIGGER outbox_down`); err != nil {
+		t.Fatal(err)
+	}
+	if err := edge.sensorData.CreateSensorData(ctx, &model.SensorData{DeviceId: deviceId, MetricName: "temperature", MetricValue: 20}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := forwarder.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if n := countReadings(t, central, deviceId); n != 1 {
+		t.Errorf("expected 1 reading on central, got %d", n)
+	}
+}
+
+func TestForwarder_ConcurrentWrites(t *testing.T) {
+	backends := []struct {
+		name  string
+		repos func(t *testing.T) repositorytest.Repositories
+	}{
+		{"sqlite", sqlitetest.NewRecordingRepositories},
+		{"postgres", postgrestest.NewRecordingRepositories},
+	}
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			testConcurrentWrites(t, newInstance(backend.repos(t)))
+		})
+	}
+}
+
+// testConcurrentWrites forwards while several writers commit readings. A
+// seq committed after a larger one has been forwarded would be skipped by
+// central for good.
+func testConcurrentWrites(t *testing.T, edge instance) {
+	ctx := context.Background()
+	central, server := newCentral(t, "secret")
+	forwarder := replication.NewForwarder(edge.repos.Replication, replication.NewHTTPUpstream(server.URL, "secret", server.Client()), "edge-1", "central", 5, time.Second)
+
+	deviceId, err := edge.devices.CreateDevice(ctx, &model.Device{Name: "Boiler", Kind: "thermometer", ApiKey: "key-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const writers, perWriter = 8, 25
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < perWriter; j++ {
+				if err := edge.sensorData.CreateSensorData(ctx, &model.SensorData{DeviceId: deviceId, MetricName: "temperature", MetricValue: float64(i*perWriter + j)}); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for syncing := true; syncing; {
+		select {
+		case <-done:
+			syncing = false
+		default:
+		}
+		if _, err := forwarder.Sync(ctx); err != nil {
+			t.Fatalf("Sync: %v", err)
+		}
+	}
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	if _, err := forwarder.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if n := countReadings(t, central, deviceId); n != writers*perWriter {
+		t.Errorf("expected %d readings on central, got %d", writers*perWriter, n)
+	}
+}
+
+func TestHTTPUpstream_RejectsWrongToken(t *testing.T) {
+	_, server := newCentral(t, "secret")
+
+	upstream := replication.NewHTTPUpstream(server.URL, "wrong", server.Client())
+	_, err := upstream.PushChanges(context.Background(), "edge-1", 0, nil)
+	if err == nil {
+		t.Fatal("expected unauthorized push to fail")
+	}
+
+	// A central instance without a token refuses everyone rather than
+	// no one.
+	_, open := newCentral(t, "")
+	upstream = replication.NewHTTPUpstream(open.URL, "", open.Client())
+	if _, err := upstream.PushChanges(context.Background(), "edge-1", 0, nil); err == nil {
+		t.Error("expected a push to a central instance without a token to fail")
+	}
+}
+
+func TestSeedDevices(t *testing.T) {
+	ctx := context.Background()
+	repos := sqlitetest.NewRepositories(t)
+
+	if _, err := repos.Devices.SaveDevice(ctx, &model.Device{Name: "Boiler", Kind: "thermometer", ApiKey: "key-1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := replication.SeedDevices(ctx, repos.Devices, repos.Replication); err != nil {
+			t.Fatalf("SeedDevices: %v", err)
+		}
+	}
+
+	changes, err := repos.Replication.ListChangesAfter(ctx, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Kind != model.ChangeDeviceSaved {
+		t.Errorf("expected a single seeded device change, got %+v", changes)
+	}
+}
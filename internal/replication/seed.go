@@ -0,0 +1,38 @@
+package replication
+
+import (
+	"context"
+	"iot-platform/internal/model"
+	"iot-platform/internal/repository"
+)
+
+// SeedDevices records every existing device in an empty outbox, so that a
+// gateway switched to edge mode forwards the devices it already knows before
+// any of their readings.
+func SeedDevices(ctx context.Context, devices repository.DevicesRepository, outbox repository.ReplicationRepository) error {
+	pending, err := outbox.ListChangesAfter(ctx, 0, 1)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return nil
+	}
+
+	const pageSize = 100
+	for page := 1; ; page++ {
+		list, err := devices.ListDevices(ctx, model.DeviceFilter{}, page, pageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, device := range list {
+			if err := outbox.AppendChange(ctx, &model.Change{Kind: model.ChangeDeviceSaved, Device: device}); err != nil {
+				return err
+			}
+		}
+
+		if len(list) < pageSize {
+			return nil
+		}
+	}
+}
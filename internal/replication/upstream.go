@@ -0,0 +1,74 @@
+package replication
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"iot-platform/internal/model"
+	"net/http"
+	"strings"
+)
+
+type pushRequest struct {
+	SourceId string          `json:"sourceId"`
+	AfterSeq int64           `json:"afterSeq"`
+	Changes  []*model.Change `json:"changes"`
+}
+
+type pushResponse struct {
+	LastSeq int64 `json:"lastSeq"`
+}
+
+// HTTPUpstream pushes changes to the POST /replication/changes endpoint of a
+// central instance.
+type HTTPUpstream struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+func NewHTTPUpstream(baseURL, token string, client *http.Client) *HTTPUpstream {
+	return &HTTPUpstream{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		client:  client,
+	}
+}
+
+func (u *HTTPUpstream) PushChanges(ctx context.Context, sourceId string, afterSeq int64, changes []*model.Change) (int64, error) {
+	body, err := json.Marshal(pushRequest{SourceId: sourceId, AfterSeq: afterSeq, Changes: changes})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.baseURL+"/replication/changes", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if u.token != "" {
+		req.Header.Set("Authorization", "Bearer "+u.token)
+	}
+
+	res, err := u.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusConflict {
+		return 0, fmt.Errorf("upstream responded %s", res.Status)
+	}
+
+	var response pushResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return 0, fmt.Errorf("decode upstream response: %w", err)
+	}
+
+	if res.StatusCode == http.StatusConflict {
+		return 0, &GapError{LastSeq: response.LastSeq}
+	}
+
+	return response.LastSeq, nil
+}
@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"iot-platform/internal/model"
+)
+
+var (
+	// ErrAssetCycle is returned by MoveAsset when the new parent lies in the
+	// subtree being moved.
+	ErrAssetCycle = errors.New("asset cannot be moved below itself")
+	// ErrAssetNotEmpty is returned by DeleteAsset when the asset has children.
+	ErrAssetNotEmpty = errors.New("asset has children")
+)
+
+type AssetsRepository interface {
+	// SaveAsset creates asset when its Id is empty, setting the Id, and
+	// otherwise renames it. The parent is only changed by MoveAsset.
+	SaveAsset(ctx context.Context, asset *model.Asset) error
+	FindAsset(ctx context.Context, id string) (*model.Asset, error)
+	// ListAssets returns every asset, ordered by name.
+	ListAssets(ctx context.Context) ([]*model.Asset, error)
+	// ListSubtree returns an asset and all assets below it, ordered by name.
+	ListSubtree(ctx context.Context, id string) ([]*model.Asset, error)
+	// MoveAsset makes parentId the parent of the asset, or makes it a root
+	// when parentId is empty. Its subtree moves along.
+	MoveAsset(ctx context.Context, id, parentId string) error
+	DeleteAsset(ctx context.Context, id string) error
+	// AttachDevice attaches a device to an asset, detaching it from any
+	// other asset.
+	AttachDevice(ctx context.Context, assetId, deviceId string) error
+	DetachDevice(ctx context.Context, assetId, deviceId string) error
+}
@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"iot-platform/internal/model"
+)
+
+// ErrDuplicateCertificate is returned by SaveCertificate when the fingerprint
+// is registered already, to any device.
+var ErrDuplicateCertificate = errors.New("certificate already registered")
+
+type CertificatesRepository interface {
+	SaveCertificate(ctx context.Context, certificate *model.DeviceCertificate) error
+	FindCertificate(ctx context.Context, fingerprint string) (*model.DeviceCertificate, error)
+	// ListCertificates returns the certificates of a device, revoked ones
+	// included, newest first.
+	ListCertificates(ctx context.Context, deviceId string) ([]*model.DeviceCertificate, error)
+	RevokeCertificate(ctx context.Context, deviceId, fingerprint string) error
+}
@@ -6,8 +6,18 @@ import (
 )
 
 type DevicesRepository interface {
+	// SaveDevice creates a device, in its State or active, when its Id is
+	// empty and otherwise updates it. The state is only changed by
+	// UpdateDeviceState.
 	SaveDevice(ctx context.Context, device *model.Device) (string, error)
+	// FindDeviceById does not find deleted devices.
 	FindDeviceById(ctx context.Context, id string) (*model.Device, error)
+	// DeleteDevice soft-deletes a device; its readings are kept.
 	DeleteDevice(ctx context.Context, id string) error
-	ListDevices(ctx context.Context, page, pageSize int) ([]*model.Device, error)
+	// RestoreDevice undoes DeleteDevice.
+	RestoreDevice(ctx context.Context, id string) error
+	// UpdateDeviceState moves a device from state from to state to. It
+	// fails with ErrNotFound unless the device is in state from.
+	UpdateDeviceState(ctx context.Context, id string, from, to model.DeviceState) error
+	ListDevices(ctx context.Context, filter model.DeviceFilter, page, pageSize int) ([]*model.Device, error)
 }
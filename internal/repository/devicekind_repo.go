@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"context"
+	"iot-platform/internal/model"
+)
+
+type DeviceKindsRepository interface {
+	// SaveDeviceKind stores kind as the next version of its name and sets
+	// kind.Version accordingly.
+	SaveDeviceKind(ctx context.Context, kind *model.DeviceKind) error
+	// FindDeviceKind returns the given version of a kind, or its latest
+	// version when version is 0.
+	FindDeviceKind(ctx context.Context, name string, version int) (*model.DeviceKind, error)
+	ListDeviceKinds(ctx context.Context, page, pageSize int) ([]*model.DeviceKind, error)
+	ListDeviceKindVersions(ctx context.Context, name string) ([]*model.DeviceKind, error)
+	DeleteDeviceKind(ctx context.Context, name string) error
+}
@@ -0,0 +1,10 @@
+package repository
+
+import "errors"
+
+// ErrDuplicateMessage is returned by SaveSensorData when the device already
+// sent a reading with the same message id and that id has not expired yet.
+var ErrDuplicateMessage = errors.New("duplicate message")
+
+// ErrNotFound is returned when the requested record does not exist.
+var ErrNotFound = errors.New("not found")
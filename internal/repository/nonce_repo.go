@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNonceUsed is returned by UseNonce when the device has used the nonce
+// before and it has not been pruned yet.
+var ErrNonceUsed = errors.New("nonce already used")
+
+type NoncesRepository interface {
+	// UseNonce records that the device used nonce at usedAt.
+	UseNonce(ctx context.Context, deviceId, nonce string, usedAt time.Time) error
+	// PruneNonces forgets the nonces used before the given time and returns
+	// how many it forgot.
+	PruneNonces(ctx context.Context, before time.Time) (int64, error)
+}
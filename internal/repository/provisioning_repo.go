@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"iot-platform/internal/model"
+)
+
+var (
+	// ErrTokenRejected is returned by ProvisionDevice when the token is
+	// unknown, revoked, expired or used up.
+	ErrTokenRejected = errors.New("enrollment token rejected")
+	// ErrDuplicateSerial is returned by ProvisionDevice when a device with
+	// the same serial exists, deleted or not.
+	ErrDuplicateSerial = errors.New("serial already provisioned")
+)
+
+type ProvisioningRepository interface {
+	// SaveEnrollmentToken creates token and sets its Id.
+	SaveEnrollmentToken(ctx context.Context, token *model.EnrollmentToken) error
+	FindEnrollmentToken(ctx context.Context, id string) (*model.EnrollmentToken, error)
+	// ListEnrollmentTokens returns every token, newest first.
+	ListEnrollmentTokens(ctx context.Context) ([]*model.EnrollmentToken, error)
+	RevokeEnrollmentToken(ctx context.Context, id string) error
+	// ProvisionDevice uses up one use of the token with the given hash and
+	// creates device, with the token's kind and attached to its asset, in
+	// one transaction. It returns the token's id, if the token was found,
+	// even when it rejects it.
+	ProvisionDevice(ctx context.Context, tokenHash string, device *model.Device) (string, error)
+	SaveProvisioningEvent(ctx context.Context, event *model.ProvisioningEvent) error
+	// ListProvisioningEvents returns up to limit events of a token, or of
+	// every token when tokenId is empty, newest first.
+	ListProvisioningEvents(ctx context.Context, tokenId string, limit int) ([]*model.ProvisioningEvent, error)
+}
@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"context"
+	"iot-platform/internal/model"
+)
+
+type ReplicationRepository interface {
+	// Edge side: the outbox of local changes and how far each upstream has
+	// acknowledged it.
+	AppendChange(ctx context.Context, change *model.Change) error
+	ListChangesAfter(ctx context.Context, seq int64, limit int) ([]*model.Change, error)
+	FindCheckpoint(ctx context.Context, target string) (int64, error)
+	SaveCheckpoint(ctx context.Context, target string, seq int64) error
+
+	// Central side: changes received from edge instances. ApplyChanges skips
+	// anything at or below the source's last applied sequence and applies the
+	// rest atomically, returning the new last applied sequence.
+	ApplyChanges(ctx context.Context, sourceId string, changes []*model.Change) (int64, error)
+	FindAppliedSeq(ctx context.Context, sourceId string) (int64, error)
+}
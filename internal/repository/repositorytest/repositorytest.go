@@ -0,0 +1,1245 @@
+// Package repositorytest holds behavioural tests shared by every storage
+// backend, so that the Postgres and SQLite repositories are held to the same
+// contract.
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"iot-platform/internal/model"
+	"iot-platform/internal/repository"
+	"testing"
+	"time"
+)
+
+// Repositories is what a backend hands to the shared tests. Each call of the
+// factory must return repositories backed by a fresh, empty schema.
+type Repositories struct {
+	Devices      repository.DevicesRepository
+	DeviceKinds  repository.DeviceKindsRepository
+	SensorData   repository.SensorDataRepository
+	Replication  repository.ReplicationRepository
+	Assets       repository.AssetsRepository
+	Provisioning repository.ProvisioningRepository
+	Certificates repository.CertificatesRepository
+	Nonces       repository.NoncesRepository
+	Usage        repository.UsageRepository
+}
+
+func TestDevicesRepository(t *testing.T, newRepositories func(t *testing.T) Repositories) {
+	ctx := context.Background()
+
+	t.Run("SaveAndFind", func(t *testing.T) {
+		repo := newRepositories(t).Devices
+
+		id, err := repo.SaveDevice(ctx, &model.Device{Name: "Boiler", Kind: "thermometer", ApiKey: "key-1"})
+		if err != nil {
+			t.Fatalf("SaveDevice: %v", err)
+		}
+		if id == "" {
+			t.Fatal("expected a generated id")
+		}
+
+		device, err := repo.FindDeviceById(ctx, id)
+		if err != nil {
+			t.Fatalf("FindDeviceById: %v", err)
+		}
+		if device.Id != id || device.Name != "Boiler" || device.Kind != "thermometer" || device.ApiKey != "key-1" {
+			t.Errorf("unexpected device: %+v", device)
+		}
+		if device.CreatedAt.IsZero() || device.UpdatedAt.IsZero() {
+			t.Errorf("expected timestamps to be set, got %+v", device)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		repo := newRepositories(t).Devices
+
+		id, err := repo.SaveDevice(ctx, &model.Device{Name: "Boiler", Kind: "thermometer", ApiKey: "key-1"})
+		if err != nil {
+			t.Fatalf("SaveDevice: %v", err)
+		}
+
+		updatedId, err := repo.SaveDevice(ctx, &model.Device{Id: id, Name: "Heater", Kind: "hygrometer", ApiKey: "key-2"})
+		if err != nil {
+			t.Fatalf("SaveDevice update: %v", err)
+		}
+		if updatedId != id {
+			t.Errorf("expected id %s, got %s", id, updatedId)
+		}
+
+		device, err := repo.FindDeviceById(ctx, id)
+		if err != nil {
+			t.Fatalf("FindDeviceById: %v", err)
+		}
+		if device.Name != "Heater" || device.Kind != "hygrometer" || device.ApiKey != "key-2" {
+			t.Errorf("update not applied: %+v", device)
+		}
+	})
+
+	t.Run("FindNotFound", func(t *testing.T) {
+		repo := newRepositories(t).Devices
+
+		if _, err := repo.FindDeviceById(ctx, "00000000-0000-0000-0000-000000000000"); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		repo := newRepositories(t).Devices
+
+		id, err := repo.SaveDevice(ctx, &model.Device{Name: "Boiler", Kind: "thermometer", ApiKey: "key-1"})
+		if err != nil {
+			t.Fatalf("SaveDevice: %v", err)
+		}
+
+		if err := repo.DeleteDevice(ctx, id); err != nil {
+			t.Fatalf("DeleteDevice: %v", err)
+		}
+		if _, err := repo.FindDeviceById(ctx, id); err == nil {
+			t.Error("expected deleted device to be gone")
+		}
+		if err := repo.DeleteDevice(ctx, id); err == nil {
+			t.Error("expected error deleting a missing device")
+		}
+	})
+
+	t.Run("ListPages", func(t *testing.T) {
+		repo := newRepositories(t).Devices
+
+		for _, name := range []string{"a", "b", "c"} {
+			if _, err := repo.SaveDevice(ctx, &model.Device{Name: name, Kind: "thermometer", ApiKey: "key-" + name}); err != nil {
+				t.Fatalf("SaveDevice: %v", err)
+			}
+		}
+
+		for _, tc := range []struct{ page, pageSize, want int }{{1, 2, 2}, {2, 2, 1}, {3, 2, 0}, {1, 10, 3}} {
+			devices, err := repo.ListDevices(ctx, model.DeviceFilter{}, tc.page, tc.pageSize)
+			if err != nil {
+				t.Fatalf("ListDevices(%d, %d): %v", tc.page, tc.pageSize, err)
+			}
+			if len(devices) != tc.want {
+				t.Errorf("ListDevices(%d, %d): expected %d devices, got %d", tc.page, tc.pageSize, tc.want, len(devices))
+			}
+		}
+	})
+
+	t.Run("States", func(t *testing.T) {
+		repo := newRepositories(t).Devices
+
+		id, err := repo.SaveDevice(ctx, &model.Device{Name: "Boiler", Kind: "thermometer", ApiKey: "key-1"})
+		if err != nil {
+			t.Fatalf("SaveDevice: %v", err)
+		}
+		provisioned, err := repo.SaveDevice(ctx, &model.Device{Name: "Spare", Kind: "thermometer", ApiKey: "key-2", State: model.DeviceProvisioned})
+		if err != nil {
+			t.Fatalf("SaveDevice: %v", err)
+		}
+
+		device, err := repo.FindDeviceById(ctx, id)
+		if err != nil || device.State != model.DeviceActive || device.DeletedAt != nil {
+			t.Fatalf("expected an active device, got %+v, %v", device, err)
+		}
+
+		if err := repo.UpdateDeviceState(ctx, id, model.DeviceProvisioned, model.DeviceSuspended); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("expected ErrNotFound for a stale state, got %v", err)
+		}
+		if err := repo.UpdateDeviceState(ctx, id, model.DeviceActive, model.DeviceSuspended); err != nil {
+			t.Fatalf("UpdateDeviceState: %v", err)
+		}
+
+		// Updating other fields keeps the state.
+		device.Name = "Boiler 2"
+		if _, err := repo.SaveDevice(ctx, device); err != nil {
+			t.Fatalf("SaveDevice: %v", err)
+		}
+
+		suspended, err := repo.ListDevices(ctx, model.DeviceFilter{State: model.DeviceSuspended}, 1, 10)
+		if err != nil || len(suspended) != 1 || suspended[0].Id != id || suspended[0].Name != "Boiler 2" {
+			t.Errorf("expected the suspended device, got %+v, %v", suspended, err)
+		}
+		listed, err := repo.ListDevices(ctx, model.DeviceFilter{State: model.DeviceProvisioned}, 1, 10)
+		if err != nil || len(listed) != 1 || listed[0].Id != provisioned {
+			t.Errorf("expected the provisioned device, got %+v, %v", listed, err)
+		}
+	})
+
+	t.Run("SoftDelete", func(t *testing.T) {
+		repos := newRepositories(t)
+
+		id, err := repos.Devices.SaveDevice(ctx, &model.Device{Name: "Boiler", Kind: "thermometer", ApiKey: "key-1"})
+		if err != nil {
+			t.Fatalf("SaveDevice: %v", err)
+		}
+		if err := repos.SensorData.SaveSensorData(ctx, &model.SensorData{DeviceId: id, MetricName: "temperature", MetricValue: 1}); err != nil {
+			t.Fatalf("SaveSensorData: %v", err)
+		}
+
+		if err := repos.Devices.RestoreDevice(ctx, id); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("expected ErrNotFound restoring a device that is not deleted, got %v", err)
+		}
+		if err := repos.Devices.DeleteDevice(ctx, id); err != nil {
+			t.Fatalf("DeleteDevice: %v", err)
+		}
+		if _, err := repos.Devices.FindDeviceById(ctx, id); err == nil {
+			t.Error("expected a deleted device not to be found")
+		}
+		if err := repos.Devices.UpdateDeviceState(ctx, id, model.DeviceActive, model.DeviceSuspended); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("expected ErrNotFound changing a deleted device, got %v", err)
+		}
+		if n := countReadings(t, repos, id); n != 1 {
+			t.Errorf("expected the readings to be kept, got %d", n)
+		}
+
+		live, err := repos.Devices.ListDevices(ctx, model.DeviceFilter{}, 1, 10)
+		if err != nil || len(live) != 0 {
+			t.Errorf("expected no live devices, got %+v, %v", live, err)
+		}
+		deleted, err := repos.Devices.ListDevices(ctx, model.DeviceFilter{Deleted: true}, 1, 10)
+		if err != nil || len(deleted) != 1 || deleted[0].DeletedAt == nil {
+			t.Fatalf("expected the deleted device, got %+v, %v", deleted, err)
+		}
+
+		if err := repos.Devices.RestoreDevice(ctx, id); err != nil {
+			t.Fatalf("RestoreDevice: %v", err)
+		}
+		device, err := repos.Devices.FindDeviceById(ctx, id)
+		if err != nil || device.DeletedAt != nil {
+			t.Errorf("expected the device to be restored, got %+v, %v", device, err)
+		}
+	})
+}
+
+func TestSensorDataRepository(t *testing.T, newRepositories func(t *testing.T) Repositories) {
+	ctx := context.Background()
+
+	newDevice := func(t *testing.T, repos Repositories) string {
+		t.Helper()
+		id, err := repos.Devices.SaveDevice(ctx, &model.Device{Name: "Boiler", Kind: "thermometer", ApiKey: "key-1"})
+		if err != nil {
+			t.Fatalf("SaveDevice: %v", err)
+		}
+		return id
+	}
+
+	t.Run("SaveArgumentError", func(t *testing.T) {
+		repo := newRepositories(t).SensorData
+
+		if err := repo.SaveSensorData(ctx, &model.SensorData{MetricName: "temperature"}); err == nil {
+			t.Error("expected error for missing device id")
+		}
+		if err := repo.SaveSensorData(ctx, &model.SensorData{DeviceId: "device"}); err == nil {
+			t.Error("expected error for missing metric name")
+		}
+	})
+
+	t.Run("SaveAndFind", func(t *testing.T) {
+		repos := newRepositories(t)
+		deviceId := newDevice(t, repos)
+
+		saved := &model.SensorData{DeviceId: deviceId, MetricName: "temperature", MetricValue: 21.5}
+		if err := repos.SensorData.SaveSensorData(ctx, saved); err != nil {
+			t.Fatalf("SaveSensorData: %v", err)
+		}
+
+		list, err := repos.SensorData.FindSensorDataByDeviceId(ctx, deviceId)
+		if err != nil {
+			t.Fatalf("FindSensorDataByDeviceId: %v", err)
+		}
+		if len(list) != 1 {
+			t.Fatalf("expected 1 reading, got %d", len(list))
+		}
+		got := list[0]
+		if got.Id == 0 || got.Id != saved.Id || got.DeviceId != deviceId || got.MetricName != "temperature" || got.MetricValue != 21.5 || got.Timestamp.IsZero() {
+			t.Errorf("unexpected reading: %+v", got)
+		}
+
+		byId, err := repos.SensorData.FindSensorDataById(ctx, got.Id)
+		if err != nil {
+			t.Fatalf("FindSensorDataById: %v", err)
+		}
+		if byId.Id != got.Id || byId.DeviceId != deviceId || byId.MetricName != "temperature" || byId.MetricValue != 21.5 {
+			t.Errorf("unexpected reading: %+v", byId)
+		}
+	})
+
+	t.Run("FindErrors", func(t *testing.T) {
+		repo := newRepositories(t).SensorData
+
+		if _, err := repo.FindSensorDataById(ctx, 0); err == nil {
+			t.Error("expected error for id 0")
+		}
+		if _, err := repo.FindSensorDataById(ctx, 424242); err == nil {
+			t.Error("expected error for missing id")
+		}
+		if _, err := repo.FindSensorDataByDeviceId(ctx, ""); err == nil {
+			t.Error("expected error for empty device id")
+		}
+		if _, err := repo.FindSensorDataByDeviceId(ctx, "missing-device"); err == nil {
+			t.Error("expected error for device without readings")
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		repos := newRepositories(t)
+		deviceId := newDevice(t, repos)
+
+		if err := repos.SensorData.SaveSensorData(ctx, &model.SensorData{DeviceId: deviceId, MetricName: "temperature", MetricValue: 1}); err != nil {
+			t.Fatalf("SaveSensorData: %v", err)
+		}
+		list, err := repos.SensorData.FindSensorDataByDeviceId(ctx, deviceId)
+		if err != nil {
+			t.Fatalf("FindSensorDataByDeviceId: %v", err)
+		}
+
+		if err := repos.SensorData.DeleteSensorData(ctx, 0); err == nil {
+			t.Error("expected error for id 0")
+		}
+		if err := repos.SensorData.DeleteSensorData(ctx, list[0].Id); err != nil {
+			t.Fatalf("DeleteSensorData: %v", err)
+		}
+		if err := repos.SensorData.DeleteSensorData(ctx, list[0].Id); err == nil {
+			t.Error("expected error deleting a missing reading")
+		}
+	})
+
+	t.Run("DeleteByIds", func(t *testing.T) {
+		repos := newRepositories(t)
+		deviceId := newDevice(t, repos)
+
+		for i := 0; i < 3; i++ {
+			if err := repos.SensorData.SaveSensorData(ctx, &model.SensorData{DeviceId: deviceId, MetricName: "temperature", MetricValue: float64(i)}); err != nil {
+				t.Fatalf("SaveSensorData: %v", err)
+			}
+		}
+		list, err := repos.SensorData.FindSensorDataByDeviceId(ctx, deviceId)
+		if err != nil {
+			t.Fatalf("FindSensorDataByDeviceId: %v", err)
+		}
+
+		deleted, err := repos.SensorData.DeleteSensorDataByIds(ctx, []int64{list[0].Id, list[1].Id, list[2].Id + 1000})
+		if err != nil || deleted != 2 {
+			t.Fatalf("expected 2 deleted readings, got %d, %v", deleted, err)
+		}
+		if n := countReadings(t, repos, deviceId); n != 1 {
+			t.Errorf("expected 1 remaining reading, got %d", n)
+		}
+		if deleted, err := repos.SensorData.DeleteSensorDataByIds(ctx, nil); err != nil || deleted != 0 {
+			t.Errorf("expected nothing deleted, got %d, %v", deleted, err)
+		}
+	})
+
+	t.Run("MessageIdDeduplication", func(t *testing.T) {
+		repos := newRepositories(t)
+		deviceId := newDevice(t, repos)
+		otherDeviceId := newDevice(t, repos)
+
+		reading := func(deviceId, messageId string) *model.SensorData {
+			return &model.SensorData{DeviceId: deviceId, MetricName: "temperature", MetricValue: 1, MessageId: messageId}
+		}
+
+		if err := repos.SensorData.SaveSensorData(ctx, reading(deviceId, "msg-1")); err != nil {
+			t.Fatalf("SaveSensorData: %v", err)
+		}
+		if err := repos.SensorData.SaveSensorData(ctx, reading(deviceId, "msg-1")); !errors.Is(err, repository.ErrDuplicateMessage) {
+			t.Fatalf("expected ErrDuplicateMessage, got %v", err)
+		}
+		if err := repos.SensorData.SaveSensorData(ctx, reading(otherDeviceId, "msg-1")); err != nil {
+			t.Fatalf("message ids are per device, got %v", err)
+		}
+		if n := countReadings(t, repos, deviceId); n != 1 {
+			t.Errorf("expected 1 reading, got %d", n)
+		}
+
+		pruned, err := repos.SensorData.PruneMessageIds(ctx, time.Now().Add(time.Minute))
+		if err != nil || pruned != 2 {
+			t.Fatalf("expected 2 pruned message ids, got %d, %v", pruned, err)
+		}
+		if err := repos.SensorData.SaveSensorData(ctx, reading(deviceId, "msg-1")); err != nil {
+			t.Fatalf("expected expired message id to be accepted, got %v", err)
+		}
+		if n := countReadings(t, repos, deviceId); n != 2 {
+			t.Errorf("expected 2 readings, got %d", n)
+		}
+	})
+
+	t.Run("KeepsTimestamp", func(t *testing.T) {
+		repos := newRepositories(t)
+		deviceId := newDevice(t, repos)
+
+		timestamp := time.Date(2026, 3, 1, 8, 30, 0, 0, time.UTC)
+		if err := repos.SensorData.SaveSensorData(ctx, &model.SensorData{DeviceId: deviceId, MetricName: "temperature", MetricValue: 1, Timestamp: timestamp}); err != nil {
+			t.Fatalf("SaveSensorData: %v", err)
+		}
+
+		list, err := repos.SensorData.FindSensorDataByDeviceId(ctx, deviceId)
+		if err != nil {
+			t.Fatalf("FindSensorDataByDeviceId: %v", err)
+		}
+		if !list[0].Timestamp.Equal(timestamp) {
+			t.Errorf("expected timestamp %s, got %s", timestamp, list[0].Timestamp)
+		}
+	})
+
+	t.Run("KeepsUnits", func(t *testing.T) {
+		repos := newRepositories(t)
+		deviceId := newDevice(t, repos)
+
+		original := 212.0
+		sensorData := &model.SensorData{DeviceId: deviceId, MetricName: "temperature", MetricValue: 100, Unit: "Cel", OriginalUnit: "degF", OriginalValue: &original}
+		if err := repos.SensorData.SaveSensorData(ctx, sensorData); err != nil {
+			t.Fatalf("SaveSensorData: %v", err)
+		}
+
+		list, err := repos.SensorData.QuerySensorData(ctx, model.SensorDataQuery{DeviceIds: []string{deviceId}})
+		if err != nil || len(list) != 1 {
+			t.Fatalf("QuerySensorData: %d, %v", len(list), err)
+		}
+		got := list[0]
+		if got.Unit != "Cel" || got.OriginalUnit != "degF" || got.OriginalValue == nil || *got.OriginalValue != original {
+			t.Errorf("expected units to round-trip, got %+v", got)
+		}
+	})
+
+	t.Run("QueryAfterCursor", func(t *testing.T) {
+		repos := newRepositories(t)
+		deviceId := newDevice(t, repos)
+
+		base := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+		for i, offset := range []int{0, 1, 1, 1, 2} {
+			sensorData := &model.SensorData{DeviceId: deviceId, MetricName: "temperature", MetricValue: float64(i), Timestamp: base.Add(time.Duration(offset) * time.Minute)}
+			if err := repos.SensorData.SaveSensorData(ctx, sensorData); err != nil {
+				t.Fatalf("SaveSensorData: %v", err)
+			}
+		}
+
+		var values []float64
+		q := model.SensorDataQuery{DeviceIds: []string{deviceId}, Limit: 2}
+		for {
+			page, err := repos.SensorData.QuerySensorData(ctx, q)
+			if err != nil {
+				t.Fatalf("QuerySensorData: %v", err)
+			}
+			if len(page) == 0 {
+				break
+			}
+			for _, sensorData := range page {
+				values = append(values, sensorData.MetricValue)
+			}
+			last := page[len(page)-1]
+			q.After = &model.SensorDataCursor{Timestamp: last.Timestamp, Id: last.Id}
+		}
+
+		if len(values) != 5 {
+			t.Fatalf("expected every reading once, got %v", values)
+		}
+		for i, value := range values {
+			if value != float64(i) {
+				t.Errorf("expected readings in time and id order, got %v", values)
+				break
+			}
+		}
+	})
+
+	t.Run("KeepsLabels", func(t *testing.T) {
+		repos := newRepositories(t)
+		deviceId := newDevice(t, repos)
+
+		sensorData := &model.SensorData{DeviceId: deviceId, MetricName: "cpu.usage_idle", MetricValue: 97.5, Labels: map[string]string{"host": "gw-1", "cpu": "cpu0"}, MessageId: "m-1"}
+		if err := repos.SensorData.SaveSensorData(ctx, sensorData); err != nil {
+			t.Fatalf("SaveSensorData: %v", err)
+		}
+
+		list, err := repos.SensorData.FindSensorDataByDeviceId(ctx, deviceId)
+		if err != nil || len(list) != 1 {
+			t.Fatalf("FindSensorDataByDeviceId: %d, %v", len(list), err)
+		}
+		if labels := list[0].Labels; len(labels) != 2 || labels["host"] != "gw-1" || labels["cpu"] != "cpu0" {
+			t.Errorf("expected labels to round-trip, got %v", labels)
+		}
+	})
+
+	t.Run("TypedValues", func(t *testing.T) {
+		repos := newRepositories(t)
+		deviceId := newDevice(t, repos)
+
+		base := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+		readings := []*model.SensorData{
+			{MetricName: "temperature", ValueType: model.ValueNumber, MetricValue: 10},
+			{MetricName: "temperature", ValueType: model.ValueNumber, MetricValue: 30},
+			{MetricName: "door", ValueType: model.ValueBool, RawValue: []byte(`true`)},
+			{MetricName: "door", ValueType: model.ValueBool, RawValue: []byte(`false`)},
+			{MetricName: "firmware", ValueType: model.ValueString, RawValue: []byte(`"1.2.3"`)},
+			{MetricName: "position", ValueType: model.ValueGeo, RawValue: []byte(`{"lat":52.5,"lon":13.4}`)},
+			{MetricName: "config", ValueType: model.ValueJSON, RawValue: []byte(`{"mode":"eco"}`)},
+		}
+		for i, reading := range readings {
+			reading.DeviceId = deviceId
+			reading.Timestamp = base.Add(time.Duration(i) * time.Minute)
+			if err := repos.SensorData.SaveSensorData(ctx, reading); err != nil {
+				t.Fatalf("SaveSensorData: %v", err)
+			}
+		}
+
+		all, err := repos.SensorData.QuerySensorData(ctx, model.SensorDataQuery{DeviceIds: []string{deviceId}})
+		if err != nil {
+			t.Fatalf("QuerySensorData: %v", err)
+		}
+		if len(all) != len(readings) {
+			t.Fatalf("expected %d readings, got %d", len(readings), len(all))
+		}
+		for i, got := range all {
+			want := readings[i]
+			if got.ValueType != want.ValueType || got.MetricValue != want.MetricValue || string(got.RawValue) != string(want.RawValue) || !got.Timestamp.Equal(want.Timestamp) {
+				t.Errorf("reading %d: expected %+v, got %+v", i, want, got)
+			}
+		}
+
+		open, err := repos.SensorData.QuerySensorData(ctx, model.SensorDataQuery{MetricName: "door", ValueType: model.ValueBool, Equals: []byte(`true`)})
+		if err != nil || len(open) != 1 || !open[0].Timestamp.Equal(readings[2].Timestamp) {
+			t.Errorf("expected the open door reading, got %+v, %v", open, err)
+		}
+
+		low, high := 20.0, 40.0
+		warm, err := repos.SensorData.QuerySensorData(ctx, model.SensorDataQuery{Min: &low, Max: &high})
+		if err != nil || len(warm) != 1 || warm[0].MetricValue != 30 {
+			t.Errorf("expected the 30 degree reading, got %+v, %v", warm, err)
+		}
+
+		ranged, err := repos.SensorData.QuerySensorData(ctx, model.SensorDataQuery{From: base.Add(time.Minute), To: base.Add(3 * time.Minute), Limit: 1, Offset: 1})
+		if err != nil || len(ranged) != 1 || ranged[0].MetricName != "door" {
+			t.Errorf("expected the first door reading, got %+v, %v", ranged, err)
+		}
+
+		avg, err := repos.SensorData.AggregateSensorData(ctx, model.SensorDataQuery{DeviceIds: []string{deviceId}}, model.AggregateAvg)
+		if err != nil || avg.Value != 20 || avg.Count != 2 {
+			t.Errorf("expected an average of 20 over 2 numeric readings, got %+v, %v", avg, err)
+		}
+
+		empty, err := repos.SensorData.AggregateSensorData(ctx, model.SensorDataQuery{MetricName: "missing"}, model.AggregateSum)
+		if err != nil || empty.Count != 0 {
+			t.Errorf("expected an empty aggregate, got %+v, %v", empty, err)
+		}
+	})
+
+	t.Run("Latest", func(t *testing.T) {
+		repos := newRepositories(t)
+		deviceId := newDevice(t, repos)
+		otherId := newDevice(t, repos)
+
+		now := time.Now().UTC().Truncate(time.Second)
+		readings := []*model.SensorData{
+			{DeviceId: deviceId, MetricName: "temperature", MetricValue: 20, Timestamp: now.Add(-2 * time.Minute)},
+			{DeviceId: deviceId, MetricName: "temperature", MetricValue: 22, Timestamp: now},
+			{DeviceId: deviceId, MetricName: "temperature", MetricValue: 21, Timestamp: now.Add(-time.Minute)},
+			{DeviceId: deviceId, MetricName: "humidity", MetricValue: 40, Timestamp: now},
+			{DeviceId: otherId, MetricName: "temperature", MetricValue: 30, Timestamp: now, Labels: map[string]string{"site": "a"}},
+		}
+		for _, reading := range readings {
+			if err := repos.SensorData.SaveSensorData(ctx, reading); err != nil {
+				t.Fatalf("SaveSensorData: %v", err)
+			}
+		}
+
+		latest, err := repos.SensorData.ListLatestSensorData(ctx, deviceId, "")
+		if err != nil {
+			t.Fatalf("ListLatestSensorData: %v", err)
+		}
+		if len(latest) != 2 || latest[0].MetricName != "humidity" || latest[1].MetricName != "temperature" {
+			t.Fatalf("expected humidity and temperature, got %+v", latest)
+		}
+		if latest[1].Id != readings[1].Id || latest[1].MetricValue != 22 || !latest[1].Timestamp.Equal(now) {
+			t.Errorf("expected the newest temperature, got %+v", latest[1])
+		}
+
+		fleet, err := repos.SensorData.ListLatestSensorData(ctx, "", "temperature")
+		if err != nil {
+			t.Fatalf("ListLatestSensorData: %v", err)
+		}
+		if len(fleet) != 2 {
+			t.Fatalf("expected 2 devices, got %d", len(fleet))
+		}
+		for _, reading := range fleet {
+			if reading.DeviceId == otherId && reading.Labels["site"] != "a" {
+				t.Errorf("expected labels to be kept, got %+v", reading)
+			}
+		}
+
+		if err := repos.SensorData.DeleteSensorData(ctx, readings[1].Id); err != nil {
+			t.Fatalf("DeleteSensorData: %v", err)
+		}
+		latest, err = repos.SensorData.ListLatestSensorData(ctx, deviceId, "temperature")
+		if err != nil {
+			t.Fatalf("ListLatestSensorData: %v", err)
+		}
+		if len(latest) != 1 || latest[0].Id != readings[2].Id {
+			t.Errorf("expected the next newest temperature after delete, got %+v", latest)
+		}
+
+		if _, err := repos.SensorData.DeleteSensorDataByIds(ctx, []int64{readings[0].Id, readings[2].Id}); err != nil {
+			t.Fatalf("DeleteSensorDataByIds: %v", err)
+		}
+		latest, err = repos.SensorData.ListLatestSensorData(ctx, deviceId, "temperature")
+		if err != nil || len(latest) != 1 || latest[0].MetricValue != 21 {
+			t.Errorf("expected the latest value to outlive archived readings, got %+v, %v", latest, err)
+		}
+	})
+
+	t.Run("ListPages", func(t *testing.T) {
+		repos := newRepositories(t)
+
+		if _, err := repos.SensorData.ListSensorData(ctx, 0, 10); err == nil {
+			t.Error("expected error for page 0")
+		}
+		if _, err := repos.SensorData.ListSensorData(ctx, 1, 0); err == nil {
+			t.Error("expected error for page size 0")
+		}
+		if _, err := repos.SensorData.ListSensorData(ctx, 1, 10); err == nil {
+			t.Error("expected not found error for an empty table")
+		}
+
+		deviceId := newDevice(t, repos)
+		for i := 0; i < 3; i++ {
+			if err := repos.SensorData.SaveSensorData(ctx, &model.SensorData{DeviceId: deviceId, MetricName: "temperature", MetricValue: float64(i)}); err != nil {
+				t.Fatalf("SaveSensorData: %v", err)
+			}
+		}
+
+		first, err := repos.SensorData.ListSensorData(ctx, 1, 2)
+		if err != nil {
+			t.Fatalf("ListSensorData: %v", err)
+		}
+		second, err := repos.SensorData.ListSensorData(ctx, 2, 2)
+		if err != nil {
+			t.Fatalf("ListSensorData: %v", err)
+		}
+		if len(first) != 2 || len(second) != 1 {
+			t.Errorf("expected pages of 2 and 1, got %d and %d", len(first), len(second))
+		}
+	})
+}
+
+func countReadings(t *testing.T, repos Repositories, deviceId string) int {
+	t.Helper()
+
+	list, err := repos.SensorData.FindSensorDataByDeviceId(context.Background(), deviceId)
+	if err != nil {
+		return 0
+	}
+
+	return len(list)
+}
+
+func TestReplicationRepository(t *testing.T, newRepositories func(t *testing.T) Repositories) {
+	ctx := context.Background()
+
+	t.Run("OutboxOrder", func(t *testing.T) {
+		repo := newRepositories(t).Replication
+
+		device := &model.Device{Id: "device-1", Name: "Boiler", Kind: "thermometer", ApiKey: "key-1"}
+		changes := []*model.Change{
+			{Kind: model.ChangeDeviceSaved, Device: device},
+			{Kind: model.ChangeSensorDataCreated, SensorData: &model.SensorData{DeviceId: "device-1", MetricName: "temperature", MetricValue: 21.5}},
+			{Kind: model.ChangeDeviceDeleted, Device: &model.Device{Id: "device-1"}},
+		}
+		for _, change := range changes {
+			if err := repo.AppendChange(ctx, change); err != nil {
+				t.Fatalf("AppendChange: %v", err)
+			}
+			if change.Seq == 0 {
+				t.Fatal("expected a sequence number")
+			}
+		}
+
+		listed, err := repo.ListChangesAfter(ctx, 0, 10)
+		if err != nil {
+			t.Fatalf("ListChangesAfter: %v", err)
+		}
+		if len(listed) != 3 {
+			t.Fatalf("expected 3 changes, got %d", len(listed))
+		}
+		for i, change := range listed {
+			if change.Seq != changes[i].Seq || change.Kind != changes[i].Kind {
+				t.Errorf("change %d: expected seq %d kind %s, got seq %d kind %s", i, changes[i].Seq, changes[i].Kind, change.Seq, change.Kind)
+			}
+		}
+		if listed[1].SensorData == nil || listed[1].SensorData.MetricValue != 21.5 {
+			t.Errorf("sensor data payload not restored: %+v", listed[1])
+		}
+
+		rest, err := repo.ListChangesAfter(ctx, listed[0].Seq, 1)
+		if err != nil {
+			t.Fatalf("ListChangesAfter: %v", err)
+		}
+		if len(rest) != 1 || rest[0].Seq != listed[1].Seq {
+			t.Errorf("expected only change %d, got %+v", listed[1].Seq, rest)
+		}
+	})
+
+	t.Run("Checkpoint", func(t *testing.T) {
+		repo := newRepositories(t).Replication
+
+		seq, err := repo.FindCheckpoint(ctx, "central")
+		if err != nil || seq != 0 {
+			t.Fatalf("expected empty checkpoint, got %d, %v", seq, err)
+		}
+		for _, want := range []int64{5, 9} {
+			if err := repo.SaveCheckpoint(ctx, "central", want); err != nil {
+				t.Fatalf("SaveCheckpoint: %v", err)
+			}
+			seq, err := repo.FindCheckpoint(ctx, "central")
+			if err != nil || seq != want {
+				t.Errorf("expected checkpoint %d, got %d, %v", want, seq, err)
+			}
+		}
+	})
+
+	t.Run("ApplyDeduplicates", func(t *testing.T) {
+		repos := newRepositories(t)
+
+		changes := []*model.Change{
+			{Seq: 1, Kind: model.ChangeDeviceSaved, Device: &model.Device{Id: "edge-device", Name: "Boiler", Kind: "thermometer", ApiKey: "key-1"}},
+			{Seq: 2, Kind: model.ChangeSensorDataCreated, SensorData: &model.SensorData{DeviceId: "edge-device", MetricName: "temperature", MetricValue: 20}},
+			{Seq: 3, Kind: model.ChangeSensorDataCreated, SensorData: &model.SensorData{DeviceId: "edge-device", MetricName: "temperature", MetricValue: 21}},
+		}
+
+		last, err := repos.Replication.ApplyChanges(ctx, "edge-1", changes[:2])
+		if err != nil || last != 2 {
+			t.Fatalf("expected last seq 2, got %d, %v", last, err)
+		}
+		last, err = repos.Replication.ApplyChanges(ctx, "edge-1", changes)
+		if err != nil || last != 3 {
+			t.Fatalf("expected last seq 3, got %d, %v", last, err)
+		}
+
+		applied, err := repos.Replication.FindAppliedSeq(ctx, "edge-1")
+		if err != nil || applied != 3 {
+			t.Errorf("expected applied seq 3, got %d, %v", applied, err)
+		}
+
+		device, err := repos.Devices.FindDeviceById(ctx, "edge-device")
+		if err != nil || device.Name != "Boiler" {
+			t.Fatalf("expected replicated device, got %+v, %v", device, err)
+		}
+		readings, err := repos.SensorData.FindSensorDataByDeviceId(ctx, "edge-device")
+		if err != nil {
+			t.Fatalf("FindSensorDataByDeviceId: %v", err)
+		}
+		if len(readings) != 2 {
+			t.Errorf("expected 2 readings without duplicates, got %d", len(readings))
+		}
+	})
+
+	t.Run("ApplyIsAtomic", func(t *testing.T) {
+		repos := newRepositories(t)
+
+		changes := []*model.Change{
+			{Seq: 1, Kind: model.ChangeDeviceSaved, Device: &model.Device{Id: "edge-device", Name: "Boiler", Kind: "thermometer", ApiKey: "key-1"}},
+			{Seq: 2, Kind: "unknown"},
+		}
+		if _, err := repos.Replication.ApplyChanges(ctx, "edge-1", changes); err == nil {
+			t.Fatal("expected error for unknown change kind")
+		}
+
+		if _, err := repos.Devices.FindDeviceById(ctx, "edge-device"); err == nil {
+			t.Error("expected the failed batch to be rolled back")
+		}
+		applied, err := repos.Replication.FindAppliedSeq(ctx, "edge-1")
+		if err != nil || applied != 0 {
+			t.Errorf("expected applied seq 0, got %d, %v", applied, err)
+		}
+	})
+}
+
+func TestDeviceKindsRepository(t *testing.T, newRepositories func(t *testing.T) Repositories) {
+	ctx := context.Background()
+	max := 100.0
+
+	t.Run("SaveVersionsAndFind", func(t *testing.T) {
+		repo := newRepositories(t).DeviceKinds
+
+		kind := &model.DeviceKind{
+			Name:        "thermometer",
+			Description: "Room thermometer",
+			Metrics:     []model.MetricSchema{{Name: "temperature", Unit: "Cel", ValueType: model.ValueNumber, Max: &max}},
+			Enforcement: model.EnforceReject,
+		}
+		if err := repo.SaveDeviceKind(ctx, kind); err != nil {
+			t.Fatalf("SaveDeviceKind: %v", err)
+		}
+		if kind.Version != 1 {
+			t.Errorf("expected version 1, got %d", kind.Version)
+		}
+
+		updated := &model.DeviceKind{Name: "thermometer", Enforcement: model.EnforceFlag}
+		if err := repo.SaveDeviceKind(ctx, updated); err != nil {
+			t.Fatalf("SaveDeviceKind update: %v", err)
+		}
+		if updated.Version != 2 {
+			t.Errorf("expected version 2, got %d", updated.Version)
+		}
+
+		latest, err := repo.FindDeviceKind(ctx, "thermometer", 0)
+		if err != nil {
+			t.Fatalf("FindDeviceKind: %v", err)
+		}
+		if latest.Version != 2 || latest.Enforcement != model.EnforceFlag {
+			t.Errorf("expected latest version, got %+v", latest)
+		}
+
+		first, err := repo.FindDeviceKind(ctx, "thermometer", 1)
+		if err != nil {
+			t.Fatalf("FindDeviceKind version 1: %v", err)
+		}
+		metric := first.Metric("temperature")
+		if metric == nil || metric.Unit != "Cel" || metric.Max == nil || *metric.Max != max {
+			t.Errorf("unexpected metric schema: %+v", first.Metrics)
+		}
+		if first.CreatedAt.IsZero() {
+			t.Error("expected created at to be set")
+		}
+
+		versions, err := repo.ListDeviceKindVersions(ctx, "thermometer")
+		if err != nil || len(versions) != 2 {
+			t.Errorf("expected 2 versions, got %d, %v", len(versions), err)
+		}
+	})
+
+	t.Run("ListLatestAndDelete", func(t *testing.T) {
+		repo := newRepositories(t).DeviceKinds
+
+		for _, name := range []string{"hygrometer", "thermometer", "thermometer"} {
+			if err := repo.SaveDeviceKind(ctx, &model.DeviceKind{Name: name, Enforcement: model.EnforceReject}); err != nil {
+				t.Fatalf("SaveDeviceKind: %v", err)
+			}
+		}
+
+		kinds, err := repo.ListDeviceKinds(ctx, 1, 10)
+		if err != nil {
+			t.Fatalf("ListDeviceKinds: %v", err)
+		}
+		if len(kinds) != 2 || kinds[0].Name != "hygrometer" || kinds[1].Version != 2 {
+			t.Errorf("expected the latest version of each kind, got %+v", kinds)
+		}
+
+		if err := repo.DeleteDeviceKind(ctx, "thermometer"); err != nil {
+			t.Fatalf("DeleteDeviceKind: %v", err)
+		}
+		if _, err := repo.FindDeviceKind(ctx, "thermometer", 0); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+		if err := repo.DeleteDeviceKind(ctx, "thermometer"); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("expected ErrNotFound deleting twice, got %v", err)
+		}
+	})
+}
+
+func TestAssetsRepository(t *testing.T, newRepositories func(t *testing.T) Repositories) {
+	ctx := context.Background()
+
+	// newTree saves site -> building -> floor, plus a second building.
+	newTree := func(t *testing.T, repo repository.AssetsRepository) (site, building, floor, other *model.Asset) {
+		t.Helper()
+		site = &model.Asset{Name: "Site", Kind: "site"}
+		building = &model.Asset{Name: "Building B", Kind: "building"}
+		floor = &model.Asset{Name: "Floor 1", Kind: "floor"}
+		other = &model.Asset{Name: "Building C", Kind: "building"}
+		for _, asset := range []*model.Asset{site, building, floor, other} {
+			switch asset {
+			case building, other:
+				asset.ParentId = site.Id
+			case floor:
+				asset.ParentId = building.Id
+			}
+			if err := repo.SaveAsset(ctx, asset); err != nil {
+				t.Fatalf("SaveAsset: %v", err)
+			}
+		}
+		return site, building, floor, other
+	}
+
+	t.Run("SaveAndFind", func(t *testing.T) {
+		repo := newRepositories(t).Assets
+
+		if err := repo.SaveAsset(ctx, &model.Asset{Kind: "site"}); err == nil {
+			t.Error("expected error for missing name")
+		}
+
+		site, building, _, _ := newTree(t, repo)
+		if site.Id == "" || site.CreatedAt.IsZero() {
+			t.Fatalf("expected a generated id and timestamps, got %+v", site)
+		}
+
+		building.Name = "Building A"
+		if err := repo.SaveAsset(ctx, building); err != nil {
+			t.Fatalf("SaveAsset: %v", err)
+		}
+		found, err := repo.FindAsset(ctx, building.Id)
+		if err != nil {
+			t.Fatalf("FindAsset: %v", err)
+		}
+		if found.Name != "Building A" || found.Kind != "building" || found.ParentId != site.Id || len(found.DeviceIds) != 0 {
+			t.Errorf("unexpected asset: %+v", found)
+		}
+
+		if _, err := repo.FindAsset(ctx, "missing"); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+		if err := repo.SaveAsset(ctx, &model.Asset{Id: "missing", Name: "x"}); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("expected ErrNotFound renaming a missing asset, got %v", err)
+		}
+
+		all, err := repo.ListAssets(ctx)
+		if err != nil || len(all) != 4 {
+			t.Fatalf("expected 4 assets, got %d, %v", len(all), err)
+		}
+		if all[0].Name != "Building A" {
+			t.Errorf("expected assets ordered by name, got %s first", all[0].Name)
+		}
+	})
+
+	t.Run("SubtreeAndDevices", func(t *testing.T) {
+		repos := newRepositories(t)
+		site, building, floor, other := newTree(t, repos.Assets)
+
+		deviceId, err := repos.Devices.SaveDevice(ctx, &model.Device{Name: "Boiler", Kind: "thermometer", ApiKey: "key-1"})
+		if err != nil {
+			t.Fatalf("SaveDevice: %v", err)
+		}
+		if err := repos.Assets.AttachDevice(ctx, other.Id, deviceId); err != nil {
+			t.Fatalf("AttachDevice: %v", err)
+		}
+		if err := repos.Assets.AttachDevice(ctx, floor.Id, deviceId); err != nil {
+			t.Fatalf("AttachDevice: %v", err)
+		}
+
+		subtree, err := repos.Assets.ListSubtree(ctx, building.Id)
+		if err != nil {
+			t.Fatalf("ListSubtree: %v", err)
+		}
+		if len(subtree) != 2 || subtree[0].Id != building.Id || subtree[1].Id != floor.Id {
+			t.Fatalf("expected building and floor, got %+v", subtree)
+		}
+		if len(subtree[1].DeviceIds) != 1 || subtree[1].DeviceIds[0] != deviceId {
+			t.Errorf("expected the device on the floor only, got %+v", subtree[1])
+		}
+		if found, _ := repos.Assets.FindAsset(ctx, other.Id); found == nil || len(found.DeviceIds) != 0 {
+			t.Errorf("expected attaching elsewhere to detach the device, got %+v", found)
+		}
+
+		whole, err := repos.Assets.ListSubtree(ctx, site.Id)
+		if err != nil || len(whole) != 4 {
+			t.Errorf("expected the whole tree under the site, got %d, %v", len(whole), err)
+		}
+		if _, err := repos.Assets.ListSubtree(ctx, "missing"); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+
+		if err := repos.Assets.DetachDevice(ctx, other.Id, deviceId); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("expected ErrNotFound detaching from the wrong asset, got %v", err)
+		}
+		if err := repos.Assets.DetachDevice(ctx, floor.Id, deviceId); err != nil {
+			t.Fatalf("DetachDevice: %v", err)
+		}
+		if found, _ := repos.Assets.FindAsset(ctx, floor.Id); found == nil || len(found.DeviceIds) != 0 {
+			t.Errorf("expected the device to be detached, got %+v", found)
+		}
+	})
+
+	t.Run("Move", func(t *testing.T) {
+		repo := newRepositories(t).Assets
+		site, building, floor, other := newTree(t, repo)
+
+		if err := repo.MoveAsset(ctx, building.Id, floor.Id); !errors.Is(err, repository.ErrAssetCycle) {
+			t.Errorf("expected ErrAssetCycle moving below a descendant, got %v", err)
+		}
+		if err := repo.MoveAsset(ctx, building.Id, building.Id); !errors.Is(err, repository.ErrAssetCycle) {
+			t.Errorf("expected ErrAssetCycle moving below itself, got %v", err)
+		}
+		if err := repo.MoveAsset(ctx, "missing", site.Id); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+
+		if err := repo.MoveAsset(ctx, building.Id, other.Id); err != nil {
+			t.Fatalf("MoveAsset: %v", err)
+		}
+		subtree, err := repo.ListSubtree(ctx, other.Id)
+		if err != nil || len(subtree) != 3 {
+			t.Errorf("expected the building and its floor to move along, got %d, %v", len(subtree), err)
+		}
+
+		if err := repo.MoveAsset(ctx, building.Id, ""); err != nil {
+			t.Fatalf("MoveAsset: %v", err)
+		}
+		found, err := repo.FindAsset(ctx, building.Id)
+		if err != nil || found.ParentId != "" {
+			t.Errorf("expected the building to become a root, got %+v, %v", found, err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		repos := newRepositories(t)
+		_, building, floor, _ := newTree(t, repos.Assets)
+
+		deviceId, err := repos.Devices.SaveDevice(ctx, &model.Device{Name: "Boiler", Kind: "thermometer", ApiKey: "key-1"})
+		if err != nil {
+			t.Fatalf("SaveDevice: %v", err)
+		}
+		if err := repos.Assets.AttachDevice(ctx, floor.Id, deviceId); err != nil {
+			t.Fatalf("AttachDevice: %v", err)
+		}
+
+		if err := repos.Assets.DeleteAsset(ctx, building.Id); !errors.Is(err, repository.ErrAssetNotEmpty) {
+			t.Errorf("expected ErrAssetNotEmpty, got %v", err)
+		}
+		if err := repos.Assets.DeleteAsset(ctx, floor.Id); err != nil {
+			t.Fatalf("DeleteAsset: %v", err)
+		}
+		if err := repos.Assets.DeleteAsset(ctx, floor.Id); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+		if _, err := repos.Devices.FindDeviceById(ctx, deviceId); err != nil {
+			t.Errorf("expected the device to outlive its asset, got %v", err)
+		}
+	})
+}
+
+func TestProvisioningRepository(t *testing.T, newRepositories func(t *testing.T) Repositories) {
+	ctx := context.Background()
+
+	t.Run("Provision", func(t *testing.T) {
+		repos := newRepositories(t)
+		group := &model.Asset{Name: "Warehouse", Kind: "site"}
+		if err := repos.Assets.SaveAsset(ctx, group); err != nil {
+			t.Fatalf("SaveAsset: %v", err)
+		}
+
+		token := &model.EnrollmentToken{TokenHash: "hash-1", Kind: "thermometer", AssetId: group.Id, MaxUses: 2}
+		if err := repos.Provisioning.SaveEnrollmentToken(ctx, token); err != nil {
+			t.Fatalf("SaveEnrollmentToken: %v", err)
+		}
+
+		device := &model.Device{Name: "SN-1", ApiKey: "key-1", Serial: "SN-1"}
+		tokenId, err := repos.Provisioning.ProvisionDevice(ctx, "hash-1", device)
+		if err != nil || tokenId != token.Id {
+			t.Fatalf("ProvisionDevice: %s, %v", tokenId, err)
+		}
+		found, err := repos.Devices.FindDeviceById(ctx, device.Id)
+		if err != nil || found.Kind != "thermometer" || found.Serial != "SN-1" || found.State != model.DeviceProvisioned {
+			t.Errorf("expected a provisioned thermometer, got %+v, %v", found, err)
+		}
+		asset, err := repos.Assets.FindAsset(ctx, group.Id)
+		if err != nil || len(asset.DeviceIds) != 1 || asset.DeviceIds[0] != device.Id {
+			t.Errorf("expected the device to join the token's asset, got %+v, %v", asset, err)
+		}
+
+		if _, err := repos.Provisioning.ProvisionDevice(ctx, "hash-1", &model.Device{Name: "SN-1", ApiKey: "key-2", Serial: "SN-1"}); !errors.Is(err, repository.ErrDuplicateSerial) {
+			t.Errorf("expected ErrDuplicateSerial, got %v", err)
+		}
+		if _, err := repos.Provisioning.ProvisionDevice(ctx, "hash-1", &model.Device{Name: "SN-2", ApiKey: "key-2", Serial: "SN-2"}); err != nil {
+			t.Fatalf("ProvisionDevice: %v", err)
+		}
+		tokenId, err = repos.Provisioning.ProvisionDevice(ctx, "hash-1", &model.Device{Name: "SN-3", ApiKey: "key-3", Serial: "SN-3"})
+		if !errors.Is(err, repository.ErrTokenRejected) || tokenId != token.Id {
+			t.Errorf("expected a used up token to be rejected, got %s, %v", tokenId, err)
+		}
+		if _, err := repos.Provisioning.ProvisionDevice(ctx, "unknown", &model.Device{Name: "SN-3", ApiKey: "key-3", Serial: "SN-3"}); !errors.Is(err, repository.ErrTokenRejected) {
+			t.Errorf("expected an unknown token to be rejected, got %v", err)
+		}
+
+		stored, err := repos.Provisioning.FindEnrollmentToken(ctx, token.Id)
+		if err != nil || stored.Uses != 2 {
+			t.Errorf("expected the duplicate serial not to use up the token, got %+v, %v", stored, err)
+		}
+	})
+
+	t.Run("ExpireAndRevoke", func(t *testing.T) {
+		repo := newRepositories(t).Provisioning
+
+		expired := time.Now().Add(-time.Minute)
+		if err := repo.SaveEnrollmentToken(ctx, &model.EnrollmentToken{TokenHash: "expired", Kind: "thermometer", MaxUses: 1, ExpiresAt: &expired}); err != nil {
+			t.Fatalf("SaveEnrollmentToken: %v", err)
+		}
+		if _, err := repo.ProvisionDevice(ctx, "expired", &model.Device{Name: "SN-1", ApiKey: "key-1", Serial: "SN-1"}); !errors.Is(err, repository.ErrTokenRejected) {
+			t.Errorf("expected an expired token to be rejected, got %v", err)
+		}
+
+		token := &model.EnrollmentToken{TokenHash: "revoked", Kind: "thermometer", MaxUses: 1}
+		if err := repo.SaveEnrollmentToken(ctx, token); err != nil {
+			t.Fatalf("SaveEnrollmentToken: %v", err)
+		}
+		if err := repo.RevokeEnrollmentToken(ctx, token.Id); err != nil {
+			t.Fatalf("RevokeEnrollmentToken: %v", err)
+		}
+		if _, err := repo.ProvisionDevice(ctx, "revoked", &model.Device{Name: "SN-1", ApiKey: "key-1", Serial: "SN-1"}); !errors.Is(err, repository.ErrTokenRejected) {
+			t.Errorf("expected a revoked token to be rejected, got %v", err)
+		}
+		if err := repo.RevokeEnrollmentToken(ctx, "missing"); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+
+		tokens, err := repo.ListEnrollmentTokens(ctx)
+		if err != nil || len(tokens) != 2 || tokens[0].Id != token.Id || tokens[0].RevokedAt == nil {
+			t.Errorf("expected the revoked token first, got %+v, %v", tokens, err)
+		}
+	})
+
+	t.Run("Events", func(t *testing.T) {
+		repo := newRepositories(t).Provisioning
+
+		events := []*model.ProvisioningEvent{
+			{TokenId: "token-1", Serial: "SN-1", DeviceId: "device-1", RemoteAddr: "10.0.0.1:1234"},
+			{Serial: "SN-2", Error: "enrollment token rejected: unknown token"},
+			{TokenId: "token-1", Serial: "SN-3", Error: "serial already provisioned"},
+		}
+		for _, event := range events {
+			if err := repo.SaveProvisioningEvent(ctx, event); err != nil {
+				t.Fatalf("SaveProvisioningEvent: %v", err)
+			}
+		}
+
+		list, err := repo.ListProvisioningEvents(ctx, "token-1", 10)
+		if err != nil || len(list) != 2 || list[0].Serial != "SN-3" || list[1].DeviceId != "device-1" {
+			t.Errorf("expected the token's events, newest first, got %+v, %v", list, err)
+		}
+		list, err = repo.ListProvisioningEvents(ctx, "", 2)
+		if err != nil || len(list) != 2 || list[1].TokenId != "" {
+			t.Errorf("expected the two newest events, got %+v, %v", list, err)
+		}
+	})
+}
+
+func TestCertificatesRepository(t *testing.T, newRepositories func(t *testing.T) Repositories) {
+	ctx := context.Background()
+
+	t.Run("SaveAndRevoke", func(t *testing.T) {
+		repos := newRepositories(t)
+		deviceId, err := repos.Devices.SaveDevice(ctx, &model.Device{Name: "Boiler", Kind: "thermometer", ApiKey: "key-1"})
+		if err != nil {
+			t.Fatalf("SaveDevice: %v", err)
+		}
+
+		notAfter := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+		certificate := &model.DeviceCertificate{Fingerprint: "aa11", DeviceId: deviceId, Subject: "CN=" + deviceId, NotAfter: notAfter}
+		if err := repos.Certificates.SaveCertificate(ctx, certificate); err != nil {
+			t.Fatalf("SaveCertificate: %v", err)
+		}
+		if err := repos.Certificates.SaveCertificate(ctx, &model.DeviceCertificate{Fingerprint: "aa11", DeviceId: deviceId, Subject: "CN=" + deviceId, NotAfter: notAfter}); !errors.Is(err, repository.ErrDuplicateCertificate) {
+			t.Errorf("expected ErrDuplicateCertificate, got %v", err)
+		}
+
+		found, err := repos.Certificates.FindCertificate(ctx, "aa11")
+		if err != nil || found.DeviceId != deviceId || !found.NotAfter.Equal(notAfter) || found.RevokedAt != nil {
+			t.Errorf("unexpected certificate %+v, %v", found, err)
+		}
+		if _, err := repos.Certificates.FindCertificate(ctx, "missing"); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+
+		if err := repos.Certificates.RevokeCertificate(ctx, "other-device", "aa11"); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("expected ErrNotFound revoking another device's certificate, got %v", err)
+		}
+		if err := repos.Certificates.RevokeCertificate(ctx, deviceId, "aa11"); err != nil {
+			t.Fatalf("RevokeCertificate: %v", err)
+		}
+		list, err := repos.Certificates.ListCertificates(ctx, deviceId)
+		if err != nil || len(list) != 1 || list[0].RevokedAt == nil {
+			t.Errorf("expected the revoked certificate to stay listed, got %+v, %v", list, err)
+		}
+	})
+}
+
+func TestNoncesRepository(t *testing.T, newRepositories func(t *testing.T) Repositories) {
+	ctx := context.Background()
+
+	t.Run("UseAndPrune", func(t *testing.T) {
+		repo := newRepositories(t).Nonces
+		usedAt := time.Now().Add(-time.Hour)
+
+		if err := repo.UseNonce(ctx, "device-1", "n-1", usedAt); err != nil {
+			t.Fatalf("UseNonce: %v", err)
+		}
+		if err := repo.UseNonce(ctx, "device-1", "n-1", time.Now()); !errors.Is(err, repository.ErrNonceUsed) {
+			t.Errorf("expected ErrNonceUsed, got %v", err)
+		}
+		if err := repo.UseNonce(ctx, "device-2", "n-1", time.Now()); err != nil {
+			t.Errorf("expected nonces to be per device, got %v", err)
+		}
+
+		pruned, err := repo.PruneNonces(ctx, time.Now().Add(-time.Minute))
+		if err != nil || pruned != 1 {
+			t.Fatalf("expected one nonce to be pruned, got %d, %v", pruned, err)
+		}
+		if err := repo.UseNonce(ctx, "device-1", "n-1", time.Now()); err != nil {
+			t.Errorf("expected a pruned nonce to be usable again, got %v", err)
+		}
+	})
+}
+
+func TestUsageRepository(t *testing.T, newRepositories func(t *testing.T) Repositories) {
+	ctx := context.Background()
+
+	t.Run("AddWithinQuota", func(t *testing.T) {
+		repo := newRepositories(t).Usage
+
+		if usage, err := repo.AddUsage(ctx, "tenant-1", "2024-01-01", 6, 10); err != nil || usage != 6 {
+			t.Fatalf("expected a usage of 6, got %d, %v", usage, err)
+		}
+		if usage, err := repo.AddUsage(ctx, "tenant-1", "2024-01-01", 4, 10); err != nil || usage != 10 {
+			t.Fatalf("expected a usage of 10, got %d, %v", usage, err)
+		}
+		if usage, err := repo.AddUsage(ctx, "tenant-1", "2024-01-01", 1, 10); !errors.Is(err, repository.ErrQuotaExceeded) || usage != 10 {
+			t.Errorf("expected ErrQuotaExceeded at a usage of 10, got %d, %v", usage, err)
+		}
+		if usage, err := repo.AddUsage(ctx, "tenant-2", "2024-01-01", 11, 10); !errors.Is(err, repository.ErrQuotaExceeded) || usage != 0 {
+			t.Errorf("expected ErrQuotaExceeded for a first batch past the quota, got %d, %v", usage, err)
+		}
+		if usage, err := repo.AddUsage(ctx, "tenant-1", "2024-01-02", 3, 10); err != nil || usage != 3 {
+			t.Errorf("expected usage to be per day, got %d, %v", usage, err)
+		}
+	})
+
+	t.Run("RefundUsage", func(t *testing.T) {
+		repo := newRepositories(t).Usage
+
+		if _, err := repo.AddUsage(ctx, "tenant-1", "2024-01-01", 10, 10); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.RefundUsage(ctx, "tenant-1", "2024-01-01", 4); err != nil {
+			t.Fatalf("RefundUsage: %v", err)
+		}
+		if usage, err := repo.AddUsage(ctx, "tenant-1", "2024-01-01", 4, 10); err != nil || usage != 10 {
+			t.Errorf("expected the refunded readings to fit the quota again, got %d, %v", usage, err)
+		}
+		if err := repo.RefundUsage(ctx, "tenant-1", "2024-01-01", 20); err != nil {
+			t.Fatalf("RefundUsage: %v", err)
+		}
+		if err := repo.RefundUsage(ctx, "tenant-2", "2024-01-01", 1); err != nil {
+			t.Errorf("expected refunding a tenant without usage to do nothing, got %v", err)
+		}
+		usages, err := repo.ListUsage(ctx, "2024-01-01")
+		if err != nil || len(usages) != 1 || usages[0].Readings != 0 {
+			t.Errorf("expected usage to stop at 0, got %+v, %v", usages, err)
+		}
+	})
+
+	t.Run("ListUsage", func(t *testing.T) {
+		repo := newRepositories(t).Usage
+		for _, tenantId := range []string{"tenant-b", "tenant-a"} {
+			if _, err := repo.AddUsage(ctx, tenantId, "2024-01-01", 5, 100); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := repo.AddUsage(ctx, "tenant-a", "2024-01-02", 7, 100); err != nil {
+			t.Fatal(err)
+		}
+
+		usages, err := repo.ListUsage(ctx, "2024-01-01")
+		if err != nil {
+			t.Fatalf("ListUsage: %v", err)
+		}
+		if len(usages) != 2 || usages[0].TenantId != "tenant-a" || usages[0].Readings != 5 || usages[1].TenantId != "tenant-b" {
+			t.Errorf("unexpected usage: %+v", usages)
+		}
+	})
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"iot-platform/internal/model"
+	"time"
 )
 
 type SensorDataRepository interface {
@@ -10,5 +11,18 @@ type SensorDataRepository interface {
 	FindSensorDataById(ctx context.Context, id int64) (*model.SensorData, error)
 	FindSensorDataByDeviceId(ctx context.Context, id string) ([]*model.SensorData, error)
 	DeleteSensorData(ctx context.Context, id int64) error
+	// DeleteSensorDataByIds deletes the given readings and returns how many
+	// existed.
+	DeleteSensorDataByIds(ctx context.Context, ids []int64) (int64, error)
 	ListSensorData(ctx context.Context, page, pageSize int) ([]*model.SensorData, error)
+	QuerySensorData(ctx context.Context, q model.SensorDataQuery) ([]*model.SensorData, error)
+	// ListLatestSensorData returns the newest reading of every device and
+	// metric, ordered by device and metric. An empty deviceId or metricName
+	// does not filter.
+	ListLatestSensorData(ctx context.Context, deviceId, metricName string) ([]*model.SensorData, error)
+	// AggregateSensorData only considers numeric readings.
+	AggregateSensorData(ctx context.Context, q model.SensorDataQuery, fn model.AggregateFunc) (*model.Aggregate, error)
+	// PruneMessageIds forgets message ids received before the given time, so
+	// that they are no longer treated as duplicates.
+	PruneMessageIds(ctx context.Context, before time.Time) (int64, error)
 }
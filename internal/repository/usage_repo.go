@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"iot-platform/internal/model"
+)
+
+// ErrQuotaExceeded is returned by AddUsage when the readings would take a
+// tenant past its quota for the day.
+var ErrQuotaExceeded = errors.New("daily quota exceeded")
+
+type UsageRepository interface {
+	// AddUsage adds readings to the tenant's usage of day and returns the
+	// new usage. When that would exceed quota nothing is added, and the
+	// current usage is returned along with ErrQuotaExceeded.
+	AddUsage(ctx context.Context, tenantId, day string, readings, quota int64) (int64, error)
+	// RefundUsage takes readings off the tenant's usage of day, for readings
+	// AddUsage counted that were not stored after all. Usage does not go
+	// below zero.
+	RefundUsage(ctx context.Context, tenantId, day string, readings int64) error
+	// ListUsage returns the usage of every tenant on day, ordered by tenant.
+	ListUsage(ctx context.Context, day string) ([]*model.TenantUsage, error)
+}
@@ -0,0 +1,211 @@
+// Package senml decodes Sensor Measurement Lists (RFC 8428) in their JSON
+// and CBOR representations and resolves base fields into plain records.
+package senml
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const (
+	MediaTypeJSON = "application/senml+json"
+	MediaTypeCBOR = "application/senml+cbor"
+)
+
+// Version is the SenML version understood; packs declaring a later base
+// version are rejected.
+const Version = 10
+
+// relativeTimeLimit is 2**28 seconds: resolved times below it are relative
+// to now rather than since the epoch.
+const relativeTimeLimit = 1 << 28
+
+// Record is one entry of a pack as sent, base fields included. CBOR uses
+// the integer labels of RFC 8428 section 6.
+type Record struct {
+	BaseName    string   `json:"bn,omitempty" cbor:"-2,keyasint,omitempty"`
+	BaseTime    float64  `json:"bt,omitempty" cbor:"-3,keyasint,omitempty"`
+	BaseUnit    string   `json:"bu,omitempty" cbor:"-4,keyasint,omitempty"`
+	BaseValue   *float64 `json:"bv,omitempty" cbor:"-5,keyasint,omitempty"`
+	BaseSum     *float64 `json:"bs,omitempty" cbor:"-6,keyasint,omitempty"`
+	BaseVersion int      `json:"bver,omitempty" cbor:"-1,keyasint,omitempty"`
+	Name        string   `json:"n,omitempty" cbor:"0,keyasint,omitempty"`
+	Unit        string   `json:"u,omitempty" cbor:"1,keyasint,omitempty"`
+	Value       *float64 `json:"v,omitempty" cbor:"2,keyasint,omitempty"`
+	StringValue *string  `json:"vs,omitempty" cbor:"3,keyasint,omitempty"`
+	BoolValue   *bool    `json:"vb,omitempty" cbor:"4,keyasint,omitempty"`
+	Sum         *float64 `json:"s,omitempty" cbor:"5,keyasint,omitempty"`
+	Time        float64  `json:"t,omitempty" cbor:"6,keyasint,omitempty"`
+	UpdateTime  float64  `json:"ut,omitempty" cbor:"7,keyasint,omitempty"`
+	DataValue   Data     `json:"vd,omitempty" cbor:"8,keyasint,omitempty"`
+}
+
+// Data is an opaque data value, base64url encoded in JSON and a byte
+// string in CBOR.
+type Data []byte
+
+func (d *Data) UnmarshalJSON(b []byte) error {
+	var text string
+	if err := json.Unmarshal(b, &text); err != nil {
+		return err
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(text, "="))
+	if err != nil {
+		return fmt.Errorf("vd is not base64url: %w", err)
+	}
+	*d = decoded
+
+	return nil
+}
+
+func (d Data) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(d))
+}
+
+// Resolved is a record with its base fields applied, as described in RFC
+// 8428 section 4.6. Exactly one of the value fields is set.
+type Resolved struct {
+	Name        string
+	Unit        string
+	Time        time.Time
+	Value       *float64
+	StringValue *string
+	BoolValue   *bool
+	DataValue   Data
+	Sum         *float64
+}
+
+var ErrEmptyPack = errors.New("senml pack is empty")
+
+func DecodeJSON(data []byte) ([]Record, error) {
+	// Labels ending in '_' must be understood; none are supported.
+	var labels []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &labels); err != nil {
+		return nil, err
+	}
+	for i, record := range labels {
+		for label := range record {
+			if strings.HasSuffix(label, "_") {
+				return nil, fmt.Errorf("record %d: unsupported must-understand label %q", i, label)
+			}
+		}
+	}
+
+	var pack []Record
+	if err := json.Unmarshal(data, &pack); err != nil {
+		return nil, err
+	}
+
+	return pack, nil
+}
+
+func DecodeCBOR(data []byte) ([]Record, error) {
+	var pack []Record
+	if err := cbor.Unmarshal(data, &pack); err != nil {
+		return nil, err
+	}
+
+	return pack, nil
+}
+
+// Decode decodes a pack in the given media type, either MediaTypeJSON or
+// MediaTypeCBOR.
+func Decode(mediaType string, data []byte) ([]Record, error) {
+	switch mediaType {
+	case MediaTypeJSON:
+		return DecodeJSON(data)
+	case MediaTypeCBOR:
+		return DecodeCBOR(data)
+	default:
+		return nil, fmt.Errorf("unsupported senml media type %q", mediaType)
+	}
+}
+
+// Resolve applies the base fields of a pack to its records. Records without
+// a time are taken at now, as are relative times.
+func Resolve(pack []Record, now time.Time) ([]Resolved, error) {
+	if len(pack) == 0 {
+		return nil, ErrEmptyPack
+	}
+
+	var baseName, baseUnit string
+	var baseTime, baseValue, baseSum float64
+	resolved := make([]Resolved, 0, len(pack))
+	for i, record := range pack {
+		if record.BaseVersion > Version {
+			return nil, fmt.Errorf("record %d: unsupported senml version %d", i, record.BaseVersion)
+		}
+		if record.BaseName != "" {
+			baseName = record.BaseName
+		}
+		if record.BaseTime != 0 {
+			baseTime = record.BaseTime
+		}
+		if record.BaseUnit != "" {
+			baseUnit = record.BaseUnit
+		}
+		if record.BaseValue != nil {
+			baseValue = *record.BaseValue
+		}
+		if record.BaseSum != nil {
+			baseSum = *record.BaseSum
+		}
+
+		entry := Resolved{
+			Name:        baseName + record.Name,
+			Unit:        record.Unit,
+			Time:        resolveTime(baseTime+record.Time, now),
+			StringValue: record.StringValue,
+			BoolValue:   record.BoolValue,
+			DataValue:   record.DataValue,
+		}
+		if entry.Unit == "" {
+			entry.Unit = baseUnit
+		}
+		if record.Value != nil {
+			value := baseValue + *record.Value
+			entry.Value = &value
+		}
+		if record.Sum != nil {
+			sum := baseSum + *record.Sum
+			entry.Sum = &sum
+		}
+
+		if entry.Name == "" {
+			return nil, fmt.Errorf("record %d: name is required", i)
+		}
+		values := 0
+		for _, set := range []bool{entry.Value != nil, entry.StringValue != nil, entry.BoolValue != nil, entry.DataValue != nil} {
+			if set {
+				values++
+			}
+		}
+		if values > 1 {
+			return nil, fmt.Errorf("record %d: more than one value", i)
+		}
+		if values == 0 && entry.Sum == nil {
+			return nil, fmt.Errorf("record %d: value or sum is required", i)
+		}
+
+		resolved = append(resolved, entry)
+	}
+
+	return resolved, nil
+}
+
+func resolveTime(seconds float64, now time.Time) time.Time {
+	if seconds < relativeTimeLimit {
+		return now.Add(time.Duration(seconds * float64(time.Second)))
+	}
+
+	whole, fraction := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(fraction*1e9)).UTC()
+}
@@ -0,0 +1,110 @@
+package senml_test
+
+import (
+	"iot-platform/internal/senml"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+func TestResolve(t *testing.T) {
+	// The multiple-datapoint example of RFC 8428 section 5.1.2.
+	pack, err := senml.DecodeJSON([]byte(`[
+		{"bn": "urn:dev:ow:10e2073a01080063:", "bt": 1.320067464e+09, "bu": "%RH", "v": 20},
+		{"u": "lon", "v": 24.30621},
+		{"u": "lat", "v": 60.07965},
+		{"t": 60, "v": 20.3},
+		{"u": "lon", "t": 60, "v": 24.30622},
+		{"n": "door", "vb": true},
+		{"n": "label", "vs": "kitchen"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := senml.Resolve(pack, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 7 {
+		t.Fatalf("expected 7 records, got %d", len(records))
+	}
+
+	fourth := records[3]
+	if fourth.Name != "urn:dev:ow:10e2073a01080063:" || fourth.Unit != "%RH" || *fourth.Value != 20.3 {
+		t.Errorf("unexpected fourth record %+v", fourth)
+	}
+	if want := time.Unix(1320067524, 0).UTC(); !fourth.Time.Equal(want) {
+		t.Errorf("expected time %s, got %s", want, fourth.Time)
+	}
+	if records[1].Unit != "lon" {
+		t.Errorf("expected the record unit to override the base unit, got %s", records[1].Unit)
+	}
+	if door := records[5]; door.Name != "urn:dev:ow:10e2073a01080063:door" || door.BoolValue == nil || !*door.BoolValue {
+		t.Errorf("unexpected door record %+v", door)
+	}
+}
+
+func TestResolve_RelativeTimeAndBaseValue(t *testing.T) {
+	bv := 100.0
+	v := 2.5
+	now := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	records, err := senml.Resolve([]senml.Record{{BaseName: "dev-1/", BaseValue: &bv, Name: "counter", Value: &v, Time: -30}}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *records[0].Value != 102.5 {
+		t.Errorf("expected base value to be added, got %v", *records[0].Value)
+	}
+	if want := now.Add(-30 * time.Second); !records[0].Time.Equal(want) {
+		t.Errorf("expected time %s, got %s", want, records[0].Time)
+	}
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	data, err := cbor.Marshal([]map[int]any{
+		{-2: "dev-1:", -3: 1.7e9, 0: "temperature", 1: "Cel", 2: 21.5},
+		{0: "firmware", 3: "1.2.0"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pack, err := senml.DecodeCBOR(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := senml.Resolve(pack, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if records[0].Name != "dev-1:temperature" || records[0].Unit != "Cel" || *records[0].Value != 21.5 {
+		t.Errorf("unexpected first record %+v", records[0])
+	}
+	if records[1].StringValue == nil || *records[1].StringValue != "1.2.0" || !records[1].Time.Equal(time.Unix(1.7e9, 0)) {
+		t.Errorf("unexpected second record %+v", records[1])
+	}
+}
+
+func TestInvalidPacks(t *testing.T) {
+	for _, body := range []string{
+		`[]`,
+		`[{"n": "a"}]`,
+		`[{"v": 1}]`,
+		`[{"n": "a", "v": 1, "vs": "x"}]`,
+		`[{"bver": 11, "n": "a", "v": 1}]`,
+		`[{"n": "a", "v": 1, "x_": 2}]`,
+	} {
+		pack, err := senml.DecodeJSON([]byte(body))
+		if err == nil {
+			_, err = senml.Resolve(pack, time.Now())
+		}
+		if err == nil {
+			t.Errorf("expected %s to be rejected", body)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iot-platform/internal/model"
+	"iot-platform/internal/repository"
+)
+
+var ErrInvalidAsset = errors.New("invalid asset")
+
+type assetService interface {
+	CreateAsset(ctx context.Context, asset *model.Asset) error
+	UpdateAsset(ctx context.Context, id string, asset *model.Asset) error
+	FindAsset(ctx context.Context, id string) (*model.Asset, error)
+	FetchAssets(ctx context.Context) ([]*model.Asset, error)
+	FetchSubtree(ctx context.Context, id string) ([]*model.Asset, error)
+	MoveAsset(ctx context.Context, id, parentId string) error
+	DeleteAsset(ctx context.Context, id string) error
+	AttachDevice(ctx context.Context, assetId, deviceId string) error
+	DetachDevice(ctx context.Context, assetId, deviceId string) error
+	SubtreeDeviceIds(ctx context.Context, id string) ([]string, error)
+	DeviceTenants(ctx context.Context) (map[string]string, error)
+}
+
+// AssetService manages the asset tree, e.g. sites, buildings, floors and
+// rooms, and the devices attached to it.
+type AssetService struct {
+	repo    repository.AssetsRepository
+	devices repository.DevicesRepository
+}
+
+func NewAssetService(repo repository.AssetsRepository, devices repository.DevicesRepository) *AssetService {
+	return &AssetService{
+		repo:    repo,
+		devices: devices,
+	}
+}
+
+func (as *AssetService) CreateAsset(ctx context.Context, asset *model.Asset) error {
+	if asset.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidAsset)
+	}
+	if err := as.checkParent(ctx, asset.ParentId); err != nil {
+		return err
+	}
+
+	asset.Id = ""
+	return as.repo.SaveAsset(ctx, asset)
+}
+
+// UpdateAsset renames an asset. Use MoveAsset to change its parent.
+func (as *AssetService) UpdateAsset(ctx context.Context, id string, asset *model.Asset) error {
+	if asset.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidAsset)
+	}
+
+	asset.Id = id
+	if err := as.repo.SaveAsset(ctx, asset); err != nil {
+		return err
+	}
+
+	updated, err := as.repo.FindAsset(ctx, id)
+	if err != nil {
+		return err
+	}
+	*asset = *updated
+
+	return nil
+}
+
+func (as *AssetService) FindAsset(ctx context.Context, id string) (*model.Asset, error) {
+	return as.repo.FindAsset(ctx, id)
+}
+
+func (as *AssetService) FetchAssets(ctx context.Context) ([]*model.Asset, error) {
+	return as.repo.ListAssets(ctx)
+}
+
+// FetchSubtree returns an asset and every asset below it.
+func (as *AssetService) FetchSubtree(ctx context.Context, id string) ([]*model.Asset, error) {
+	return as.repo.ListSubtree(ctx, id)
+}
+
+// MoveAsset moves an asset, with everything below it, under parentId, or to
+// the top of the tree when parentId is empty.
+func (as *AssetService) MoveAsset(ctx context.Context, id, parentId string) error {
+	if err := as.checkParent(ctx, parentId); err != nil {
+		return err
+	}
+
+	return as.repo.MoveAsset(ctx, id, parentId)
+}
+
+func (as *AssetService) DeleteAsset(ctx context.Context, id string) error {
+	return as.repo.DeleteAsset(ctx, id)
+}
+
+func (as *AssetService) AttachDevice(ctx context.Context, assetId, deviceId string) error {
+	if _, err := as.repo.FindAsset(ctx, assetId); err != nil {
+		return err
+	}
+	if _, err := as.devices.FindDeviceById(ctx, deviceId); err != nil {
+		return fmt.Errorf("%w: device %s not found", ErrInvalidAsset, deviceId)
+	}
+
+	return as.repo.AttachDevice(ctx, assetId, deviceId)
+}
+
+func (as *AssetService) DetachDevice(ctx context.Context, assetId, deviceId string) error {
+	return as.repo.DetachDevice(ctx, assetId, deviceId)
+}
+
+// SubtreeDeviceIds returns the devices attached to an asset or to any asset
+// below it.
+func (as *AssetService) SubtreeDeviceIds(ctx context.Context, id string) ([]string, error) {
+	subtree, err := as.repo.ListSubtree(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceIds := []string{}
+	for _, asset := range subtree {
+		deviceIds = append(deviceIds, asset.DeviceIds...)
+	}
+
+	return deviceIds, nil
+}
+
+// DeviceTenants maps every device attached to the asset tree to its tenant,
+// the root asset above it.
+func (as *AssetService) DeviceTenants(ctx context.Context) (map[string]string, error) {
+	assets, err := as.repo.ListAssets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	parentOf := make(map[string]string, len(assets))
+	for _, asset := range assets {
+		parentOf[asset.Id] = asset.ParentId
+	}
+
+	tenants := make(map[string]string)
+	for _, asset := range assets {
+		root := asset.Id
+		for parentOf[root] != "" {
+			root = parentOf[root]
+		}
+		for _, deviceId := range asset.DeviceIds {
+			tenants[deviceId] = root
+		}
+	}
+
+	return tenants, nil
+}
+
+func (as *AssetService) checkParent(ctx context.Context, parentId string) error {
+	if parentId == "" {
+		return nil
+	}
+
+	_, err := as.repo.FindAsset(ctx, parentId)
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("%w: parent %s not found", ErrInvalidAsset, parentId)
+	}
+
+	return err
+}
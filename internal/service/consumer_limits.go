@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"iot-platform/internal/model"
+	"iot-platform/internal/ratelimit"
+	"sync"
+	"time"
+)
+
+// consumerAuthTTL is how long ConsumerLimits trusts a device's API key
+// without looking it up again. It only decides which bucket a request is
+// counted in; the handlers still authenticate every request.
+const consumerAuthTTL = time.Minute
+
+// Authenticator checks a device's API key, such as DeviceService.
+type Authenticator interface {
+	Authenticate(ctx context.Context, id string, apiKey string) (*model.Device, error)
+}
+
+// Consumer is what an API request says about who sent it. Certificate is
+// the client certificate the server verified, if any; DeviceId and ApiKey
+// are as sent, and unverified.
+type Consumer struct {
+	Certificate *x509.Certificate
+	DeviceId    string
+	ApiKey      string
+	Address     string
+}
+
+// ConsumerLimits limits the requests of each API consumer, whichever
+// protocol it uses. Consumers are told apart by who they authenticated as:
+// the verified client certificate, or the device whose API key they sent.
+// Everything else, including unknown or wrong keys, counts against the
+// client's address, so that made-up keys do not each get a bucket of their
+// own.
+type ConsumerLimits struct {
+	limiter *ratelimit.Limiter
+	rate    ratelimit.Rate
+	devices Authenticator
+
+	mu            sync.Mutex
+	authenticated map[string]time.Time
+	sweep         time.Time
+}
+
+func NewConsumerLimits(limiter *ratelimit.Limiter, rate ratelimit.Rate, devices Authenticator) *ConsumerLimits {
+	return &ConsumerLimits{
+		limiter:       limiter,
+		rate:          rate,
+		devices:       devices,
+		authenticated: make(map[string]time.Time),
+	}
+}
+
+// Unlimited reports whether every request gets through.
+func (c *ConsumerLimits) Unlimited() bool {
+	return c.rate.Unlimited()
+}
+
+// Take takes a request of consumer out of its bucket. A key that was not
+// verified lately costs a lookup, which is first paid for by the address:
+// requests refused there never reach the database.
+func (c *ConsumerLimits) Take(ctx context.Context, consumer Consumer) ratelimit.Decision {
+	if consumer.Certificate != nil {
+		return c.limiter.Take("cert:"+CertificateFingerprint(consumer.Certificate)[:16], c.rate, 1)
+	}
+
+	address := "addr:" + consumer.Address
+	if consumer.DeviceId == "" || consumer.ApiKey == "" {
+		return c.limiter.Take(address, c.rate, 1)
+	}
+
+	now := time.Now()
+	sum := sha256.Sum256([]byte(consumer.ApiKey))
+	key := consumer.DeviceId + ":" + hex.EncodeToString(sum[:])
+	c.mu.Lock()
+	expires, ok := c.authenticated[key]
+	c.mu.Unlock()
+	if ok && now.Before(expires) {
+		return c.limiter.Take("device:"+consumer.DeviceId, c.rate, 1)
+	}
+
+	decision := c.limiter.Take(address, c.rate, 1)
+	if decision.Limited > 0 {
+		return decision
+	}
+	if _, err := c.devices.Authenticate(ctx, consumer.DeviceId, consumer.ApiKey); err != nil {
+		return decision
+	}
+
+	c.mu.Lock()
+	c.authenticated[key] = now.Add(consumerAuthTTL)
+	if now.After(c.sweep) {
+		for key, expires := range c.authenticated {
+			if now.After(expires) {
+				delete(c.authenticated, key)
+			}
+		}
+		c.sweep = now.Add(consumerAuthTTL)
+	}
+	c.mu.Unlock()
+
+	return c.limiter.Take("device:"+consumer.DeviceId, c.rate, 1)
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"iot-platform/internal/model"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidCertificate = errors.New("invalid certificate")
+	// ErrCertificatesDisabled is returned by the certificate methods of a
+	// DeviceService created without WithCertificates.
+	ErrCertificatesDisabled = errors.New("client certificates are not enabled")
+)
+
+// CertificateFingerprint returns the fingerprint a certificate is registered
+// by: the hex SHA-256 of its DER encoding.
+func CertificateFingerprint(certificate *x509.Certificate) string {
+	sum := sha256.Sum256(certificate.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// certificateNames returns the device ids a certificate may name: its common
+// name, its DNS names, and its urn:uuid URIs.
+func certificateNames(certificate *x509.Certificate) []string {
+	names := append([]string{certificate.Subject.CommonName}, certificate.DNSNames...)
+	for _, uri := range certificate.URIs {
+		if id, ok := strings.CutPrefix(uri.String(), "urn:uuid:"); ok {
+			names = append(names, id)
+		}
+	}
+
+	return names
+}
+
+// RegisterCertificate registers a PEM encoded client certificate for a
+// device. The certificate must name the device in its common name or a
+// subject alternative name. Whether it chains to a trusted CA is checked by
+// the TLS handshake, not here.
+func (de *DeviceService) RegisterCertificate(ctx context.Context, deviceId string, certificatePEM []byte) (*model.DeviceCertificate, error) {
+	if de.certificates == nil {
+		return nil, ErrCertificatesDisabled
+	}
+	if _, err := de.repo.FindDeviceById(ctx, deviceId); err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(certificatePEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%w: expected a PEM encoded certificate", ErrInvalidCertificate)
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCertificate, err)
+	}
+	if !slices.Contains(certificateNames(certificate), deviceId) {
+		return nil, fmt.Errorf("%w: certificate does not name device %s", ErrInvalidCertificate, deviceId)
+	}
+	if time.Now().After(certificate.NotAfter) {
+		return nil, fmt.Errorf("%w: certificate expired", ErrInvalidCertificate)
+	}
+
+	registered := &model.DeviceCertificate{
+		Fingerprint: CertificateFingerprint(certificate),
+		DeviceId:    deviceId,
+		Subject:     certificate.Subject.String(),
+		NotAfter:    certificate.NotAfter,
+	}
+	if err := de.certificates.SaveCertificate(ctx, registered); err != nil {
+		return nil, err
+	}
+
+	return registered, nil
+}
+
+func (de *DeviceService) FetchCertificates(ctx context.Context, deviceId string) ([]*model.DeviceCertificate, error) {
+	if de.certificates == nil {
+		return nil, ErrCertificatesDisabled
+	}
+
+	return de.certificates.ListCertificates(ctx, deviceId)
+}
+
+// RevokeCertificate stops a certificate from authenticating its device. It
+// takes effect with the next request.
+func (de *DeviceService) RevokeCertificate(ctx context.Context, deviceId, fingerprint string) error {
+	if de.certificates == nil {
+		return ErrCertificatesDisabled
+	}
+
+	return de.certificates.RevokeCertificate(ctx, deviceId, fingerprint)
+}
+
+// AuthenticateCertificate returns the device a client certificate is
+// registered to. The certificate must have been verified by the TLS
+// handshake; it must still name the device and must not be revoked.
+// Everything else fails with ErrUnauthorized.
+func (de *DeviceService) AuthenticateCertificate(ctx context.Context, certificate *x509.Certificate) (*model.Device, error) {
+	if de.certificates == nil {
+		return nil, ErrUnauthorized
+	}
+
+	registered, err := de.certificates.FindCertificate(ctx, CertificateFingerprint(certificate))
+	if err != nil || registered.RevokedAt != nil || !slices.Contains(certificateNames(certificate), registered.DeviceId) {
+		return nil, ErrUnauthorized
+	}
+
+	device, err := de.repo.FindDeviceById(ctx, registered.DeviceId)
+	if err != nil {
+		return nil, ErrUnauthorized
+	}
+
+	return device, nil
+}
@@ -2,8 +2,13 @@ package service
 
 import (
 	"context"
+	"crypto/subtle"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"iot-platform/internal/model"
 	"iot-platform/internal/repository"
+	"sync"
 	"time"
 )
 
@@ -11,21 +16,63 @@ type deviceService interface {
 	CreateDevice(ctx context.Context, device *model.Device) (string, error)
 	UpdateDevice(ctx context.Context, id string, newDevice *model.Device) error
 	FindDeviceById(ctx context.Context, id string) (*model.Device, error)
-	FetchDevices(ctx context.Context, page int, pageSize int) ([]*model.Device, error)
+	FetchDevices(ctx context.Context, filter model.DeviceFilter, page int, pageSize int) ([]*model.Device, error)
 	DeleteDevice(ctx context.Context, id string) error
+	RestoreDevice(ctx context.Context, id string) (*model.Device, error)
+	ChangeDeviceState(ctx context.Context, id string, state model.DeviceState) (*model.Device, error)
+	RegisterCertificate(ctx context.Context, deviceId string, certificatePEM []byte) (*model.DeviceCertificate, error)
+	FetchCertificates(ctx context.Context, deviceId string) ([]*model.DeviceCertificate, error)
+	RevokeCertificate(ctx context.Context, deviceId, fingerprint string) error
+	AuthenticateCertificate(ctx context.Context, certificate *x509.Certificate) (*model.Device, error)
 }
 
+var (
+	ErrUnauthorized = errors.New("invalid device credentials")
+	// ErrInvalidTransition is returned for a state a device cannot move to
+	// from its current one.
+	ErrInvalidTransition = errors.New("invalid device state transition")
+	// ErrDeviceInactive is returned by DeviceStateValidator for readings of
+	// devices that are suspended, decommissioned, deleted or unknown.
+	ErrDeviceInactive = errors.New("device does not accept readings")
+)
+
 type DeviceService struct {
-	repo repository.DevicesRepository
+	repo         repository.DevicesRepository
+	certificates repository.CertificatesRepository
 }
 
-func NewDevicesService(repo repository.DevicesRepository) *DeviceService {
-	return &DeviceService{
+type DeviceOption func(*DeviceService)
+
+// WithCertificates lets devices register X.509 client certificates and
+// authenticate with them instead of their API key.
+func WithCertificates(certificates repository.CertificatesRepository) DeviceOption {
+	return func(de *DeviceService) {
+		de.certificates = certificates
+	}
+}
+
+func NewDevicesService(repo repository.DevicesRepository, opts ...DeviceOption) *DeviceService {
+	de := &DeviceService{
 		repo: repo,
 	}
+	for _, opt := range opts {
+		opt(de)
+	}
+
+	return de
 }
 
+// CreateDevice creates a device in its State, which must be provisioned or
+// active, or active when it is empty.
 func (de *DeviceService) CreateDevice(ctx context.Context, device *model.Device) (string, error) {
+	switch device.State {
+	case "":
+		device.State = model.DeviceActive
+	case model.DeviceProvisioned, model.DeviceActive:
+	default:
+		return "", fmt.Errorf("%w: devices start out %s or %s", ErrInvalidTransition, model.DeviceProvisioned, model.DeviceActive)
+	}
+
 	deviceId, err := de.repo.SaveDevice(ctx, device)
 	if err != nil {
 		return "", err
@@ -65,8 +112,8 @@ func (de *DeviceService) FindDeviceById(ctx context.Context, id string) (*model.
 	return device, nil
 }
 
-func (de *DeviceService) FetchDevices(ctx context.Context, page int, pageSize int) ([]*model.Device, error) {
-	devices, err := de.repo.ListDevices(ctx, page, pageSize)
+func (de *DeviceService) FetchDevices(ctx context.Context, filter model.DeviceFilter, page int, pageSize int) ([]*model.Device, error) {
+	devices, err := de.repo.ListDevices(ctx, filter, page, pageSize)
 	if err != nil {
 		return nil, err
 	}
@@ -82,3 +129,118 @@ func (de *DeviceService) DeleteDevice(ctx context.Context, id string) error {
 
 	return nil
 }
+
+// RestoreDevice undoes DeleteDevice. The device keeps the state it was
+// deleted in.
+func (de *DeviceService) RestoreDevice(ctx context.Context, id string) (*model.Device, error) {
+	if err := de.repo.RestoreDevice(ctx, id); err != nil {
+		return nil, err
+	}
+
+	return de.repo.FindDeviceById(ctx, id)
+}
+
+// ChangeDeviceState moves a device to state, if its current state allows.
+// Moving to the state it is in already does nothing.
+func (de *DeviceService) ChangeDeviceState(ctx context.Context, id string, state model.DeviceState) (*model.Device, error) {
+	if !state.Valid() {
+		return nil, fmt.Errorf("%w: unknown state %q", ErrInvalidTransition, state)
+	}
+
+	device, err := de.repo.FindDeviceById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if device.State == state {
+		return device, nil
+	}
+	if !device.State.CanTransition(state) {
+		return nil, fmt.Errorf("%w: %s devices cannot become %s", ErrInvalidTransition, device.State, state)
+	}
+
+	err = de.repo.UpdateDeviceState(ctx, id, device.State, state)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("%w: the device changed concurrently", ErrInvalidTransition)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return de.repo.FindDeviceById(ctx, id)
+}
+
+// Authenticate returns the device if apiKey is its API key. Unknown devices
+// and wrong keys fail alike with ErrUnauthorized.
+func (de *DeviceService) Authenticate(ctx context.Context, id string, apiKey string) (*model.Device, error) {
+	device, err := de.repo.FindDeviceById(ctx, id)
+	if err != nil || apiKey == "" || subtle.ConstantTimeCompare([]byte(device.ApiKey), []byte(apiKey)) != 1 {
+		return nil, ErrUnauthorized
+	}
+
+	return device, nil
+}
+
+// deviceStateCacheTTL is how long DeviceStateValidator trusts a device's
+// state. Suspensions and deletions reach ingestion within this delay.
+const deviceStateCacheTTL = 5 * time.Second
+
+type cachedState struct {
+	state   model.DeviceState
+	expires time.Time
+}
+
+// DeviceStateValidator refuses readings of devices that are not in a state
+// accepting them, including deleted and unknown devices.
+type DeviceStateValidator struct {
+	devices repository.DevicesRepository
+
+	mu    sync.Mutex
+	cache map[string]cachedState
+	sweep time.Time
+}
+
+func NewDeviceStateValidator(devices repository.DevicesRepository) *DeviceStateValidator {
+	return &DeviceStateValidator{
+		devices: devices,
+		cache:   make(map[string]cachedState),
+	}
+}
+
+func (v *DeviceStateValidator) ValidateReading(ctx context.Context, sensorData *model.SensorData) error {
+	v.mu.Lock()
+	cached, ok := v.cache[sensorData.DeviceId]
+	v.mu.Unlock()
+
+	if !ok || time.Now().After(cached.expires) {
+		// Deleted and unknown devices are not found and have no state.
+		cached = cachedState{expires: time.Now().Add(deviceStateCacheTTL)}
+		device, err := v.devices.FindDeviceById(ctx, sensorData.DeviceId)
+		switch {
+		case err == nil:
+			cached.state = device.State
+		case !errors.Is(err, repository.ErrNotFound):
+			return err
+		}
+
+		v.mu.Lock()
+		v.cache[sensorData.DeviceId] = cached
+		if now := time.Now(); now.After(v.sweep) {
+			for id, cached := range v.cache {
+				if now.After(cached.expires) {
+					delete(v.cache, id)
+				}
+			}
+			v.sweep = now.Add(deviceStateCacheTTL)
+		}
+		v.mu.Unlock()
+	}
+
+	switch {
+	case cached.state == "":
+		return fmt.Errorf("%w: device %s is unknown or deleted", ErrDeviceInactive, sensorData.DeviceId)
+	case !cached.state.Ingests():
+		return fmt.Errorf("%w: device %s is %s", ErrDeviceInactive, sensorData.DeviceId, cached.state)
+	}
+
+	return nil
+}
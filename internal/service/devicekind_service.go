@@ -0,0 +1,260 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iot-platform/internal/model"
+	"iot-platform/internal/repository"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidDeviceKind = errors.New("invalid device kind")
+	ErrDeviceKindExists  = errors.New("device kind already exists")
+)
+
+// SchemaViolationError is returned by CreateSensorData when a reading does not
+// match the schema of its device's kind and the kind rejects such readings.
+type SchemaViolationError struct {
+	Metric string
+	Reason string
+}
+
+func (e *SchemaViolationError) Error() string {
+	return fmt.Sprintf("metric %s: %s", e.Metric, e.Reason)
+}
+
+type deviceKindService interface {
+	CreateDeviceKind(ctx context.Context, kind *model.DeviceKind) error
+	UpdateDeviceKind(ctx context.Context, name string, kind *model.DeviceKind) error
+	FindDeviceKind(ctx context.Context, name string, version int) (*model.DeviceKind, error)
+	FetchDeviceKinds(ctx context.Context, page int, pageSize int) ([]*model.DeviceKind, error)
+	FetchDeviceKindVersions(ctx context.Context, name string) ([]*model.DeviceKind, error)
+	DeleteDeviceKind(ctx context.Context, name string) error
+}
+
+type DeviceKindService struct {
+	repo repository.DeviceKindsRepository
+}
+
+func NewDeviceKindService(repo repository.DeviceKindsRepository) *DeviceKindService {
+	return &DeviceKindService{
+		repo: repo,
+	}
+}
+
+func (de *DeviceKindService) CreateDeviceKind(ctx context.Context, kind *model.DeviceKind) error {
+	if err := normalizeDeviceKind(kind); err != nil {
+		return err
+	}
+
+	_, err := de.repo.FindDeviceKind(ctx, kind.Name, 0)
+	if err == nil {
+		return ErrDeviceKindExists
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+
+	return de.repo.SaveDeviceKind(ctx, kind)
+}
+
+// UpdateDeviceKind stores kind as a new version of an existing kind.
+func (de *DeviceKindService) UpdateDeviceKind(ctx context.Context, name string, kind *model.DeviceKind) error {
+	kind.Name = name
+	if err := normalizeDeviceKind(kind); err != nil {
+		return err
+	}
+
+	if _, err := de.repo.FindDeviceKind(ctx, name, 0); err != nil {
+		return err
+	}
+
+	return de.repo.SaveDeviceKind(ctx, kind)
+}
+
+func (de *DeviceKindService) FindDeviceKind(ctx context.Context, name string, version int) (*model.DeviceKind, error) {
+	return de.repo.FindDeviceKind(ctx, name, version)
+}
+
+func (de *DeviceKindService) FetchDeviceKinds(ctx context.Context, page int, pageSize int) ([]*model.DeviceKind, error) {
+	return de.repo.ListDeviceKinds(ctx, page, pageSize)
+}
+
+func (de *DeviceKindService) FetchDeviceKindVersions(ctx context.Context, name string) ([]*model.DeviceKind, error) {
+	return de.repo.ListDeviceKindVersions(ctx, name)
+}
+
+func (de *DeviceKindService) DeleteDeviceKind(ctx context.Context, name string) error {
+	return de.repo.DeleteDeviceKind(ctx, name)
+}
+
+// normalizeDeviceKind fills in defaults and rejects inconsistent schemas.
+func normalizeDeviceKind(kind *model.DeviceKind) error {
+	if kind.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidDeviceKind)
+	}
+	if kind.ReportingIntervalSeconds < 0 {
+		return fmt.Errorf("%w: reportingIntervalSeconds must not be negative", ErrInvalidDeviceKind)
+	}
+
+	switch kind.Enforcement {
+	case "":
+		kind.Enforcement = model.EnforceReject
+	case model.EnforceReject, model.EnforceFlag:
+	default:
+		return fmt.Errorf("%w: unknown enforcement %q", ErrInvalidDeviceKind, kind.Enforcement)
+	}
+
+	seen := make(map[string]bool)
+	for i := range kind.Metrics {
+		metric := &kind.Metrics[i]
+		if metric.Name == "" || seen[metric.Name] {
+			return fmt.Errorf("%w: metric names must be unique and not empty", ErrInvalidDeviceKind)
+		}
+		seen[metric.Name] = true
+
+		if metric.ValueType == "" {
+			metric.ValueType = model.ValueNumber
+		}
+		if !metric.ValueType.Valid() {
+			return fmt.Errorf("%w: metric %s has unknown value type %q", ErrInvalidDeviceKind, metric.Name, metric.ValueType)
+		}
+		if (metric.Min != nil || metric.Max != nil) && metric.ValueType != model.ValueNumber {
+			return fmt.Errorf("%w: metric %s has a range but is not a number", ErrInvalidDeviceKind, metric.Name)
+		}
+		if metric.Min != nil && metric.Max != nil && *metric.Min > *metric.Max {
+			return fmt.Errorf("%w: metric %s has min greater than max", ErrInvalidDeviceKind, metric.Name)
+		}
+	}
+
+	return nil
+}
+
+// schemaCacheTTL is how long the validator trusts a device's kind. Schema
+// changes reach ingestion within this delay.
+const schemaCacheTTL = 30 * time.Second
+
+type cachedKind struct {
+	kind    *model.DeviceKind
+	expires time.Time
+}
+
+// SchemaValidator checks readings against the latest schema of their
+// device's kind. Devices whose kind is not registered are not validated.
+type SchemaValidator struct {
+	devices repository.DevicesRepository
+	kinds   repository.DeviceKindsRepository
+
+	mu    sync.Mutex
+	cache map[string]cachedKind
+	sweep time.Time
+}
+
+func NewSchemaValidator(devices repository.DevicesRepository, kinds repository.DeviceKindsRepository) *SchemaValidator {
+	return &SchemaValidator{
+		devices: devices,
+		kinds:   kinds,
+		cache:   make(map[string]cachedKind),
+	}
+}
+
+func (v *SchemaValidator) ValidateReading(ctx context.Context, sensorData *model.SensorData) error {
+	kind, err := v.kindOf(ctx, sensorData.DeviceId)
+	if err != nil || kind == nil {
+		return err
+	}
+
+	metric := kind.Metric(sensorData.MetricName)
+	if metric != nil && sensorData.Unit == "" && sensorData.ValueType.Numeric() {
+		// Readings without a unit are in the unit their kind declares.
+		sensorData.Unit = metric.Unit
+	}
+
+	reason := checkSchema(kind, sensorData)
+	if reason == "" {
+		return nil
+	}
+
+	if kind.Enforcement == model.EnforceFlag {
+		sensorData.Violation = reason
+		return nil
+	}
+
+	return &SchemaViolationError{Metric: sensorData.MetricName, Reason: reason}
+}
+
+func (v *SchemaValidator) kindOf(ctx context.Context, deviceId string) (*model.DeviceKind, error) {
+	v.mu.Lock()
+	cached, ok := v.cache[deviceId]
+	v.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.kind, nil
+	}
+
+	var kind *model.DeviceKind
+	device, err := v.devices.FindDeviceById(ctx, deviceId)
+	if err == nil {
+		kind, err = v.kinds.FindDeviceKind(ctx, device.Kind, 0)
+		if errors.Is(err, repository.ErrNotFound) {
+			kind, err = nil, nil
+		}
+	} else {
+		// Unknown devices are left for the repository to refuse.
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	v.mu.Lock()
+	v.cache[deviceId] = cachedKind{kind: kind, expires: now.Add(schemaCacheTTL)}
+	if now.After(v.sweep) {
+		for id, cached := range v.cache {
+			if now.After(cached.expires) {
+				delete(v.cache, id)
+			}
+		}
+		v.sweep = now.Add(schemaCacheTTL)
+	}
+	v.mu.Unlock()
+
+	return kind, nil
+}
+
+func checkSchema(kind *model.DeviceKind, sensorData *model.SensorData) string {
+	metric := kind.Metric(sensorData.MetricName)
+	if metric == nil {
+		return fmt.Sprintf("not defined by kind %s", kind.Name)
+	}
+
+	valueType := sensorData.ValueType
+	if valueType == "" {
+		valueType = model.ValueNumber
+	}
+	if valueType != metric.ValueType {
+		return fmt.Sprintf("expected a %s value, got %s", metric.ValueType, valueType)
+	}
+
+	// Min and Max are in the unit of the schema.
+	value := sensorData.MetricValue
+	if metric.Unit != "" && sensorData.Unit != metric.Unit {
+		converted, err := model.ConvertUnit(value, sensorData.Unit, metric.Unit)
+		if err != nil {
+			return fmt.Sprintf("unit %s is not compatible with %s", sensorData.Unit, metric.Unit)
+		}
+		value = converted
+	}
+
+	if metric.Min != nil && value < *metric.Min {
+		return fmt.Sprintf("value %g is below the minimum %g", value, *metric.Min)
+	}
+	if metric.Max != nil && value > *metric.Max {
+		return fmt.Sprintf("value %g is above the maximum %g", value, *metric.Max)
+	}
+
+	return ""
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iot-platform/internal/model"
+	"iot-platform/internal/ratelimit"
+	"iot-platform/internal/repository"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned for readings past their device's rate limit.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// ingestLimitsCacheTTL is how long IngestLimits trusts a device's kind and
+// the tenants of devices. Devices moved elsewhere get their new limits within
+// this delay.
+const ingestLimitsCacheTTL = time.Minute
+
+// LimitError refuses a reading past a rate limit or quota. Limit is the
+// burst or quota, Remaining what is left of it and Reset how long until it
+// is whole again. RetryAfter is how long until a reading may get through.
+type LimitError struct {
+	Err        error
+	Limit      int64
+	Remaining  int64
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// DeviceRates are the rate limits of devices, in readings per second, by
+// device kind. Kinds without a rate of their own get Default.
+type DeviceRates struct {
+	Default ratelimit.Rate
+	Kinds   map[string]ratelimit.Rate
+}
+
+func (r DeviceRates) For(kind string) ratelimit.Rate {
+	if rate, ok := r.Kinds[kind]; ok {
+		return rate
+	}
+	return r.Default
+}
+
+// TenantQuotas are how many readings tenants may ingest per UTC day, by
+// tenant. Tenants without a quota of their own get Default, and a quota of 0
+// is unlimited.
+type TenantQuotas struct {
+	Default int64
+	Tenants map[string]int64
+}
+
+func (q TenantQuotas) For(tenantId string) int64 {
+	if quota, ok := q.Tenants[tenantId]; ok {
+		return quota
+	}
+	return q.Default
+}
+
+// Tenants maps devices to the tenant they belong to, such as AssetService.
+type Tenants interface {
+	DeviceTenants(ctx context.Context) (map[string]string, error)
+}
+
+type cachedDeviceKind struct {
+	kind    string
+	expires time.Time
+}
+
+// IngestLimits limits the readings of each device to the rate of its kind,
+// and the readings of each tenant to its daily quota. Usage is counted for
+// every tenant, quota or not, so that it can be inspected. Devices belonging
+// to no tenant only have a rate limit.
+type IngestLimits struct {
+	devices repository.DevicesRepository
+	tenants Tenants
+	usage   repository.UsageRepository
+	limiter *ratelimit.Limiter
+	rates   DeviceRates
+	quotas  TenantQuotas
+
+	mu             sync.Mutex
+	kinds          map[string]cachedDeviceKind
+	tenantOf       map[string]string
+	tenantsExpires time.Time
+}
+
+func NewIngestLimits(devices repository.DevicesRepository, tenants Tenants, usage repository.UsageRepository, limiter *ratelimit.Limiter, rates DeviceRates, quotas TenantQuotas) *IngestLimits {
+	return &IngestLimits{
+		devices: devices,
+		tenants: tenants,
+		usage:   usage,
+		limiter: limiter,
+		rates:   rates,
+		quotas:  quotas,
+		kinds:   make(map[string]cachedDeviceKind),
+	}
+}
+
+// Admit takes the readings of each device out of its bucket, then counts
+// the ones left against the quota of their tenant. A device with more
+// readings than tokens gets its earliest readings through; a tenant whose
+// quota cannot hold all of its readings gets none through. Admitted readings
+// that are not stored must be given back with Refund.
+func (l *IngestLimits) Admit(ctx context.Context, sensorDataList []*model.SensorData) (*Admission, error) {
+	refused := make([]error, len(sensorDataList))
+	now := time.Now()
+	day := now.UTC().Format(time.DateOnly)
+
+	var deviceIds []string
+	byDevice := make(map[string][]int)
+	for i, sensorData := range sensorDataList {
+		if _, ok := byDevice[sensorData.DeviceId]; !ok {
+			deviceIds = append(deviceIds, sensorData.DeviceId)
+		}
+		byDevice[sensorData.DeviceId] = append(byDevice[sensorData.DeviceId], i)
+	}
+
+	tenantOf, err := l.deviceTenants(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var tenantIds []string
+	byTenant := make(map[string][]int)
+	for _, deviceId := range deviceIds {
+		indexes := byDevice[deviceId]
+		kind, err := l.deviceKind(ctx, deviceId, now)
+		if err != nil {
+			return nil, err
+		}
+
+		decision := l.limiter.Take(deviceId, l.rates.For(kind), len(indexes))
+		if decision.Limited > 0 {
+			limitErr := &LimitError{
+				Err:        fmt.Errorf("%w for device %s", ErrRateLimited, deviceId),
+				Limit:      int64(decision.Limit),
+				Remaining:  int64(decision.Remaining),
+				Reset:      decision.Reset,
+				RetryAfter: decision.RetryAfter,
+			}
+			for _, i := range indexes[decision.Taken:] {
+				refused[i] = limitErr
+			}
+			indexes = indexes[:decision.Taken]
+		}
+
+		tenantId := tenantOf[deviceId]
+		if tenantId == "" || len(indexes) == 0 {
+			continue
+		}
+		if _, ok := byTenant[tenantId]; !ok {
+			tenantIds = append(tenantIds, tenantId)
+		}
+		byTenant[tenantId] = append(byTenant[tenantId], indexes...)
+	}
+
+	for _, tenantId := range tenantIds {
+		indexes := byTenant[tenantId]
+		quota := l.quotas.For(tenantId)
+		limit := quota
+		if limit <= 0 {
+			limit = math.MaxInt64
+		}
+
+		usage, err := l.usage.AddUsage(ctx, tenantId, day, int64(len(indexes)), limit)
+		if errors.Is(err, repository.ErrQuotaExceeded) {
+			untilTomorrow := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now)
+			limitErr := &LimitError{
+				Err:        fmt.Errorf("%w for tenant %s", repository.ErrQuotaExceeded, tenantId),
+				Limit:      quota,
+				Remaining:  max(quota-usage, 0),
+				Reset:      untilTomorrow,
+				RetryAfter: untilTomorrow,
+			}
+			for _, i := range indexes {
+				refused[i] = limitErr
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Admission{Refused: refused, Day: day}, nil
+}
+
+// Refund takes readings Admit counted but that were not stored, such as
+// duplicates of readings stored before, back off their tenant's usage on the
+// day of their admission. Device tokens are not given back: the readings
+// were still sent.
+func (l *IngestLimits) Refund(ctx context.Context, admission *Admission, sensorDataList []*model.SensorData) error {
+	tenantOf, err := l.deviceTenants(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var tenantIds []string
+	readings := make(map[string]int64)
+	for _, sensorData := range sensorDataList {
+		tenantId := tenantOf[sensorData.DeviceId]
+		if tenantId == "" {
+			continue
+		}
+		if _, ok := readings[tenantId]; !ok {
+			tenantIds = append(tenantIds, tenantId)
+		}
+		readings[tenantId]++
+	}
+
+	for _, tenantId := range tenantIds {
+		if err := l.usage.RefundUsage(ctx, tenantId, admission.Day, readings[tenantId]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Usage returns how many readings every tenant ingested today, along with
+// its quota.
+func (l *IngestLimits) Usage(ctx context.Context) ([]*model.TenantUsage, error) {
+	usages, err := l.usage.ListUsage(ctx, time.Now().UTC().Format(time.DateOnly))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, usage := range usages {
+		usage.Quota = l.quotas.For(usage.TenantId)
+	}
+
+	return usages, nil
+}
+
+// DeviceStats returns the rate limit counters of devices.
+func (l *IngestLimits) DeviceStats() ratelimit.Stats {
+	return l.limiter.Stats()
+}
+
+// deviceKind returns the kind of a device, or "" for unknown devices, which
+// get the default rate.
+func (l *IngestLimits) deviceKind(ctx context.Context, deviceId string, now time.Time) (string, error) {
+	l.mu.Lock()
+	cached, ok := l.kinds[deviceId]
+	l.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.kind, nil
+	}
+
+	cached = cachedDeviceKind{expires: now.Add(ingestLimitsCacheTTL)}
+	device, err := l.devices.FindDeviceById(ctx, deviceId)
+	switch {
+	case err == nil:
+		cached.kind = device.Kind
+	case !errors.Is(err, repository.ErrNotFound):
+		return "", err
+	}
+
+	l.mu.Lock()
+	l.kinds[deviceId] = cached
+	l.mu.Unlock()
+
+	return cached.kind, nil
+}
+
+func (l *IngestLimits) deviceTenants(ctx context.Context, now time.Time) (map[string]string, error) {
+	l.mu.Lock()
+	tenantOf, expires := l.tenantOf, l.tenantsExpires
+	l.mu.Unlock()
+	if tenantOf != nil && now.Before(expires) {
+		return tenantOf, nil
+	}
+
+	tenantOf, err := l.tenants.DeviceTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	l.tenantOf, l.tenantsExpires = tenantOf, now.Add(ingestLimitsCacheTTL)
+	l.mu.Unlock()
+
+	return tenantOf, nil
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"iot-platform/internal/model"
+	"iot-platform/internal/repository"
+	"log"
+	"time"
+)
+
+var ErrInvalidProvisioning = errors.New("invalid provisioning request")
+
+type provisioningService interface {
+	CreateEnrollmentToken(ctx context.Context, token *model.EnrollmentToken) (string, error)
+	FindEnrollmentToken(ctx context.Context, id string) (*model.EnrollmentToken, error)
+	FetchEnrollmentTokens(ctx context.Context) ([]*model.EnrollmentToken, error)
+	RevokeEnrollmentToken(ctx context.Context, id string) error
+	ProvisionDevice(ctx context.Context, secret, serial, name, remoteAddr string) (*model.Device, error)
+	FetchProvisioningEvents(ctx context.Context, tokenId string, limit int) ([]*model.ProvisioningEvent, error)
+}
+
+// ProvisioningService lets devices register themselves with enrollment
+// tokens handed out by operators, instead of being created one by one.
+type ProvisioningService struct {
+	repo   repository.ProvisioningRepository
+	assets repository.AssetsRepository
+}
+
+func NewProvisioningService(repo repository.ProvisioningRepository, assets repository.AssetsRepository) *ProvisioningService {
+	return &ProvisioningService{
+		repo:   repo,
+		assets: assets,
+	}
+}
+
+// CreateEnrollmentToken stores token, usable once unless MaxUses says
+// otherwise, and returns the secret devices provision with. The secret is not
+// stored and cannot be retrieved later.
+func (ps *ProvisioningService) CreateEnrollmentToken(ctx context.Context, token *model.EnrollmentToken) (string, error) {
+	if token.Kind == "" {
+		return "", fmt.Errorf("%w: kind is required", ErrInvalidProvisioning)
+	}
+	if token.MaxUses < 0 {
+		return "", fmt.Errorf("%w: maxUses must be positive", ErrInvalidProvisioning)
+	}
+	if token.MaxUses == 0 {
+		token.MaxUses = 1
+	}
+	if token.ExpiresAt != nil && !token.ExpiresAt.After(time.Now()) {
+		return "", fmt.Errorf("%w: expiresAt is in the past", ErrInvalidProvisioning)
+	}
+	if token.AssetId != "" {
+		_, err := ps.assets.FindAsset(ctx, token.AssetId)
+		if errors.Is(err, repository.ErrNotFound) {
+			return "", fmt.Errorf("%w: asset %s not found", ErrInvalidProvisioning, token.AssetId)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return "", err
+	}
+	token.TokenHash = hashSecret(secret)
+	token.Uses = 0
+	token.RevokedAt = nil
+	if err := ps.repo.SaveEnrollmentToken(ctx, token); err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+func (ps *ProvisioningService) FindEnrollmentToken(ctx context.Context, id string) (*model.EnrollmentToken, error) {
+	return ps.repo.FindEnrollmentToken(ctx, id)
+}
+
+func (ps *ProvisioningService) FetchEnrollmentTokens(ctx context.Context) ([]*model.EnrollmentToken, error) {
+	return ps.repo.ListEnrollmentTokens(ctx)
+}
+
+func (ps *ProvisioningService) RevokeEnrollmentToken(ctx context.Context, id string) error {
+	return ps.repo.RevokeEnrollmentToken(ctx, id)
+}
+
+// ProvisionDevice registers the device with the given hardware serial, named
+// after it unless name is set, and returns it with a freshly generated API
+// key. Every attempt is audited, failed ones included.
+func (ps *ProvisioningService) ProvisionDevice(ctx context.Context, secret, serial, name, remoteAddr string) (*model.Device, error) {
+	if serial == "" {
+		return nil, fmt.Errorf("%w: serial is required", ErrInvalidProvisioning)
+	}
+	if name == "" {
+		name = serial
+	}
+
+	apiKey, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	device := &model.Device{Name: name, ApiKey: apiKey, Serial: serial}
+	tokenId, err := ps.repo.ProvisionDevice(ctx, hashSecret(secret), device)
+
+	event := &model.ProvisioningEvent{TokenId: tokenId, Serial: serial, DeviceId: device.Id, RemoteAddr: remoteAddr}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	// The device exists by now; failing the request would only make it
+	// retry with a serial that is taken.
+	if auditErr := ps.repo.SaveProvisioningEvent(context.WithoutCancel(ctx), event); auditErr != nil {
+		log.Printf("failed to audit provisioning of %s: %v", serial, auditErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return device, nil
+}
+
+// FetchProvisioningEvents returns the newest provisioning attempts with a
+// token, or with any token when tokenId is empty.
+func (ps *ProvisioningService) FetchProvisioningEvents(ctx context.Context, tokenId string, limit int) ([]*model.ProvisioningEvent, error) {
+	return ps.repo.ListProvisioningEvents(ctx, tokenId, limit)
+}
+
+func newSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(secret), nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
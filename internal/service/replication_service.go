@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"iot-platform/internal/model"
+	"iot-platform/internal/repository"
+)
+
+// ErrReplicationGap means a source pushed changes that do not follow the last
+// sequence applied for it.
+var ErrReplicationGap = errors.New("replication gap")
+
+type replicationService interface {
+	ReceiveChanges(ctx context.Context, sourceId string, afterSeq int64, changes []*model.Change) (int64, error)
+}
+
+type ReplicationService struct {
+	repo repository.ReplicationRepository
+}
+
+func NewReplicationService(repo repository.ReplicationRepository) *ReplicationService {
+	return &ReplicationService{
+		repo: repo,
+	}
+}
+
+// ReceiveChanges applies a batch pushed by an edge instance. Changes that were
+// already applied are skipped, so a source may safely resend after a lost
+// acknowledgement. It returns the last applied sequence for the source, which
+// is also returned alongside ErrReplicationGap so the source can rewind.
+func (re *ReplicationService) ReceiveChanges(ctx context.Context, sourceId string, afterSeq int64, changes []*model.Change) (int64, error) {
+	applied, err := re.repo.FindAppliedSeq(ctx, sourceId)
+	if err != nil {
+		return 0, err
+	}
+
+	if applied < afterSeq {
+		return applied, ErrReplicationGap
+	}
+
+	return re.repo.ApplyChanges(ctx, sourceId, changes)
+}
@@ -2,37 +2,312 @@ package service
 
 import (
 	"context"
+	"errors"
 	"iot-platform/internal/model"
 	"iot-platform/internal/repository"
+	"log"
+	"slices"
+	"time"
 )
 
 type sensorDataService interface {
 	CreateSensorData(ctx context.Context, sensorData *model.SensorData) error
+	IngestSensorData(ctx context.Context, sensorDataList []*model.SensorData) (*IngestResult, error)
 	FindSensorDataById(ctx context.Context, id int64) (*model.SensorData, error)
 	FindSensorDataByDeviceId(ctx context.Context, deviceId string) ([]*model.SensorData, error)
 	FetchSensorData(ctx context.Context, page int, pageSize int) ([]*model.SensorData, error)
 	DeleteSensorData(ctx context.Context, id int64) error
+	QuerySensorData(ctx context.Context, q model.SensorDataQuery) ([]*model.SensorData, error)
+	AggregateSensorData(ctx context.Context, q model.SensorDataQuery, fn model.AggregateFunc) (*model.Aggregate, error)
+	LatestSensorData(ctx context.Context, deviceId string) ([]*model.SensorData, error)
+	FleetSnapshot(ctx context.Context, metricName string, labels map[string]string) ([]*model.SensorData, error)
+}
+
+// MaxQueryLimit bounds the number of readings a single query returns.
+const MaxQueryLimit = 10000
+
+var (
+	ErrUnknownAggregate = errors.New("unknown aggregate function")
+	// ErrNotNumeric is returned when aggregating a non-numeric value type.
+	ErrNotNumeric = errors.New("only numeric values can be aggregated")
+	// ErrNoAssets is returned for queries scoped to an asset when the
+	// service has no AssetScope.
+	ErrNoAssets = errors.New("asset scoped queries are not supported")
+)
+
+// IngestResult counts what happened to the readings of one ingest request.
+// Deduplicated readings were already stored under the same message id and
+// are acknowledged without being stored again. Flagged readings were stored
+// despite violating their device kind's schema; Rejected ones were not, or
+// came from a device that does not accept readings.
+type IngestResult struct {
+	Accepted     int
+	Deduplicated int
+	Flagged      int
+	Rejected     []RejectedReading
+}
+
+// RejectedReading is a reading refused by validation. Index points into the
+// list passed to IngestSensorData.
+type RejectedReading struct {
+	Index int
+	Err   error
+}
+
+// ReadingValidator checks a reading before it is stored. It may annotate the
+// reading, or return an error to refuse it.
+type ReadingValidator interface {
+	ValidateReading(ctx context.Context, sensorData *model.SensorData) error
+}
+
+// Publisher is told about every reading once it is stored.
+type Publisher interface {
+	Publish(sensorData *model.SensorData)
+}
+
+// Archive holds readings moved out of the repository, such as
+// archive.Archive. It is queried with the same storage-unit bounds as the
+// repository.
+type Archive interface {
+	// Horizon returns the newest archived timestamp, or the zero time when
+	// nothing is archived.
+	Horizon() time.Time
+	QuerySensorData(ctx context.Context, q model.SensorDataQuery) ([]*model.SensorData, error)
+}
+
+// Cache holds recent readings in memory, such as hotcache.Cache. It is
+// told about every reading stored or deleted through the service.
+type Cache interface {
+	Add(sensorData *model.SensorData)
+	Remove(sensorData *model.SensorData)
+	// QuerySensorData reports false when the cache may not hold every
+	// reading matched by q.
+	QuerySensorData(q model.SensorDataQuery) ([]*model.SensorData, bool)
+}
+
+// Limiter admits the readings of an ingest request that passed validation,
+// such as IngestLimits. Admitted readings that are not stored, such as
+// duplicates, are refunded along with their admission.
+type Limiter interface {
+	Admit(ctx context.Context, sensorDataList []*model.SensorData) (*Admission, error)
+	Refund(ctx context.Context, admission *Admission, sensorDataList []*model.SensorData) error
+}
+
+// Admission is what a Limiter decided for a list of readings. Refused holds
+// a LimitError for each reading refused and nil for the others.
+type Admission struct {
+	Refused []error
+	// Day is the UTC day admitted readings were counted against their
+	// tenant's quota.
+	Day string
+}
+
+// AssetScope resolves an asset into the devices attached to it or anywhere
+// below it, such as AssetService.
+type AssetScope interface {
+	SubtreeDeviceIds(ctx context.Context, id string) ([]string, error)
 }
 
 type SensorDataService struct {
-	repo repository.SensorDataRepository
+	repo       repository.SensorDataRepository
+	validators []ReadingValidator
+	limiter    Limiter
+	publisher  Publisher
+	archive    Archive
+	cache      Cache
+	assets     AssetScope
+}
+
+type SensorDataOption func(*SensorDataService)
+
+// WithReadingValidator validates every reading passed to CreateSensorData.
+// Validators run in the order they are given.
+func WithReadingValidator(validator ReadingValidator) SensorDataOption {
+	return func(se *SensorDataService) {
+		se.validators = append(se.validators, validator)
+	}
 }
 
-func NewSensorDataService(repo repository.SensorDataRepository) *SensorDataService {
-	return &SensorDataService{
+// WithLimiter refuses readings past the limits of limiter. Readings are
+// only counted against the limits once they pass validation.
+func WithLimiter(limiter Limiter) SensorDataOption {
+	return func(se *SensorDataService) {
+		se.limiter = limiter
+	}
+}
+
+// WithPublisher publishes every reading stored by CreateSensorData.
+func WithPublisher(publisher Publisher) SensorDataOption {
+	return func(se *SensorDataService) {
+		se.publisher = publisher
+	}
+}
+
+// WithArchive answers queries and aggregates reaching back past the
+// archive's horizon from both the repository and the archive.
+func WithArchive(archive Archive) SensorDataOption {
+	return func(se *SensorDataService) {
+		se.archive = archive
+	}
+}
+
+// WithCache answers queries the cache holds every reading for from the
+// cache, and keeps it up to date.
+func WithCache(cache Cache) SensorDataOption {
+	return func(se *SensorDataService) {
+		se.cache = cache
+	}
+}
+
+// WithAssetScope lets queries and aggregates be scoped to an asset subtree.
+func WithAssetScope(assets AssetScope) SensorDataOption {
+	return func(se *SensorDataService) {
+		se.assets = assets
+	}
+}
+
+func NewSensorDataService(repo repository.SensorDataRepository, opts ...SensorDataOption) *SensorDataService {
+	se := &SensorDataService{
 		repo: repo,
 	}
+	for _, opt := range opts {
+		opt(se)
+	}
+
+	return se
 }
 
 func (se *SensorDataService) CreateSensorData(ctx context.Context, sensorData *model.SensorData) error {
+	if err := se.validate(ctx, sensorData); err != nil {
+		return err
+	}
+	var admission *Admission
+	if se.limiter != nil {
+		var err error
+		admission, err = se.limiter.Admit(ctx, []*model.SensorData{sensorData})
+		if err != nil {
+			return err
+		}
+		if admission.Refused[0] != nil {
+			return admission.Refused[0]
+		}
+	}
+
+	err := se.store(ctx, sensorData)
+	if err != nil {
+		se.refund(ctx, admission, []*model.SensorData{sensorData})
+	}
+
+	return err
+}
+
+// refund gives the limiter back what it took for admitted readings that were
+// not stored. A failed refund only costs the tenant some of its quota, so it
+// does not fail the ingest.
+func (se *SensorDataService) refund(ctx context.Context, admission *Admission, sensorDataList []*model.SensorData) {
+	if se.limiter == nil || len(sensorDataList) == 0 {
+		return
+	}
+	if err := se.limiter.Refund(ctx, admission, sensorDataList); err != nil {
+		log.Printf("failed to refund the limits of %d readings: %v", len(sensorDataList), err)
+	}
+}
+
+func (se *SensorDataService) validate(ctx context.Context, sensorData *model.SensorData) error {
+	for _, validator := range se.validators {
+		if err := validator.ValidateReading(ctx, sensorData); err != nil {
+			return err
+		}
+	}
+	sensorData.NormalizeUnit()
+
+	return nil
+}
+
+func (se *SensorDataService) store(ctx context.Context, sensorData *model.SensorData) error {
 	err := se.repo.SaveSensorData(ctx, sensorData)
 	if err != nil {
 		return err
 	}
 
+	if se.cache != nil {
+		se.cache.Add(sensorData)
+	}
+	if se.publisher != nil {
+		published := *sensorData
+		se.publisher.Publish(&published)
+	}
+
 	return nil
 }
 
+// IngestSensorData stores readings in order. Readings failing schema
+// validation or refused by the limiter are skipped and listed in the result;
+// any other error stops the ingest, and the result reflects the readings
+// handled before it.
+func (se *SensorDataService) IngestSensorData(ctx context.Context, sensorDataList []*model.SensorData) (*IngestResult, error) {
+	result := &IngestResult{}
+	var valid []*model.SensorData
+	var validIndexes []int
+	for i, sensorData := range sensorDataList {
+		err := se.validate(ctx, sensorData)
+		var violation *SchemaViolationError
+		if errors.As(err, &violation) || errors.Is(err, ErrDeviceInactive) {
+			result.Rejected = append(result.Rejected, RejectedReading{Index: i, Err: err})
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		valid = append(valid, sensorData)
+		validIndexes = append(validIndexes, i)
+	}
+
+	admission := &Admission{Refused: make([]error, len(valid))}
+	if se.limiter != nil && len(valid) > 0 {
+		var err error
+		admission, err = se.limiter.Admit(ctx, valid)
+		if err != nil {
+			return result, err
+		}
+	}
+	refused := admission.Refused
+
+	var unstored []*model.SensorData
+	for i, sensorData := range valid {
+		if refused[i] != nil {
+			result.Rejected = append(result.Rejected, RejectedReading{Index: validIndexes[i], Err: refused[i]})
+			continue
+		}
+
+		err := se.store(ctx, sensorData)
+		if errors.Is(err, repository.ErrDuplicateMessage) {
+			result.Deduplicated++
+			unstored = append(unstored, sensorData)
+			continue
+		}
+		if err != nil {
+			for j := i; j < len(valid); j++ {
+				if refused[j] == nil {
+					unstored = append(unstored, valid[j])
+				}
+			}
+			se.refund(ctx, admission, unstored)
+			return result, err
+		}
+		result.Accepted++
+		if sensorData.Violation != "" {
+			result.Flagged++
+		}
+	}
+	se.refund(ctx, admission, unstored)
+	slices.SortFunc(result.Rejected, func(a, b RejectedReading) int {
+		return a.Index - b.Index
+	})
+
+	return result, nil
+}
+
 func (se *SensorDataService) FindSensorDataById(ctx context.Context, id int64) (*model.SensorData, error) {
 	sensorData, err := se.repo.FindSensorDataById(ctx, id)
 	if err != nil {
@@ -61,11 +336,385 @@ func (se *SensorDataService) FetchSensorData(ctx context.Context, page int, page
 }
 
 func (se *SensorDataService) DeleteSensorData(ctx context.Context, id int64) error {
+	var deleted *model.SensorData
+	if se.cache != nil {
+		// The cache finds readings by series and time, not id.
+		deleted, _ = se.repo.FindSensorDataById(ctx, id)
+	}
+
 	err := se.repo.DeleteSensorData(ctx, id)
 	if err != nil {
 		return err
 	}
 
+	if deleted != nil {
+		se.cache.Remove(deleted)
+	}
+
 	return nil
 }
 
+// QuerySensorData returns the readings matched by q in time order, at most
+// MaxQueryLimit of them. With q.Unit set, values are converted into it.
+func (se *SensorDataService) QuerySensorData(ctx context.Context, q model.SensorDataQuery) ([]*model.SensorData, error) {
+	if q.Limit <= 0 || q.Limit > MaxQueryLimit {
+		q.Limit = MaxQueryLimit
+	}
+	boundsToStorageUnit(&q)
+
+	if ok, err := se.scope(ctx, &q); !ok || err != nil {
+		return nil, err
+	}
+
+	sensorDataList, err := se.query(ctx, q)
+	if err != nil || q.Unit == "" {
+		return sensorDataList, err
+	}
+
+	for _, sensorData := range sensorDataList {
+		sensorData.MetricValue = fromStorageUnit(sensorData.MetricValue, q.Unit)
+		sensorData.Unit = q.Unit
+	}
+
+	return sensorDataList, nil
+}
+
+// LatestSensorData returns the newest reading of every metric of a device,
+// ordered by metric name.
+func (se *SensorDataService) LatestSensorData(ctx context.Context, deviceId string) ([]*model.SensorData, error) {
+	return se.repo.ListLatestSensorData(ctx, deviceId, "")
+}
+
+// FleetSnapshot returns the newest reading of metricName of every device
+// carrying all of labels, ordered by device id.
+func (se *SensorDataService) FleetSnapshot(ctx context.Context, metricName string, labels map[string]string) ([]*model.SensorData, error) {
+	sensorDataList, err := se.repo.ListLatestSensorData(ctx, "", metricName)
+	if err != nil || len(labels) == 0 {
+		return sensorDataList, err
+	}
+
+	matched := sensorDataList[:0]
+	for _, sensorData := range sensorDataList {
+		if hasLabels(sensorData, labels) {
+			matched = append(matched, sensorData)
+		}
+	}
+
+	return matched, nil
+}
+
+func hasLabels(sensorData *model.SensorData, labels map[string]string) bool {
+	for key, value := range labels {
+		if got, ok := sensorData.Labels[key]; !ok || got != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// exportPageSize is how many readings ExportSensorData reads at a time.
+const exportPageSize = 1000
+
+// ExportSensorData passes the readings matched by q to fn in time order,
+// a page at a time, so that exports of any size use bounded memory and do
+// not hold a database connection between pages. q.Limit, when set, bounds
+// the total.
+func (se *SensorDataService) ExportSensorData(ctx context.Context, q model.SensorDataQuery, fn func([]*model.SensorData) error) error {
+	if ok, err := se.scope(ctx, &q); !ok || err != nil {
+		return err
+	}
+
+	remaining := q.Limit
+	for {
+		page := q
+		page.Limit = exportPageSize
+		if remaining > 0 && remaining < exportPageSize {
+			page.Limit = remaining
+		}
+		boundsToStorageUnit(&page)
+
+		sensorDataList, err := se.query(ctx, page)
+		if err != nil {
+			return err
+		}
+		if len(sensorDataList) == 0 {
+			return nil
+		}
+
+		if q.Unit != "" {
+			for _, sensorData := range sensorDataList {
+				sensorData.MetricValue = fromStorageUnit(sensorData.MetricValue, q.Unit)
+				sensorData.Unit = q.Unit
+			}
+		}
+		if err := fn(sensorDataList); err != nil {
+			return err
+		}
+
+		if remaining > 0 {
+			remaining -= len(sensorDataList)
+			if remaining == 0 {
+				return nil
+			}
+		}
+		if len(sensorDataList) < page.Limit {
+			return nil
+		}
+		last := sensorDataList[len(sensorDataList)-1]
+		q.After = &model.SensorDataCursor{Timestamp: last.Timestamp, Id: last.Id}
+		q.Offset = 0
+	}
+}
+
+func (se *SensorDataService) AggregateSensorData(ctx context.Context, q model.SensorDataQuery, fn model.AggregateFunc) (*model.Aggregate, error) {
+	if !fn.Valid() {
+		return nil, ErrUnknownAggregate
+	}
+	if !q.ValueType.Numeric() {
+		return nil, ErrNotNumeric
+	}
+
+	boundsToStorageUnit(&q)
+
+	ok, err := se.scope(ctx, &q)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return model.AggregateOf(fn, nil), nil
+	}
+
+	aggregate, err := se.aggregate(ctx, q, fn)
+	if err != nil || q.Unit == "" {
+		return aggregate, err
+	}
+
+	switch fn {
+	case model.AggregateSum:
+		if sum, err := model.ConvertSum(aggregate.Value, aggregate.Count, model.StorageUnit(q.Unit), q.Unit); err == nil {
+			aggregate.Value = sum
+		}
+	case model.AggregateAvg, model.AggregateMin, model.AggregateMax:
+		aggregate.Value = fromStorageUnit(aggregate.Value, q.Unit)
+	}
+
+	return aggregate, nil
+}
+
+// scope replaces q.AssetId with the devices below the asset, keeping only
+// those also in q.DeviceIds when it is set. It reports false when no device
+// is left to match.
+func (se *SensorDataService) scope(ctx context.Context, q *model.SensorDataQuery) (bool, error) {
+	if q.AssetId == "" {
+		return true, nil
+	}
+	if se.assets == nil {
+		return false, ErrNoAssets
+	}
+
+	deviceIds, err := se.assets.SubtreeDeviceIds(ctx, q.AssetId)
+	if err != nil {
+		return false, err
+	}
+	if len(q.DeviceIds) > 0 {
+		deviceIds = slices.DeleteFunc(deviceIds, func(deviceId string) bool {
+			return !slices.Contains(q.DeviceIds, deviceId)
+		})
+	}
+
+	q.DeviceIds = deviceIds
+	q.AssetId = ""
+	return len(deviceIds) > 0, nil
+}
+
+// archived reports whether the archive may hold readings matched by q.
+func (se *SensorDataService) archived(q model.SensorDataQuery) bool {
+	if se.archive == nil {
+		return false
+	}
+
+	horizon := se.archive.Horizon()
+	if horizon.IsZero() || q.From.After(horizon) {
+		return false
+	}
+
+	return q.After == nil || !q.After.Timestamp.After(horizon)
+}
+
+// query reads the readings matched by q from the cache when it holds them
+// all, or else from the repository and, for old ranges, the archive, merging
+// both into time order.
+func (se *SensorDataService) query(ctx context.Context, q model.SensorDataQuery) ([]*model.SensorData, error) {
+	if se.cache != nil {
+		if sensorDataList, ok := se.cache.QuerySensorData(q); ok {
+			return sensorDataList, nil
+		}
+	}
+	if !se.archived(q) {
+		return se.repo.QuerySensorData(ctx, q)
+	}
+
+	// Either side may hold any of the readings before the offset, so both
+	// are read from the start and the page is cut from the merge.
+	window := q
+	window.Offset = 0
+	if q.Limit > 0 {
+		window.Limit = q.Offset + q.Limit
+	}
+
+	current, err := se.repo.QuerySensorData(ctx, window)
+	if err != nil {
+		return nil, err
+	}
+	archived, err := se.archive.QuerySensorData(ctx, window)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := mergeSensorData(current, archived)
+	if q.Limit > 0 {
+		start := min(q.Offset, len(merged))
+		merged = merged[start:min(start+q.Limit, len(merged))]
+	}
+
+	return merged, nil
+}
+
+// mergeSensorData merges two lists in time order into one, keeping a
+// reading found in both, which happens while it is being archived, once.
+func mergeSensorData(a, b []*model.SensorData) []*model.SensorData {
+	merged := make([]*model.SensorData, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		switch {
+		case a[0].Id == b[0].Id:
+			merged = append(merged, a[0])
+			a, b = a[1:], b[1:]
+		case a[0].Timestamp.Before(b[0].Timestamp) || a[0].Timestamp.Equal(b[0].Timestamp) && a[0].Id < b[0].Id:
+			merged = append(merged, a[0])
+			a = a[1:]
+		default:
+			merged = append(merged, b[0])
+			b = b[1:]
+		}
+	}
+	merged = append(merged, a...)
+
+	return append(merged, b...)
+}
+
+// aggregate applies fn to the cache when it holds every matching reading,
+// or else to the repository and, for old ranges, the archive, combining both
+// results.
+func (se *SensorDataService) aggregate(ctx context.Context, q model.SensorDataQuery, fn model.AggregateFunc) (*model.Aggregate, error) {
+	if se.cache != nil {
+		numeric := q
+		numeric.ValueType = model.ValueNumber
+		numeric.Limit, numeric.Offset = 0, 0
+		if sensorDataList, ok := se.cache.QuerySensorData(numeric); ok {
+			return model.AggregateOf(fn, sensorDataList), nil
+		}
+	}
+
+	if !se.archived(q) {
+		return se.repo.AggregateSensorData(ctx, q, fn)
+	}
+
+	// Readings up to the horizon may be both in the repository and the
+	// archive, after an interrupted archive run, so they are merged to count
+	// each once. Only newer readings are aggregated by the repository.
+	boundary := se.archive.Horizon().Add(time.Nanosecond)
+	recent := q
+	if recent.From.Before(boundary) {
+		recent.From = boundary
+	}
+	current, err := se.repo.AggregateSensorData(ctx, recent, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	old := q
+	old.ValueType = model.ValueNumber
+	old.Limit, old.Offset = 0, 0
+	if old.To.IsZero() || old.To.After(boundary) {
+		old.To = boundary
+	}
+	overlap, err := se.repo.QuerySensorData(ctx, old)
+	if err != nil {
+		return nil, err
+	}
+	archivedList, err := se.archive.QuerySensorData(ctx, old)
+	if err != nil {
+		return nil, err
+	}
+	archived := model.AggregateOf(fn, mergeSensorData(overlap, archivedList))
+
+	if current.Count == 0 {
+		return archived, nil
+	}
+	if archived.Count == 0 {
+		return current, nil
+	}
+
+	combined := &model.Aggregate{Func: fn, Count: current.Count + archived.Count}
+	switch fn {
+	case model.AggregateAvg:
+		combined.Value = (current.Value*float64(current.Count) + archived.Value*float64(archived.Count)) / float64(combined.Count)
+	case model.AggregateMin:
+		combined.Value = min(current.Value, archived.Value)
+	case model.AggregateMax:
+		combined.Value = max(current.Value, archived.Value)
+	case model.AggregateSum, model.AggregateCount:
+		combined.Value = current.Value + archived.Value
+	}
+
+	return combined, nil
+}
+
+// boundsToStorageUnit converts the numeric bounds of q from q.Unit into the
+// unit the matching readings are stored in.
+func boundsToStorageUnit(q *model.SensorDataQuery) {
+	if q.Unit == "" {
+		return
+	}
+
+	for _, bound := range []**float64{&q.Min, &q.Max} {
+		if *bound == nil {
+			continue
+		}
+		value, err := model.ConvertUnit(**bound, q.Unit, model.StorageUnit(q.Unit))
+		if err == nil {
+			*bound = &value
+		}
+	}
+}
+
+// fromStorageUnit converts a value stored for unit into unit. Units outside
+// the registry are stored as reported and need no conversion.
+func fromStorageUnit(value float64, unit string) float64 {
+	converted, err := model.ConvertUnit(value, model.StorageUnit(unit), unit)
+	if err != nil {
+		return value
+	}
+
+	return converted
+}
+
+// ExpireMessageIds periodically forgets message ids older than window until
+// ctx is cancelled. A message id can be reused once it has expired.
+func (se *SensorDataService) ExpireMessageIds(ctx context.Context, window time.Duration) {
+	ticker := time.NewTicker(max(window/10, time.Minute))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := se.repo.PruneMessageIds(ctx, time.Now().Add(-window)); err != nil {
+			log.Printf("failed to expire message ids: %v", err)
+		}
+	}
+}
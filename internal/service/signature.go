@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"iot-platform/internal/model"
+	"iot-platform/internal/repository"
+	"log"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrStaleTimestamp   = errors.New("timestamp outside the allowed window")
+)
+
+// maxNonceLength bounds the nonces stored per device.
+const maxNonceLength = 128
+
+// SignedRequest is a request signed by a device. Timestamp is in Unix
+// seconds and Signature is hex encoded.
+type SignedRequest struct {
+	DeviceId  string
+	Timestamp string
+	Nonce     string
+	Signature string
+	Method    string
+	Path      string
+	Body      []byte
+}
+
+// SignedMessage returns what a device signs: the timestamp, nonce, method
+// and path, query included, on a line each, followed by the body.
+func SignedMessage(timestamp, nonce, method, path string, body []byte) []byte {
+	message := []byte(timestamp + "\n" + nonce + "\n" + method + "\n" + path + "\n")
+	return append(message, body...)
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of message keyed with secret.
+func Sign(secret string, message []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(message)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignatureVerifier authenticates requests that devices sign with their API
+// key, for devices that cannot use TLS. Requests whose timestamp is more than
+// window away from now are refused, and so is every nonce a device has used
+// before, so that a captured request cannot be replayed.
+type SignatureVerifier struct {
+	devices repository.DevicesRepository
+	nonces  repository.NoncesRepository
+	window  time.Duration
+}
+
+func NewSignatureVerifier(devices repository.DevicesRepository, nonces repository.NoncesRepository, window time.Duration) *SignatureVerifier {
+	return &SignatureVerifier{
+		devices: devices,
+		nonces:  nonces,
+		window:  window,
+	}
+}
+
+// Verify returns the device that signed request. Unknown devices and wrong
+// signatures fail alike with ErrInvalidSignature; a reused nonce fails with
+// repository.ErrNonceUsed.
+func (v *SignatureVerifier) Verify(ctx context.Context, request SignedRequest) (*model.Device, error) {
+	seconds, err := strconv.ParseInt(request.Timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	now := time.Now()
+	if skew := now.Sub(time.Unix(seconds, 0)); skew > v.window || skew < -v.window {
+		return nil, ErrStaleTimestamp
+	}
+	if request.Nonce == "" || len(request.Nonce) > maxNonceLength {
+		return nil, ErrInvalidSignature
+	}
+
+	device, err := v.devices.FindDeviceById(ctx, request.DeviceId)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	signature, err := hex.DecodeString(request.Signature)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	mac := hmac.New(sha256.New, []byte(device.ApiKey))
+	mac.Write(SignedMessage(request.Timestamp, request.Nonce, request.Method, request.Path, request.Body))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, ErrInvalidSignature
+	}
+
+	// Only nonces of genuine requests are recorded, so that nobody but the
+	// device can use them up.
+	if err := v.nonces.UseNonce(ctx, device.Id, request.Nonce, now); err != nil {
+		return nil, err
+	}
+
+	return device, nil
+}
+
+// ExpireNonces periodically forgets nonces until ctx is cancelled. A nonce is
+// kept for twice the window: a request may arrive up to a window after its
+// timestamp, which itself may lie a window ahead of the first use.
+func (v *SignatureVerifier) ExpireNonces(ctx context.Context) {
+	ticker := time.NewTicker(max(v.window/10, time.Minute))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := v.nonces.PruneNonces(ctx, time.Now().Add(-2*v.window)); err != nil {
+			log.Printf("failed to expire nonces: %v", err)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Package stream fans newly ingested readings out to live subscribers.
+package stream
+
+import (
+	"iot-platform/internal/model"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Event is a published reading. Ids increase monotonically, also across
+// restarts, so that subscribers can resume after the last id they saw.
+type Event struct {
+	Id         int64
+	SensorData *model.SensorData
+}
+
+// Filter selects the events a subscriber receives. Empty fields match
+// everything.
+type Filter struct {
+	DeviceIds   []string
+	MetricNames []string
+	// Labels maps label keys to the values a reading may carry for them.
+	// A reading must match every key.
+	Labels map[string][]string
+}
+
+func (f Filter) Match(sensorData *model.SensorData) bool {
+	if len(f.DeviceIds) > 0 && !slices.Contains(f.DeviceIds, sensorData.DeviceId) {
+		return false
+	}
+	if len(f.MetricNames) > 0 && !slices.Contains(f.MetricNames, sensorData.MetricName) {
+		return false
+	}
+	for key, values := range f.Labels {
+		value, ok := sensorData.Labels[key]
+		if !ok || !slices.Contains(values, value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Subscription receives the events matching its filter. Its channel is
+// closed when the subscription is closed or when the subscriber fell too far
+// behind; a dropped subscriber should resubscribe from its last event id.
+type Subscription struct {
+	broker *Broker
+	filter Filter
+	events chan Event
+}
+
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+func (s *Subscription) Close() {
+	s.broker.unsubscribe(s)
+}
+
+// Broker is an in-process pub/sub fanout. It keeps the most recent events in
+// a ring buffer to replay them to resuming subscribers.
+type Broker struct {
+	mu          sync.Mutex
+	nextId      int64
+	history     []Event
+	start       int
+	subscribers map[*Subscription]struct{}
+	queueSize   int
+}
+
+// NewBroker keeps up to historySize events for replay and queues up to
+// queueSize events per subscriber before dropping it.
+func NewBroker(historySize int, queueSize int) *Broker {
+	return &Broker{
+		// Starting from the clock keeps ids increasing across restarts.
+		nextId:      time.Now().UnixMicro(),
+		history:     make([]Event, 0, historySize),
+		subscribers: make(map[*Subscription]struct{}),
+		queueSize:   queueSize,
+	}
+}
+
+func (b *Broker) Publish(sensorData *model.SensorData) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextId++
+	event := Event{Id: b.nextId, SensorData: sensorData}
+	if len(b.history) < cap(b.history) {
+		b.history = append(b.history, event)
+	} else if cap(b.history) > 0 {
+		b.history[b.start] = event
+		b.start = (b.start + 1) % cap(b.history)
+	}
+
+	for subscription := range b.subscribers {
+		if !subscription.filter.Match(sensorData) {
+			continue
+		}
+		select {
+		case subscription.events <- event:
+		default:
+			delete(b.subscribers, subscription)
+			close(subscription.events)
+		}
+	}
+}
+
+// Subscribe registers a subscriber. With afterId set, it also returns the
+// buffered events after that id which match filter; older events are lost.
+func (b *Broker) Subscribe(filter Filter, afterId int64) (*Subscription, []Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var replay []Event
+	if afterId > 0 {
+		for i := range b.history {
+			event := b.history[(b.start+i)%len(b.history)]
+			if event.Id > afterId && filter.Match(event.SensorData) {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	subscription := &Subscription{
+		broker: b,
+		filter: filter,
+		events: make(chan Event, b.queueSize),
+	}
+	b.subscribers[subscription] = struct{}{}
+
+	return subscription, replay
+}
+
+func (b *Broker) unsubscribe(subscription *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[subscription]; ok {
+		delete(b.subscribers, subscription)
+		close(subscription.events)
+	}
+}
@@ -0,0 +1,72 @@
+package stream_test
+
+import (
+	"iot-platform/internal/model"
+	"iot-platform/internal/stream"
+	"testing"
+)
+
+func TestBroker_FanoutAndReplay(t *testing.T) {
+	broker := stream.NewBroker(3, 10)
+
+	boiler, _ := broker.Subscribe(stream.Filter{DeviceIds: []string{"boiler"}}, 0)
+	defer boiler.Close()
+
+	for _, deviceId := range []string{"boiler", "fridge", "boiler", "boiler", "fridge"} {
+		broker.Publish(&model.SensorData{DeviceId: deviceId, MetricName: "temperature"})
+	}
+
+	var ids []int64
+	for len(ids) < 3 {
+		event := <-boiler.Events()
+		if event.SensorData.DeviceId != "boiler" {
+			t.Fatalf("unexpected event for %s", event.SensorData.DeviceId)
+		}
+		ids = append(ids, event.Id)
+	}
+	if !(ids[0] < ids[1] && ids[1] < ids[2]) {
+		t.Errorf("expected increasing ids, got %v", ids)
+	}
+
+	// Only the last three events are buffered; of those, two are after the
+	// second boiler reading and one of them is for the boiler.
+	resumed, replay := broker.Subscribe(stream.Filter{DeviceIds: []string{"boiler"}}, ids[1])
+	defer resumed.Close()
+	if len(replay) != 1 || replay[0].Id != ids[2] {
+		t.Errorf("expected to replay event %d, got %+v", ids[2], replay)
+	}
+}
+
+func TestBroker_DropsSlowSubscriber(t *testing.T) {
+	broker := stream.NewBroker(0, 1)
+
+	subscription, _ := broker.Subscribe(stream.Filter{}, 0)
+	broker.Publish(&model.SensorData{DeviceId: "boiler"})
+	broker.Publish(&model.SensorData{DeviceId: "boiler"})
+
+	<-subscription.Events()
+	if _, ok := <-subscription.Events(); ok {
+		t.Error("expected the slow subscriber to be dropped")
+	}
+	subscription.Close()
+}
+
+func TestFilter_MatchesLabels(t *testing.T) {
+	filter := stream.Filter{Labels: map[string][]string{"room": {"kitchen", "cellar"}, "floor": {"1"}}}
+
+	cases := []struct {
+		labels map[string]string
+		match  bool
+	}{
+		{map[string]string{"room": "kitchen", "floor": "1"}, true},
+		{map[string]string{"room": "cellar", "floor": "1", "line": "a"}, true},
+		{map[string]string{"room": "attic", "floor": "1"}, false},
+		{map[string]string{"room": "kitchen"}, false},
+		{nil, false},
+	}
+	for _, c := range cases {
+		if got := filter.Match(&model.SensorData{DeviceId: "boiler", Labels: c.labels}); got != c.match {
+			t.Errorf("labels %v: expected match %v, got %v", c.labels, c.match, got)
+		}
+	}
+}